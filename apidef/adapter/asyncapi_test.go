@@ -334,6 +334,12 @@ const expectedGraphqlConfig = `{
         "merged_sdl": "",
         "global_headers": null,
         "disable_query_batching": false
+    },
+    "cache": {
+        "enabled": false,
+        "timeout": 0,
+        "cache_by_session": false,
+        "disable_cache_control_hints": false
     }
 }`
 
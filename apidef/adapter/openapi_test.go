@@ -315,6 +315,12 @@ const expectedOpenAPIGraphQLConfig = `{
         "merged_sdl": "",
         "global_headers": null,
         "disable_query_batching": false
+    },
+    "cache": {
+        "enabled": false,
+        "timeout": 0,
+        "cache_by_session": false,
+        "disable_cache_control_hints": false
     }
 }`
 
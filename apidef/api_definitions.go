@@ -35,6 +35,13 @@ type EndpointMethodAction string
 type SourceMode string
 
 type MiddlewareDriver string
+
+// JSVMEngine is the engine running the virtual endpoints and JS middleware of an API.
+type JSVMEngine string
+
+// PluginBodyMode is how the request and response bodies are passed to a rich plugin.
+type PluginBodyMode string
+
 type IdExtractorSource string
 type IdExtractorType string
 type AuthTypeEnum string
@@ -59,6 +66,19 @@ const (
 	LuaDriver      MiddlewareDriver = "lua"
 	GrpcDriver     MiddlewareDriver = "grpc"
 	GoPluginDriver MiddlewareDriver = "goplugin"
+	WASMDriver     MiddlewareDriver = "wasm"
+
+	// OttoEngine runs ES5 code, it's the default engine.
+	OttoEngine JSVMEngine = "otto"
+	// GojaEngine runs ES2020 code on a pool of VMs.
+	GojaEngine JSVMEngine = "goja"
+
+	// BufferedBody passes the whole body in the coprocess object, it's the default.
+	BufferedBody PluginBodyMode = ""
+	// HeadersOnlyBody passes no body to the plugin, the body is passed on untouched.
+	HeadersOnlyBody PluginBodyMode = "headers_only"
+	// StreamedBody streams the response body to gRPC response hooks in chunks, and the transformed chunks back.
+	StreamedBody PluginBodyMode = "stream"
 
 	BodySource        IdExtractorSource = "body"
 	HeaderSource      IdExtractorSource = "header"
@@ -210,6 +230,33 @@ type RequestSizeMeta struct {
 	SizeLimit int64  `bson:"size_limit" json:"size_limit"`
 }
 
+// CostMeta weighs the requests to an endpoint in the quotas of the keys, requests cost 1 by default.
+type CostMeta struct {
+	Disabled bool   `bson:"disabled" json:"disabled"`
+	Path     string `bson:"path" json:"path"`
+	Method   string `bson:"method" json:"method"`
+	// Cost is counted in the quotas instead of 1, 0 makes the endpoint free unless ResponseHeader is set, the request
+	// is then counted as 1 until the upstream reports its cost.
+	Cost int64 `bson:"cost" json:"cost"`
+	// ResponseHeader is a header the upstream may set to the actual cost of a request. The quotas are adjusted by the
+	// difference once the response is received, and the header is removed from the response.
+	ResponseHeader string `bson:"response_header" json:"response_header"`
+}
+
+// GRPCMethodMeta holds the rules applied to a single gRPC method.
+type GRPCMethodMeta struct {
+	Disabled bool `bson:"disabled" json:"disabled"`
+	// Path is the full gRPC method name, e.g. /package.Service/Method.
+	Path string `bson:"path" json:"path"`
+	// Block rejects calls to the method with an UNIMPLEMENTED status.
+	Block bool `bson:"block" json:"block"`
+	// RateLimit is applied per key, or per API for keyless access.
+	RateLimit GlobalRateLimit `bson:"rate_limit" json:"rate_limit"`
+	// QuotaMax is the number of calls allowed per QuotaRenewalRate seconds, per key or per API for keyless access.
+	QuotaMax         int64 `bson:"quota_max" json:"quota_max"`
+	QuotaRenewalRate int64 `bson:"quota_renewal_rate" json:"quota_renewal_rate"`
+}
+
 type CircuitBreakerMeta struct {
 	Path                 string  `bson:"path" json:"path"`
 	Method               string  `bson:"method" json:"method"`
@@ -327,6 +374,8 @@ type ExtendedPathsSet struct {
 	Internal                []InternalMeta        `bson:"internal" json:"internal,omitempty"`
 	GoPlugin                []GoPluginMeta        `bson:"go_plugin" json:"go_plugin,omitempty"`
 	PersistGraphQL          []PersistGraphQLMeta  `bson:"persist_graphql" json:"persist_graphql"`
+	GRPCMethods             []GRPCMethodMeta      `bson:"grpc_methods" json:"grpc_methods,omitempty"`
+	Costs                   []CostMeta            `bson:"costs" json:"costs,omitempty"`
 }
 
 type VersionDefinition struct {
@@ -394,6 +443,8 @@ type MiddlewareDefinition struct {
 	Path           string `bson:"path" json:"path"`
 	RequireSession bool   `bson:"require_session" json:"require_session"`
 	RawBodyOnly    bool   `bson:"raw_body_only" json:"raw_body_only"`
+	// BodyMode is how the bodies are passed to coprocess plugins.
+	BodyMode PluginBodyMode `bson:"body_mode" json:"body_mode"`
 }
 
 // IDExtractorConfig specifies the configuration for ID extractor
@@ -426,6 +477,48 @@ type MiddlewareSection struct {
 	Response    []MiddlewareDefinition `bson:"response" json:"response"`
 	Driver      MiddlewareDriver       `bson:"driver" json:"driver"`
 	IdExtractor MiddlewareIdExtractor  `bson:"id_extractor" json:"id_extractor"`
+	GRPCServer  GRPCPluginServer       `bson:"grpc_server" json:"grpc_server"`
+}
+
+// GRPCPluginServer configures the calls of the gRPC driver to the plugin server of an API.
+type GRPCPluginServer struct {
+	// Addresses are the URLs of the plugin servers, e.g. tcp://127.0.0.1:5555, calls are balanced
+	// across them. The coprocess_grpc_server of the gateway is used when empty.
+	Addresses []string `bson:"addresses" json:"addresses"`
+	// PoolSize is the number of connections to each server, defaults to 1.
+	PoolSize int `bson:"pool_size" json:"pool_size"`
+	// Timeout is the deadline of a hook call in milliseconds, 0 for no deadline.
+	Timeout int64 `bson:"timeout" json:"timeout"`
+	// HookTimeouts overrides Timeout for the hooks of the given names.
+	HookTimeouts map[string]int64 `bson:"hook_timeouts" json:"hook_timeouts"`
+	// HealthCheck excludes the servers not reporting to be serving through the gRPC health checking protocol.
+	HealthCheck bool `bson:"health_check" json:"health_check"`
+	// TLS secures the connections to the servers.
+	TLS GRPCPluginServerTLS `bson:"tls" json:"tls"`
+	// CircuitBreaker stops calling the servers while too many calls fail.
+	CircuitBreaker GRPCPluginCircuitBreaker `bson:"circuit_breaker" json:"circuit_breaker"`
+}
+
+// GRPCPluginServerTLS configures the TLS connections to the plugin servers.
+type GRPCPluginServerTLS struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// ClientCertificate is the ID of the certificate presented to the servers for mTLS.
+	ClientCertificate string `bson:"client_certificate" json:"client_certificate"`
+	// CACertificates are the IDs of the certificates the servers are verified with, the system pool is used when empty.
+	CACertificates []string `bson:"ca_certificates" json:"ca_certificates"`
+	// ServerName overrides the host name the certificates of the servers are verified against.
+	ServerName         string `bson:"server_name" json:"server_name"`
+	InsecureSkipVerify bool   `bson:"insecure_skip_verify" json:"insecure_skip_verify"`
+}
+
+// GRPCPluginCircuitBreaker configures the circuit breaker of the calls to the plugin servers.
+type GRPCPluginCircuitBreaker struct {
+	Enabled              bool    `bson:"enabled" json:"enabled"`
+	ThresholdPercent     float64 `bson:"threshold_percent" json:"threshold_percent"`
+	Samples              int64   `bson:"samples" json:"samples"`
+	ReturnToServiceAfter int     `bson:"return_to_service_after" json:"return_to_service_after"`
+	// FailOpen skips the hooks while the breaker is tripped, requests are rejected otherwise.
+	FailOpen bool `bson:"fail_open" json:"fail_open"`
 }
 
 type CacheOptions struct {
@@ -578,6 +671,7 @@ type APIDefinition struct {
 	CustomMiddleware                     MiddlewareSection      `bson:"custom_middleware" json:"custom_middleware"`
 	CustomMiddlewareBundle               string                 `bson:"custom_middleware_bundle" json:"custom_middleware_bundle"`
 	CustomMiddlewareBundleDisabled       bool                   `bson:"custom_middleware_bundle_disabled" json:"custom_middleware_bundle_disabled"`
+	JSVMEngine                           JSVMEngine             `bson:"jsvm_engine" json:"jsvm_engine"`
 	CacheOptions                         CacheOptions           `bson:"cache_options" json:"cache_options"`
 	SessionLifetimeRespectsKeyExpiration bool                   `bson:"session_lifetime_respects_key_expiration" json:"session_lifetime_respects_key_expiration,omitempty"`
 	SessionLifetime                      int64                  `bson:"session_lifetime" json:"session_lifetime"`
@@ -607,6 +701,9 @@ type APIDefinition struct {
 	StripAuthData                        bool                   `bson:"strip_auth_data" json:"strip_auth_data"`
 	EnableDetailedRecording              bool                   `bson:"enable_detailed_recording" json:"enable_detailed_recording"`
 	GraphQL                              GraphQLConfig          `bson:"graphql" json:"graphql"`
+	GRPC                                 GRPCConfig             `bson:"grpc" json:"grpc"`
+	WebSocket                            WebSocketConfig        `bson:"websocket" json:"websocket"`
+	SSE                                  SSEConfig              `bson:"sse" json:"sse"`
 	AnalyticsPlugin                      AnalyticsPluginConfig  `bson:"analytics_plugin" json:"analytics_plugin,omitempty"`
 
 	// Gateway segment tags
@@ -618,6 +715,73 @@ type APIDefinition struct {
 	VersionName string `bson:"-" json:"-"`
 }
 
+// GRPCConfig configures gRPC aware proxying.
+type GRPCConfig struct {
+	// Enabled turns on per-method rules, gRPC status codes in gateway error responses
+	// and recording of the grpc-status trailer in analytics.
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// EnableGRPCWeb translates gRPC-Web requests from browsers to gRPC for the upstream.
+	EnableGRPCWeb bool `bson:"enable_grpc_web" json:"enable_grpc_web"`
+	// Transcoding exposes the gRPC methods of the upstream as JSON REST endpoints.
+	Transcoding GRPCTranscodingConfig `bson:"transcoding" json:"transcoding"`
+}
+
+// GRPCTranscodingConfig configures REST to gRPC transcoding.
+type GRPCTranscodingConfig struct {
+	// Enabled turns on transcoding of the routes declared with google.api.http annotations.
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// DescriptorSet is the base64 encoded protobuf FileDescriptorSet of the upstream services,
+	// as produced by `protoc --include_imports --descriptor_set_out`.
+	DescriptorSet string `bson:"descriptor_set" json:"descriptor_set"`
+}
+
+// WebSocketConfig configures message level policies of proxied WebSocket connections.
+type WebSocketConfig struct {
+	// Enabled turns on parsing of the frames of upgraded connections, so the limits apply to messages
+	// and analytics record the messages and bytes sent in each direction.
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// MaxMessageSize is the largest message in bytes accepted in either direction, 0 for no limit.
+	// Text messages of the client are limited to 1MB when a Schema is set, as they are held until validated.
+	MaxMessageSize int64 `bson:"max_message_size" json:"max_message_size"`
+	// IdleTimeout closes connections without messages in either direction for this many seconds, 0 to disable.
+	// Control frames such as pings don't keep a connection alive.
+	IdleTimeout int64 `bson:"idle_timeout" json:"idle_timeout"`
+	// ConnectionRateLimit limits the messages sent by the client over a single connection.
+	ConnectionRateLimit GlobalRateLimit `bson:"connection_rate_limit" json:"connection_rate_limit"`
+	// KeyRateLimit limits the messages sent by the client over all connections of the same key.
+	KeyRateLimit GlobalRateLimit `bson:"key_rate_limit" json:"key_rate_limit"`
+	// Schema is a JSON schema the text messages of the client are validated against.
+	Schema string `bson:"schema" json:"schema"`
+}
+
+// SSEConfig configures Server-Sent Events aware proxying of text/event-stream responses.
+type SSEConfig struct {
+	// Enabled turns on forwarding of upstream streams one event at a time, with heartbeats and lifetime limits.
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// HeartbeatInterval sends a comment to clients after this many seconds without events, 0 to disable.
+	HeartbeatInterval int64 `bson:"heartbeat_interval" json:"heartbeat_interval"`
+	// MaxConnectionLifetime ends streams after this many seconds, 0 for no limit. Clients reconnect
+	// with the Last-Event-ID of the last event they received, which is passed to the upstream.
+	MaxConnectionLifetime int64 `bson:"max_connection_lifetime" json:"max_connection_lifetime"`
+	// FanOut shares one upstream stream between the clients of a channel.
+	FanOut SSEFanOutConfig `bson:"fan_out" json:"fan_out"`
+}
+
+// SSEFanOutConfig configures sharing of upstream event streams.
+type SSEFanOutConfig struct {
+	// Enabled turns on fan-out. Requests of a channel share the upstream response,
+	// response middleware runs only for the request opening the upstream stream.
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// ChannelHeaders are the request headers telling channels apart, next to the path and query.
+	ChannelHeaders []string `bson:"channel_headers" json:"channel_headers"`
+	// SharedChannels lets clients authenticated with different keys share a channel. By default
+	// each key has its own channels, as the upstream stream is opened with the first client's request.
+	SharedChannels bool `bson:"shared_channels" json:"shared_channels"`
+	// ReplayBufferSize is the number of recent events kept per channel, so that clients
+	// reconnecting with a Last-Event-ID receive the events they missed.
+	ReplayBufferSize int `bson:"replay_buffer_size" json:"replay_buffer_size"`
+}
+
 type AnalyticsPluginConfig struct {
 	Enabled    bool   `bson:"enable" json:"enable,omitempty"`
 	PluginPath string `bson:"plugin_path" json:"plugin_path,omitempty"`
@@ -738,6 +902,8 @@ type GraphQLConfig struct {
 	Subgraph GraphQLSubgraphConfig `bson:"subgraph" json:"subgraph"`
 	// Supergraph holds the configuration for a GraphQL federation supergraph.
 	Supergraph GraphQLSupergraphConfig `bson:"supergraph" json:"supergraph"`
+	// Cache holds the configuration for GraphQL aware response caching.
+	Cache GraphQLCacheConfig `bson:"cache" json:"cache"`
 }
 
 type GraphQLConfigVersion string
@@ -759,6 +925,18 @@ type GraphQLProxyConfig struct {
 	UseResponseExtensions GraphQLResponseExtensions `bson:"use_response_extensions" json:"use_response_extensions"`
 }
 
+// GraphQLCacheConfig configures response caching keyed on the normalised GraphQL operation.
+type GraphQLCacheConfig struct {
+	// Enabled activates caching of GraphQL query operations. Mutations and subscriptions are never cached.
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Timeout is the default TTL in seconds. When zero, CacheOptions.CacheTimeout is used.
+	Timeout int64 `bson:"timeout" json:"timeout"`
+	// CacheBySession adds the identity of the requesting session to the cache key.
+	CacheBySession bool `bson:"cache_by_session" json:"cache_by_session"`
+	// DisableCacheControlHints ignores `@cacheControl(maxAge: ...)` directives found in the schema.
+	DisableCacheControlHints bool `bson:"disable_cache_control_hints" json:"disable_cache_control_hints"`
+}
+
 type GraphQLSubgraphConfig struct {
 	SDL string `bson:"sdl" json:"sdl"`
 }
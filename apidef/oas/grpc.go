@@ -0,0 +1,244 @@
+package oas
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/internal/transcoding"
+)
+
+var grpcOASMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodPut:     true,
+	http.MethodPost:    true,
+	http.MethodDelete:  true,
+	http.MethodPatch:   true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+}
+
+// fillGRPCTranscoding adds the REST routes of transcoded gRPC methods to the paths.
+// Operations already present are left as they are. Invalid descriptor sets
+// are reported when the API is loaded, they are skipped here.
+func (s *OAS) fillGRPCTranscoding(config apidef.GRPCTranscodingConfig) {
+	if !config.Enabled || config.DescriptorSet == "" {
+		return
+	}
+
+	descriptorSet, err := base64.StdEncoding.DecodeString(config.DescriptorSet)
+	if err != nil {
+		return
+	}
+
+	transcoder, err := transcoding.New(descriptorSet)
+	if err != nil {
+		return
+	}
+
+	if s.Paths == nil {
+		s.Paths = make(openapi3.Paths)
+	}
+
+	for _, route := range transcoder.Routes() {
+		// custom HTTP methods can't be described
+		if !grpcOASMethods[route.HTTPMethod] {
+			continue
+		}
+
+		path := route.OASPath()
+		if s.Paths[path] == nil {
+			s.Paths[path] = &openapi3.PathItem{}
+		}
+
+		if s.Paths[path].GetOperation(route.HTTPMethod) != nil {
+			continue
+		}
+
+		s.Paths[path].SetOperation(route.HTTPMethod, newGRPCTranscodingOperation(route))
+	}
+}
+
+func newGRPCTranscodingOperation(route *transcoding.Route) *openapi3.Operation {
+	input, output := route.Method.Input(), route.Method.Output()
+
+	operation := &openapi3.Operation{
+		OperationID: strings.TrimPrefix(route.OASPath(), "/") + route.HTTPMethod,
+		Summary:     string(route.Method.FullName()),
+		Responses:   openapi3.NewResponses(),
+	}
+
+	bound := make(map[string]bool)
+	for _, variable := range route.Variables() {
+		bound[variable] = true
+
+		param := openapi3.NewPathParameter(variable).WithSchema(grpcFieldPathSchema(input, variable))
+		operation.AddParameter(param)
+	}
+
+	switch route.Body {
+	case "":
+	case "*":
+		operation.RequestBody = &openapi3.RequestBodyRef{
+			Value: openapi3.NewRequestBody().WithRequired(true).WithJSONSchema(grpcMessageSchema(input, nil)),
+		}
+	default:
+		bound[route.Body] = true
+		field := grpcField(input, route.Body)
+		operation.RequestBody = &openapi3.RequestBodyRef{
+			Value: openapi3.NewRequestBody().WithRequired(true).WithJSONSchema(grpcFieldSchema(field, nil)),
+		}
+	}
+
+	// fields not bound by the path or body can be set with query parameters
+	if route.Body != "*" {
+		fields := input.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			field := fields.Get(i)
+			if bound[string(field.Name())] || bound[field.JSONName()] || field.IsMap() ||
+				(field.Kind() == protoreflect.MessageKind && grpcWellKnownSchema(field.Message()) == nil) {
+				continue
+			}
+
+			param := openapi3.NewQueryParameter(field.JSONName()).WithSchema(grpcFieldSchema(field, nil))
+			operation.AddParameter(param)
+		}
+	}
+
+	responseSchema := grpcMessageSchema(output, nil)
+	if route.ResponseBody != "" {
+		responseSchema = grpcFieldSchema(grpcField(output, route.ResponseBody), nil)
+	}
+
+	if route.Method.IsStreamingServer() {
+		responseSchema = openapi3.NewArraySchema().WithItems(responseSchema)
+	}
+
+	operation.AddResponse(http.StatusOK, openapi3.NewResponse().WithDescription("OK").WithJSONSchema(responseSchema))
+
+	errSchema := openapi3.NewObjectSchema().
+		WithProperty("code", openapi3.NewInt32Schema()).
+		WithProperty("message", openapi3.NewStringSchema())
+	operation.Responses["default"] = &openapi3.ResponseRef{
+		Value: openapi3.NewResponse().WithDescription("gRPC status of a failed call").WithJSONSchema(errSchema),
+	}
+
+	return operation
+}
+
+func grpcField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if field := md.Fields().ByName(protoreflect.Name(name)); field != nil {
+		return field
+	}
+
+	return md.Fields().ByJSONName(name)
+}
+
+// grpcFieldPathSchema returns the schema of the field at the end of a dotted field path.
+func grpcFieldPathSchema(md protoreflect.MessageDescriptor, path string) *openapi3.Schema {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		md = grpcField(md, part).Message()
+	}
+
+	return grpcFieldSchema(grpcField(md, parts[len(parts)-1]), nil)
+}
+
+// grpcMessageSchema returns the schema of the protojson form of a message.
+// Recursive messages are described as plain objects once they recur.
+func grpcMessageSchema(md protoreflect.MessageDescriptor, visiting map[protoreflect.FullName]bool) *openapi3.Schema {
+	if schema := grpcWellKnownSchema(md); schema != nil {
+		return schema
+	}
+
+	schema := openapi3.NewObjectSchema()
+	if visiting[md.FullName()] {
+		return schema
+	}
+
+	if visiting == nil {
+		visiting = make(map[protoreflect.FullName]bool)
+	}
+	visiting[md.FullName()] = true
+	defer delete(visiting, md.FullName())
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		schema.WithProperty(field.JSONName(), grpcFieldSchema(field, visiting))
+	}
+
+	return schema
+}
+
+func grpcFieldSchema(field protoreflect.FieldDescriptor, visiting map[protoreflect.FullName]bool) *openapi3.Schema {
+	switch {
+	case field.IsMap():
+		return openapi3.NewObjectSchema().WithAdditionalProperties(grpcKindSchema(field.MapValue(), visiting))
+	case field.IsList():
+		return openapi3.NewArraySchema().WithItems(grpcKindSchema(field, visiting))
+	}
+
+	return grpcKindSchema(field, visiting)
+}
+
+func grpcKindSchema(field protoreflect.FieldDescriptor, visiting map[protoreflect.FullName]bool) *openapi3.Schema {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return openapi3.NewBoolSchema()
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return openapi3.NewInt32Schema()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return openapi3.NewIntegerSchema().WithFormat("uint32")
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		// protojson writes 64 bit integers as strings
+		return openapi3.NewStringSchema().WithFormat("int64")
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return openapi3.NewStringSchema().WithFormat("uint64")
+	case protoreflect.FloatKind:
+		return openapi3.NewFloat64Schema().WithFormat("float")
+	case protoreflect.DoubleKind:
+		return openapi3.NewFloat64Schema().WithFormat("double")
+	case protoreflect.StringKind:
+		return openapi3.NewStringSchema()
+	case protoreflect.BytesKind:
+		return openapi3.NewBytesSchema()
+	case protoreflect.EnumKind:
+		values := field.Enum().Values()
+		names := make([]interface{}, 0, values.Len())
+		for i := 0; i < values.Len(); i++ {
+			names = append(names, string(values.Get(i).Name()))
+		}
+		return openapi3.NewStringSchema().WithEnum(names...)
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return grpcMessageSchema(field.Message(), visiting)
+	}
+
+	return openapi3.NewSchema()
+}
+
+// grpcWellKnownSchema returns the schema of well known types which have a special protojson form.
+func grpcWellKnownSchema(md protoreflect.MessageDescriptor) *openapi3.Schema {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return openapi3.NewDateTimeSchema()
+	case "google.protobuf.Duration", "google.protobuf.FieldMask":
+		return openapi3.NewStringSchema()
+	case "google.protobuf.Struct", "google.protobuf.Any", "google.protobuf.Empty":
+		return openapi3.NewObjectSchema()
+	case "google.protobuf.ListValue":
+		return openapi3.NewArraySchema().WithItems(openapi3.NewSchema())
+	case "google.protobuf.Value":
+		return openapi3.NewSchema()
+	case "google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value", "google.protobuf.Int64Value",
+		"google.protobuf.UInt64Value", "google.protobuf.FloatValue", "google.protobuf.DoubleValue":
+		return grpcKindSchema(md.Fields().ByName("value"), nil)
+	}
+
+	return nil
+}
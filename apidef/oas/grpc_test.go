@@ -0,0 +1,143 @@
+package oas
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func testGRPCDescriptorSet(t *testing.T) string {
+	t.Helper()
+
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     typ.Enum(),
+			TypeName: proto.String(typeName),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+	}
+
+	method := func(name, input string, rule *annotations.HttpRule) *descriptorpb.MethodDescriptorProto {
+		opts := &descriptorpb.MethodOptions{}
+		proto.SetExtension(opts, annotations.E_Http, rule)
+
+		return &descriptorpb.MethodDescriptorProto{
+			Name:       proto.String(name),
+			InputType:  proto.String(input),
+			OutputType: proto.String(".library.v1.Book"),
+			Options:    opts,
+		}
+	}
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("library.proto"),
+		Package:    proto.String("library.v1"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/api/annotations.proto", "google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Book"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("page_count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+					field("published", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+				},
+			},
+			{
+				Name: proto.String("GetBookRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("published_after", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+					field("book", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".library.v1.Book"),
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Library"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("GetBook", ".library.v1.GetBookRequest", &annotations.HttpRule{
+					Pattern: &annotations.HttpRule_Get{Get: "/v1/{name=books/*}"},
+				}),
+				method("UpdateBook", ".library.v1.GetBookRequest", &annotations.HttpRule{
+					Pattern: &annotations.HttpRule_Patch{Patch: "/v1/{book.name=books/*}"},
+					Body:    "book",
+				}),
+				method("ListBooks", ".library.v1.GetBookRequest", &annotations.HttpRule{
+					Pattern: &annotations.HttpRule_Custom{Custom: &annotations.CustomHttpPattern{Kind: "LIST", Path: "/v1/books"}},
+				}),
+			},
+		}},
+	}
+
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	require.NoError(t, err)
+
+	return base64.StdEncoding.EncodeToString(set)
+}
+
+func TestOAS_FillGRPCTranscoding(t *testing.T) {
+	t.Parallel()
+
+	var api apidef.APIDefinition
+	api.SetDisabledFlags()
+	api.Name = "library"
+	api.VersionData.Versions = map[string]apidef.VersionInfo{Main: {}}
+	api.GRPC.Transcoding = apidef.GRPCTranscodingConfig{
+		Enabled:       true,
+		DescriptorSet: testGRPCDescriptorSet(t),
+	}
+
+	var s OAS
+	s.Fill(api)
+
+	assert.NoError(t, s.Paths.Validate(context.Background()))
+	assert.Len(t, s.Paths, 2)
+
+	get := s.Paths["/v1/{name}"].Get
+	require.NotNil(t, get)
+	assert.Equal(t, "library.v1.Library.GetBook", get.Summary)
+	assert.Equal(t, "v1/{name}GET", get.OperationID)
+	assert.Nil(t, get.RequestBody)
+
+	params := map[string]string{}
+	for _, param := range get.Parameters {
+		params[param.Value.Name] = param.Value.In
+	}
+	// message fields other than well known types can't be set with query parameters
+	assert.Equal(t, map[string]string{"name": "path", "publishedAfter": "query"}, params)
+
+	book := get.Responses.Get(http.StatusOK).Value.Content.Get("application/json").Schema.Value
+	assert.Equal(t, "string", book.Properties["pageCount"].Value.Type)
+	assert.Equal(t, "date-time", book.Properties["published"].Value.Format)
+	assert.NotNil(t, get.Responses.Default())
+
+	patch := s.Paths["/v1/{book.name}"].Patch
+	require.NotNil(t, patch)
+	require.NotNil(t, patch.RequestBody)
+	assert.Contains(t, patch.RequestBody.Value.Content.Get("application/json").Schema.Value.Properties, "pageCount")
+
+	t.Run("existing operations are kept", func(t *testing.T) {
+		s.Paths["/v1/{name}"].Get.Summary = "custom"
+		s.Fill(api)
+		assert.Equal(t, "custom", s.Paths["/v1/{name}"].Get.Summary)
+	})
+
+	t.Run("invalid descriptor set", func(t *testing.T) {
+		api.GRPC.Transcoding.DescriptorSet = "invalid"
+
+		var s OAS
+		s.Fill(api)
+		assert.Empty(t, s.Paths)
+	})
+}
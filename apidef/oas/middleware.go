@@ -193,7 +193,8 @@ type PluginConfig struct {
 	// - `python`,
 	// - `lua`,
 	// - `grpc`,
-	// - `goplugin`.
+	// - `goplugin`,
+	// - `wasm`.
 	//
 	// Tyk classic API definition: `custom_middleware.driver`.
 	Driver apidef.MiddlewareDriver `bson:"driver,omitempty" json:"driver,omitempty"`
@@ -867,6 +868,33 @@ func (et *EnforceTimeout) ExtractTo(meta *apidef.HardTimeoutMeta) {
 	meta.TimeOut = et.Value
 }
 
+// Cost weighs the requests to an operation in the quotas of the keys.
+type Cost struct {
+	// Enabled is a boolean flag. If set to `true`, the requests are counted in the quotas with the cost.
+	Enabled bool `bson:"enabled" json:"enabled"`
+
+	// Value is counted in the quotas instead of 1, 0 makes the operation free.
+	Value int64 `bson:"value" json:"value"`
+
+	// ResponseHeader is a header the upstream may set to the actual cost of a request. The quotas are adjusted by the
+	// difference once the response is received, and the header is removed from the response.
+	ResponseHeader string `bson:"responseHeader,omitempty" json:"responseHeader,omitempty"`
+}
+
+// Fill fills *Cost from apidef.CostMeta.
+func (c *Cost) Fill(meta apidef.CostMeta) {
+	c.Enabled = !meta.Disabled
+	c.Value = meta.Cost
+	c.ResponseHeader = meta.ResponseHeader
+}
+
+// ExtractTo extracts *Cost to *apidef.CostMeta.
+func (c *Cost) ExtractTo(meta *apidef.CostMeta) {
+	meta.Disabled = !c.Enabled
+	meta.Cost = c.Value
+	meta.ResponseHeader = c.ResponseHeader
+}
+
 // CustomPlugin configures custom plugin.
 type CustomPlugin struct {
 	// Enabled enables the custom pre plugin.
@@ -877,6 +905,9 @@ type CustomPlugin struct {
 	Path string `bson:"path" json:"path"`
 	// RawBodyOnly if set to true, do not fill body in request or response object.
 	RawBodyOnly bool `bson:"rawBodyOnly,omitempty" json:"rawBodyOnly,omitempty"`
+	// BodyMode is how the bodies are passed to coprocess plugins: `headers_only` passes no body, `stream` streams the
+	// response body to gRPC response plugins in chunks. The whole body is passed when empty.
+	BodyMode apidef.PluginBodyMode `bson:"bodyMode,omitempty" json:"bodyMode,omitempty"`
 	// RequireSession if set to true passes down the session information for plugins after authentication.
 	// RequireSession is used only with JSVM custom middleware.
 	RequireSession bool `bson:"requireSession,omitempty" json:"requireSession,omitempty"`
@@ -893,6 +924,7 @@ func (c CustomPlugins) Fill(mwDefs []apidef.MiddlewareDefinition) {
 			Path:           mwDef.Path,
 			FunctionName:   mwDef.Name,
 			RawBodyOnly:    mwDef.RawBodyOnly,
+			BodyMode:       mwDef.BodyMode,
 			RequireSession: mwDef.RequireSession,
 		}
 	}
@@ -906,6 +938,7 @@ func (c CustomPlugins) ExtractTo(mwDefs []apidef.MiddlewareDefinition) {
 			Name:           plugin.FunctionName,
 			Path:           plugin.Path,
 			RawBodyOnly:    plugin.RawBodyOnly,
+			BodyMode:       plugin.BodyMode,
 			RequireSession: plugin.RequireSession,
 		}
 	}
@@ -69,6 +69,7 @@ func (s *OAS) Fill(api apidef.APIDefinition) {
 
 	xTykAPIGateway.Fill(api)
 	s.fillPathsAndOperations(api.VersionData.Versions[Main].ExtendedPaths)
+	s.fillGRPCTranscoding(api.GRPC.Transcoding)
 	s.fillSecurity(api)
 
 	if ShouldOmit(xTykAPIGateway) {
@@ -49,6 +49,9 @@ type Operation struct {
 
 	// PostPlugins contains endpoint level post plugins configuration.
 	PostPlugins EndpointPostPlugins `bson:"postPlugins,omitempty" json:"postPlugins,omitempty"`
+
+	// Cost contains the cost of the requests in the quotas.
+	Cost *Cost `bson:"cost,omitempty" json:"cost,omitempty"`
 }
 
 // AllowanceType holds the valid allowance types values.
@@ -121,6 +124,7 @@ func (s *OAS) fillPathsAndOperations(ep apidef.ExtendedPathsSet) {
 	s.fillOASValidateRequest(ep.ValidateJSON)
 	s.fillVirtualEndpoint(ep.Virtual)
 	s.fillEndpointPostPlugins(ep.GoPlugin)
+	s.fillCost(ep.Costs)
 }
 
 func (s *OAS) extractPathsAndOperations(ep *apidef.ExtendedPathsSet) {
@@ -143,6 +147,7 @@ func (s *OAS) extractPathsAndOperations(ep *apidef.ExtendedPathsSet) {
 					tykOp.extractEnforceTimeoutTo(ep, path, method)
 					tykOp.extractVirtualEndpointTo(ep, path, method)
 					tykOp.extractEndpointPostPluginTo(ep, path, method)
+					tykOp.extractCostTo(ep, path, method)
 					break found
 				}
 			}
@@ -242,6 +247,21 @@ func (s *OAS) fillEnforceTimeout(metas []apidef.HardTimeoutMeta) {
 	}
 }
 
+func (s *OAS) fillCost(metas []apidef.CostMeta) {
+	for _, meta := range metas {
+		operationID := s.getOperationID(meta.Path, meta.Method)
+		operation := s.GetTykExtension().getOperation(operationID)
+		if operation.Cost == nil {
+			operation.Cost = &Cost{}
+		}
+
+		operation.Cost.Fill(meta)
+		if ShouldOmit(operation.Cost) {
+			operation.Cost = nil
+		}
+	}
+}
+
 func (o *Operation) extractAllowanceTo(ep *apidef.ExtendedPathsSet, path string, method string, typ AllowanceType) {
 	allowance := o.Allow
 	endpointMetas := &ep.WhiteList
@@ -307,6 +327,16 @@ func (o *Operation) extractEnforceTimeoutTo(ep *apidef.ExtendedPathsSet, path st
 	ep.HardTimeouts = append(ep.HardTimeouts, meta)
 }
 
+func (o *Operation) extractCostTo(ep *apidef.ExtendedPathsSet, path string, method string) {
+	if o.Cost == nil {
+		return
+	}
+
+	meta := apidef.CostMeta{Path: path, Method: method}
+	o.Cost.ExtractTo(&meta)
+	ep.Costs = append(ep.Costs, meta)
+}
+
 // detect possible regex pattern:
 // - character match ([a-z])
 // - greedy match (.*)
@@ -80,6 +80,10 @@ const Schema = `{
         },
         "custom_middleware_bundle": {
             "type": "string"
+        },
+        "jsvm_engine": {
+            "type": "string",
+            "enum": ["", "otto", "goja"]
         },
 		"custom_middleware_bundle_disabled": {
            	"type": "boolean"
@@ -625,6 +629,23 @@ const Schema = `{
                         }
                     }
                 },
+                "cache": {
+                    "type": ["object", "null"],
+                    "properties": {
+                        "enabled": {
+                            "type": "boolean"
+                        },
+                        "timeout": {
+                            "type": "integer"
+                        },
+                        "cache_by_session": {
+                            "type": "boolean"
+                        },
+                        "disable_cache_control_hints": {
+                            "type": "boolean"
+                        }
+                    }
+                },
                 "subgraph": {
                     "type": ["object", "null"],
                     "properties": {
@@ -690,6 +711,98 @@ const Schema = `{
                 "enabled"
             ]
         },
+        "grpc": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "enable_grpc_web": {
+                    "type": "boolean"
+                },
+                "transcoding": {
+                    "type": ["object", "null"],
+                    "properties": {
+                        "enabled": {
+                            "type": "boolean"
+                        },
+                        "descriptor_set": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "websocket": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "max_message_size": {
+                    "type": "integer"
+                },
+                "idle_timeout": {
+                    "type": "integer"
+                },
+                "connection_rate_limit": {
+                    "type": ["object", "null"],
+                    "properties": {
+                        "rate": {
+                            "type": "number"
+                        },
+                        "per": {
+                            "type": "number"
+                        }
+                    }
+                },
+                "key_rate_limit": {
+                    "type": ["object", "null"],
+                    "properties": {
+                        "rate": {
+                            "type": "number"
+                        },
+                        "per": {
+                            "type": "number"
+                        }
+                    }
+                },
+                "schema": {
+                    "type": "string"
+                }
+            }
+        },
+        "sse": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "heartbeat_interval": {
+                    "type": "integer"
+                },
+                "max_connection_lifetime": {
+                    "type": "integer"
+                },
+                "fan_out": {
+                    "type": ["object", "null"],
+                    "properties": {
+                        "enabled": {
+                            "type": "boolean"
+                        },
+                        "channel_headers": {
+                            "type": ["array", "null"]
+                        },
+                        "shared_channels": {
+                            "type": "boolean"
+                        },
+                        "replay_buffer_size": {
+                            "type": "integer"
+                        }
+                    }
+                }
+            }
+        },
         "analytics_plugin": {
             "type": ["object", "null"],
             "properties": {
@@ -31,6 +31,9 @@ for pkg in ${PKGS}; do
     go test ${OPTS} -timeout ${TEST_TIMEOUT} -coverprofile=${coveragefile}.cov ${pkg} ${tags}
 done
 
+# the plugin test harness is a module of its own, it keeps the embedded Redis out of the gateway dependencies
+(cd cli/plugin/plugintest && go test ${OPTS} -timeout ${TEST_TIMEOUT} ./...)
+
 # run rpc tests separately
 rpc_tests='SyncAPISpecsRPC|OrgSessionWithRPCDown'
 go test -count=1 -timeout ${TEST_TIMEOUT} -v -coverprofile=gateway-rpc.cov github.com/TykTechnologies/tyk/gateway -p 1 -run '"'${rpc_tests}'"'
@@ -0,0 +1,463 @@
+package plugin
+
+//lint:file-ignore faillint This file should be ignored by faillint (fmt in use).
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v3"
+)
+
+// HarnessOptions describes the API run by a Harness.
+type HarnessOptions struct {
+	// ConfPath is the gateway configuration file, the defaults are used if it's empty.
+	ConfPath string
+	// APIPath is the API definition file.
+	APIPath string
+	// BundlePath is a bundle archive replacing the bundle of the API.
+	BundlePath string
+	// PluginPath is a Go plugin replacing the path of the Go plugin hooks of the API.
+	PluginPath string
+	// RedisHost and RedisPort are the Redis server of the gateway, the one of the configuration isn't used.
+	RedisHost string
+	RedisPort int
+}
+
+// Harness runs fixture requests through the middleware chain of an API.
+type Harness interface {
+	Run(test *FixtureTest, upstream []RecordedResponse) (*Result, error)
+	Close()
+}
+
+// NewHarness creates a Harness along with the Redis server it runs on. It's set by the plugintest module, which
+// embeds a Redis server, and is nil in the builds of the gateway.
+var NewHarness func(opts HarnessOptions) (Harness, error)
+
+// NewGatewayHarness creates a Harness running on the Redis server of the options, it's set by the gateway which
+// the cli packages can't import.
+var NewGatewayHarness func(opts HarnessOptions) (Harness, error)
+
+// Fixture is a suite of requests run through the middleware chain of an API.
+type Fixture struct {
+	// Upstream are the recorded responses of the upstream, shared by all the tests.
+	Upstream []RecordedResponse `json:"upstream"`
+	Tests    []FixtureTest      `json:"tests"`
+}
+
+// FixtureTest is a request along with the expected outcome.
+type FixtureTest struct {
+	Name string `json:"name"`
+	// Session creates a key with this session state before the request, the key is sent in the Authorization header.
+	Session json.RawMessage `json:"session"`
+	// Key is the key created for the session, a key is generated if it's empty.
+	Key     string         `json:"key"`
+	Request FixtureRequest `json:"request"`
+	// Upstream are the recorded responses of the upstream for this test, they take precedence over the fixture ones.
+	Upstream []RecordedResponse `json:"upstream"`
+	Expect   FixtureExpect      `json:"expect"`
+}
+
+// FixtureRequest is the request sent to the gateway.
+type FixtureRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// RecordedResponse is a response of the stubbed upstream, served for the requests matching its method and path.
+type RecordedResponse struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// Matches checks the response is recorded for a request, empty fields match anything.
+func (r *RecordedResponse) Matches(method, path string) bool {
+	return (r.Method == "" || strings.EqualFold(r.Method, method)) && (r.Path == "" || r.Path == path)
+}
+
+// FixtureExpect is the expected outcome of a request, empty fields aren't checked.
+type FixtureExpect struct {
+	Status       int               `json:"status"`
+	Headers      map[string]string `json:"headers"`
+	Body         *string           `json:"body"`
+	BodyContains string            `json:"body_contains"`
+	// Session is matched against the session state after the request, only the given fields are checked.
+	Session json.RawMessage `json:"session"`
+	// UpstreamRequest is the request the upstream is expected to receive.
+	UpstreamRequest *ExpectedRequest `json:"upstream_request"`
+}
+
+// ExpectedRequest is the expected request received by the upstream.
+type ExpectedRequest struct {
+	Method       string            `json:"method"`
+	Path         string            `json:"path"`
+	Headers      map[string]string `json:"headers"`
+	Body         *string           `json:"body"`
+	BodyContains string            `json:"body_contains"`
+}
+
+// RecordedRequest is a request received by the stubbed upstream.
+type RecordedRequest struct {
+	Method  string
+	Path    string
+	Headers map[string]string
+	Body    string
+	// Unmatched is set when no recorded response matched the request.
+	Unmatched bool
+}
+
+// Result is the outcome of a request run by a Harness.
+type Result struct {
+	Status   int
+	Headers  map[string]string
+	Body     string
+	Session  json.RawMessage
+	Upstream []RecordedRequest
+}
+
+// LoadFixture reads a YAML or JSON fixture file.
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is decoded to JSON first so the fixture types only need JSON tags
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("couldn't parse fixture: %w", err)
+	}
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse fixture: %w", err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("couldn't parse fixture: %w", err)
+	}
+	if len(fixture.Tests) == 0 {
+		return nil, errors.New("fixture has no tests")
+	}
+
+	for i := range fixture.Tests {
+		if fixture.Tests[i].Name == "" {
+			fixture.Tests[i].Name = fmt.Sprintf("test %d", i+1)
+		}
+	}
+
+	return &fixture, nil
+}
+
+// Check compares the result of the test with the expected outcome, it returns the failures.
+func (t *FixtureTest) Check(res *Result) []string {
+	var failures []string
+	fail := func(format string, args ...interface{}) {
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+
+	for _, req := range res.Upstream {
+		if req.Unmatched {
+			fail("no recorded upstream response for %s %s", req.Method, req.Path)
+		}
+	}
+
+	expect := t.Expect
+	if expect.Status != 0 && expect.Status != res.Status {
+		fail("status: expected %d, got %d", expect.Status, res.Status)
+	}
+	failures = append(failures, checkMessage("", expect.Headers, expect.Body, expect.BodyContains, res.Headers, res.Body)...)
+
+	if len(expect.Session) > 0 {
+		var want, got interface{}
+		if err := json.Unmarshal(expect.Session, &want); err != nil {
+			fail("expected session: %v", err)
+		} else if len(res.Session) == 0 {
+			fail("session: expected a session, the test has none")
+		} else if err := json.Unmarshal(res.Session, &got); err != nil {
+			fail("session: %v", err)
+		} else {
+			for _, diff := range matchSubset("session", want, got) {
+				fail("%s", diff)
+			}
+		}
+	}
+
+	if want := expect.UpstreamRequest; want != nil {
+		if len(res.Upstream) == 0 {
+			fail("upstream request: the upstream wasn't called")
+		} else {
+			// the last request is the one proxied, the previous ones may come from plugins
+			got := res.Upstream[len(res.Upstream)-1]
+			if want.Method != "" && !strings.EqualFold(want.Method, got.Method) {
+				fail("upstream request method: expected %s, got %s", want.Method, got.Method)
+			}
+			if want.Path != "" && want.Path != got.Path {
+				fail("upstream request path: expected %q, got %q", want.Path, got.Path)
+			}
+			failures = append(failures, checkMessage("upstream request ", want.Headers, want.Body, want.BodyContains, got.Headers, got.Body)...)
+		}
+	}
+
+	return failures
+}
+
+func checkMessage(prefix string, headers map[string]string, body *string, bodyContains string, gotHeaders map[string]string, gotBody string) []string {
+	var failures []string
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		got, ok := lookupHeader(gotHeaders, name)
+		if want := headers[name]; !ok || got != want {
+			failures = append(failures, fmt.Sprintf("%sheader %s: expected %q, got %q", prefix, name, want, got))
+		}
+	}
+
+	if body != nil && *body != gotBody {
+		failures = append(failures, fmt.Sprintf("%sbody: expected %q, got %q", prefix, *body, gotBody))
+	}
+	if bodyContains != "" && !strings.Contains(gotBody, bodyContains) {
+		failures = append(failures, fmt.Sprintf("%sbody: expected to contain %q, got %q", prefix, bodyContains, gotBody))
+	}
+
+	return failures
+}
+
+func lookupHeader(headers map[string]string, name string) (string, bool) {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// matchSubset checks every field of want is in got with the same value, got may have more fields.
+func matchSubset(path string, want, got interface{}) []string {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		gotMap, ok := got.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object, got %s", path, marshalValue(got))}
+		}
+
+		keys := make([]string, 0, len(want))
+		for key := range want {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var diffs []string
+		for _, key := range keys {
+			gotValue, ok := gotMap[key]
+			if !ok {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: expected %s, it's missing", path, key, marshalValue(want[key])))
+				continue
+			}
+			diffs = append(diffs, matchSubset(path+"."+key, want[key], gotValue)...)
+		}
+		return diffs
+	case []interface{}:
+		gotSlice, ok := got.([]interface{})
+		if !ok || len(gotSlice) != len(want) {
+			return []string{fmt.Sprintf("%s: expected %s, got %s", path, marshalValue(want), marshalValue(got))}
+		}
+
+		var diffs []string
+		for i := range want {
+			diffs = append(diffs, matchSubset(fmt.Sprintf("%s[%d]", path, i), want[i], gotSlice[i])...)
+		}
+		return diffs
+	default:
+		if !reflect.DeepEqual(want, got) {
+			return []string{fmt.Sprintf("%s: expected %s, got %s", path, marshalValue(want), marshalValue(got))}
+		}
+		return nil
+	}
+}
+
+func marshalValue(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// RunFixture runs all the tests of the fixture with the harness.
+func RunFixture(h Harness, name string, fixture *Fixture) *JUnitTestSuite {
+	suite := &JUnitTestSuite{Name: name}
+	start := time.Now()
+
+	for i := range fixture.Tests {
+		test := &fixture.Tests[i]
+		testCase := JUnitTestCase{Name: test.Name, ClassName: name}
+
+		testStart := time.Now()
+		upstream := append(append([]RecordedResponse{}, test.Upstream...), fixture.Upstream...)
+		res, err := h.Run(test, upstream)
+		testCase.Time = time.Since(testStart).Seconds()
+
+		switch {
+		case err != nil:
+			suite.Errors++
+			testCase.Error = &JUnitMessage{Message: err.Error(), Type: "error"}
+		default:
+			if failures := test.Check(res); len(failures) > 0 {
+				suite.Failures++
+				testCase.Failure = &JUnitMessage{
+					Message:  failures[0],
+					Type:     "failure",
+					Contents: strings.Join(failures, "\n"),
+				}
+			}
+		}
+
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	suite.Time = time.Since(start).Seconds()
+	return suite
+}
+
+// JUnitTestSuites is the root of a JUnit XML report.
+type JUnitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []JUnitTestSuite `xml:"testsuite"`
+}
+
+// JUnitTestSuite is a suite of a JUnit XML report.
+type JUnitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      float64         `xml:"time,attr"`
+	TestCases []JUnitTestCase `xml:"testcase"`
+}
+
+// JUnitTestCase is a test case of a JUnit XML report.
+type JUnitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *JUnitMessage `xml:"failure,omitempty"`
+	Error     *JUnitMessage `xml:"error,omitempty"`
+}
+
+// JUnitMessage is the failure or error of a JUnit test case.
+type JUnitMessage struct {
+	Message  string `xml:"message,attr"`
+	Type     string `xml:"type,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// WriteJUnit writes the suites as a JUnit XML report.
+func WriteJUnit(w io.Writer, suites ...JUnitTestSuite) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(JUnitTestSuites{Suites: suites}); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type pluginTester struct {
+	conf       *string
+	api        *string
+	bundle     *string
+	plugin     *string
+	fixtures   *[]string
+	outputPath *string
+}
+
+// Test runs the fixtures through the middleware chain of the API.
+func (p *pluginTester) Test(_ *kingpin.ParseContext) error {
+	if NewHarness == nil {
+		return errors.New("plugin tests aren't supported by this build, build the gateway from the cli/plugin/plugintest module")
+	}
+
+	fixtures := make([]*Fixture, 0, len(*p.fixtures))
+	for _, path := range *p.fixtures {
+		fixture, err := LoadFixture(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fixtures = append(fixtures, fixture)
+	}
+
+	h, err := NewHarness(HarnessOptions{
+		ConfPath:   *p.conf,
+		APIPath:    *p.api,
+		BundlePath: *p.bundle,
+		PluginPath: *p.plugin,
+	})
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	var suites []JUnitTestSuite
+	var tests, failed int
+	for i, fixture := range fixtures {
+		suite := RunFixture(h, (*p.fixtures)[i], fixture)
+		suites = append(suites, *suite)
+		tests += suite.Tests
+		failed += suite.Failures + suite.Errors
+	}
+
+	out := io.Writer(os.Stdout)
+	if *p.outputPath != "" {
+		f, err := os.Create(*p.outputPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := WriteJUnit(out, suites...); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, tests)
+	}
+	return nil
+}
+
+var tester = &pluginTester{}
+
+func addTestCommand(cmd *kingpin.CmdClause) {
+	testCmd := cmd.Command("test", "Run requests from fixture files through the middleware chain of an API and report the results as JUnit XML")
+	tester.conf = testCmd.Flag("conf", "gateway configuration file, the defaults are used if it's not set").PlaceHolder("FILE").String()
+	tester.api = testCmd.Flag("api", "API definition file").Required().PlaceHolder("FILE").String()
+	tester.bundle = testCmd.Flag("bundle", "bundle archive to load instead of the bundle of the API").PlaceHolder("FILE").String()
+	tester.plugin = testCmd.Flag("plugin", "Go plugin to load for the Go plugin hooks of the API").PlaceHolder("FILE").String()
+	tester.outputPath = testCmd.Flag("output", "JUnit XML report file, the report is written to stdout if it's not set").Short('o').PlaceHolder("FILE").String()
+	tester.fixtures = testCmd.Arg("fixtures", "YAML or JSON fixture files").Required().ExistingFiles()
+	testCmd.Action(tester.Test)
+}
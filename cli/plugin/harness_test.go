@@ -0,0 +1,116 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFixture(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "fixture.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(`
+tests:
+  - request:
+      path: /orders
+    expect:
+      status: 200
+      session:
+        quota_remaining: 9
+`), 0600))
+
+	fixture, err := LoadFixture(yamlPath)
+	require.NoError(t, err)
+	require.Len(t, fixture.Tests, 1)
+	assert.Equal(t, "test 1", fixture.Tests[0].Name)
+	assert.Equal(t, "/orders", fixture.Tests[0].Request.Path)
+	assert.JSONEq(t, `{"quota_remaining": 9}`, string(fixture.Tests[0].Expect.Session))
+
+	jsonPath := filepath.Join(dir, "fixture.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"tests": [{"name": "orders", "request": {"path": "/orders"}}]}`), 0600))
+
+	fixture, err = LoadFixture(jsonPath)
+	require.NoError(t, err)
+	assert.Equal(t, "orders", fixture.Tests[0].Name)
+
+	emptyPath := filepath.Join(dir, "empty.yaml")
+	require.NoError(t, os.WriteFile(emptyPath, []byte(`upstream: []`), 0600))
+	_, err = LoadFixture(emptyPath)
+	assert.Error(t, err)
+}
+
+func TestFixtureTest_Check(t *testing.T) {
+	body := "created"
+	test := FixtureTest{
+		Expect: FixtureExpect{
+			Status:  201,
+			Headers: map[string]string{"X-Upstream": "stub"},
+			Body:    &body,
+			Session: json.RawMessage(`{"quota_remaining": 9, "meta_data": {"team": "a"}, "tags": ["x"]}`),
+			UpstreamRequest: &ExpectedRequest{
+				Path:    "/items",
+				Headers: map[string]string{"X-Plugin": "on"},
+			},
+		},
+	}
+
+	res := &Result{
+		Status:  201,
+		Headers: map[string]string{"X-Upstream": "stub"},
+		Body:    "created",
+		Session: json.RawMessage(`{"quota_remaining": 9, "quota_max": 10, "meta_data": {"team": "a", "tier": "gold"}, "tags": ["x"]}`),
+		Upstream: []RecordedRequest{
+			{Method: "GET", Path: "/items", Headers: map[string]string{"X-Plugin": "on"}},
+		},
+	}
+	assert.Empty(t, test.Check(res))
+
+	res.Status = 200
+	res.Headers = map[string]string{}
+	res.Session = json.RawMessage(`{"quota_remaining": 8, "meta_data": {}, "tags": []}`)
+	res.Upstream = []RecordedRequest{{Method: "GET", Path: "/other", Unmatched: true}}
+	assert.Equal(t, []string{
+		"no recorded upstream response for GET /other",
+		"status: expected 201, got 200",
+		`header X-Upstream: expected "stub", got ""`,
+		`session.meta_data.team: expected "a", it's missing`,
+		"session.quota_remaining: expected 9, got 8",
+		`session.tags: expected ["x"], got []`,
+		`upstream request path: expected "/items", got "/other"`,
+		`upstream request header X-Plugin: expected "on", got ""`,
+	}, test.Check(res))
+}
+
+type stubHarness struct{}
+
+func (stubHarness) Run(test *FixtureTest, upstream []RecordedResponse) (*Result, error) {
+	return &Result{Status: upstream[0].Status}, nil
+}
+
+func (stubHarness) Close() {}
+
+func TestRunFixture(t *testing.T) {
+	fixture := &Fixture{
+		Upstream: []RecordedResponse{{Status: 200}},
+		Tests: []FixtureTest{
+			{Name: "ok", Expect: FixtureExpect{Status: 200}},
+			{Name: "created", Expect: FixtureExpect{Status: 201}},
+		},
+	}
+
+	suite := RunFixture(stubHarness{}, "fixture.yaml", fixture)
+	assert.Equal(t, 2, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteJUnit(&buf, *suite))
+	assert.Contains(t, buf.String(), `<testsuite name="fixture.yaml" tests="2" failures="1" errors="0"`)
+	assert.Contains(t, buf.String(), `<testcase name="ok" classname="fixture.yaml"`)
+	assert.Contains(t, buf.String(), `<failure message="status: expected 201, got 200" type="failure">status: expected 201, got 200</failure>`)
+}
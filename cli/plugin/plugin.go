@@ -55,4 +55,6 @@ func AddTo(app *kingpin.Application) {
 	loader.file = buildCmd.Flag("file", "Key for bundle signature").Short('f').String()
 	loader.symbol = buildCmd.Flag("symbol", "Function symbol name").Short('s').String()
 	buildCmd.Action(loader.Load)
+
+	addTestCommand(cmd)
 }
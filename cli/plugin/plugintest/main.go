@@ -0,0 +1,59 @@
+// Command plugintest is the gateway with `tyk plugin test` enabled. The tests run on an embedded Redis server, the
+// module keeps its dependencies out of the gateway.
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/TykTechnologies/tyk/cli/plugin"
+	"github.com/TykTechnologies/tyk/gateway"
+)
+
+func init() {
+	plugin.NewHarness = newHarness
+}
+
+func main() {
+	gateway.Start()
+}
+
+// harness is a harness of the gateway running on an embedded Redis server.
+type harness struct {
+	plugin.Harness
+	redis *miniredis.Miniredis
+}
+
+func newHarness(opts plugin.HarnessOptions) (plugin.Harness, error) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't start the embedded Redis: %w", err)
+	}
+
+	port, err := strconv.Atoi(redis.Port())
+	if err != nil {
+		redis.Close()
+		return nil, err
+	}
+	opts.RedisHost, opts.RedisPort = redis.Host(), port
+
+	h, err := plugin.NewGatewayHarness(opts)
+	if err != nil {
+		redis.Close()
+		return nil, err
+	}
+	return &harness{Harness: h, redis: redis}, nil
+}
+
+// Run runs a test, the storage is flushed so tests don't affect each other.
+func (h *harness) Run(test *plugin.FixtureTest, upstream []plugin.RecordedResponse) (*plugin.Result, error) {
+	h.redis.FlushAll()
+	return h.Harness.Run(test, upstream)
+}
+
+func (h *harness) Close() {
+	h.Harness.Close()
+	h.redis.Close()
+}
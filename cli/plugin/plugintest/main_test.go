@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/cli"
+	"github.com/TykTechnologies/tyk/cli/plugin"
+	"github.com/TykTechnologies/tyk/gateway"
+)
+
+func TestHarness(t *testing.T) {
+	// the harness runs from the command line, after the flags are set up
+	cli.Init(gateway.VERSION, nil)
+
+	dir := t.TempDir()
+	writeFile := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+		return path
+	}
+
+	templatePath, err := filepath.Abs(filepath.Join("..", "..", "..", "templates"))
+	require.NoError(t, err)
+
+	h, err := newHarness(plugin.HarnessOptions{
+		ConfPath: writeFile("tyk.conf", `{"template_path": "`+templatePath+`"}`),
+		APIPath: writeFile("api.json", `{
+			"name": "orders",
+			"org_id": "default",
+			"use_keyless": true,
+			"version_data": {"not_versioned": true, "versions": {"Default": {"name": "Default"}}},
+			"proxy": {"listen_path": "/orders/", "target_url": "http://example.com", "strip_listen_path": true}
+		}`),
+	})
+	require.NoError(t, err)
+	defer h.Close()
+
+	fixture, err := plugin.LoadFixture(writeFile("fixture.yaml", `
+upstream:
+  - path: /items
+    status: 201
+    body: created
+tests:
+  - name: created
+    request:
+      method: POST
+      path: /orders/items
+    expect:
+      status: 201
+      body: created
+`))
+	require.NoError(t, err)
+
+	suite := plugin.RunFixture(h, "fixture.yaml", fixture)
+	assert.Equal(t, 1, suite.Tests)
+	assert.Equal(t, 0, suite.Errors)
+	assert.Equal(t, 0, suite.Failures)
+}
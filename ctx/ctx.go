@@ -47,6 +47,24 @@ const (
 
 	// CacheOptions holds cache options required for cache writer middleware.
 	CacheOptions
+
+	// GRPCWebRequest holds the content type of a gRPC-Web request translated to gRPC.
+	GRPCWebRequest
+
+	// GRPCTranscodingRoute holds the route of a REST request transcoded to a gRPC call.
+	GRPCTranscodingRoute
+
+	// WebSocketConn holds the message policies and counters of a WebSocket handshake.
+	WebSocketConn
+
+	// ControlAPICredential holds the named credential of a Control API request.
+	ControlAPICredential
+
+	// QuotaCharge holds the cost of a request and the quota counters it's been counted in.
+	QuotaCharge
+
+	// OrgQuota holds the organisation session whose quota is counted together with the quotas of the key of a request.
+	OrgQuota
 )
 
 func setContext(r *http.Request, ctx context.Context) {
@@ -133,3 +151,18 @@ func GetDefinition(r *http.Request) *apidef.APIDefinition {
 	}
 	return nil
 }
+
+// GetContextData returns the context variables of the request.
+func GetContextData(r *http.Request) map[string]interface{} {
+	if v := r.Context().Value(ContextData); v != nil {
+		if val, ok := v.(map[string]interface{}); ok {
+			return val
+		}
+	}
+	return nil
+}
+
+// SetContextData sets the context variables of the request.
+func SetContextData(r *http.Request, m map[string]interface{}) {
+	setContext(r, context.WithValue(r.Context(), ContextData, m))
+}
@@ -14,6 +14,8 @@ import (
 type GoAnalyticsPlugin struct {
 	Path     string // path to .so file
 	FuncName string // function symbol to look up
+	Spec     *APISpec
+	Gw       *Gateway
 	handler  func(record *analytics.AnalyticsRecord)
 	logger   *logrus.Entry
 }
@@ -32,7 +34,20 @@ func (m *GoAnalyticsPlugin) loadAnalyticsPlugin() bool {
 	// try to load plugin
 	var err error
 
-	if m.handler, err = goplugin.GetAnalyticsHandler(m.Path, m.FuncName); err != nil {
+	// plugins exporting an SDK registry are instantiated for the API
+	var inst *goPluginInstance
+	if m.Gw != nil {
+		inst, err = m.Gw.goPluginInstance(m.Spec, m.Path, m.FuncName)
+	}
+
+	switch {
+	case err != nil:
+	case inst != nil:
+		m.handler, err = inst.analyticsHandler()
+	default:
+		m.handler, err = goplugin.GetAnalyticsHandler(m.Path, m.FuncName)
+	}
+	if err != nil {
 		m.logger.WithError(err).Error("Could not load Go-plugin for analytics")
 		return false
 	}
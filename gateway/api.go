@@ -47,6 +47,7 @@ import (
 
 	"github.com/TykTechnologies/tyk/config"
 
+	"github.com/TykTechnologies/tyk/internal/transcoding"
 	"github.com/TykTechnologies/tyk/internal/uuid"
 
 	"github.com/TykTechnologies/tyk/apidef/oas"
@@ -231,10 +232,8 @@ func (gw *Gateway) getApisIdsForOrg(orgID string) []string {
 func (gw *Gateway) checkAndApplyTrialPeriod(keyName string, newSession *user.SessionState, isHashed bool) {
 	// Check the policies to see if we are forcing an expiry on the key
 	for _, polID := range newSession.PolicyIDs() {
-		gw.policiesMu.RLock()
-		policy, ok := gw.policiesByID[polID]
-		gw.policiesMu.RUnlock()
-		if !ok {
+		policy, err := gw.resolvedPolicy(polID)
+		if err != nil {
 			continue
 		}
 		// Are we foring an expiry?
@@ -348,7 +347,7 @@ func (gw *Gateway) doAddOrUpdate(keyName string, newSession *user.SessionState,
 				// Reset quote by default
 				if !dontReset {
 					gw.GlobalSessionManager.ResetQuota(keyName, newSession, isHashed)
-					newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
+					newSession.QuotaRenews = sessionQuotaRenews(newSession)
 				}
 
 				// apply polices (if any) and save key
@@ -370,7 +369,7 @@ func (gw *Gateway) doAddOrUpdate(keyName string, newSession *user.SessionState,
 		for _, spec := range gw.apisByID {
 			if !dontReset {
 				gw.GlobalSessionManager.ResetQuota(keyName, newSession, isHashed)
-				newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
+				newSession.QuotaRenews = sessionQuotaRenews(newSession)
 			}
 			gw.checkAndApplyTrialPeriod(keyName, newSession, isHashed)
 			// apply polices (if any) and save key
@@ -449,6 +448,11 @@ func (gw *Gateway) handleAddOrUpdate(keyName string, r *http.Request, isHashed b
 		return apiError("Request malformed"), http.StatusBadRequest
 	}
 
+	if err := validateQuotaRenewals(newSession.QuotaRenewalMode, newSession.QuotaRenewalTimezone, newSession.Group, newSession.AccessRights); err != nil {
+		log.Error("Invalid quota renewal: ", err)
+		return apiError(err.Error()), http.StatusBadRequest
+	}
+
 	mw := BaseMiddleware{Gw: gw}
 	// TODO: handle apply policies error
 	mw.ApplyPolicies(newSession)
@@ -483,6 +487,9 @@ func (gw *Gateway) handleAddOrUpdate(keyName string, r *http.Request, isHashed b
 		// preserve the creation date
 		newSession.DateCreated = originalKey.DateCreated
 
+		// a key keeps its rotation until the end of its grace period
+		newSession.Rotation = originalKey.Rotation
+
 		// don't change fields related to quota and rate limiting if was passed as "suppress_reset=1"
 		if suppressReset {
 			// save existing quota_renews and last_updated if suppress_reset was passed
@@ -700,6 +707,28 @@ type apiAllKeys struct {
 	APIKeys []string `json:"keys"`
 }
 
+// apiKeyList is a page of keys listed from the key index.
+type apiKeyList struct {
+	APIKeys    []string                 `json:"keys"`
+	Sessions   []map[string]interface{} `json:"sessions,omitempty"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+// keyListParams are the query parameters which list keys from the key index rather than scanning them.
+var keyListParams = []string{
+	"cursor", "limit", "fields", "policy_id", "tag", "alias", "expires_after", "expires_before", "inactive",
+}
+
+func isKeyListRequest(r *http.Request) bool {
+	query := r.URL.Query()
+	for _, param := range keyListParams {
+		if _, ok := query[param]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (gw *Gateway) handleGetAllKeys(filter string) (interface{}, int) {
 	sessions := gw.GlobalSessionManager.Sessions(filter)
 	if filter != "" {
@@ -712,7 +741,7 @@ func (gw *Gateway) handleGetAllKeys(filter string) (interface{}, int) {
 
 	fixedSessions := make([]string, 0)
 	for _, s := range sessions {
-		if !strings.HasPrefix(s, QuotaKeyPrefix) && !strings.HasPrefix(s, RateLimitKeyPrefix) {
+		if !strings.HasPrefix(s, QuotaKeyPrefix) && !strings.HasPrefix(s, CreditsKeyPrefix) && !strings.HasPrefix(s, RateLimitKeyPrefix) {
 			fixedSessions = append(fixedSessions, s)
 		}
 	}
@@ -727,6 +756,75 @@ func (gw *Gateway) handleGetAllKeys(filter string) (interface{}, int) {
 	return sessionsObj, http.StatusOK
 }
 
+func (gw *Gateway) handleListKeys(r *http.Request) (interface{}, int) {
+	query := r.URL.Query()
+	filter := keyListFilter{
+		OrgID:    query.Get("org_id"),
+		PolicyID: query.Get("policy_id"),
+		APIID:    query.Get("api_id"),
+		Tag:      query.Get("tag"),
+		Alias:    query.Get("alias"),
+	}
+
+	var err error
+	for param, value := range map[string]*int64{"expires_after": &filter.ExpiresAfter, "expires_before": &filter.ExpiresBefore} {
+		if v := query.Get(param); v != "" {
+			if *value, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return apiError("Invalid " + param + " timestamp"), http.StatusBadRequest
+			}
+		}
+	}
+
+	if v := query.Get("inactive"); v != "" {
+		inactive, err := strconv.ParseBool(v)
+		if err != nil {
+			return apiError("Invalid inactive value"), http.StatusBadRequest
+		}
+		filter.Inactive = &inactive
+	}
+
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return apiError("Invalid limit"), http.StatusBadRequest
+		}
+	}
+
+	var fields []string
+	if v := query.Get("fields"); v != "" {
+		fields = strings.Split(v, ",")
+	}
+
+	keys, err := gw.keyIndex.list(filter, query.Get("cursor"), limit, fields)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"status": "fail",
+		}).WithError(err).Error("Failed to list keys.")
+		return apiError("Failed to list keys"), http.StatusInternalServerError
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+		"status": "ok",
+	}).Info("Retrieved key list.")
+
+	return keys, http.StatusOK
+}
+
+// keyIndexRebuildHandler indexes the keys stored before the key index, in the background.
+func (gw *Gateway) keyIndexRebuildHandler(w http.ResponseWriter, r *http.Request) {
+	go func() {
+		count := gw.keyIndex.rebuild()
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"keys":   count,
+		}).Info("Rebuilt key index.")
+	}()
+
+	doJSONWrite(w, http.StatusAccepted, apiOk("Key index rebuild started"))
+}
+
 func (gw *Gateway) handleAddKey(keyName, sessionString, orgId string) {
 	sess := &user.SessionState{}
 	json.Unmarshal([]byte(sessionString), sess)
@@ -778,6 +876,7 @@ func (gw *Gateway) handleDeleteKey(keyName, orgID, apiID string, resetQuota bool
 			}).Error("Failed to remove the key")
 			return apiError("Failed to remove the key"), http.StatusBadRequest
 		}
+		deleteKeyCredits(gw.GlobalSessionManager.Store(), storage.HashKey(keyName, gw.GetConfig().HashKeys), &session)
 
 		log.WithFields(logrus.Fields{
 			"prefix": "api",
@@ -796,6 +895,7 @@ func (gw *Gateway) handleDeleteKey(keyName, orgID, apiID string, resetQuota bool
 		}).Error("Failed to remove the key")
 		return apiError("Failed to remove the key"), http.StatusBadRequest
 	}
+	deleteKeyCredits(gw.GlobalSessionManager.Store(), storage.HashKey(keyName, gw.GetConfig().HashKeys), &session)
 
 	statusObj := apiModifyKeySuccess{
 		Key:    keyName,
@@ -926,6 +1026,21 @@ func (gw *Gateway) handleAddOrUpdatePolicy(polID string, r *http.Request) (inter
 		return apiError("Request malformed"), http.StatusBadRequest
 	}
 
+	if err := validatePolicyMerge(*newPol); err != nil {
+		log.Error("Invalid policy merge strategies: ", err)
+		return apiError(err.Error()), http.StatusBadRequest
+	}
+
+	if err := validatePolicySchedules(*newPol); err != nil {
+		log.Error("Invalid policy schedules: ", err)
+		return apiError(err.Error()), http.StatusBadRequest
+	}
+
+	if err := validateQuotaRenewals(newPol.QuotaRenewalMode, newPol.QuotaRenewalTimezone, newPol.Group, newPol.AccessRights); err != nil {
+		log.Error("Invalid policy quota renewal: ", err)
+		return apiError(err.Error()), http.StatusBadRequest
+	}
+
 	if polID != "" && newPol.ID != polID && r.Method == http.MethodPut {
 		log.Error("PUT operation on different IDs")
 		return apiError("Request ID does not match that in policy! For Update operations these must match."), http.StatusBadRequest
@@ -1637,7 +1752,11 @@ func (gw *Gateway) keyHandler(w http.ResponseWriter, r *http.Request) {
 					)
 					return
 				}
+			}
 
+			if isKeyListRequest(r) {
+				obj, code = gw.handleListKeys(r)
+			} else if gwConfig.HashKeys {
 				// we don't use filter for hashed keys
 				obj, code = gw.handleGetAllKeys("")
 			} else {
@@ -1792,7 +1911,7 @@ func (gw *Gateway) handleOrgAddOrUpdate(orgID string, r *http.Request) (interfac
 
 	if r.URL.Query().Get("reset_quota") == "1" {
 		sessionManager.ResetQuota(orgID, newSession, false)
-		newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
+		newSession.QuotaRenews = sessionQuotaRenews(newSession)
 		rawKey := QuotaKeyPrefix + storage.HashKey(orgID, gw.GetConfig().HashKeys)
 
 		// manage quotas separately
@@ -1865,7 +1984,7 @@ func (gw *Gateway) handleGetAllOrgKeys(filter string) (interface{}, int) {
 	sessions := spec.OrgSessionManager.Sessions(filter)
 	fixed_sessions := make([]string, 0)
 	for _, s := range sessions {
-		if !strings.HasPrefix(s, QuotaKeyPrefix) && !strings.HasPrefix(s, RateLimitKeyPrefix) {
+		if !strings.HasPrefix(s, QuotaKeyPrefix) && !strings.HasPrefix(s, CreditsKeyPrefix) && !strings.HasPrefix(s, RateLimitKeyPrefix) {
 			fixed_sessions = append(fixed_sessions, s)
 		}
 	}
@@ -1927,6 +2046,164 @@ func (gw *Gateway) groupResetHandler(w http.ResponseWriter, r *http.Request) {
 	doJSONWrite(w, http.StatusOK, apiOk(""))
 }
 
+// bundleReloadHandler reloads the bundle of an API on this gateway, without reloading the other APIs.
+// The API keeps its current bundle if the new one fails to load.
+func (gw *Gateway) bundleReloadHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := mux.Vars(r)["apiID"]
+
+	if err := gw.reloadAPIBundle(apiID); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"api_id": apiID,
+			"status": "fail",
+		}).WithError(err).Error("Bundle reload failed.")
+
+		status := http.StatusInternalServerError
+		switch err {
+		case errBundleReloadAPINotFound:
+			status = http.StatusNotFound
+		case errBundleReloadNoBundle:
+			status = http.StatusBadRequest
+		}
+		doJSONWrite(w, status, apiError(err.Error()))
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+		"api_id": apiID,
+		"status": "ok",
+	}).Info("Bundle reloaded.")
+
+	doJSONWrite(w, http.StatusOK, apiOk(""))
+}
+
+// groupBundleReloadHandler signals the group to reload the bundle of an API.
+func (gw *Gateway) groupBundleReloadHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := mux.Vars(r)["apiID"]
+
+	gw.MainNotifier.Notify(Notification{Command: NoticeBundleReload, Payload: apiID, Gw: gw})
+
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+		"api_id": apiID,
+	}).Info("Group bundle reload accepted.")
+
+	doJSONWrite(w, http.StatusOK, apiOk(""))
+}
+
+// webhookStatus describes a webhook handler of the gateway and its outbox.
+type webhookStatus struct {
+	ID          string `json:"id"`
+	APIID       string `json:"api_id,omitempty"`
+	Method      string `json:"method"`
+	TargetPath  string `json:"target_path"`
+	Pending     int    `json:"pending"`
+	DeadLetters int    `json:"dead_letters"`
+}
+
+// webhooksHandler lists the webhook handlers loaded by the gateway.
+func (gw *Gateway) webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	handlers := gw.webhooks.list()
+	webhooks := make([]webhookStatus, 0, len(handlers))
+	for _, handler := range handlers {
+		status := webhookStatus{
+			ID:         handler.id,
+			Method:     string(handler.getRequestMethod(handler.conf.Method)),
+			TargetPath: handler.conf.TargetPath,
+		}
+		if handler.Spec != nil {
+			status.APIID = handler.Spec.APIID
+		}
+
+		var err error
+		status.Pending, status.DeadLetters, err = handler.outbox.count()
+		if err != nil {
+			doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to read the webhook outbox"))
+			return
+		}
+
+		webhooks = append(webhooks, status)
+	}
+
+	doJSONWrite(w, http.StatusOK, webhooks)
+}
+
+// webhookDeadLettersHandler lists the deliveries of a webhook which couldn't be delivered.
+func (gw *Gateway) webhookDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	webhookID := mux.Vars(r)["webhookID"]
+
+	deliveries, err := gw.newWebhookOutbox(webhookID).deadLetters()
+	if err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to read the webhook outbox"))
+		return
+	}
+
+	doJSONWrite(w, http.StatusOK, deliveries)
+}
+
+// webhookReplayHandler moves a dead letter, or all the dead letters if no delivery ID is given, back to the
+// outbox of a webhook.
+func (gw *Gateway) webhookReplayHandler(w http.ResponseWriter, r *http.Request) {
+	webhookID := mux.Vars(r)["webhookID"]
+	deliveryID := mux.Vars(r)["deliveryID"]
+	outbox := gw.newWebhookOutbox(webhookID)
+
+	ids := []string{deliveryID}
+	if deliveryID == "" {
+		deliveries, err := outbox.deadLetters()
+		if err != nil {
+			doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to read the webhook outbox"))
+			return
+		}
+
+		ids = ids[:0]
+		for _, d := range deliveries {
+			ids = append(ids, d.ID)
+		}
+	}
+
+	for _, id := range ids {
+		if err := outbox.replay(id); err != nil {
+			if err == errWebhookDeliveryNotFound {
+				doJSONWrite(w, http.StatusNotFound, apiError("Dead letter not found"))
+				return
+			}
+			doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to replay the dead letter"))
+			return
+		}
+	}
+
+	if handler := gw.webhooks.get(webhookID); handler != nil {
+		handler.notify()
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix":  "api",
+		"webhook": webhookID,
+		"count":   len(ids),
+	}).Info("Webhook dead letters replayed.")
+
+	doJSONWrite(w, http.StatusOK, apiOk(fmt.Sprintf("%d dead letters replayed", len(ids))))
+}
+
+// webhookDeadLetterDeleteHandler deletes a dead letter of a webhook.
+func (gw *Gateway) webhookDeadLetterDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	webhookID := mux.Vars(r)["webhookID"]
+	deliveryID := mux.Vars(r)["deliveryID"]
+
+	if err := gw.newWebhookOutbox(webhookID).remove(deliveryID); err != nil {
+		if err == errWebhookDeliveryNotFound {
+			doJSONWrite(w, http.StatusNotFound, apiError("Dead letter not found"))
+			return
+		}
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to delete the dead letter"))
+		return
+	}
+
+	doJSONWrite(w, http.StatusOK, apiOk("deleted"))
+}
+
 // resetHandler will try to queue a reload. If fn is nil and block=true
 // was in the URL parameters, it will block until the reload is done.
 // Otherwise, it won't block and fn will be called once the reload is
@@ -1962,6 +2239,16 @@ func (gw *Gateway) createKeyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := validateQuotaRenewals(newSession.QuotaRenewalMode, newSession.QuotaRenewalTimezone, newSession.Group, newSession.AccessRights); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"status": "fail",
+			"err":    err,
+		}).Error("Key creation failed.")
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	}
+
 	newKey := gw.keyGen.GenerateAuthKey(newSession.OrgID)
 	if newSession.HMACEnabled {
 		newSession.HmacSecret = gw.keyGen.GenerateHMACSecret()
@@ -1994,7 +2281,7 @@ func (gw *Gateway) createKeyHandler(w http.ResponseWriter, r *http.Request) {
 				if !apiSpec.DontSetQuotasOnCreate {
 					// Reset quota by default
 					gw.GlobalSessionManager.ResetQuota(newKey, newSession, false)
-					newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
+					newSession.QuotaRenews = sessionQuotaRenews(newSession)
 				}
 				// apply polices (if any) and save key
 				if err := gw.applyPoliciesAndSave(newKey, newSession, apiSpec, false); err != nil {
@@ -2004,7 +2291,7 @@ func (gw *Gateway) createKeyHandler(w http.ResponseWriter, r *http.Request) {
 			} else {
 				// Use fallback
 				sessionManager := gw.GlobalSessionManager
-				newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
+				newSession.QuotaRenews = sessionQuotaRenews(newSession)
 				sessionManager.ResetQuota(newKey, newSession, false)
 				// apply polices (if any) and save key
 				err := sessionManager.UpdateSession(newKey, newSession, -1, false)
@@ -2035,7 +2322,7 @@ func (gw *Gateway) createKeyHandler(w http.ResponseWriter, r *http.Request) {
 				if !spec.DontSetQuotasOnCreate {
 					// Reset quote by default
 					gw.GlobalSessionManager.ResetQuota(newKey, newSession, false)
-					newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
+					newSession.QuotaRenews = sessionQuotaRenews(newSession)
 				}
 				if err := gw.applyPoliciesAndSave(newKey, newSession, spec, false); err != nil {
 					doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to create key - "+err.Error()))
@@ -3092,6 +3379,73 @@ func ctxGetCacheOptions(r *http.Request) *cacheOptions {
 	return key
 }
 
+// ctxSetGRPCWebContentType marks the request as translated from gRPC-Web, keeping its original content type
+func ctxSetGRPCWebContentType(r *http.Request, contentType string) {
+	setCtxValue(r, ctx.GRPCWebRequest, contentType)
+}
+
+// ctxGetGRPCWebContentType returns the original content type of a request translated from gRPC-Web
+func ctxGetGRPCWebContentType(r *http.Request) string {
+	contentType, _ := r.Context().Value(ctx.GRPCWebRequest).(string)
+	return contentType
+}
+
+// ctxSetGRPCTranscodingRoute marks the request as transcoded from REST to a call of the route's gRPC method
+func ctxSetGRPCTranscodingRoute(r *http.Request, route *transcoding.Route) {
+	setCtxValue(r, ctx.GRPCTranscodingRoute, route)
+}
+
+// ctxGetGRPCTranscodingRoute returns the route of a request transcoded from REST to gRPC
+func ctxGetGRPCTranscodingRoute(r *http.Request) *transcoding.Route {
+	route, _ := r.Context().Value(ctx.GRPCTranscodingRoute).(*transcoding.Route)
+	return route
+}
+
+// ctxSetWebSocketConn sets the message policies applied once a WebSocket handshake succeeds
+func ctxSetWebSocketConn(r *http.Request, conn *webSocketConn) {
+	setCtxValue(r, ctx.WebSocketConn, conn)
+}
+
+// ctxGetWebSocketConn returns the message policies of a WebSocket handshake
+func ctxGetWebSocketConn(r *http.Request) *webSocketConn {
+	conn, _ := r.Context().Value(ctx.WebSocketConn).(*webSocketConn)
+	return conn
+}
+
+// ctxSetControlAPICredential sets the named credential a Control API request is authenticated with
+func ctxSetControlAPICredential(r *http.Request, credential *config.ControlAPICredential) {
+	setCtxValue(r, ctx.ControlAPICredential, credential)
+}
+
+// ctxGetControlAPICredential returns the named credential of a Control API request, it's nil for the secret
+func ctxGetControlAPICredential(r *http.Request) *config.ControlAPICredential {
+	credential, _ := r.Context().Value(ctx.ControlAPICredential).(*config.ControlAPICredential)
+	return credential
+}
+
+// ctxSetQuotaCharge sets the charge of a request to the quotas
+func ctxSetQuotaCharge(r *http.Request, charge *quotaCharge) {
+	setCtxValue(r, ctx.QuotaCharge, charge)
+}
+
+// ctxGetQuotaCharge returns the charge of a request to the quotas, it's nil before the quotas are checked
+func ctxGetQuotaCharge(r *http.Request) *quotaCharge {
+	charge, _ := r.Context().Value(ctx.QuotaCharge).(*quotaCharge)
+	return charge
+}
+
+// ctxSetOrgQuota sets the organisation session whose quota is counted with the quotas of the key of a request
+func ctxSetOrgQuota(r *http.Request, orgSession *user.SessionState) {
+	setCtxValue(r, ctx.OrgQuota, orgSession)
+}
+
+// ctxGetOrgQuota returns the organisation session whose quota is counted with the quotas of the key of a request, nil
+// when the organisation monitor has counted it
+func ctxGetOrgQuota(r *http.Request) *user.SessionState {
+	orgSession, _ := r.Context().Value(ctx.OrgQuota).(*user.SessionState)
+	return orgSession
+}
+
 func ctxGetSession(r *http.Request) *user.SessionState {
 	return ctx.GetSession(r)
 }
@@ -46,6 +46,7 @@ import (
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/goplugin/sdk"
 	"github.com/TykTechnologies/tyk/header"
 	"github.com/TykTechnologies/tyk/regexp"
 	"github.com/TykTechnologies/tyk/rpc"
@@ -90,6 +91,8 @@ const (
 	Internal
 	GoPlugin
 	PersistGraphQL
+	GRPCMethod
+	RequestCost
 )
 
 // RequestStatus is a custom type to avoid collisions
@@ -126,6 +129,8 @@ const (
 	StatusInternal                 RequestStatus = "Internal path"
 	StatusGoPlugin                 RequestStatus = "Go plugin"
 	StatusPersistGraphQL           RequestStatus = "Persist GraphQL"
+	StatusGRPCMethod               RequestStatus = "gRPC method"
+	StatusRequestCost              RequestStatus = "Request cost"
 )
 
 // URLSpec represents a flattened specification for URLs, used to check if a proxy URL
@@ -158,6 +163,8 @@ type URLSpec struct {
 	Internal                  apidef.InternalMeta
 	GoPluginMeta              GoPluginMiddleware
 	PersistGraphQL            apidef.PersistGraphQLMeta
+	GRPCMethod                apidef.GRPCMethodMeta
+	Cost                      apidef.CostMeta
 
 	IgnoreCase bool
 }
@@ -212,6 +219,11 @@ type APISpec struct {
 	AnalyticsPluginConfig    *GoAnalyticsPlugin
 
 	middlewareChain *ChainObject
+	grpcPlugin      *grpcPluginClient
+	goPlugins       []*goPluginInstance
+	stopBundleWatch context.CancelFunc
+	// bundlePath is the directory of a bundle loaded by a bundle reload, it's removed with the spec.
+	bundlePath string
 
 	network analytics.NetworkStats
 
@@ -255,6 +267,31 @@ func (s *APISpec) Release() {
 		}
 	}
 
+	if s.grpcPlugin != nil {
+		s.grpcPlugin.Close()
+	}
+
+	for _, plugin := range s.goPlugins {
+		plugin.release(s)
+	}
+
+	// stop the workers of the event handlers
+	for _, handlers := range s.EventPaths {
+		for _, handler := range handlers {
+			if closer, ok := handler.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+	}
+
+	if s.stopBundleWatch != nil {
+		s.stopBundleWatch()
+	}
+
+	if s.bundlePath != "" {
+		os.RemoveAll(s.bundlePath)
+	}
+
 	// cancel execution contexts
 	if s.GraphQLExecutor.CancelV2 != nil {
 		s.GraphQLExecutor.CancelV2()
@@ -263,7 +300,7 @@ func (s *APISpec) Release() {
 	// release all other resources associated with spec
 
 	// JSVM object is a circular dependecy hell, but we can check if it initialized like this
-	if s.JSVM.VM != nil {
+	if s.JSVM.VM != nil || s.JSVM.pool != nil {
 		s.JSVM.DeInit()
 	}
 }
@@ -324,6 +361,13 @@ func (a APIDefinitionLoader) MakeSpec(def *nestedApiDefinition, logger *logrus.E
 		return currSpec
 	}
 
+	return a.initSpec(spec, def, logger)
+}
+
+// initSpec loads the definition into the spec, its bundle included.
+func (a APIDefinitionLoader) initSpec(spec *APISpec, def *nestedApiDefinition, logger *logrus.Entry) *APISpec {
+	var err error
+
 	if logger == nil {
 		logger = logrus.NewEntry(log)
 	}
@@ -1103,6 +1147,8 @@ func (a APIDefinitionLoader) compileGopluginPathspathSpec(paths []apidef.GoPlugi
 		newSpec := URLSpec{}
 		a.generateRegex(stringSpec.Path, &newSpec, stat, conf)
 		// Extend with method actions
+		newSpec.GoPluginMeta.BaseMiddleware = BaseMiddleware{Spec: apiSpec, Gw: a.Gw}
+		newSpec.GoPluginMeta.Hook = sdk.HookEndpoint
 		newSpec.GoPluginMeta.Path = stringSpec.PluginPath
 		newSpec.GoPluginMeta.SymbolName = stringSpec.SymbolName
 		newSpec.GoPluginMeta.Meta.Method = stringSpec.Method
@@ -1206,6 +1252,41 @@ func (a APIDefinitionLoader) compileInternalPathspathSpec(paths []apidef.Interna
 	return urlSpec
 }
 
+func (a APIDefinitionLoader) compileGRPCMethodPathSpec(paths []apidef.GRPCMethodMeta, stat URLStatus, conf config.Config) []URLSpec {
+	urlSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		if stringSpec.Disabled {
+			continue
+		}
+
+		newSpec := URLSpec{}
+		// gRPC method names are matched exactly
+		a.generateRegex("^"+regexp.QuoteMeta(stringSpec.Path)+"$", &newSpec, stat, conf)
+		newSpec.GRPCMethod = stringSpec
+		urlSpec = append(urlSpec, newSpec)
+	}
+
+	return urlSpec
+}
+
+func (a APIDefinitionLoader) compileCostPathSpec(paths []apidef.CostMeta, stat URLStatus, conf config.Config) []URLSpec {
+	urlSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		if stringSpec.Disabled {
+			continue
+		}
+
+		newSpec := URLSpec{}
+		a.generateRegex(stringSpec.Path, &newSpec, stat, conf)
+		newSpec.Cost = stringSpec
+		urlSpec = append(urlSpec, newSpec)
+	}
+
+	return urlSpec
+}
+
 func (a APIDefinitionLoader) getExtendedPathSpecs(apiVersionDef apidef.VersionInfo, apiSpec *APISpec, conf config.Config) ([]URLSpec, bool) {
 	// TODO: New compiler here, needs to put data into a different structure
 
@@ -1232,6 +1313,8 @@ func (a APIDefinitionLoader) getExtendedPathSpecs(apiVersionDef apidef.VersionIn
 	internalPaths := a.compileInternalPathspathSpec(apiVersionDef.ExtendedPaths.Internal, Internal, conf)
 	goPlugins := a.compileGopluginPathspathSpec(apiVersionDef.ExtendedPaths.GoPlugin, GoPlugin, apiSpec, conf)
 	persistGraphQL := a.compilePersistGraphQLPathSpec(apiVersionDef.ExtendedPaths.PersistGraphQL, PersistGraphQL, apiSpec, conf)
+	grpcMethods := a.compileGRPCMethodPathSpec(apiVersionDef.ExtendedPaths.GRPCMethods, GRPCMethod, conf)
+	costs := a.compileCostPathSpec(apiVersionDef.ExtendedPaths.Costs, RequestCost, conf)
 
 	combinedPath := []URLSpec{}
 	combinedPath = append(combinedPath, mockResponsePaths...)
@@ -1257,6 +1340,8 @@ func (a APIDefinitionLoader) getExtendedPathSpecs(apiVersionDef apidef.VersionIn
 	combinedPath = append(combinedPath, unTrackedPaths...)
 	combinedPath = append(combinedPath, validateJSON...)
 	combinedPath = append(combinedPath, internalPaths...)
+	combinedPath = append(combinedPath, grpcMethods...)
+	combinedPath = append(combinedPath, costs...)
 
 	return combinedPath, len(whiteListPaths) > 0
 }
@@ -1317,6 +1402,10 @@ func (a *APISpec) getURLStatus(stat URLStatus) RequestStatus {
 		return StatusGoPlugin
 	case PersistGraphQL:
 		return StatusPersistGraphQL
+	case GRPCMethod:
+		return StatusGRPCMethod
+	case RequestCost:
+		return StatusRequestCost
 	default:
 		log.Error("URL Status was not one of Ignored, Blacklist or WhiteList! Blocking.")
 		return EndPointNotAllowed
@@ -1542,6 +1631,15 @@ func (a *APISpec) CheckSpecMatchesStatus(r *http.Request, rxPaths []URLSpec, mod
 			if method == rxPaths[i].PersistGraphQL.Method {
 				return true, &rxPaths[i].PersistGraphQL
 			}
+		case GRPCMethod:
+			// gRPC calls are always sent as POST
+			if method == http.MethodPost {
+				return true, &rxPaths[i].GRPCMethod
+			}
+		case RequestCost:
+			if method == rxPaths[i].Cost.Method {
+				return true, &rxPaths[i].Cost
+			}
 		}
 	}
 	return false, nil
@@ -13,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 
 	"github.com/gorilla/mux"
@@ -22,6 +23,7 @@ import (
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/coprocess"
+	"github.com/TykTechnologies/tyk/goplugin/sdk"
 	"github.com/TykTechnologies/tyk/storage"
 	"github.com/TykTechnologies/tyk/trace"
 )
@@ -37,6 +39,42 @@ type ChainObject struct {
 	Skip           bool
 }
 
+// swap makes the chain serve the handlers of another chain of the same API, routes keep pointing to it.
+func (c *ChainObject) swap(next *ChainObject) {
+	if h, ok := c.ThisHandler.(*swappableHandler); ok {
+		h.swap(next.ThisHandler)
+	}
+	if h, ok := c.RateLimitChain.(*swappableHandler); ok && next.RateLimitChain != nil {
+		h.swap(next.RateLimitChain)
+	}
+}
+
+// swappableHandler serves a handler which can be replaced while serving, see ChainObject.swap.
+type swappableHandler struct {
+	handler atomic.Value
+}
+
+type handlerValue struct {
+	http.Handler
+}
+
+func newSwappableHandler(h http.Handler) *swappableHandler {
+	s := &swappableHandler{}
+	s.handler.Store(handlerValue{h})
+	return s
+}
+
+func (s *swappableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.Load().(handlerValue).ServeHTTP(w, r)
+}
+
+func (s *swappableHandler) swap(h http.Handler) {
+	if next, ok := h.(*swappableHandler); ok {
+		h = next.handler.Load().(handlerValue).Handler
+	}
+	s.handler.Store(handlerValue{h})
+}
+
 func (gw *Gateway) prepareStorage() generalStores {
 	var gs generalStores
 	gs.redisStore = &storage.RedisCluster{KeyPrefix: "apikey-", HashKeys: gw.GetConfig().HashKeys, RedisController: gw.RedisController}
@@ -261,6 +299,13 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 		spec.JSVM.LoadJSPaths(mwPaths, prefix)
 	}
 
+	if mwDriver == apidef.GrpcDriver && gw.GetConfig().CoProcessOptions.EnableCoProcess {
+		var err error
+		if spec.grpcPlugin, err = gw.newGRPCPluginClient(spec); err != nil {
+			logger.WithError(err).Error("Couldn't create gRPC plugin client")
+		}
+	}
+
 	//  if bundle was used - fix paths for goplugin-type custom middle-wares
 	if mwDriver == apidef.GoPluginDriver && prefix != "" {
 		mwAuthCheckFunc.Path = filepath.Join(prefix, mwAuthCheckFunc.Path)
@@ -327,11 +372,12 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 					Path:           obj.Path,
 					SymbolName:     obj.Name,
 					APILevel:       true,
+					Hook:           sdk.HookPre,
 				},
 			)
 		} else if mwDriver != apidef.OttoDriver {
 			coprocessLog.Debug("Registering coprocess middleware, hook name: ", obj.Name, "hook type: Pre", ", driver: ", mwDriver)
-			gw.mwAppendEnabled(&chainArray, &CoProcessMiddleware{baseMid, coprocess.HookType_Pre, obj.Name, mwDriver, obj.RawBodyOnly, nil})
+			gw.mwAppendEnabled(&chainArray, &CoProcessMiddleware{baseMid, coprocess.HookType_Pre, obj.Name, mwDriver, obj.RawBodyOnly, obj.BodyMode, nil})
 		} else {
 			chainArray = append(chainArray, gw.createDynamicMiddleware(obj.Name, true, obj.RequireSession, baseMid))
 		}
@@ -341,7 +387,7 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 	gw.mwAppendEnabled(&chainArray, &IPWhiteListMiddleware{BaseMiddleware: baseMid})
 	gw.mwAppendEnabled(&chainArray, &IPBlackListMiddleware{BaseMiddleware: baseMid})
 	gw.mwAppendEnabled(&chainArray, &CertificateCheckMW{BaseMiddleware: baseMid})
-	gw.mwAppendEnabled(&chainArray, &OrganizationMonitor{BaseMiddleware: baseMid, mon: Monitor{Gw: gw}})
+	gw.mwAppendEnabled(&chainArray, &OrganizationMonitor{BaseMiddleware: baseMid, mon: Monitor{Gw: gw}, deferQuota: !spec.UseKeylessAccess})
 	gw.mwAppendEnabled(&chainArray, &RequestSizeLimitMiddleware{baseMid})
 	gw.mwAppendEnabled(&chainArray, &MiddlewareContextVars{BaseMiddleware: baseMid})
 	gw.mwAppendEnabled(&chainArray, &TrackEndpointMiddleware{baseMid})
@@ -392,13 +438,14 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 						Path:           mwAuthCheckFunc.Path,
 						SymbolName:     mwAuthCheckFunc.Name,
 						APILevel:       true,
+						Hook:           sdk.HookAuthCheck,
 					},
 				)
 			default:
 				coprocessLog.Debug("Registering coprocess middleware, hook name: ", mwAuthCheckFunc.Name, "hook type: CustomKeyCheck", ", driver: ", mwDriver)
 
 				newExtractor(spec, baseMid)
-				gw.mwAppendEnabled(&authArray, &CoProcessMiddleware{baseMid, coprocess.HookType_CustomKeyCheck, mwAuthCheckFunc.Name, mwDriver, mwAuthCheckFunc.RawBodyOnly, nil})
+				gw.mwAppendEnabled(&authArray, &CoProcessMiddleware{baseMid, coprocess.HookType_CustomKeyCheck, mwAuthCheckFunc.Name, mwDriver, mwAuthCheckFunc.RawBodyOnly, mwAuthCheckFunc.BodyMode, nil})
 			}
 		}
 
@@ -418,11 +465,12 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 						Path:           obj.Path,
 						SymbolName:     obj.Name,
 						APILevel:       true,
+						Hook:           sdk.HookPostKeyAuth,
 					},
 				)
 			} else {
 				coprocessLog.Debug("Registering coprocess middleware, hook name: ", obj.Name, "hook type: Pre", ", driver: ", mwDriver)
-				gw.mwAppendEnabled(&chainArray, &CoProcessMiddleware{baseMid, coprocess.HookType_PostKeyAuth, obj.Name, mwDriver, obj.RawBodyOnly, nil})
+				gw.mwAppendEnabled(&chainArray, &CoProcessMiddleware{baseMid, coprocess.HookType_PostKeyAuth, obj.Name, mwDriver, obj.RawBodyOnly, obj.BodyMode, nil})
 			}
 		}
 
@@ -434,6 +482,8 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 	}
 
 	gw.mwAppendEnabled(&chainArray, &RateLimitForAPI{BaseMiddleware: baseMid})
+	gw.mwAppendEnabled(&chainArray, &GRPCMiddleware{BaseMiddleware: baseMid})
+	gw.mwAppendEnabled(&chainArray, &WebSocketMiddleware{BaseMiddleware: baseMid})
 	gw.mwAppendEnabled(&chainArray, &GraphQLMiddleware{BaseMiddleware: baseMid})
 	if !spec.UseKeylessAccess {
 		gw.mwAppendEnabled(&chainArray, &GraphQLComplexityMiddleware{BaseMiddleware: baseMid})
@@ -465,16 +515,20 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 					Path:           obj.Path,
 					SymbolName:     obj.Name,
 					APILevel:       true,
+					Hook:           sdk.HookPost,
 				},
 			)
 		} else if mwDriver != apidef.OttoDriver {
 			coprocessLog.Debug("Registering coprocess middleware, hook name: ", obj.Name, "hook type: Post", ", driver: ", mwDriver)
-			gw.mwAppendEnabled(&chainArray, &CoProcessMiddleware{baseMid, coprocess.HookType_Post, obj.Name, mwDriver, obj.RawBodyOnly, nil})
+			gw.mwAppendEnabled(&chainArray, &CoProcessMiddleware{baseMid, coprocess.HookType_Post, obj.Name, mwDriver, obj.RawBodyOnly, obj.BodyMode, nil})
 		} else {
 			chainArray = append(chainArray, gw.createDynamicMiddleware(obj.Name, false, obj.RequireSession, baseMid))
 		}
 	}
 
+	// Transcode last, so that the rest of the chain deals with the JSON request
+	gw.mwAppendEnabled(&chainArray, &GRPCTranscodingMiddleware{BaseMiddleware: baseMid})
+
 	chain = alice.New(chainArray...).Then(&DummyProxyHandler{SH: SuccessHandler{baseMid}, Gw: gw})
 
 	if !spec.UseKeylessAccess {
@@ -490,16 +544,17 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 		rateLimitPath := path.Join(spec.Proxy.ListenPath, rateLimitEndpoint)
 		logger.Debug("Rate limit endpoint is: ", rateLimitPath)
 
-		chainDef.RateLimitChain = alice.New(simpleArray...).
-			Then(http.HandlerFunc(userRatesCheck))
+		chainDef.RateLimitChain = newSwappableHandler(alice.New(simpleArray...).
+			Then(http.HandlerFunc(userRatesCheck)))
 	}
 
 	logger.Debug("Setting Listen Path: ", spec.Proxy.ListenPath)
 
+	// bundle reloads swap the chain of the API without touching the routes
 	if trace.IsEnabled() {
-		chainDef.ThisHandler = trace.Handle(spec.Name, chain)
+		chainDef.ThisHandler = newSwappableHandler(trace.Handle(spec.Name, chain))
 	} else {
-		chainDef.ThisHandler = chain
+		chainDef.ThisHandler = newSwappableHandler(chain)
 	}
 
 	if spec.APIDefinition.AnalyticsPlugin.Enabled {
@@ -507,6 +562,8 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 		ap := &GoAnalyticsPlugin{
 			Path:     spec.AnalyticsPlugin.PluginPath,
 			FuncName: spec.AnalyticsPlugin.FuncName,
+			Spec:     spec,
+			Gw:       gw,
 		}
 
 		if ap.loadAnalyticsPlugin() {
@@ -0,0 +1,613 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	defaultAuditLogPath       = "tyk-audit.log"
+	defaultAuditLogMaxSize    = 100
+	defaultAuditLogMaxBackups = 10
+
+	// auditBodyLimit is the size of the responses read to find the target and the result of a change.
+	auditBodyLimit = 1 << 20
+
+	auditRedacted = "[redacted]"
+)
+
+// auditSecretFields are redacted from the recorded changes, along with the fields named after a secret or a password.
+var auditSecretFields = map[string]bool{
+	"hmac_string":   true,
+	"private_key":   true,
+	"access_token":  true,
+	"refresh_token": true,
+}
+
+// auditUntracked are the control API routes which don't change anything.
+var auditUntracked = map[string]bool{
+	"/debug":        true,
+	"/keys/preview": true,
+}
+
+// auditActor identifies who made a change, with all the credentials sent along with the request.
+type auditActor struct {
+	// User is the Dashboard user named by the user header.
+	User string `json:"user,omitempty"`
+	// Certificate is the SHA256 of the client certificate.
+	Certificate string `json:"certificate,omitempty"`
+	// Credential is the name of the control API credential, empty for the secret.
+	Credential string `json:"credential,omitempty"`
+	// Secret is a fingerprint of the control API secret or credential token.
+	Secret string `json:"secret,omitempty"`
+}
+
+type auditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+type auditResult struct {
+	Status  int    `json:"status"`
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+}
+
+// auditRecord is a change made through the control API. Its hash is the SHA256 of the hash of the previous record
+// followed by the record without its hash, so a record can't be altered or removed without breaking the chain.
+type auditRecord struct {
+	Time     time.Time              `json:"time"`
+	NodeID   string                 `json:"node_id"`
+	Actor    auditActor             `json:"actor"`
+	Action   string                 `json:"action"`
+	Target   string                 `json:"target,omitempty"`
+	Changes  map[string]auditChange `json:"changes,omitempty"`
+	SourceIP string                 `json:"source_ip"`
+	Result   auditResult            `json:"result"`
+	PrevHash string                 `json:"prev_hash"`
+	Hash     string                 `json:"hash,omitempty"`
+}
+
+// chain links the record to the previous record and returns its JSON line.
+func (rec *auditRecord) chain(prevHash string) ([]byte, error) {
+	rec.PrevHash = prevHash
+	rec.Hash = ""
+	unhashed, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(prevHash))
+	h.Write(unhashed)
+	rec.Hash = hex.EncodeToString(h.Sum(nil))
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// auditLog writes the audit records to a file rotated by size, and to a Redis stream.
+type auditLog struct {
+	conf   config.AuditLogConfig
+	stream *storage.RedisCluster
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	lastHash string
+}
+
+func newAuditLog(conf config.AuditLogConfig, controller *storage.RedisController) (*auditLog, error) {
+	if conf.Path == "" {
+		conf.Path = defaultAuditLogPath
+	}
+	if conf.MaxSize <= 0 {
+		conf.MaxSize = defaultAuditLogMaxSize
+	}
+	if conf.MaxBackups <= 0 {
+		conf.MaxBackups = defaultAuditLogMaxBackups
+	}
+	if conf.UserHeader == "" {
+		conf.UserHeader = header.XTykDashboardUser
+	}
+
+	a := &auditLog{conf: conf}
+	if conf.RedisStream != "" {
+		a.stream = &storage.RedisCluster{RedisController: controller}
+	}
+
+	// the chain continues from the last record, which is in the rotated file if the gateway stopped right after
+	// a rotation
+	for _, path := range []string{conf.Path, conf.Path + ".1"} {
+		if a.lastHash = auditLastHash(path); a.lastHash != "" {
+			break
+		}
+	}
+
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// auditLastHash returns the hash of the last record of an audit log file, or an empty string if it has none.
+func auditLastHash(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var last []byte
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			last = line
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	var rec struct {
+		Hash string `json:"hash"`
+	}
+	json.Unmarshal(last, &rec)
+	return rec.Hash
+}
+
+func (a *auditLog) open() error {
+	f, err := os.OpenFile(a.conf.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	a.file, a.size = f, info.Size()
+	return nil
+}
+
+// rotate renames the file with the .1 suffix, shifting the suffixes of the older files up to the maximum backups.
+func (a *auditLog) rotate() error {
+	a.file.Close()
+
+	os.Remove(fmt.Sprintf("%s.%d", a.conf.Path, a.conf.MaxBackups))
+	for i := a.conf.MaxBackups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", a.conf.Path, i), fmt.Sprintf("%s.%d", a.conf.Path, i+1))
+	}
+	if err := os.Rename(a.conf.Path, a.conf.Path+".1"); err != nil {
+		log.WithError(err).Error("Couldn't rotate the audit log")
+	}
+
+	return a.open()
+}
+
+func (a *auditLog) write(rec *auditRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	line, err := rec.chain(a.lastHash)
+	if err != nil {
+		return err
+	}
+
+	if a.size > 0 && a.size+int64(len(line)) > a.conf.MaxSize<<20 {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		return err
+	}
+	a.lastHash = rec.Hash
+
+	if a.stream != nil {
+		value := map[string]interface{}{"record": string(bytes.TrimSpace(line))}
+		if err := a.stream.AddToStream(a.conf.RedisStream, value, a.conf.RedisStreamMaxLen); err != nil {
+			log.WithError(err).Error("Couldn't add the audit record to the Redis stream")
+		}
+	}
+
+	return nil
+}
+
+func (a *auditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.file.Close()
+}
+
+func (a *auditLog) actor(r *http.Request) auditActor {
+	actor := auditActor{User: r.Header.Get(a.conf.UserHeader)}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		actor.Certificate = certs.HexSHA256(r.TLS.PeerCertificates[0].Raw)
+	}
+	if secret := r.Header.Get(header.XTykAuthorization); secret != "" {
+		sum := sha256.Sum256([]byte(secret))
+		actor.Secret = hex.EncodeToString(sum[:8])
+	}
+	if credential := ctxGetControlAPICredential(r); credential != nil {
+		actor.Credential = credential.Name
+	}
+	return actor
+}
+
+func (a *auditLog) isSecret(field string) bool {
+	name := strings.ToLower(field)
+	if strings.Contains(name, "secret") || strings.Contains(name, "password") || auditSecretFields[name] {
+		return true
+	}
+	for _, redacted := range a.conf.RedactFields {
+		if field == redacted {
+			return true
+		}
+	}
+	return false
+}
+
+// redact replaces the values of the secret fields of a JSON value.
+func (a *auditLog) redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for field, fieldValue := range v {
+			if a.isSecret(field) {
+				redacted[field] = redactSecret(fieldValue)
+			} else {
+				redacted[field] = a.redact(fieldValue)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i := range v {
+			redacted[i] = a.redact(v[i])
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// redactSecret hides a secret, unless it's empty so that setting and clearing secrets can be told apart.
+func redactSecret(value interface{}) interface{} {
+	if value == nil || value == "" {
+		return value
+	}
+	return auditRedacted
+}
+
+// changes returns the redacted top level fields which differ between two JSON objects.
+func (a *auditLog) changes(before, after map[string]interface{}) map[string]auditChange {
+	changes := map[string]auditChange{}
+	for field, value := range before {
+		if !reflect.DeepEqual(value, after[field]) {
+			changes[field] = auditChange{Before: value, After: after[field]}
+		}
+	}
+	for field, value := range after {
+		if _, ok := before[field]; !ok {
+			changes[field] = auditChange{After: value}
+		}
+	}
+
+	for field, change := range changes {
+		if a.isSecret(field) {
+			change.Before, change.After = redactSecret(change.Before), redactSecret(change.After)
+		} else {
+			change.Before, change.After = a.redact(change.Before), a.redact(change.After)
+		}
+		changes[field] = change
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+// auditResponseWriter keeps the status and the beginning of the body of a response, it discards the response when
+// it doesn't wrap a ResponseWriter.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditResponseWriter) Header() http.Header {
+	if w.ResponseWriter != nil {
+		return w.ResponseWriter.Header()
+	}
+	if w.header == nil {
+		w.header = http.Header{}
+	}
+	return w.header
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	if w.ResponseWriter != nil {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if remaining := auditBodyLimit - w.body.Len(); remaining > 0 {
+		if len(b) < remaining {
+			remaining = len(b)
+		}
+		w.body.Write(b[:remaining])
+	}
+	if w.ResponseWriter != nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return len(b), nil
+}
+
+// auditJSONObject decodes a JSON object, it returns nil if the data isn't a JSON object.
+func auditJSONObject(data []byte) map[string]interface{} {
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil
+	}
+	return object
+}
+
+// auditTemplateSegments splits a route template into its path segments, the patterns of the variables can contain
+// slashes.
+func auditTemplateSegments(template string) []string {
+	var (
+		segments []string
+		depth    int
+		start    int
+	)
+	template = strings.Trim(template, "/")
+	for i, c := range template {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '/':
+			if depth == 0 {
+				segments = append(segments, template[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segments, template[start:])
+}
+
+// auditTemplateVars returns the names of the variables of a route template, in order.
+func auditTemplateVars(template string) []string {
+	var names []string
+	for _, segment := range auditTemplateSegments(template) {
+		if !strings.HasPrefix(segment, "{") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}")
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			name = name[:i]
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// auditAction names the action of a route, from its static path segments: "/apis/{apiID}" with PUT is
+// "apis.update", while "/keys/{keyName}/rotate" is "keys.rotate".
+func auditAction(method, template string) string {
+	var segments []string
+	lastIsVar := false
+	for _, segment := range auditTemplateSegments(template) {
+		if lastIsVar = strings.HasPrefix(segment, "{"); !lastIsVar {
+			segments = append(segments, segment)
+		}
+	}
+	action := strings.Join(segments, ".")
+
+	if method == http.MethodGet || (len(segments) > 1 && !lastIsVar) {
+		return action
+	}
+
+	switch method {
+	case http.MethodPost:
+		return action + ".create"
+	case http.MethodPut, http.MethodPatch:
+		return action + ".update"
+	case http.MethodDelete:
+		return action + ".delete"
+	}
+	return action
+}
+
+// auditKeyID returns the hash of a key, so that the audit log doesn't leak keys.
+func auditKeyID(r *http.Request, key string) string {
+	if r.URL.Query().Get("hashed") != "" {
+		return key
+	}
+	return storage.HashKey(key, true)
+}
+
+// auditTarget returns the IDs of the target of a request, from the variables of its route.
+func auditTarget(r *http.Request, template string) string {
+	vars := mux.Vars(r)
+	var ids []string
+	for _, name := range auditTemplateVars(template) {
+		id := vars[name]
+		if id == "" {
+			continue
+		}
+		if name == "keyName" && strings.HasPrefix(template, "/keys") {
+			id = auditKeyID(r, id)
+		}
+		ids = append(ids, id)
+	}
+	return strings.Join(ids, "/")
+}
+
+// auditResponseTarget returns the ID of the target created by a request, from its response.
+func auditResponseTarget(r *http.Request, template string, body []byte) string {
+	var response struct {
+		Key      string `json:"key"`
+		KeyHash  string `json:"key_hash"`
+		ClientID string `json:"client_id"`
+		ID       string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return ""
+	}
+
+	switch {
+	case response.KeyHash != "":
+		return response.KeyHash
+	case response.Key != "" && strings.HasPrefix(template, "/keys"):
+		return auditKeyID(r, response.Key)
+	case response.Key != "":
+		return response.Key
+	case response.ClientID != "":
+		return response.ClientID
+	}
+	return response.ID
+}
+
+// isAuditedRequest tells if a control API request changes the gateway, either through a write method or a reload.
+func isAuditedRequest(r *http.Request, template string) bool {
+	if auditUntracked[template] {
+		return false
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return strings.HasPrefix(template, "/reload")
+	case http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// auditSnapshot reads the target of a request with a GET request on the same path through the router, it returns
+// nil when the target doesn't exist or isn't a JSON object.
+func auditSnapshot(router http.Handler, r *http.Request, template string) map[string]interface{} {
+	if !strings.HasSuffix(template, "}") {
+		return nil
+	}
+
+	req := r.Clone(r.Context())
+	req.Method = http.MethodGet
+	req.Body = http.NoBody
+	req.ContentLength = 0
+	// the state is read whatever the scopes of the credential, it only ends up in the audit log
+	ctxSetControlAPICredential(req, nil)
+
+	rw := &auditResponseWriter{}
+	router.ServeHTTP(rw, req)
+	if rw.status != http.StatusOK {
+		return nil
+	}
+	return auditJSONObject(rw.body.Bytes())
+}
+
+// auditControlAPI records the changes made through the control API in the audit log. The state of the target
+// before the change is read through the router, and compared with the request body.
+func (gw *Gateway) auditControlAPI(router http.Handler) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			audit := gw.auditLog
+			if audit == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			template, _ := mux.CurrentRoute(r).GetPathTemplate()
+			if !isAuditedRequest(r, template) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &auditRecord{
+				Time:     time.Now().UTC(),
+				NodeID:   gw.GetNodeID(),
+				Actor:    audit.actor(r),
+				Action:   auditAction(r.Method, template),
+				Target:   auditTarget(r, template),
+				SourceIP: request.RealIP(r),
+			}
+
+			var before map[string]interface{}
+			if r.Method != http.MethodGet {
+				before = auditSnapshot(router, r, template)
+			}
+
+			var body []byte
+			if r.Body != nil {
+				body, _ = io.ReadAll(r.Body)
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			rw := &auditResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(rw, r)
+			if rw.status == 0 {
+				rw.status = http.StatusOK
+			}
+
+			rec.Result = auditResult{Status: rw.status, Success: rw.status < http.StatusBadRequest}
+			if rec.Target == "" {
+				rec.Target = auditResponseTarget(r, template, rw.body.Bytes())
+			}
+
+			if rec.Result.Success {
+				var after map[string]interface{}
+				if r.Method != http.MethodDelete {
+					after = auditJSONObject(body)
+				}
+				rec.Changes = audit.changes(before, after)
+			} else {
+				var msg apiStatusMessage
+				json.Unmarshal(rw.body.Bytes(), &msg)
+				rec.Result.Message = msg.Message
+			}
+
+			if err := audit.write(rec); err != nil {
+				log.WithError(err).Error("Couldn't write the audit record")
+			}
+		})
+	}
+}
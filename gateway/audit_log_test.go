@@ -0,0 +1,252 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/internal/uuid"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+// readAuditRecords reads the records of audit log lines, and checks that they are chained.
+func readAuditRecords(t *testing.T, prevHash string, lines ...string) []auditRecord {
+	t.Helper()
+
+	var records []auditRecord
+	for i, line := range lines {
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.UseNumber()
+
+		var rec auditRecord
+		require.NoError(t, dec.Decode(&rec))
+		hash := rec.Hash
+
+		_, err := rec.chain(prevHash)
+		require.NoError(t, err)
+		require.Equal(t, hash, rec.Hash, "record %d isn't chained", i)
+
+		records = append(records, rec)
+		prevHash = hash
+	}
+	return records
+}
+
+func readAuditLines(t *testing.T, path string) []string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 4<<20)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	stream := "audit-" + uuid.New()
+
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.AuditLog = config.AuditLogConfig{
+			Enabled:     true,
+			Path:        path,
+			RedisStream: stream,
+		}
+	})
+	defer ts.Close()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "audit"
+		spec.UseKeylessAccess = false
+	})
+
+	user := map[string]string{header.XTykDashboardUser: "alice@example.com"}
+	session := bulkKeySession("audit")
+	session.HmacSecret = "hmac-secret"
+
+	resp, err := ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/keys/create", Data: session, Headers: user, AdminAuth: true, Code: http.StatusOK})
+	require.NoError(t, err)
+	var created apiModifyKeySuccess
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	keyID := storage.HashKey(created.Key, true)
+
+	session.Alias = "audited"
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodPut, Path: "/tyk/keys/" + created.Key, Data: session, AdminAuth: true, Code: http.StatusOK},
+		{Method: http.MethodGet, Path: "/tyk/keys/" + created.Key, AdminAuth: true, Code: http.StatusOK},
+		{Method: http.MethodDelete, Path: "/tyk/keys/" + created.Key, AdminAuth: true, Code: http.StatusOK},
+		{Method: http.MethodDelete, Path: "/tyk/keys/" + created.Key, AdminAuth: true, Code: http.StatusNotFound},
+		{Method: http.MethodGet, Path: "/tyk/reload", AdminAuth: true, Code: http.StatusOK},
+		{Method: http.MethodPost, Path: "/tyk/keys/preview", Data: session, AdminAuth: true},
+	}...)
+
+	lines := readAuditLines(t, path)
+	records := readAuditRecords(t, "", lines...)
+	require.Len(t, records, 5)
+
+	var actions []string
+	for _, rec := range records {
+		actions = append(actions, rec.Action)
+		assert.Equal(t, ts.Gw.GetNodeID(), rec.NodeID)
+		assert.NotEmpty(t, rec.Actor.Secret)
+		assert.NotContains(t, rec.Actor.Secret, ts.Gw.GetConfig().Secret)
+	}
+	assert.Equal(t, []string{"keys.create", "keys.update", "keys.delete", "keys.delete", "reload"}, actions)
+
+	t.Run("create", func(t *testing.T) {
+		rec := records[0]
+		assert.Equal(t, "alice@example.com", rec.Actor.User)
+		assert.Equal(t, keyID, rec.Target)
+		assert.Equal(t, auditResult{Status: http.StatusOK, Success: true}, rec.Result)
+		assert.Nil(t, rec.Changes["hmac_string"].Before)
+		assert.Equal(t, auditRedacted, rec.Changes["hmac_string"].After)
+		assert.NotContains(t, lines[0], "hmac-secret")
+		assert.NotContains(t, lines[0], created.Key)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		rec := records[1]
+		assert.Empty(t, rec.Actor.User)
+		assert.Equal(t, keyID, rec.Target)
+		assert.Equal(t, auditChange{Before: "", After: "audited"}, rec.Changes["alias"])
+		assert.NotContains(t, rec.Changes, "hmac_string")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Equal(t, "audited", records[2].Changes["alias"].Before)
+		assert.Nil(t, records[2].Changes["alias"].After)
+
+		assert.Equal(t, auditResult{Status: http.StatusNotFound, Message: "There is no such key found"}, records[3].Result)
+		assert.Nil(t, records[3].Changes)
+	})
+
+	t.Run("redis stream", func(t *testing.T) {
+		store := &storage.RedisCluster{RedisController: ts.Gw.RedisController}
+		defer store.DeleteRawKey(stream)
+
+		entries, err := store.GetStreamRange(stream, "-", "+", 10)
+		require.NoError(t, err)
+		require.Len(t, entries, len(lines))
+		for i, entry := range entries {
+			assert.Equal(t, lines[i], entry["record"])
+		}
+	})
+}
+
+func TestAuditLog_Chain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	conf := config.AuditLogConfig{Path: path, MaxSize: 1, MaxBackups: 1}
+
+	audit, err := newAuditLog(conf, nil)
+	require.NoError(t, err)
+
+	// each record takes more than half of the maximum size, so the file is rotated before the second one
+	large := strings.Repeat("a", 600<<10)
+	require.NoError(t, audit.write(&auditRecord{Action: "apis.create", Target: "1", Changes: map[string]auditChange{"name": {After: large}}}))
+	require.NoError(t, audit.write(&auditRecord{Action: "apis.update", Target: "1", Changes: map[string]auditChange{"name": {Before: large}}}))
+	require.NoError(t, audit.Close())
+
+	// the chain continues after a restart
+	audit, err = newAuditLog(conf, nil)
+	require.NoError(t, err)
+	require.NoError(t, audit.write(&auditRecord{Action: "apis.delete", Target: "1"}))
+	require.NoError(t, audit.Close())
+
+	rotated, current := readAuditLines(t, path+".1"), readAuditLines(t, path)
+	require.Len(t, rotated, 1)
+	require.Len(t, current, 2)
+	records := readAuditRecords(t, "", append(rotated, current...)...)
+	assert.Equal(t, "apis.delete", records[2].Action)
+
+	t.Run("tampering breaks the chain", func(t *testing.T) {
+		lines := append(rotated, current...)
+		tampered := strings.Replace(lines[1], `"target":"1"`, `"target":"2"`, 1)
+		require.NotEqual(t, lines[1], tampered)
+
+		var rec auditRecord
+		require.NoError(t, json.Unmarshal([]byte(tampered), &rec))
+		hash := rec.Hash
+		_, err := rec.chain(records[0].Hash)
+		require.NoError(t, err)
+		assert.NotEqual(t, hash, rec.Hash)
+
+		// removing a record breaks the chain too
+		assert.NotEqual(t, records[0].Hash, records[2].PrevHash)
+	})
+}
+
+func TestAuditLog_Changes(t *testing.T) {
+	audit := &auditLog{conf: config.AuditLogConfig{RedactFields: []string{"internal"}}}
+
+	before := map[string]interface{}{
+		"name":            "before",
+		"same":            1.0,
+		"basic_auth_data": map[string]interface{}{"password": "old", "hash_type": "bcrypt"},
+		"jwt_secret":      "",
+		"internal":        "a",
+	}
+	after := map[string]interface{}{
+		"name":            "after",
+		"same":            1.0,
+		"basic_auth_data": map[string]interface{}{"password": "new", "hash_type": "bcrypt"},
+		"jwt_secret":      "set",
+		"internal":        "b",
+		"added":           []interface{}{map[string]interface{}{"client_secret": "x"}},
+	}
+
+	changes := audit.changes(before, after)
+	asJSON, _ := json.Marshal(changes)
+	assert.False(t, bytes.Contains(asJSON, []byte("old")) || bytes.Contains(asJSON, []byte("new")) || bytes.Contains(asJSON, []byte(`"x"`)))
+
+	assert.Equal(t, map[string]auditChange{
+		"name": {Before: "before", After: "after"},
+		"basic_auth_data": {
+			Before: map[string]interface{}{"password": auditRedacted, "hash_type": "bcrypt"},
+			After:  map[string]interface{}{"password": auditRedacted, "hash_type": "bcrypt"},
+		},
+		"jwt_secret": {Before: "", After: auditRedacted},
+		"internal":   {Before: auditRedacted, After: auditRedacted},
+		"added":      {After: []interface{}{map[string]interface{}{"client_secret": auditRedacted}}},
+	}, changes)
+
+	assert.Nil(t, audit.changes(before, before))
+}
+
+func TestAuditAction(t *testing.T) {
+	tests := []struct {
+		method, template, action string
+	}{
+		{http.MethodPost, "/keys/create", "keys.create"},
+		{http.MethodPost, "/keys/{keyName:[^/]*}", "keys.create"},
+		{http.MethodPut, "/keys/{keyName:[^/]*}", "keys.update"},
+		{http.MethodPost, "/keys/{keyName}/rotate", "keys.rotate"},
+		{http.MethodPost, "/apis", "apis.create"},
+		{http.MethodPatch, "/apis/oas/{apiID}", "apis.oas.update"},
+		{http.MethodDelete, "/oauth/clients/{apiID}/{keyName:[^/]*}", "oauth.clients.delete"},
+		{http.MethodPut, "/oauth/clients/{apiID}/{keyName:[^/]*}/rotate", "oauth.clients.rotate"},
+		{http.MethodGet, "/reload", "reload"},
+		{http.MethodGet, "/reload/group", "reload.group"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.action, auditAction(tc.method, tc.template), tc.template)
+	}
+}
@@ -25,13 +25,33 @@ type SessionHandler interface {
 	KeyExpired(newSession *user.SessionState) bool
 	Sessions(filter string) []string
 	ResetQuota(string, *user.SessionState, bool)
+	SessionDetails(keyIDs []string) map[string]*user.SessionState
+	UpdateSessions(updates []sessionUpdate, rawKeys []string) error
 	Stop()
 }
 
+// sessionUpdate is the change of a hashed key in a batch, a nil session removes the key.
+type sessionUpdate struct {
+	KeyID      string
+	OrgID      string
+	Session    *user.SessionState
+	ResetTTLTo int64
+}
+
+// rawKeysBatcher is implemented by the stores which read and write many raw keys in a single pipeline.
+type rawKeysBatcher interface {
+	GetRawMultiKey(keys []string) ([]string, error)
+	SetRawKeys(keys, values []string, timeouts []int64) error
+	DeleteRawKeys(keys []string) error
+}
+
 type DefaultSessionManager struct {
 	store storage.Handler
 	orgID string
 	Gw    *Gateway `json:"-"`
+
+	// index is the key index of the global session manager, updated on every key write.
+	index *keyIndex
 }
 
 func (b *DefaultSessionManager) ResetQuotaObfuscateKey(keyName string) string {
@@ -102,6 +122,23 @@ func (b *DefaultSessionManager) clearCacheForKey(keyName string, hashed bool) {
 	b.Gw.MainNotifier.Notify(n)
 }
 
+// clearCacheForKeys removes hashed keys from the session cache of the gateways with a single notification.
+func (b *DefaultSessionManager) clearCacheForKeys(keyIDs []string) {
+	if len(keyIDs) == 0 {
+		return
+	}
+
+	for _, keyID := range keyIDs {
+		b.Gw.SessionCache.Delete(keyID)
+	}
+
+	b.Gw.MainNotifier.Notify(Notification{
+		Command: KeySpaceUpdateNotification,
+		Payload: strings.Join(keyIDs, ","),
+		Gw:      b.Gw,
+	})
+}
+
 // UpdateSession updates the session state in the storage engine
 func (b *DefaultSessionManager) UpdateSession(keyName string, session *user.SessionState,
 	resetTTLTo int64, hashed bool) error {
@@ -115,12 +152,19 @@ func (b *DefaultSessionManager) UpdateSession(keyName string, session *user.Sess
 
 	// sync update
 	if hashed {
-		keyName = b.store.GetKeyPrefix() + keyName
-		err = b.store.SetRawKey(keyName, string(v), resetTTLTo)
+		err = b.store.SetRawKey(b.store.GetKeyPrefix()+keyName, string(v), resetTTLTo)
 	} else {
 		err = b.store.SetKey(keyName, string(v), resetTTLTo)
 	}
 
+	if err == nil && b.index != nil {
+		keyID := keyName
+		if !hashed {
+			keyID = storage.HashKey(keyName, b.Gw.GetConfig().HashKeys)
+		}
+		b.index.update(keyID, session)
+	}
+
 	return err
 }
 
@@ -129,8 +173,17 @@ func (b *DefaultSessionManager) RemoveSession(orgID string, keyName string, hash
 	defer b.clearCacheForKey(keyName, hashed)
 
 	if hashed {
+		if b.index != nil {
+			b.index.remove(keyName)
+		}
 		return b.store.DeleteRawKey(b.store.GetKeyPrefix() + keyName)
 	} else {
+		if b.index != nil {
+			hashKeys := b.Gw.GetConfig().HashKeys
+			b.index.remove(storage.HashKey(keyName, hashKeys))
+			b.index.remove(storage.HashKey(b.Gw.generateToken(orgID, keyName), hashKeys))
+		}
+
 		// support both old and new key hashing
 		res1 := b.store.DeleteKey(keyName)
 		res2 := b.store.DeleteKey(b.Gw.generateToken(orgID, keyName))
@@ -196,6 +249,106 @@ func (b *DefaultSessionManager) SessionDetail(orgID string, keyName string, hash
 	return session.Clone(), true
 }
 
+// SessionDetails returns the sessions of hashed keys, the keys not found are left out. The keys are read at once
+// when the store supports it.
+func (b *DefaultSessionManager) SessionDetails(keyIDs []string) map[string]*user.SessionState {
+	sessions := make(map[string]*user.SessionState, len(keyIDs))
+	if len(keyIDs) == 0 {
+		return sessions
+	}
+
+	batcher, ok := b.store.(rawKeysBatcher)
+	if !ok {
+		for _, keyID := range keyIDs {
+			if session, found := b.SessionDetail("", keyID, true); found {
+				sessions[keyID] = &session
+			}
+		}
+		return sessions
+	}
+
+	rawKeys := make([]string, len(keyIDs))
+	for i, keyID := range keyIDs {
+		rawKeys[i] = b.store.GetKeyPrefix() + keyID
+	}
+	values, _ := batcher.GetRawMultiKey(rawKeys)
+	for i, value := range values {
+		if value == "" {
+			continue
+		}
+		session := &user.SessionState{}
+		if err := json.Unmarshal([]byte(value), session); err != nil {
+			log.Error("Couldn't unmarshal session object (may be cache miss): ", err)
+			continue
+		}
+		session.KeyID = keyIDs[i]
+		sessions[keyIDs[i]] = session
+	}
+	return sessions
+}
+
+// UpdateSessions deletes raw keys, the quota counters of the keys reset, then saves and removes the sessions of
+// hashed keys. The keys are written at once when the store supports it.
+func (b *DefaultSessionManager) UpdateSessions(updates []sessionUpdate, rawKeys []string) error {
+	batcher, ok := b.store.(rawKeysBatcher)
+	if !ok {
+		for _, rawKey := range rawKeys {
+			b.store.DeleteRawKey(rawKey)
+		}
+		for _, update := range updates {
+			if update.Session == nil {
+				b.RemoveSession(update.OrgID, update.KeyID, true)
+				continue
+			}
+			if err := b.UpdateSession(update.KeyID, update.Session, update.ResetTTLTo, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		setKeys, setValues []string
+		timeouts           []int64
+		keyIDs             = make([]string, 0, len(updates))
+	)
+	for _, update := range updates {
+		keyIDs = append(keyIDs, update.KeyID)
+		if update.Session == nil {
+			rawKeys = append(rawKeys, b.store.GetKeyPrefix()+update.KeyID)
+			continue
+		}
+
+		v, err := json.Marshal(update.Session)
+		if err != nil {
+			log.Error("Error marshalling session for sync update")
+			return err
+		}
+		setKeys = append(setKeys, b.store.GetKeyPrefix()+update.KeyID)
+		setValues = append(setValues, string(v))
+		timeouts = append(timeouts, update.ResetTTLTo)
+	}
+	defer b.clearCacheForKeys(keyIDs)
+
+	if err := batcher.DeleteRawKeys(rawKeys); err != nil {
+		return err
+	}
+	if err := batcher.SetRawKeys(setKeys, setValues, timeouts); err != nil {
+		return err
+	}
+
+	if b.index != nil {
+		for _, update := range updates {
+			if update.Session == nil {
+				b.index.remove(update.KeyID)
+			} else {
+				b.index.update(update.KeyID, update.Session)
+			}
+		}
+	}
+	return nil
+}
+
 func (b *DefaultSessionManager) Stop() {}
 
 // Sessions returns all sessions in the key store that match a filter key (a prefix)
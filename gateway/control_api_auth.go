@@ -0,0 +1,215 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/header"
+)
+
+const (
+	controlAPIRead   = "read"
+	controlAPIWrite  = "write"
+	controlAPIDelete = "delete"
+)
+
+var errControlAPIOrgScope = errors.New("not allowed for credentials scoped to organisations")
+
+// controlAPICredential returns the named credential authenticating a Control API request, with the token of its
+// header or the subject of its client certificate.
+func (gw *Gateway) controlAPICredential(r *http.Request) *config.ControlAPICredential {
+	conf := gw.GetConfig()
+	credentials := conf.Security.ControlAPICredentials
+
+	if token := r.Header.Get(header.XTykAuthorization); token != "" {
+		for i := range credentials {
+			if credentials[i].Token != "" && subtle.ConstantTimeCompare([]byte(credentials[i].Token), []byte(token)) == 1 {
+				return &credentials[i]
+			}
+		}
+		return nil
+	}
+
+	// the client certificate is only checked against the Control API certificates with mutual TLS
+	if !conf.Security.ControlAPIUseMutualTLS || r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	subject := r.TLS.PeerCertificates[0].Subject.CommonName
+	for i := range credentials {
+		if credentials[i].CertificateSubject != "" && credentials[i].CertificateSubject == subject {
+			return &credentials[i]
+		}
+	}
+	return nil
+}
+
+// controlAPIResource returns the resource type of a Control API route, the first segment of its path.
+func controlAPIResource(template string) string {
+	resource := strings.TrimPrefix(template, "/")
+	if i := strings.IndexByte(resource, '/'); i >= 0 {
+		resource = resource[:i]
+	}
+	return resource
+}
+
+// controlAPIVerb returns the verb of a Control API request, the reloads are writes despite their method.
+func controlAPIVerb(method, template string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		if controlAPIResource(template) == "reload" {
+			return controlAPIWrite
+		}
+		return controlAPIRead
+	case http.MethodDelete:
+		return controlAPIDelete
+	}
+	return controlAPIWrite
+}
+
+// controlAPIScope tells if a credential is allowed a verb on a resource, and returns the organisations it's limited
+// to, none if it isn't limited.
+func controlAPIScope(credential *config.ControlAPICredential, resource, verb string) (allowed bool, orgIDs []string) {
+	for _, scope := range credential.Scopes {
+		if scope.Resource != "*" && scope.Resource != resource {
+			continue
+		}
+		if len(scope.Verbs) > 0 && !contains(scope.Verbs, verb) {
+			continue
+		}
+
+		if len(scope.OrgIDs) == 0 {
+			return true, nil
+		}
+		allowed = true
+		orgIDs = append(orgIDs, scope.OrgIDs...)
+	}
+	return allowed, orgIDs
+}
+
+// controlAPIBodyOrg returns the organisation of the session or the org session in the body of a request.
+func controlAPIBodyOrg(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var session struct {
+		OrgID string `json:"org_id"`
+	}
+	json.Unmarshal(body, &session)
+	return session.OrgID
+}
+
+// controlAPIOrgs returns the organisations of the keys or the org keys a Control API request accesses, it fails for
+// the requests to other resources.
+func (gw *Gateway) controlAPIOrgs(r *http.Request, template string) ([]string, error) {
+	vars := mux.Vars(r)
+
+	switch controlAPIResource(template) {
+	case "org":
+		if vars["keyName"] == "" {
+			return nil, errControlAPIOrgScope
+		}
+		return []string{vars["keyName"]}, nil
+	case "keys":
+	default:
+		// the other resources can't be attributed to an organisation
+		return nil, errControlAPIOrgScope
+	}
+
+	switch template {
+	case "/keys/bulk", "/keys/index/rebuild":
+		return nil, errControlAPIOrgScope
+	case "/keys/create", "/keys/preview":
+		return []string{controlAPIBodyOrg(r)}, nil
+	}
+
+	keyName := vars["keyName"]
+	if keyName == "" {
+		if r.Method == http.MethodGet {
+			// keys are only listed by organisation from the key index
+			if !isKeyListRequest(r) || r.URL.Query().Get("org_id") == "" {
+				return nil, errors.New("credentials scoped to organisations must list keys with the org_id and limit parameters")
+			}
+			return []string{r.URL.Query().Get("org_id")}, nil
+		}
+		return []string{controlAPIBodyOrg(r)}, nil
+	}
+
+	var orgIDs []string
+	isHashed := r.URL.Query().Get("hashed") != ""
+	if session, found := gw.GlobalSessionManager.SessionDetail(r.URL.Query().Get("org_id"), keyName, isHashed); found {
+		orgIDs = append(orgIDs, session.OrgID)
+	}
+	// a key can't be moved to another organisation
+	if (r.Method == http.MethodPost || r.Method == http.MethodPut) && template == "/keys/{keyName:[^/]*}" {
+		orgIDs = append(orgIDs, controlAPIBodyOrg(r))
+	}
+	return orgIDs, nil
+}
+
+// authorizeControlAPI checks that the named credential of a Control API request is allowed to access its route.
+func (gw *Gateway) authorizeControlAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credential := ctxGetControlAPICredential(r)
+		if credential == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		template, _ := mux.CurrentRoute(r).GetPathTemplate()
+		resource, verb := controlAPIResource(template), controlAPIVerb(r.Method, template)
+		if err := gw.checkControlAPIScope(r, credential, resource, verb, template); err != nil {
+			log.WithField("credential", credential.Name).Warning("Control API access denied: ", err)
+			doJSONWrite(w, http.StatusForbidden, apiError(err.Error()))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (gw *Gateway) checkControlAPIScope(r *http.Request, credential *config.ControlAPICredential, resource, verb, template string) error {
+	allowed, orgIDs := controlAPIScope(credential, resource, verb)
+	if !allowed {
+		return fmt.Errorf("credential %s isn't allowed to %s %s", credential.Name, verb, resource)
+	}
+	if len(orgIDs) == 0 {
+		return nil
+	}
+
+	requested, err := gw.controlAPIOrgs(r, template)
+	if err != nil {
+		return err
+	}
+	for _, orgID := range requested {
+		if !contains(orgIDs, orgID) {
+			return fmt.Errorf("credential %s isn't allowed to %s %s of organisation %q", credential.Name, verb, resource, orgID)
+		}
+	}
+	return nil
+}
+
+// requireControlAPIScope checks that the named credential of a request is allowed a verb on a resource, for the
+// Control API endpoints served out of the Control API router.
+func (gw *Gateway) requireControlAPIScope(resource, verb string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if credential := ctxGetControlAPICredential(r); credential != nil {
+			if allowed, orgIDs := controlAPIScope(credential, resource, verb); !allowed || len(orgIDs) > 0 {
+				doJSONWrite(w, http.StatusForbidden, apiError(fmt.Sprintf("credential %s isn't allowed to %s %s", credential.Name, verb, resource)))
+				return
+			}
+		}
+		next(w, r)
+	}
+}
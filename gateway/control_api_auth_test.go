@@ -0,0 +1,149 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestControlAPICredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.AuditLog = config.AuditLogConfig{Enabled: true, Path: path}
+		globalConf.Security.ControlAPICredentials = []config.ControlAPICredential{
+			{
+				Name:   "read-only",
+				Token:  "read-only-token",
+				Scopes: []config.ControlAPIScope{{Resource: "*", Verbs: []string{controlAPIRead}}},
+			},
+			{
+				Name:   "reload-only",
+				Token:  "reload-only-token",
+				Scopes: []config.ControlAPIScope{{Resource: "reload"}},
+			},
+			{
+				Name:  "org-keys",
+				Token: "org-keys-token",
+				Scopes: []config.ControlAPIScope{
+					{Resource: "keys", OrgIDs: []string{"org-a"}},
+				},
+			},
+			{
+				Name:   "org-admin",
+				Token:  "org-admin-token",
+				Scopes: []config.ControlAPIScope{{Resource: "*", OrgIDs: []string{"org-a"}}},
+			},
+		}
+	})
+	defer ts.Close()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "scoped"
+		spec.UseKeylessAccess = false
+	})
+
+	as := func(token string) map[string]string {
+		return map[string]string{header.XTykAuthorization: token}
+	}
+	orgA, orgB := bulkKeySession("scoped"), bulkKeySession("scoped")
+	orgA.OrgID, orgB.OrgID = "org-a", "org-b"
+
+	resp, err := ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/keys/create", Data: orgB, AdminAuth: true, Code: http.StatusOK})
+	require.NoError(t, err)
+	var orgBKey apiModifyKeySuccess
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&orgBKey))
+
+	t.Run("unknown token", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{Path: "/tyk/apis", Headers: as("unknown"), Code: http.StatusForbidden})
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		_, _ = ts.Run(t, []test.TestCase{
+			{Path: "/tyk/apis", Headers: as("read-only-token"), Code: http.StatusOK},
+			{Path: "/tyk/keys/" + orgBKey.Key, Headers: as("read-only-token"), Code: http.StatusOK},
+			{Method: http.MethodPost, Path: "/tyk/keys/create", Data: orgA, Headers: as("read-only-token"), Code: http.StatusForbidden},
+			{Method: http.MethodDelete, Path: "/tyk/keys/" + orgBKey.Key, Headers: as("read-only-token"), Code: http.StatusForbidden},
+			{Path: "/tyk/reload", Headers: as("read-only-token"), Code: http.StatusForbidden},
+		}...)
+	})
+
+	t.Run("reload only", func(t *testing.T) {
+		_, _ = ts.Run(t, []test.TestCase{
+			{Path: "/tyk/reload", Headers: as("reload-only-token"), Code: http.StatusOK},
+			{Path: "/tyk/apis", Headers: as("reload-only-token"), Code: http.StatusForbidden},
+			{Method: http.MethodPost, Path: "/tyk/oauth/clients/create", Data: NewClientRequest{}, Headers: as("reload-only-token"), Code: http.StatusForbidden},
+		}...)
+	})
+
+	t.Run("keys of an organisation", func(t *testing.T) {
+		resp, err := ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/keys/create", Data: orgA, Headers: as("org-keys-token"), Code: http.StatusOK})
+		require.NoError(t, err)
+		var orgAKey apiModifyKeySuccess
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&orgAKey))
+
+		moved := *orgA
+		moved.OrgID = "org-b"
+		_, _ = ts.Run(t, []test.TestCase{
+			{Path: "/tyk/keys/" + orgAKey.Key, Headers: as("org-keys-token"), Code: http.StatusOK},
+			{Path: "/tyk/keys/" + orgBKey.Key, Headers: as("org-keys-token"), Code: http.StatusForbidden},
+			{Method: http.MethodPost, Path: "/tyk/keys/create", Data: orgB, Headers: as("org-keys-token"), Code: http.StatusForbidden},
+			{Method: http.MethodPut, Path: "/tyk/keys/" + orgAKey.Key, Data: &moved, Headers: as("org-keys-token"), Code: http.StatusForbidden},
+			{Method: http.MethodDelete, Path: "/tyk/keys/" + orgBKey.Key, Headers: as("org-keys-token"), Code: http.StatusForbidden},
+			{Method: http.MethodPost, Path: "/tyk/keys/bulk", Data: map[string]interface{}{}, Headers: as("org-keys-token"), Code: http.StatusForbidden},
+			{Path: "/tyk/keys", Headers: as("org-keys-token"), Code: http.StatusForbidden},
+			{Path: "/tyk/apis", Headers: as("org-keys-token"), Code: http.StatusForbidden},
+			{Method: http.MethodDelete, Path: "/tyk/keys/" + orgAKey.Key, Headers: as("org-keys-token"), Code: http.StatusOK},
+		}...)
+	})
+
+	t.Run("all resources of an organisation", func(t *testing.T) {
+		_, _ = ts.Run(t, []test.TestCase{
+			{Path: "/tyk/keys/" + orgBKey.Key, Headers: as("org-admin-token"), Code: http.StatusForbidden},
+			{Path: "/tyk/apis", Headers: as("org-admin-token"), Code: http.StatusForbidden},
+			{Path: "/tyk/apis/scoped", Headers: as("org-admin-token"), Code: http.StatusForbidden},
+			{Path: "/tyk/policies", Headers: as("org-admin-token"), Code: http.StatusForbidden},
+			{Path: "/tyk/certs", Headers: as("org-admin-token"), Code: http.StatusForbidden},
+		}...)
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		records := readAuditRecords(t, "", readAuditLines(t, path)...)
+		credentials := map[string]int{}
+		for _, rec := range records {
+			credentials[rec.Actor.Credential]++
+		}
+		// the secret, then the denied changes and the changes allowed to the credentials
+		assert.Equal(t, map[string]int{"": 1, "read-only": 3, "reload-only": 2, "org-keys": 6}, credentials)
+
+		last := records[len(records)-1]
+		assert.Equal(t, "org-keys", last.Actor.Credential)
+		assert.Equal(t, "keys.delete", last.Action)
+		assert.Equal(t, "org-a", last.Changes["org_id"].Before)
+	})
+}
+
+func TestControlAPIVerb(t *testing.T) {
+	tests := []struct {
+		method, template, resource, verb string
+	}{
+		{http.MethodGet, "/keys/{keyName:[^/]*}", "keys", controlAPIRead},
+		{http.MethodPost, "/keys/create", "keys", controlAPIWrite},
+		{http.MethodDelete, "/apis/{apiID}", "apis", controlAPIDelete},
+		{http.MethodGet, "/reload/group", "reload", controlAPIWrite},
+		{http.MethodPatch, "/apis/oas/{apiID}", "apis", controlAPIWrite},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.resource, controlAPIResource(tc.template), tc.template)
+		assert.Equal(t, tc.verb, controlAPIVerb(tc.method, tc.template), tc.template)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/url"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"time"
@@ -14,16 +15,18 @@ import (
 	"github.com/TykTechnologies/tyk-pump/analytics"
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/coprocess"
+	"github.com/TykTechnologies/tyk/header"
 	"github.com/TykTechnologies/tyk/user"
 
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 )
 
 var (
-	supportedDrivers = []apidef.MiddlewareDriver{apidef.PythonDriver, apidef.LuaDriver, apidef.GrpcDriver}
+	supportedDrivers = []apidef.MiddlewareDriver{apidef.PythonDriver, apidef.LuaDriver, apidef.GrpcDriver, apidef.WASMDriver}
 	loadedDrivers    = map[apidef.MiddlewareDriver]coprocess.Dispatcher{}
 )
 
@@ -34,6 +37,7 @@ type CoProcessMiddleware struct {
 	HookName         string
 	MiddlewareDriver apidef.MiddlewareDriver
 	RawBodyOnly      bool
+	BodyMode         apidef.PluginBodyMode
 
 	successHandler *SuccessHandler
 }
@@ -101,7 +105,7 @@ func (c *CoProcessor) BuildObject(req *http.Request, res *http.Response, spec *A
 		Scheme:     scheme,
 	}
 
-	if req.Body != nil {
+	if req.Body != nil && c.Middleware.copiesRequestBody() {
 		defer req.Body.Close()
 		var err error
 		miniRequestObject.RawBody, err = ioutil.ReadAll(req.Body)
@@ -132,10 +136,8 @@ func (c *CoProcessor) BuildObject(req *http.Request, res *http.Response, spec *A
 			}
 		}
 
-		bundleHash, err := c.Middleware.Gw.getHashedBundleName(spec.CustomMiddlewareBundle)
-		if err != nil {
-			return nil, err
-		}
+		// the directory of the loaded bundle, bundle reloads load it side by side with the previous one
+		bundleHash := filepath.Base(c.Middleware.Gw.getBundleDestPath(spec))
 
 		object.Spec = map[string]string{
 			"OrgID":       c.Middleware.Spec.OrgID,
@@ -146,6 +148,13 @@ func (c *CoProcessor) BuildObject(req *http.Request, res *http.Response, spec *A
 		if shouldAddConfigData(c.Middleware.Spec) {
 			object.Spec["config_data"] = string(configDataAsJSON)
 		}
+
+		// WebAssembly plugins read context variables through the host functions
+		if c.Middleware.MiddlewareDriver == apidef.WASMDriver && c.Middleware.Spec.EnableContextVars {
+			if contextVars, err := json.Marshal(ctxGetData(req)); err == nil {
+				object.Spec[wasmContextVarsKey] = string(contextVars)
+			}
+		}
 	}
 
 	// Encode the session object (if not a pre-process & not a custom key check):
@@ -174,14 +183,16 @@ func (c *CoProcessor) BuildObject(req *http.Request, res *http.Response, spec *A
 			resObj.MultivalueHeaders = append(resObj.MultivalueHeaders, &currentHeader)
 		}
 		resObj.StatusCode = int32(res.StatusCode)
-		rawBody, err := ioutil.ReadAll(res.Body)
-		if err != nil {
-			return nil, err
-		}
-		resObj.RawBody = rawBody
-		res.Body = ioutil.NopCloser(bytes.NewReader(rawBody))
-		if utf8.Valid(rawBody) && !c.Middleware.RawBodyOnly {
-			resObj.Body = string(rawBody)
+		if c.Middleware.BodyMode == apidef.BufferedBody {
+			rawBody, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				return nil, err
+			}
+			resObj.RawBody = rawBody
+			res.Body = ioutil.NopCloser(bytes.NewReader(rawBody))
+			if utf8.Valid(rawBody) && !c.Middleware.RawBodyOnly {
+				resObj.Body = string(rawBody)
+			}
 		}
 		object.Response = resObj
 	}
@@ -191,9 +202,11 @@ func (c *CoProcessor) BuildObject(req *http.Request, res *http.Response, spec *A
 
 // ObjectPostProcess does CoProcessObject post-processing (adding/removing headers or params, etc.).
 func (c *CoProcessor) ObjectPostProcess(object *coprocess.Object, r *http.Request, origURL string, origMethod string) (err error) {
-	r.ContentLength = int64(len(object.Request.RawBody))
-	r.Body = ioutil.NopCloser(bytes.NewReader(object.Request.RawBody))
-	nopCloseRequestBody(r)
+	if c.Middleware.copiesRequestBody() {
+		r.ContentLength = int64(len(object.Request.RawBody))
+		r.Body = ioutil.NopCloser(bytes.NewReader(object.Request.RawBody))
+		nopCloseRequestBody(r)
+	}
 
 	logger := c.Middleware.Logger()
 
@@ -244,6 +257,23 @@ func (c *CoProcessor) ObjectPostProcess(object *coprocess.Object, r *http.Reques
 		r.URL.RawQuery = updatedValues.Encode()
 	}
 
+	if setContextVars := object.Spec[wasmSetContextVarsKey]; setContextVars != "" {
+		vars := map[string]string{}
+		if err := json.Unmarshal([]byte(setContextVars), &vars); err != nil {
+			logger.Error(err)
+			return nil
+		}
+
+		contextData := ctxGetData(r)
+		if contextData == nil {
+			contextData = make(map[string]interface{})
+		}
+		for k, v := range vars {
+			contextData[k] = v
+		}
+		ctxSetData(r, contextData)
+	}
+
 	return
 }
 
@@ -297,7 +327,7 @@ func (m *CoProcessMiddleware) EnabledForSpec() bool {
 		return false
 	}
 
-	if d, _ := loadedDrivers[m.Spec.CustomMiddleware.Driver]; d == nil {
+	if d, _ := loadedDrivers[m.Spec.CustomMiddleware.Driver]; d == nil && m.Spec.grpcPlugin == nil {
 		log.WithFields(logrus.Fields{
 			"prefix": "coprocess",
 		}).Errorf("Driver '%s' isn't loaded", m.Spec.CustomMiddleware.Driver)
@@ -527,11 +557,33 @@ func (h *CustomMiddlewareResponseHook) Init(mwDef interface{}, spec *APISpec) er
 		HookName:         mwDefinition.Name,
 		HookType:         coprocess.HookType_Response,
 		RawBodyOnly:      mwDefinition.RawBodyOnly,
+		BodyMode:         mwDefinition.BodyMode,
 		MiddlewareDriver: spec.CustomMiddleware.Driver,
 	}
+
+	if h.mw.BodyMode == apidef.StreamedBody && (h.mw.MiddlewareDriver != apidef.GrpcDriver || spec.grpcPlugin == nil) {
+		log.WithFields(logrus.Fields{
+			"prefix": "coprocess",
+			"api_id": spec.APIID,
+		}).Warningf("Response hook '%s' streams the body, which the gRPC driver only supports, passing the whole body", mwDefinition.Name)
+		h.mw.BodyMode = apidef.BufferedBody
+	}
+
 	return nil
 }
 
+// copiesRequestBody returns whether the request body is passed in the coprocess object, response hooks
+// streaming the response body don't get it.
+func (m *CoProcessMiddleware) copiesRequestBody() bool {
+	switch m.BodyMode {
+	case apidef.HeadersOnlyBody:
+		return false
+	case apidef.StreamedBody:
+		return m.HookType != coprocess.HookType_Response
+	}
+	return true
+}
+
 // getAuthType overrides BaseMiddleware.getAuthType.
 func (m *CoProcessMiddleware) getAuthType() string {
 	return apidef.CoprocessType
@@ -561,7 +613,13 @@ func (h *CustomMiddlewareResponseHook) HandleResponse(rw http.ResponseWriter, re
 	}
 	object.Session = ProtoSessionState(ses)
 
-	retObject, err := coProcessor.Dispatch(object)
+	var retObject *coprocess.Object
+	var body io.ReadCloser
+	if h.mw.BodyMode == apidef.StreamedBody {
+		retObject, body, err = h.mw.Spec.grpcPlugin.DispatchStream(object, res.Body)
+	} else {
+		retObject, err = coProcessor.Dispatch(object)
+	}
 	if err != nil {
 		log.WithError(err).Debug("Couldn't dispatch request object")
 		return errors.New("Middleware error")
@@ -590,8 +648,16 @@ func (h *CustomMiddlewareResponseHook) HandleResponse(rw http.ResponseWriter, re
 	}
 
 	// Set response body:
-	bodyBuf := bytes.NewBuffer(retObject.Response.RawBody)
-	res.Body = ioutil.NopCloser(bodyBuf)
+	switch h.mw.BodyMode {
+	case apidef.BufferedBody:
+		bodyBuf := bytes.NewBuffer(retObject.Response.RawBody)
+		res.Body = ioutil.NopCloser(bodyBuf)
+	case apidef.StreamedBody:
+		// the length of the transformed body isn't known until it's streamed
+		res.Body = body
+		res.ContentLength = -1
+		res.Header.Del(header.ContentLength)
+	}
 
 	res.StatusCode = int(retObject.Response.StatusCode)
 	return nil
@@ -633,6 +699,10 @@ func syncHeadersAndMultiValueHeaders(headers map[string]string, multiValueHeader
 }
 
 func (c *CoProcessor) Dispatch(object *coprocess.Object) (*coprocess.Object, error) {
+	if c.Middleware.MiddlewareDriver == apidef.GrpcDriver && c.Middleware.Spec.grpcPlugin != nil {
+		return c.Middleware.Spec.grpcPlugin.Dispatch(object)
+	}
+
 	dispatcher := loadedDrivers[c.Middleware.MiddlewareDriver]
 	if dispatcher == nil {
 		err := fmt.Errorf("Couldn't dispatch request, driver '%s' isn't available", c.Middleware.MiddlewareDriver)
@@ -1,7 +1,9 @@
 package gateway
 
 import (
+	"context"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/cenk/backoff"
@@ -30,6 +32,9 @@ import (
 const BackoffMultiplier = 2
 const MaxBackoffRetries = 4
 
+// bundleDigestFile holds the digest of the bundle extracted in a bundle directory.
+const bundleDigestFile = ".digest"
+
 // Bundle is the basic bundle data structure, it holds the bundle name and the data.
 type Bundle struct {
 	Name     string
@@ -117,6 +122,19 @@ func (b *Bundle) AddToSpec() {
 			"prefix": "coprocess",
 		}).Info("Python dispatcher was initialized")
 	}
+	if loadedDrivers[b.Spec.CustomMiddleware.Driver] == nil && b.Spec.CustomMiddleware.Driver == apidef.WASMDriver {
+		var err error
+		loadedDrivers[apidef.WASMDriver], err = NewWASMDispatcher(b.Gw.GetConfig())
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "coprocess",
+			}).WithError(err).Error("Couldn't load WebAssembly dispatcher")
+			return
+		}
+		log.WithFields(logrus.Fields{
+			"prefix": "coprocess",
+		}).Info("WebAssembly dispatcher was initialized")
+	}
 	dispatcher := loadedDrivers[b.Spec.CustomMiddleware.Driver]
 	if dispatcher != nil {
 		dispatcher.HandleMiddlewareCache(&b.Manifest, b.Path)
@@ -230,46 +248,76 @@ func (gw *Gateway) fetchBundle(spec *APISpec) (Bundle, error) {
 		return bundle, err
 	}
 
-	u, err := url.Parse(gw.GetConfig().BundleBaseURL)
+	getter, err := gw.bundleGetter(spec)
 	if err != nil {
 		return bundle, err
 	}
 
+	bundleData, err := pullBundle(getter, BackoffMultiplier)
+
+	bundle.Name = spec.CustomMiddlewareBundle
+	bundle.Data = bundleData
+	bundle.Spec = spec
+	return bundle, err
+}
+
+// bundleGetter returns the BundleGetter matching the scheme of the bundle base URL, the bundle name is resolved against its path.
+func (gw *Gateway) bundleGetter(spec *APISpec) (BundleGetter, error) {
+	conf := gw.GetConfig()
+
+	u, err := url.Parse(conf.BundleBaseURL)
+	if err != nil {
+		return nil, err
+	}
+
 	u.Path = path.Join(u.Path, spec.CustomMiddlewareBundle)
 
 	bundleURL := u.String()
 
-	var getter BundleGetter
-
 	switch u.Scheme {
 	case "http":
-		getter = &HTTPBundleGetter{
+		return &HTTPBundleGetter{
 			URL:                bundleURL,
 			InsecureSkipVerify: false,
-		}
+		}, nil
 	case "https":
-		getter = &HTTPBundleGetter{
+		return &HTTPBundleGetter{
 			URL:                bundleURL,
-			InsecureSkipVerify: gw.GetConfig().BundleInsecureSkipVerify,
-		}
+			InsecureSkipVerify: conf.BundleInsecureSkipVerify,
+		}, nil
 	case "mock":
-		getter = &MockBundleGetter{
+		return &MockBundleGetter{
 			URL:                bundleURL,
-			InsecureSkipVerify: gw.GetConfig().BundleInsecureSkipVerify,
+			InsecureSkipVerify: conf.BundleInsecureSkipVerify,
+		}, nil
+	case "file":
+		return &LocalBundleGetter{
+			Path: filepath.FromSlash(u.Path),
+		}, nil
+	case "oci":
+		getter, err := newOCIBundleGetter(u.Host + u.Path)
+		if err != nil {
+			return nil, err
 		}
-	default:
-		err = errors.New("Unknown URL scheme")
-	}
-	if err != nil {
-		return bundle, err
+		getter.Username = conf.BundleOCI.Username
+		getter.Password = conf.BundleOCI.Password
+		getter.PlainHTTP = conf.BundleOCI.PlainHTTP
+		getter.InsecureSkipVerify = conf.BundleInsecureSkipVerify
+		return getter, nil
+	case "s3":
+		return &S3BundleGetter{
+			Endpoint:           conf.BundleS3.Endpoint,
+			Region:             conf.BundleS3.Region,
+			Bucket:             u.Host,
+			Key:                strings.TrimPrefix(u.Path, "/"),
+			AccessKeyID:        conf.BundleS3.AccessKeyID,
+			SecretAccessKey:    conf.BundleS3.SecretAccessKey,
+			SessionToken:       conf.BundleS3.SessionToken,
+			InsecureSkipVerify: conf.BundleInsecureSkipVerify,
+		}, nil
 	}
 
-	bundleData, err := pullBundle(getter, BackoffMultiplier)
-
-	bundle.Name = spec.CustomMiddlewareBundle
-	bundle.Data = bundleData
-	bundle.Spec = spec
-	return bundle, err
+	return nil, errors.New("Unknown URL scheme")
 }
 
 func pullBundle(getter BundleGetter, backoffMultiplier float64) ([]byte, error) {
@@ -335,7 +383,16 @@ func loadBundleManifest(bundle *Bundle, spec *APISpec, skipVerification bool) er
 	return nil
 }
 
+// getBundleDestPath returns the directory of the bundle loaded by the API.
 func (gw *Gateway) getBundleDestPath(spec *APISpec) string {
+	if spec.bundlePath != "" {
+		return spec.bundlePath
+	}
+	return gw.getBundleInstallPath(spec)
+}
+
+// getBundleInstallPath returns the directory the bundle of the API is installed to, see getBundleDestPath.
+func (gw *Gateway) getBundleInstallPath(spec *APISpec) string {
 	tykBundlePath := filepath.Join(gw.GetConfig().MiddlewarePath, "bundles")
 	bundlePath, _ := gw.getHashedBundleName(spec.CustomMiddlewareBundle)
 	return filepath.Join(tykBundlePath, bundlePath)
@@ -391,6 +448,7 @@ func (gw *Gateway) loadBundle(spec *APISpec) error {
 		}).Info("----> Using bundle: ", spec.CustomMiddlewareBundle)
 
 		bundle.AddToSpec()
+		gw.watchBundle(spec)
 
 		return nil
 	}
@@ -428,15 +486,139 @@ func (gw *Gateway) loadBundle(spec *APISpec) error {
 		return nil
 	}
 
+	if err := os.WriteFile(filepath.Join(bundle.Path, bundleDigestFile), []byte(bundleDigest(bundle.Data)), 0600); err != nil {
+		bundleError(spec, err, "Couldn't save bundle digest")
+	}
+
 	log.WithFields(logrus.Fields{
 		"prefix": "main",
 	}).Info("----> Bundle is valid, adding to spec: ", spec.CustomMiddlewareBundle)
 
 	bundle.AddToSpec()
+	gw.watchBundle(spec)
 
 	return nil
 }
 
+// watchBundle checks the source of the bundle of the API for updates, until the API is released or replaced.
+func (gw *Gateway) watchBundle(spec *APISpec) {
+	interval := gw.GetConfig().BundleRefreshInterval
+	if interval <= 0 || !gw.GetConfig().EnableBundleDownloader || spec.stopBundleWatch != nil {
+		return
+	}
+
+	getter, err := gw.bundleGetter(spec)
+	if err != nil {
+		bundleError(spec, err, "Couldn't watch bundle")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(gw.ctx)
+	spec.stopBundleWatch = cancel
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if gw.getApiSpec(spec.APIID) != spec {
+				cancel()
+				return
+			}
+
+			if err := gw.refreshBundle(spec, getter); err != nil {
+				bundleError(spec, err, "Couldn't refresh bundle")
+			}
+		}
+	}()
+}
+
+// refreshBundle switches the API to the bundle of its source when it holds a different one, see switchBundle.
+func (gw *Gateway) refreshBundle(spec *APISpec, getter BundleGetter) error {
+	installed, _ := os.ReadFile(filepath.Join(gw.getBundleDestPath(spec), bundleDigestFile))
+
+	if digester, ok := getter.(BundleDigester); ok {
+		digest, err := digester.Digest()
+		if err != nil {
+			return err
+		}
+		if digest == string(installed) {
+			return nil
+		}
+	}
+
+	data, err := getter.Get()
+	if err != nil {
+		return err
+	}
+
+	if bundleDigest(data) == string(installed) {
+		return nil
+	}
+
+	return gw.switchBundle(spec, data)
+}
+
+// stageBundle extracts and verifies the bundle data in a new directory next to the installed bundle of the API.
+func (gw *Gateway) stageBundle(spec *APISpec, data []byte) (Bundle, error) {
+	installPath := gw.getBundleInstallPath(spec)
+	if err := os.MkdirAll(filepath.Dir(installPath), 0700); err != nil {
+		return Bundle{}, err
+	}
+
+	stagePath, err := os.MkdirTemp(filepath.Dir(installPath), filepath.Base(installPath)+".")
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	bundle := Bundle{
+		Name: spec.CustomMiddlewareBundle,
+		Data: data,
+		Path: stagePath,
+		Spec: spec,
+		Gw:   gw,
+	}
+
+	err = (ZipBundleSaver{}).Save(&bundle, stagePath, spec)
+	if err == nil {
+		err = loadBundleManifest(&bundle, spec, true)
+	}
+	if err == nil {
+		err = bundle.Verify()
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(stagePath, bundleDigestFile), []byte(bundleDigest(data)), 0600)
+	}
+	if err != nil {
+		os.RemoveAll(stagePath)
+		return Bundle{}, err
+	}
+
+	return bundle, nil
+}
+
+// installBundle replaces the installed bundle of the API with a staged one, later loads of the API use it.
+func (gw *Gateway) installBundle(spec *APISpec, stagePath string) error {
+	installPath := gw.getBundleInstallPath(spec)
+
+	oldPath := stagePath + ".old"
+	if err := os.Rename(installPath, oldPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(stagePath, installPath); err != nil {
+		os.Rename(oldPath, installPath)
+		return err
+	}
+
+	return os.RemoveAll(oldPath)
+}
+
 // bundleError is a log helper.
 func bundleError(spec *APISpec, err error, message string) error {
 	if err != nil {
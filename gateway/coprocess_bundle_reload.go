@@ -0,0 +1,197 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/goplugin"
+)
+
+var (
+	errBundleReloadAPINotFound = errors.New("API not found")
+	errBundleReloadNoBundle    = errors.New("API has no bundle")
+	errBundleReloadReplaced    = errors.New("API was reloaded during the bundle reload")
+	errBundleReloadAuthChanged = errors.New("bundle changes the authentication of the API, a full reload is required")
+)
+
+// reloadAPIBundle fetches the bundle of an API and switches the API to it, other APIs aren't reloaded.
+func (gw *Gateway) reloadAPIBundle(apiID string) error {
+	spec := gw.getApiSpec(apiID)
+	if spec == nil {
+		return errBundleReloadAPINotFound
+	}
+
+	if spec.CustomMiddlewareBundleDisabled || spec.CustomMiddlewareBundle == "" {
+		return errBundleReloadNoBundle
+	}
+
+	bundle, err := gw.fetchBundle(spec)
+	if err != nil {
+		return err
+	}
+
+	return gw.switchBundle(spec, bundle.Data)
+}
+
+// switchBundle loads the bundle data side by side with the current bundle of the API, into a new spec
+// and middleware chain. Once they're initialised, the chain of the API is swapped atomically and the
+// bundle is installed for later loads of the API. The API keeps its current chain if anything fails.
+func (gw *Gateway) switchBundle(spec *APISpec, data []byte) error {
+	gw.reloadMu.Lock()
+	defer gw.reloadMu.Unlock()
+
+	if gw.getApiSpec(spec.APIID) != spec {
+		return errBundleReloadReplaced
+	}
+
+	handle, found := gw.apisHandlesByID.Load(spec.APIID)
+	if !found {
+		return errBundleReloadAPINotFound
+	}
+	chainObj := handle.(*ChainObject)
+
+	bundle, err := gw.stageBundle(spec, data)
+	if err != nil {
+		return err
+	}
+
+	newSpec, newChainObj, err := gw.loadBundleSpec(spec, bundle.Path)
+	if err == nil && newChainObj.Open != chainObj.Open {
+		err = errBundleReloadAuthChanged
+	}
+	if err != nil {
+		newSpec.Release()
+		return fmt.Errorf("bundle failed to initialise, rolled back: %w", err)
+	}
+
+	chainObj.swap(newChainObj)
+
+	gw.apisMu.Lock()
+	gw.apisByID[spec.APIID] = newSpec
+	for i := range gw.apiSpecs {
+		if gw.apiSpecs[i] == spec {
+			gw.apiSpecs[i] = newSpec
+		}
+	}
+	gw.apisMu.Unlock()
+
+	spec.Release()
+
+	log.WithFields(logrus.Fields{
+		"prefix": "main",
+		"api_id": spec.APIID,
+	}).Info("----> Bundle reloaded: ", spec.CustomMiddlewareBundle, " ", bundleDigest(data))
+
+	installed, err := gw.stageBundle(newSpec, data)
+	if err != nil {
+		return err
+	}
+	return gw.installBundle(newSpec, installed.Path)
+}
+
+// loadBundleSpec loads a new spec of the API with the bundle of bundlePath, along with its middleware chain.
+// The spec owns the bundle directory, releasing it removes the directory.
+func (gw *Gateway) loadBundleSpec(spec *APISpec, bundlePath string) (newSpec *APISpec, chainObj *ChainObject, err error) {
+	newSpec = &APISpec{
+		Checksum:   spec.Checksum,
+		bundlePath: bundlePath,
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic while loading the API: %v", e)
+			log.Errorf("Panic while reloading the bundle of an API: %v, stacktrace: %v", e, string(debug.Stack()))
+		}
+	}()
+
+	// the current definition is in use, the spec gets its own copy
+	rawDef, err := json.Marshal(spec.APIDefinition)
+	if err != nil {
+		return newSpec, nil, err
+	}
+	def := &nestedApiDefinition{APIDefinition: &apidef.APIDefinition{}}
+	if err := json.Unmarshal(rawDef, def.APIDefinition); err != nil {
+		return newSpec, nil, err
+	}
+	def.VersionDefinition.BaseID = spec.VersionDefinition.BaseID
+	if spec.IsOAS {
+		oasDef := spec.OAS
+		def.OAS = &oasDef
+	}
+
+	newSpec.APIDefinition = def.APIDefinition
+
+	logger := logrus.NewEntry(log).WithField("api_id", spec.APIID)
+	loader := APIDefinitionLoader{Gw: gw}
+	loader.initSpec(newSpec, def, logger)
+
+	gw.apisMu.RLock()
+	apisByListen := countApisByListenHash(gw.apiSpecs)
+	gw.apisMu.RUnlock()
+
+	gs := gw.prepareStorage()
+	chainObj = gw.processSpec(newSpec, apisByListen, &gs, logger)
+	if chainObj.ThisHandler == nil {
+		return newSpec, nil, errors.New("API is invalid")
+	}
+
+	return newSpec, chainObj, gw.bundleInitError(newSpec)
+}
+
+// bundleInitError checks the plugins of the bundle loaded by the spec are available to the middleware chain.
+func (gw *Gateway) bundleInitError(spec *APISpec) error {
+	section := spec.CustomMiddleware
+	hooks := append([]apidef.MiddlewareDefinition{section.AuthCheck}, section.Pre...)
+	hooks = append(hooks, section.PostKeyAuth...)
+	hooks = append(hooks, section.Post...)
+	hooks = append(hooks, section.Response...)
+
+	switch section.Driver {
+	case apidef.OttoDriver:
+		if !gw.GetConfig().EnableJSVM {
+			return errors.New("JSVM is disabled")
+		}
+		for _, hook := range hooks {
+			if hook.Name == "" || hook.Disabled {
+				continue
+			}
+			if kind, err := spec.JSVM.run("typeof " + hook.Name); err != nil || kind != "object" {
+				return fmt.Errorf("JS middleware %q isn't defined", hook.Name)
+			}
+		}
+	case apidef.GoPluginDriver:
+		var prefix string
+		if !spec.CustomMiddlewareBundleDisabled && spec.CustomMiddlewareBundle != "" {
+			prefix = gw.getBundleDestPath(spec)
+		}
+		for _, hook := range hooks {
+			if hook.Name == "" || hook.Disabled {
+				continue
+			}
+			path, err := goplugin.GetPluginFileNameToLoad(goplugin.FileSystemStorage{}, filepath.Join(prefix, hook.Path), VERSION)
+			if err == nil {
+				_, err = goplugin.GetSymbol(path, hook.Name)
+			}
+			if err != nil {
+				return fmt.Errorf("Go plugin %q couldn't be loaded: %w", hook.Name, err)
+			}
+		}
+	case apidef.GrpcDriver:
+		if gw.GetConfig().CoProcessOptions.EnableCoProcess && spec.grpcPlugin == nil {
+			return errors.New("gRPC plugin client couldn't be created")
+		}
+	case "":
+	default:
+		if loadedDrivers[section.Driver] == nil {
+			return fmt.Errorf("%s dispatcher isn't loaded", section.Driver)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestBundleReloadAPI(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	sourcePath := t.TempDir()
+	conf := ts.Gw.GetConfig()
+	conf.BundleBaseURL = "file://" + sourcePath
+	ts.Gw.SetConfig(conf)
+
+	writeBundle := func(archive []byte) {
+		require.NoError(t, os.WriteFile(filepath.Join(sourcePath, "reload.zip"), archive, 0600))
+	}
+	writeBundle(testJSBundleArchive(t, "a"))
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "bundled"
+		spec.Proxy.ListenPath = "/bundled/"
+		spec.CustomMiddlewareBundle = "reload.zip"
+	}, func(spec *APISpec) {
+		spec.APIID = "plain"
+		spec.Proxy.ListenPath = "/plain/"
+	})
+
+	plain := ts.Gw.getApiSpec("plain")
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/bundled/", Code: http.StatusOK, BodyMatch: `"X-Bundle":"a"`},
+		{Method: http.MethodGet, Path: "/tyk/reload/bundle/unknown", AdminAuth: true, Code: http.StatusNotFound},
+		{Method: http.MethodGet, Path: "/tyk/reload/bundle/plain", AdminAuth: true, Code: http.StatusBadRequest},
+	}...)
+
+	t.Run("updated bundle", func(t *testing.T) {
+		writeBundle(testJSBundleArchive(t, "b"))
+
+		_, _ = ts.Run(t, []test.TestCase{
+			{Method: http.MethodGet, Path: "/tyk/reload/bundle/bundled", AdminAuth: true, Code: http.StatusOK},
+			{Path: "/bundled/", Code: http.StatusOK, BodyMatch: `"X-Bundle":"b"`},
+		}...)
+
+		assert.Same(t, plain, ts.Gw.getApiSpec("plain"), "other APIs aren't reloaded")
+	})
+
+	t.Run("failed initialisation", func(t *testing.T) {
+		current := ts.Gw.getApiSpec("bundled")
+
+		// the bundle declares a hook its script doesn't define
+		section := apidef.MiddlewareSection{
+			Driver: apidef.OttoDriver,
+			Pre:    []apidef.MiddlewareDefinition{{Name: "missing", Path: "pre.js"}},
+		}
+		writeBundle(testBundleArchive(t, section, map[string]string{"pre.js": "var other = {};"}))
+
+		_, _ = ts.Run(t, []test.TestCase{
+			{Method: http.MethodGet, Path: "/tyk/reload/bundle/bundled", AdminAuth: true, Code: http.StatusInternalServerError,
+				BodyMatch: "rolled back"},
+			{Path: "/bundled/", Code: http.StatusOK, BodyMatch: `"X-Bundle":"b"`},
+		}...)
+
+		assert.Same(t, current, ts.Gw.getApiSpec("bundled"))
+		assert.DirExists(t, current.bundlePath)
+	})
+}
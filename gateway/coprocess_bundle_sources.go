@@ -0,0 +1,428 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ociBundleLayerMediaType is the media type of the layer holding the bundle in an OCI artifact.
+	// Artifacts with a single layer are accepted whatever its media type.
+	ociBundleLayerMediaType = "application/vnd.tyk.bundle.layer.v1+zip"
+
+	ociManifestMediaTypes = "application/vnd.oci.image.manifest.v1+json, application/vnd.docker.distribution.manifest.v2+json"
+
+	defaultS3Region = "us-east-1"
+	// s3EmptyPayloadHash is the SHA-256 of the empty body of the requests to S3.
+	s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// BundleDigester is implemented by BundleGetters able to tell the digest of the bundle without downloading it.
+// The digest has the form returned by bundleDigest.
+type BundleDigester interface {
+	Digest() (string, error)
+}
+
+// bundleDigest returns the content address of the bundle data.
+func bundleDigest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func newBundleHTTPClient(insecureSkipVerify bool) *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	return &http.Client{Transport: tr, Timeout: 5 * time.Second}
+}
+
+func readBundleResponse(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP Error, got status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// LocalBundleGetter reads bundles from a local directory, e.g. a volume updated by a deployment pipeline.
+type LocalBundleGetter struct {
+	Path string
+}
+
+// Get reads the bundle file.
+func (g *LocalBundleGetter) Get() ([]byte, error) {
+	return os.ReadFile(g.Path)
+}
+
+// Digest hashes the bundle file.
+func (g *LocalBundleGetter) Digest() (string, error) {
+	data, err := g.Get()
+	if err != nil {
+		return "", err
+	}
+	return bundleDigest(data), nil
+}
+
+// OCIBundleGetter pulls bundles stored as OCI artifacts, referenced by tag or digest.
+type OCIBundleGetter struct {
+	Registry   string
+	Repository string
+	// Reference is either a tag or a digest of the artifact manifest.
+	Reference          string
+	Username           string
+	Password           string
+	PlainHTTP          bool
+	InsecureSkipVerify bool
+
+	client *http.Client
+	// authorization is reused across the requests once the registry challenged the getter.
+	authorization string
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// newOCIBundleGetter parses references of the form <registry>/<repository>[:<tag>|@<digest>], the tag defaults to latest.
+func newOCIBundleGetter(ref string) (*OCIBundleGetter, error) {
+	registry, repository, ok := strings.Cut(ref, "/")
+	if !ok || registry == "" || repository == "" {
+		return nil, fmt.Errorf("invalid OCI reference %q", ref)
+	}
+
+	reference := "latest"
+	if i := strings.Index(repository, "@"); i >= 0 {
+		repository, reference = repository[:i], repository[i+1:]
+	} else if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository, reference = repository[:i], repository[i+1:]
+	}
+
+	return &OCIBundleGetter{
+		Registry:   registry,
+		Repository: repository,
+		Reference:  reference,
+	}, nil
+}
+
+// Get pulls the bundle layer of the artifact and checks it against its digest.
+func (g *OCIBundleGetter) Get() ([]byte, error) {
+	layer, err := g.layer()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Attempting to pull plugin bundle: %s/%s@%s", g.Registry, g.Repository, layer.Digest)
+	data, err := g.fetch("blobs/"+layer.Digest, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if digest := bundleDigest(data); digest != layer.Digest {
+		return nil, fmt.Errorf("bundle layer digest mismatch, expected %s, got %s", layer.Digest, digest)
+	}
+	return data, nil
+}
+
+// Digest returns the digest of the bundle layer, only the manifest of the artifact is pulled.
+func (g *OCIBundleGetter) Digest() (string, error) {
+	layer, err := g.layer()
+	if err != nil {
+		return "", err
+	}
+	return layer.Digest, nil
+}
+
+func (g *OCIBundleGetter) layer() (ociDescriptor, error) {
+	data, err := g.fetch("manifests/"+g.Reference, ociManifestMediaTypes)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+
+	if strings.HasPrefix(g.Reference, "sha256:") && bundleDigest(data) != g.Reference {
+		return ociDescriptor{}, fmt.Errorf("manifest digest mismatch, expected %s", g.Reference)
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return ociDescriptor{}, err
+	}
+
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == ociBundleLayerMediaType {
+			return layer, nil
+		}
+	}
+	if len(manifest.Layers) == 1 {
+		return manifest.Layers[0], nil
+	}
+
+	return ociDescriptor{}, fmt.Errorf("no bundle layer in artifact %s/%s:%s", g.Registry, g.Repository, g.Reference)
+}
+
+func (g *OCIBundleGetter) fetch(path, accept string) ([]byte, error) {
+	if g.client == nil {
+		g.client = newBundleHTTPClient(g.InsecureSkipVerify)
+	}
+
+	scheme := "https"
+	if g.PlainHTTP {
+		scheme = "http"
+	}
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", scheme, g.Registry, g.Repository, path)
+
+	do := func() (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if g.authorization != "" {
+			req.Header.Set("Authorization", g.authorization)
+		}
+		return g.client.Do(req)
+	}
+
+	resp, err := do()
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && g.authorization == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		if g.authorization, err = g.authorize(challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = do(); err != nil {
+			return nil, err
+		}
+	}
+
+	return readBundleResponse(resp)
+}
+
+// authorize answers the challenge of the registry, either with basic credentials or a bearer token
+// obtained from the token service of the registry.
+func (g *OCIBundleGetter) authorize(challenge string) (string, error) {
+	scheme, params := parseAuthChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if g.Username == "" {
+			return "", errors.New("registry requires credentials")
+		}
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(g.Username, g.Password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported registry authentication challenge %q", challenge)
+	}
+
+	tokenURL, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid registry token realm %q", params["realm"])
+	}
+
+	query := tokenURL.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", g.Repository)
+	}
+	query.Set("scope", scope)
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if g.Username != "" {
+		req.SetBasicAuth(g.Username, g.Password)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	data, err := readBundleResponse(resp)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get registry token: %w", err)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+
+	return "Bearer " + token.Token, nil
+}
+
+// parseAuthChallenge parses a WWW-Authenticate header like `Bearer realm="...",service="..."`.
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := make(map[string]string)
+
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimLeft(rest, ", ") {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				break
+			}
+			params[key], rest = value[1:end+1], value[end+2:]
+			continue
+		}
+
+		params[key], rest, _ = strings.Cut(value, ",")
+	}
+
+	return scheme, params
+}
+
+// S3BundleGetter downloads bundles from S3 or an S3-compatible object store.
+type S3BundleGetter struct {
+	// Endpoint of an S3-compatible store, buckets are addressed path-style on it.
+	Endpoint           string
+	Region             string
+	Bucket             string
+	Key                string
+	AccessKeyID        string
+	SecretAccessKey    string
+	SessionToken       string
+	InsecureSkipVerify bool
+}
+
+// URL returns the address of the bundle object.
+func (g *S3BundleGetter) URL() string {
+	key := escapeS3Key(g.Key)
+	if g.Endpoint != "" {
+		return strings.TrimSuffix(g.Endpoint, "/") + "/" + g.Bucket + "/" + key
+	}
+
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", g.Bucket, g.region(), key)
+}
+
+func (g *S3BundleGetter) region() string {
+	if g.Region == "" {
+		return defaultS3Region
+	}
+	return g.Region
+}
+
+// Get downloads the bundle object, signing the request when credentials are set.
+func (g *S3BundleGetter) Get() ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, g.URL(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.AccessKeyID != "" {
+		signS3Request(req, g.region(), g.AccessKeyID, g.SecretAccessKey, g.SessionToken, time.Now())
+	}
+
+	log.Infof("Attempting to download plugin bundle: s3://%s/%s", g.Bucket, g.Key)
+	resp, err := newBundleHTTPClient(g.InsecureSkipVerify).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return readBundleResponse(resp)
+}
+
+func escapeS3Key(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signS3Request signs a request with no body using AWS Signature Version 4, all the headers set on the request are signed.
+func signS3Request(req *http.Request, region, accessKeyID, secretAccessKey, sessionToken string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", s3EmptyPayloadHash)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		s3EmptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
@@ -1,22 +1,34 @@
 package gateway
 
 import (
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/url"
+	"sync/atomic"
 	"time"
 
+	circuit "github.com/TykTechnologies/circuitbreaker"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/health" // client side health checking
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
 
 	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/certs"
 	"github.com/TykTechnologies/tyk/coprocess"
 )
 
 var (
-	grpcConnection *grpc.ClientConn
-	grpcClient     coprocess.DispatcherClient
+	grpcConnection   *grpc.ClientConn
+	grpcClient       coprocess.DispatcherClient
+	grpcStreamClient coprocess.StreamDispatcherClient
 )
 
 // GRPCDispatcher implements a coprocess.Dispatcher
@@ -99,6 +111,7 @@ func (gw *Gateway) NewGRPCDispatcher() (coprocess.Dispatcher, error) {
 	)
 
 	grpcClient = coprocess.NewDispatcherClient(grpcConnection)
+	grpcStreamClient = coprocess.NewStreamDispatcherClient(grpcConnection)
 
 	if err != nil {
 
@@ -109,3 +122,346 @@ func (gw *Gateway) NewGRPCDispatcher() (coprocess.Dispatcher, error) {
 	}
 	return &GRPCDispatcher{}, nil
 }
+
+const grpcPluginResolverScheme = "tyk-grpc-plugin"
+
+// grpcStreamChunkSize is the size of the body chunks sent to streaming response hooks.
+const grpcStreamChunkSize = 32 * 1024
+
+var errGRPCPluginBreakerOpen = errors.New("gRPC plugin server circuit breaker is open")
+
+// grpcPluginClient dispatches the hooks of an API with the deadlines and the circuit breaker of
+// its gRPC server configuration, to its own servers or to the coprocess_grpc_server of the gateway.
+type grpcPluginClient struct {
+	conns         []*grpc.ClientConn
+	clients       []coprocess.DispatcherClient
+	streamClients []coprocess.StreamDispatcherClient
+	next          uint32
+	timeout       time.Duration
+	hookTimeouts  map[string]time.Duration
+	breaker       *circuit.Breaker
+	failOpen      bool
+}
+
+// newGRPCPluginClient creates the plugin client of an API using the gRPC driver.
+func (gw *Gateway) newGRPCPluginClient(spec *APISpec) (*grpcPluginClient, error) {
+	conf := spec.CustomMiddleware.GRPCServer
+
+	var tlsConfig *tls.Config
+	if conf.TLS.Enabled {
+		tlsConfig = &tls.Config{
+			ServerName:         conf.TLS.ServerName,
+			InsecureSkipVerify: conf.TLS.InsecureSkipVerify,
+		}
+
+		if conf.TLS.ClientCertificate != "" {
+			certificates := gw.CertificateManager.List([]string{conf.TLS.ClientCertificate}, certs.CertificatePrivate)
+			if len(certificates) == 0 || certificates[0] == nil {
+				return nil, fmt.Errorf("gRPC plugin client certificate %q not found", conf.TLS.ClientCertificate)
+			}
+			tlsConfig.Certificates = []tls.Certificate{*certificates[0]}
+		}
+
+		if len(conf.TLS.CACertificates) > 0 {
+			tlsConfig.RootCAs = gw.CertificateManager.CertPool(conf.TLS.CACertificates)
+		}
+	}
+
+	client, err := newGRPCPluginClient(conf, tlsConfig, gw.GetConfig().CoProcessOptions.GRPCAuthority, gw.grpcCallOpts())
+	if err != nil {
+		return nil, err
+	}
+
+	if client.breaker != nil {
+		events := client.breaker.Subscribe()
+		go func() {
+			for e := range events {
+				switch e {
+				case circuit.BreakerTripped:
+					log.WithFields(logrus.Fields{
+						"prefix": "coprocess",
+						"api_id": spec.APIID,
+					}).Warning("gRPC plugin server breaker tripped")
+
+					go func(timeout int) {
+						time.Sleep(time.Duration(timeout) * time.Second)
+						client.breaker.Reset()
+					}(conf.CircuitBreaker.ReturnToServiceAfter)
+
+					spec.FireEvent(EventBreakerTripped, EventCurcuitBreakerMeta{
+						EventMetaDefault: EventMetaDefault{Message: "gRPC plugin server breaker tripped"},
+						CircuitEvent:     e,
+						APIID:            spec.APIID,
+					})
+				case circuit.BreakerReset:
+					spec.FireEvent(EventBreakerReset, EventCurcuitBreakerMeta{
+						EventMetaDefault: EventMetaDefault{Message: "gRPC plugin server breaker reset"},
+						CircuitEvent:     e,
+						APIID:            spec.APIID,
+					})
+				case circuit.BreakerStop:
+					return
+				}
+			}
+		}()
+	}
+
+	return client, nil
+}
+
+func newGRPCPluginClient(conf apidef.GRPCPluginServer, tlsConfig *tls.Config, authority string, callOpts grpc.DialOption) (*grpcPluginClient, error) {
+	client := &grpcPluginClient{
+		timeout:      time.Duration(conf.Timeout) * time.Millisecond,
+		hookTimeouts: make(map[string]time.Duration, len(conf.HookTimeouts)),
+		failOpen:     conf.CircuitBreaker.FailOpen,
+	}
+
+	for name, timeout := range conf.HookTimeouts {
+		client.hookTimeouts[name] = time.Duration(timeout) * time.Millisecond
+	}
+
+	if conf.CircuitBreaker.Enabled {
+		client.breaker = circuit.NewRateBreaker(conf.CircuitBreaker.ThresholdPercent, conf.CircuitBreaker.Samples)
+	}
+
+	if len(conf.Addresses) == 0 {
+		if grpcClient == nil {
+			client.Close()
+			return nil, errors.New("No gRPC URL is set")
+		}
+		client.clients = []coprocess.DispatcherClient{grpcClient}
+		client.streamClients = []coprocess.StreamDispatcherClient{grpcStreamClient}
+		return client, nil
+	}
+
+	addresses := make([]resolver.Address, 0, len(conf.Addresses))
+	for _, address := range conf.Addresses {
+		serverURL, err := url.Parse(address)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+
+		serverName := serverURL.Hostname()
+		if tlsConfig != nil && tlsConfig.ServerName != "" {
+			serverName = tlsConfig.ServerName
+		}
+		addresses = append(addresses, resolver.Address{Addr: address, ServerName: serverName})
+	}
+
+	transportCredentials := insecure.NewCredentials()
+	if tlsConfig != nil {
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
+
+	serviceConfig := `{"loadBalancingConfig": [{"round_robin": {}}]}`
+	if conf.HealthCheck {
+		serviceConfig = `{"loadBalancingConfig": [{"round_robin": {}}], "healthCheckConfig": {"serviceName": ""}}`
+	}
+
+	poolSize := conf.PoolSize
+	if poolSize < 1 {
+		poolSize = 1
+	}
+
+	for i := 0; i < poolSize; i++ {
+		// a resolver serves a single connection
+		r := manual.NewBuilderWithScheme(grpcPluginResolverScheme)
+		r.InitialState(resolver.State{Addresses: addresses})
+
+		conn, err := grpc.Dial(grpcPluginResolverScheme+":///plugins",
+			callOpts,
+			grpc.WithResolvers(r),
+			grpc.WithTransportCredentials(transportCredentials),
+			grpc.WithAuthority(authority),
+			grpc.WithDefaultServiceConfig(serviceConfig),
+			grpc.WithContextDialer(dialGRPCPluginServer),
+		)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+
+		client.conns = append(client.conns, conn)
+		client.clients = append(client.clients, coprocess.NewDispatcherClient(conn))
+		client.streamClients = append(client.streamClients, coprocess.NewStreamDispatcherClient(conn))
+	}
+
+	return client, nil
+}
+
+// dialGRPCPluginServer dials the network and address of a server URL such as tcp://127.0.0.1:5555 or unix:///tmp/plugins.sock.
+func dialGRPCPluginServer(ctx context.Context, address string) (net.Conn, error) {
+	serverURL, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, serverURL.Scheme, address[len(serverURL.Scheme)+3:])
+}
+
+// Dispatch calls the hook of the object on the next connection of the pool.
+func (c *grpcPluginClient) Dispatch(object *coprocess.Object) (*coprocess.Object, error) {
+	if c.breaker != nil && !c.breaker.Ready() {
+		if c.failOpen {
+			return object, nil
+		}
+		return nil, errGRPCPluginBreakerOpen
+	}
+
+	ctx := context.Background()
+	if timeout := c.hookTimeout(object.HookName); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	client := c.clients[int(atomic.AddUint32(&c.next, 1))%len(c.clients)]
+	newObject, err := client.Dispatch(ctx, object)
+	c.report(err)
+
+	return newObject, err
+}
+
+// DispatchStream calls the response hook of the object with the streaming protocol: the object is sent
+// without the response body, which follows in chunks ended by a message with end set. The hook replies
+// with the object, then with the chunks of the new body. The returned body reads the chunks of the hook.
+func (c *grpcPluginClient) DispatchStream(object *coprocess.Object, body io.ReadCloser) (*coprocess.Object, io.ReadCloser, error) {
+	if c.breaker != nil && !c.breaker.Ready() {
+		if c.failOpen {
+			return object, body, nil
+		}
+		return nil, nil, errGRPCPluginBreakerOpen
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// the hook deadline applies until the object is returned, the body streams as long as it's read
+	if timeout := c.hookTimeout(object.HookName); timeout > 0 {
+		timer := time.AfterFunc(timeout, cancel)
+		defer timer.Stop()
+	}
+
+	client := c.streamClients[int(atomic.AddUint32(&c.next, 1))%len(c.streamClients)]
+	stream, err := client.DispatchStream(ctx)
+	if err == nil {
+		err = stream.Send(&coprocess.StreamMessage{Object: object})
+	}
+
+	var reply *coprocess.StreamMessage
+	if err == nil {
+		reply, err = stream.Recv()
+	}
+	if err == nil && reply.Object == nil {
+		err = errors.New("no object returned by the streaming hook")
+	}
+
+	c.report(err)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	go sendStreamBody(stream, body, cancel)
+
+	return reply.Object, &grpcStreamBody{stream: stream, body: body, cancel: cancel}, nil
+}
+
+// sendStreamBody sends the body to a streaming hook in chunks, the stream is cancelled if the body can't be read.
+func sendStreamBody(stream coprocess.StreamDispatcher_DispatchStreamClient, body io.Reader, cancel context.CancelFunc) {
+	for {
+		chunk := make([]byte, grpcStreamChunkSize)
+		n, err := body.Read(chunk)
+		if n > 0 {
+			if stream.Send(&coprocess.StreamMessage{Chunk: chunk[:n]}) != nil {
+				return
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "coprocess",
+			}).WithError(err).Error("Couldn't read the response body of a streaming hook")
+			cancel()
+			return
+		}
+	}
+
+	if stream.Send(&coprocess.StreamMessage{End: true}) == nil {
+		stream.CloseSend()
+	}
+}
+
+// grpcStreamBody reads the body chunks sent back by a streaming hook.
+type grpcStreamBody struct {
+	stream coprocess.StreamDispatcher_DispatchStreamClient
+	body   io.Closer
+	cancel context.CancelFunc
+	chunk  []byte
+	done   bool
+}
+
+func (b *grpcStreamBody) Read(p []byte) (int, error) {
+	for len(b.chunk) == 0 {
+		if b.done {
+			return 0, io.EOF
+		}
+
+		msg, err := b.stream.Recv()
+		if err == io.EOF {
+			b.done = true
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		b.chunk = msg.Chunk
+		b.done = msg.End
+	}
+
+	n := copy(p, b.chunk)
+	b.chunk = b.chunk[n:]
+	return n, nil
+}
+
+// Close ends the stream and closes the original body.
+func (b *grpcStreamBody) Close() error {
+	b.cancel()
+	return b.body.Close()
+}
+
+func (c *grpcPluginClient) hookTimeout(hookName string) time.Duration {
+	if timeout, ok := c.hookTimeouts[hookName]; ok {
+		return timeout
+	}
+	return c.timeout
+}
+
+// report records the result of a call in the circuit breaker.
+func (c *grpcPluginClient) report(err error) {
+	if c.breaker == nil {
+		return
+	}
+
+	if err != nil {
+		c.breaker.Fail()
+	} else {
+		c.breaker.Success()
+	}
+}
+
+// Close releases the connections and the circuit breaker of the client.
+func (c *grpcPluginClient) Close() {
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+
+	if c.breaker != nil {
+		c.breaker.Stop()
+	}
+}
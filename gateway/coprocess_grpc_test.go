@@ -0,0 +1,277 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/coprocess"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+type testGRPCPluginServer struct {
+	coprocess.UnimplementedDispatcherServer
+	coprocess.UnimplementedStreamDispatcherServer
+	name string
+}
+
+func (s *testGRPCPluginServer) Dispatch(ctx context.Context, object *coprocess.Object) (*coprocess.Object, error) {
+	switch object.HookName {
+	case "slow":
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case "fail":
+		return nil, status.Error(codes.Internal, "failed")
+	case "headers":
+		if object.Response.Headers == nil {
+			object.Response.Headers = map[string]string{}
+		}
+		object.Response.Headers["X-Body-Length"] = strconv.Itoa(len(object.Response.RawBody))
+		object.Response.MultivalueHeaders = append(object.Response.MultivalueHeaders, &coprocess.Header{Key: "X-Body-Length", Values: []string{strconv.Itoa(len(object.Response.RawBody))}})
+		object.Response.RawBody = []byte("ignored")
+		return object, nil
+	}
+
+	object.Request.SetHeaders = map[string]string{"X-Server": s.name}
+	return object, nil
+}
+
+// DispatchStream sends the body back in upper case.
+func (s *testGRPCPluginServer) DispatchStream(stream coprocess.StreamDispatcher_DispatchStreamServer) error {
+	msg, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	object := msg.Object
+	if object.HookName == "slow" {
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	}
+
+	if object.Response.Headers == nil {
+		object.Response.Headers = map[string]string{}
+	}
+	object.Response.Headers["X-Server"] = s.name
+	object.Response.MultivalueHeaders = append(object.Response.MultivalueHeaders, &coprocess.Header{Key: "X-Server", Values: []string{s.name}})
+	object.Response.StatusCode = http.StatusAccepted
+	if err := stream.Send(&coprocess.StreamMessage{Object: object}); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		if len(msg.Chunk) > 0 {
+			if err := stream.Send(&coprocess.StreamMessage{Chunk: bytes.ToUpper(msg.Chunk)}); err != nil {
+				return err
+			}
+		}
+
+		if msg.End {
+			return stream.Send(&coprocess.StreamMessage{End: true})
+		}
+	}
+}
+
+func startTestGRPCPluginServer(t *testing.T, name string) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	coprocess.RegisterDispatcherServer(server, &testGRPCPluginServer{name: name})
+	coprocess.RegisterStreamDispatcherServer(server, &testGRPCPluginServer{name: name})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return "tcp://" + listener.Addr().String()
+}
+
+func testGRPCPluginObject(hookName string) *coprocess.Object {
+	return &coprocess.Object{
+		HookName: hookName,
+		Request:  &coprocess.MiniRequestObject{},
+	}
+}
+
+func TestGRPCPluginClient(t *testing.T) {
+	first := startTestGRPCPluginServer(t, "first")
+	second := startTestGRPCPluginServer(t, "second")
+
+	t.Run("calls are balanced across servers", func(t *testing.T) {
+		client, err := newGRPCPluginClient(apidef.GRPCPluginServer{
+			Addresses: []string{first, second},
+			PoolSize:  2,
+		}, nil, "", grpc.EmptyDialOption{})
+		require.NoError(t, err)
+		defer client.Close()
+
+		servers := map[string]bool{}
+		for i := 0; i < 20; i++ {
+			object, err := client.Dispatch(testGRPCPluginObject("hook"))
+			require.NoError(t, err)
+			servers[object.Request.SetHeaders["X-Server"]] = true
+		}
+		assert.Equal(t, map[string]bool{"first": true, "second": true}, servers)
+	})
+
+	t.Run("hook timeouts", func(t *testing.T) {
+		client, err := newGRPCPluginClient(apidef.GRPCPluginServer{
+			Addresses:    []string{first},
+			Timeout:      5000,
+			HookTimeouts: map[string]int64{"slow": 50},
+		}, nil, "", grpc.EmptyDialOption{})
+		require.NoError(t, err)
+		defer client.Close()
+
+		start := time.Now()
+		_, err = client.Dispatch(testGRPCPluginObject("slow"))
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	for _, failOpen := range []bool{false, true} {
+		t.Run(fmt.Sprintf("circuit breaker, fail open: %v", failOpen), func(t *testing.T) {
+			client, err := newGRPCPluginClient(apidef.GRPCPluginServer{
+				Addresses: []string{first},
+				CircuitBreaker: apidef.GRPCPluginCircuitBreaker{
+					Enabled:          true,
+					ThresholdPercent: 0.5,
+					Samples:          2,
+					FailOpen:         failOpen,
+				},
+			}, nil, "", grpc.EmptyDialOption{})
+			require.NoError(t, err)
+			defer client.Close()
+
+			for i := 0; i < 2; i++ {
+				_, err := client.Dispatch(testGRPCPluginObject("fail"))
+				assert.Equal(t, codes.Internal, status.Code(err))
+			}
+
+			object := testGRPCPluginObject("hook")
+			result, err := client.Dispatch(object)
+			if failOpen {
+				assert.NoError(t, err, "the hook is skipped")
+				assert.Equal(t, object, result)
+			} else {
+				assert.Equal(t, errGRPCPluginBreakerOpen, err)
+			}
+		})
+	}
+}
+
+func TestGRPCPluginClient_DispatchStream(t *testing.T) {
+	server := startTestGRPCPluginServer(t, "stream")
+
+	client, err := newGRPCPluginClient(apidef.GRPCPluginServer{
+		Addresses:    []string{server},
+		HookTimeouts: map[string]int64{"slow": 50},
+	}, nil, "", grpc.EmptyDialOption{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	streamObject := func(hookName string) *coprocess.Object {
+		return &coprocess.Object{
+			HookName: hookName,
+			Request:  &coprocess.MiniRequestObject{},
+			Response: &coprocess.ResponseObject{Headers: map[string]string{}},
+		}
+	}
+
+	body := strings.Repeat("tyk", grpcStreamChunkSize)
+	object, newBody, err := client.DispatchStream(streamObject("upper"), io.NopCloser(strings.NewReader(body)))
+	require.NoError(t, err)
+	assert.Equal(t, "stream", object.Response.Headers["X-Server"])
+
+	data, err := io.ReadAll(newBody)
+	require.NoError(t, err)
+	assert.Equal(t, strings.ToUpper(body), string(data))
+	assert.NoError(t, newBody.Close())
+
+	t.Run("hook timeout", func(t *testing.T) {
+		_, _, err := client.DispatchStream(streamObject("slow"), io.NopCloser(strings.NewReader(body)))
+		assert.Equal(t, codes.Canceled, status.Code(err))
+	})
+}
+
+func TestCoProcessResponseBodyModes(t *testing.T) {
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.CoProcessOptions.EnableCoProcess = true
+	})
+	defer ts.Close()
+
+	server := startTestGRPCPluginServer(t, "plugins")
+
+	body := strings.Repeat("download", 16*1024)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write([]byte(body))
+	}))
+	defer upstream.Close()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "stream"
+		spec.Proxy.ListenPath = "/stream/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.CustomMiddleware = apidef.MiddlewareSection{
+			Driver:     apidef.GrpcDriver,
+			GRPCServer: apidef.GRPCPluginServer{Addresses: []string{server}},
+			Response:   []apidef.MiddlewareDefinition{{Name: "upper", BodyMode: apidef.StreamedBody}},
+		}
+	}, func(spec *APISpec) {
+		spec.APIID = "headers"
+		spec.Proxy.ListenPath = "/headers/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.CustomMiddleware = apidef.MiddlewareSection{
+			Driver:     apidef.GrpcDriver,
+			GRPCServer: apidef.GRPCPluginServer{Addresses: []string{server}},
+			Response:   []apidef.MiddlewareDefinition{{Name: "headers", BodyMode: apidef.HeadersOnlyBody}},
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/stream/")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, "plugins", resp.Header.Get("X-Server"))
+		assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+		assert.Equal(t, strings.ToUpper(body), string(data))
+	})
+
+	t.Run("headers only", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{
+			Path:         "/headers/",
+			Code:         http.StatusOK,
+			HeadersMatch: map[string]string{"X-Body-Length": "0"},
+			BodyMatchFunc: func(data []byte) bool {
+				return string(data) == body
+			},
+		})
+	})
+}
@@ -0,0 +1,518 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/coprocess"
+)
+
+const (
+	// wasmHostModule is the module name the host functions are imported from.
+	wasmHostModule = "tyk"
+
+	defaultWASMMaxMemoryPages = 256
+	defaultWASMTimeout        = 100 * time.Millisecond
+
+	// wasmContextVarsKey holds the context variables of the request in coprocess.Object.Spec, as JSON.
+	wasmContextVarsKey = "context_vars"
+	// wasmSetContextVarsKey holds the context variables set by a plugin in coprocess.Object.Spec, as JSON.
+	wasmSetContextVarsKey = "set_context_vars"
+)
+
+var errWASMMemoryAccess = errors.New("wasm plugin accessed memory out of bounds")
+
+// WASMDispatcher implements a coprocess.Dispatcher running WebAssembly plugins.
+//
+// Hooks are functions exported by the modules of a bundle, taking no arguments and returning
+// zero on success. Each call gets a fresh instance of the module, limited in memory and time,
+// with no access to the file system, network or environment of the gateway. Plugins act on the
+// request through the functions of the "tyk" host module, see wasmHostFunctions.
+//
+// The timeout is the only CPU bound: instructions aren't metered, the runtime aborts a call once
+// its context is done, checking at function calls and loop iterations. A call can thus keep a CPU
+// busy for up to the timeout.
+type WASMDispatcher struct {
+	coprocess.Dispatcher
+
+	runtime wazero.Runtime
+	timeout time.Duration
+
+	mu sync.RWMutex
+	// hooks holds the compiled modules by bundle hash and hook name.
+	hooks map[string]map[string]wazero.CompiledModule
+}
+
+// NewWASMDispatcher creates the WebAssembly runtime shared by the plugins.
+func NewWASMDispatcher(conf config.Config) (coprocess.Dispatcher, error) {
+	maxMemoryPages := conf.CoProcessOptions.WASMMaxMemoryPages
+	if maxMemoryPages == 0 {
+		maxMemoryPages = defaultWASMMaxMemoryPages
+	}
+
+	timeout := defaultWASMTimeout
+	if conf.CoProcessOptions.WASMTimeout > 0 {
+		timeout = time.Duration(conf.CoProcessOptions.WASMTimeout) * time.Millisecond
+	}
+
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(maxMemoryPages).
+		WithCloseOnContextDone(true))
+
+	// WASI is provided for the toolchains requiring it, without any file system, arguments or environment.
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		return nil, err
+	}
+
+	builder := runtime.NewHostModuleBuilder(wasmHostModule)
+	for name, fn := range wasmHostFunctions() {
+		builder.NewFunctionBuilder().WithFunc(fn).Export(name)
+	}
+	if _, err := builder.Instantiate(ctx); err != nil {
+		return nil, err
+	}
+
+	return &WASMDispatcher{
+		runtime: runtime,
+		timeout: timeout,
+		hooks:   make(map[string]map[string]wazero.CompiledModule),
+	}, nil
+}
+
+// Dispatch runs the hook of the object in a new instance of its module.
+func (d *WASMDispatcher) Dispatch(object *coprocess.Object) (*coprocess.Object, error) {
+	d.mu.RLock()
+	compiled := d.hooks[object.Spec["bundle_hash"]][object.HookName]
+	d.mu.RUnlock()
+
+	if compiled == nil {
+		return nil, fmt.Errorf("no wasm module exports hook %q", object.HookName)
+	}
+
+	// the returned object is compared to the original one by the response hook
+	call := &wasmCall{object: proto.Clone(object).(*coprocess.Object)}
+	initWASMObject(call.object)
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), wasmCallKey{}, call), d.timeout)
+	defer cancel()
+
+	module, err := d.runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize"))
+	if err != nil {
+		return nil, err
+	}
+	defer module.Close(context.Background())
+
+	hook := module.ExportedFunction(object.HookName)
+	if hook == nil {
+		return nil, fmt.Errorf("no wasm module exports hook %q", object.HookName)
+	}
+
+	results, err := hook.Call(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) > 0 && api.DecodeI32(results[0]) != 0 {
+		return nil, fmt.Errorf("wasm hook %q failed with code %d", object.HookName, api.DecodeI32(results[0]))
+	}
+
+	if len(call.setContextVars) > 0 {
+		setContextVars, err := json.Marshal(call.setContextVars)
+		if err != nil {
+			return nil, err
+		}
+		call.object.Spec[wasmSetContextVarsKey] = string(setContextVars)
+	}
+
+	return call.object, nil
+}
+
+// DispatchEvent isn't used by WebAssembly plugins.
+func (d *WASMDispatcher) DispatchEvent(eventJSON []byte) {}
+
+// Reload isn't used by WebAssembly plugins, bundles are compiled as they're loaded.
+func (d *WASMDispatcher) Reload() {}
+
+// HandleMiddlewareCache compiles the modules of a bundle. A hook runs the function of its name
+// exported by the module at its path, or by the first module of the bundle when it has no path.
+func (d *WASMDispatcher) HandleMiddlewareCache(b *apidef.BundleManifest, basePath string) {
+	bundleHash := filepath.Base(basePath)
+
+	d.mu.RLock()
+	_, loaded := d.hooks[bundleHash]
+	d.mu.RUnlock()
+
+	// bundles aren't updated in place, a reloaded bundle is loaded from a new directory
+	if loaded {
+		return
+	}
+
+	var defaultPath string
+	for _, f := range b.FileList {
+		if strings.HasSuffix(f, ".wasm") {
+			defaultPath = f
+			break
+		}
+	}
+
+	section := b.CustomMiddleware
+	definitions := append([]apidef.MiddlewareDefinition{section.AuthCheck}, section.Pre...)
+	definitions = append(definitions, section.PostKeyAuth...)
+	definitions = append(definitions, section.Post...)
+	definitions = append(definitions, section.Response...)
+
+	hooks := make(map[string]wazero.CompiledModule)
+	modules := make(map[string]wazero.CompiledModule)
+	for _, def := range definitions {
+		if def.Name == "" || def.Disabled {
+			continue
+		}
+
+		path := def.Path
+		if path == "" {
+			path = defaultPath
+		}
+
+		compiled, ok := modules[path]
+		if !ok {
+			modulePath, err := wasmModulePath(basePath, path)
+			if err == nil {
+				compiled, err = d.compile(modulePath)
+			}
+			if err != nil {
+				log.WithFields(logrus.Fields{
+					"prefix": "wasm",
+				}).WithError(err).Errorf("Couldn't compile module of hook '%s'", def.Name)
+				continue
+			}
+			modules[path] = compiled
+		}
+
+		hooks[def.Name] = compiled
+	}
+
+	d.mu.Lock()
+	d.hooks[bundleHash] = hooks
+	d.mu.Unlock()
+}
+
+// wasmModulePath returns the path of a module of the bundle at basePath, paths leading out of the bundle are refused.
+func wasmModulePath(basePath, path string) (string, error) {
+	modulePath := filepath.Join(basePath, path)
+	rel, err := filepath.Rel(basePath, modulePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("module path %q is outside of the bundle", path)
+	}
+
+	return modulePath, nil
+}
+
+func (d *WASMDispatcher) compile(path string) (wazero.CompiledModule, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.runtime.CompileModule(context.Background(), code)
+}
+
+// initWASMObject allocates the maps of the object the host functions write to, empty maps aren't cloned.
+func initWASMObject(object *coprocess.Object) {
+	if object.Spec == nil {
+		object.Spec = make(map[string]string)
+	}
+
+	if object.Request == nil {
+		object.Request = &coprocess.MiniRequestObject{}
+	}
+	req := object.Request
+	if req.Headers == nil {
+		req.Headers = make(map[string]string)
+	}
+	if req.SetHeaders == nil {
+		req.SetHeaders = make(map[string]string)
+	}
+	if req.ReturnOverrides == nil {
+		req.ReturnOverrides = &coprocess.ReturnOverrides{ResponseCode: -1}
+	}
+
+	if object.Response != nil && object.Response.Headers == nil {
+		object.Response.Headers = make(map[string]string)
+	}
+}
+
+type wasmCallKey struct{}
+
+// wasmCall is the state of a hook call, the host functions act on its object.
+type wasmCall struct {
+	object         *coprocess.Object
+	contextVars    map[string]interface{}
+	setContextVars map[string]string
+}
+
+func wasmCallFrom(ctx context.Context) *wasmCall {
+	return ctx.Value(wasmCallKey{}).(*wasmCall)
+}
+
+// wasmRead returns a copy of the guest memory at ptr.
+func wasmRead(m api.Module, ptr, size uint32) []byte {
+	b, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		panic(errWASMMemoryAccess)
+	}
+
+	return append([]byte(nil), b...)
+}
+
+func wasmReadString(m api.Module, ptr, size uint32) string {
+	return string(wasmRead(m, ptr, size))
+}
+
+// wasmWrite copies value to the guest buffer at ptr when it fits and returns its length,
+// so the guest can call again with a larger buffer.
+func wasmWrite(m api.Module, ptr, size uint32, value []byte) int32 {
+	if uint32(len(value)) <= size && !m.Memory().Write(ptr, value) {
+		panic(errWASMMemoryAccess)
+	}
+
+	return int32(len(value))
+}
+
+// wasmWriteValue writes a value looked up by the guest, -1 tells it was not found.
+func wasmWriteValue(m api.Module, ptr, size uint32, value string, found bool) int32 {
+	if !found {
+		return -1
+	}
+
+	return wasmWrite(m, ptr, size, []byte(value))
+}
+
+// wasmHostFunctions returns the functions of the "tyk" host module by name.
+//
+// Strings and bytes are passed as a pointer and a length in the guest memory. Getters copy
+// the value to the buffer given by the guest when it fits and return its length, or -1 when
+// it's not found. Response functions are only available to response hooks.
+func wasmHostFunctions() map[string]interface{} {
+	return map[string]interface{}{
+		"get_request_header": func(ctx context.Context, m api.Module, namePtr, nameLen, bufPtr, bufLen uint32) int32 {
+			headers := wasmCallFrom(ctx).object.Request.Headers
+			value, found := headers[http.CanonicalHeaderKey(wasmReadString(m, namePtr, nameLen))]
+			return wasmWriteValue(m, bufPtr, bufLen, value, found)
+		},
+		"set_request_header": func(ctx context.Context, m api.Module, namePtr, nameLen, valuePtr, valueLen uint32) {
+			req := wasmCallFrom(ctx).object.Request
+			name := http.CanonicalHeaderKey(wasmReadString(m, namePtr, nameLen))
+			value := wasmReadString(m, valuePtr, valueLen)
+
+			req.Headers[name] = value
+			req.SetHeaders[name] = value
+		},
+		"delete_request_header": func(ctx context.Context, m api.Module, namePtr, nameLen uint32) {
+			req := wasmCallFrom(ctx).object.Request
+			name := http.CanonicalHeaderKey(wasmReadString(m, namePtr, nameLen))
+
+			delete(req.Headers, name)
+			delete(req.SetHeaders, name)
+			req.DeleteHeaders = append(req.DeleteHeaders, name)
+		},
+		"get_request_body": func(ctx context.Context, m api.Module, bufPtr, bufLen uint32) int32 {
+			return wasmWrite(m, bufPtr, bufLen, wasmCallFrom(ctx).object.Request.RawBody)
+		},
+		"set_request_body": func(ctx context.Context, m api.Module, ptr, size uint32) {
+			req := wasmCallFrom(ctx).object.Request
+			req.RawBody = wasmRead(m, ptr, size)
+			req.Body = string(req.RawBody)
+		},
+		"get_response_header": func(ctx context.Context, m api.Module, namePtr, nameLen, bufPtr, bufLen uint32) int32 {
+			res := wasmCallFrom(ctx).object.Response
+			if res == nil {
+				return -1
+			}
+
+			value, found := res.Headers[http.CanonicalHeaderKey(wasmReadString(m, namePtr, nameLen))]
+			return wasmWriteValue(m, bufPtr, bufLen, value, found)
+		},
+		"set_response_header": func(ctx context.Context, m api.Module, namePtr, nameLen, valuePtr, valueLen uint32) {
+			res := wasmCallFrom(ctx).object.Response
+			if res == nil {
+				return
+			}
+
+			name := http.CanonicalHeaderKey(wasmReadString(m, namePtr, nameLen))
+			value := wasmReadString(m, valuePtr, valueLen)
+
+			res.Headers[name] = value
+			for _, h := range res.MultivalueHeaders {
+				if h.Key == name {
+					h.Values = []string{value}
+					return
+				}
+			}
+			res.MultivalueHeaders = append(res.MultivalueHeaders, &coprocess.Header{Key: name, Values: []string{value}})
+		},
+		"delete_response_header": func(ctx context.Context, m api.Module, namePtr, nameLen uint32) {
+			res := wasmCallFrom(ctx).object.Response
+			if res == nil {
+				return
+			}
+
+			name := http.CanonicalHeaderKey(wasmReadString(m, namePtr, nameLen))
+
+			delete(res.Headers, name)
+			for i, h := range res.MultivalueHeaders {
+				if h.Key == name {
+					res.MultivalueHeaders = append(res.MultivalueHeaders[:i], res.MultivalueHeaders[i+1:]...)
+					return
+				}
+			}
+		},
+		"get_response_body": func(ctx context.Context, m api.Module, bufPtr, bufLen uint32) int32 {
+			res := wasmCallFrom(ctx).object.Response
+			if res == nil {
+				return -1
+			}
+
+			return wasmWrite(m, bufPtr, bufLen, res.RawBody)
+		},
+		"set_response_body": func(ctx context.Context, m api.Module, ptr, size uint32) {
+			res := wasmCallFrom(ctx).object.Response
+			if res == nil {
+				return
+			}
+
+			res.RawBody = wasmRead(m, ptr, size)
+			res.Body = string(res.RawBody)
+		},
+		"get_response_status": func(ctx context.Context) int32 {
+			res := wasmCallFrom(ctx).object.Response
+			if res == nil {
+				return -1
+			}
+
+			return res.StatusCode
+		},
+		"set_response_status": func(ctx context.Context, status int32) {
+			if res := wasmCallFrom(ctx).object.Response; res != nil {
+				res.StatusCode = status
+			}
+		},
+		"get_session_metadata": func(ctx context.Context, m api.Module, keyPtr, keyLen, bufPtr, bufLen uint32) int32 {
+			session := wasmCallFrom(ctx).object.Session
+			if session == nil {
+				return -1
+			}
+
+			value, found := session.Metadata[wasmReadString(m, keyPtr, keyLen)]
+			return wasmWriteValue(m, bufPtr, bufLen, value, found)
+		},
+		"set_session_metadata": func(ctx context.Context, m api.Module, keyPtr, keyLen, valuePtr, valueLen uint32) {
+			object := wasmCallFrom(ctx).object
+			key := wasmReadString(m, keyPtr, keyLen)
+			value := wasmReadString(m, valuePtr, valueLen)
+
+			// custom key checks create the session, its "token" metadata is the key
+			if object.Session == nil {
+				object.Session = &coprocess.SessionState{}
+			}
+			if object.Session.Metadata == nil {
+				object.Session.Metadata = make(map[string]string)
+			}
+			object.Session.Metadata[key] = value
+
+			// the metadata of the object takes precedence over the session's
+			if object.Metadata != nil {
+				object.Metadata[key] = value
+			}
+		},
+		"apply_session_policy": func(ctx context.Context, m api.Module, idPtr, idLen uint32) {
+			object := wasmCallFrom(ctx).object
+			if object.Session == nil {
+				object.Session = &coprocess.SessionState{}
+			}
+
+			object.Session.ApplyPolicies = append(object.Session.ApplyPolicies, wasmReadString(m, idPtr, idLen))
+		},
+		"get_context_var": func(ctx context.Context, m api.Module, namePtr, nameLen, bufPtr, bufLen uint32) int32 {
+			call := wasmCallFrom(ctx)
+			name := wasmReadString(m, namePtr, nameLen)
+
+			if value, found := call.setContextVars[name]; found {
+				return wasmWrite(m, bufPtr, bufLen, []byte(value))
+			}
+
+			if call.contextVars == nil {
+				call.contextVars = make(map[string]interface{})
+				_ = json.Unmarshal([]byte(call.object.Spec[wasmContextVarsKey]), &call.contextVars)
+			}
+
+			value, found := call.contextVars[name]
+			if !found {
+				return -1
+			}
+
+			if s, ok := value.(string); ok {
+				return wasmWrite(m, bufPtr, bufLen, []byte(s))
+			}
+
+			// other values are passed as JSON
+			encoded, _ := json.Marshal(value)
+			return wasmWrite(m, bufPtr, bufLen, encoded)
+		},
+		"set_context_var": func(ctx context.Context, m api.Module, namePtr, nameLen, valuePtr, valueLen uint32) {
+			call := wasmCallFrom(ctx)
+			if call.setContextVars == nil {
+				call.setContextVars = make(map[string]string)
+			}
+
+			call.setContextVars[wasmReadString(m, namePtr, nameLen)] = wasmReadString(m, valuePtr, valueLen)
+		},
+		"get_config_data": func(ctx context.Context, m api.Module, bufPtr, bufLen uint32) int32 {
+			value, found := wasmCallFrom(ctx).object.Spec["config_data"]
+			return wasmWriteValue(m, bufPtr, bufLen, value, found)
+		},
+		"set_return_override": func(ctx context.Context, m api.Module, status int32, bodyPtr, bodyLen uint32) {
+			overrides := wasmCallFrom(ctx).object.Request.ReturnOverrides
+			overrides.ResponseCode = status
+			overrides.ResponseBody = wasmReadString(m, bodyPtr, bodyLen)
+		},
+		"log": func(ctx context.Context, m api.Module, level int32, msgPtr, msgLen uint32) {
+			object := wasmCallFrom(ctx).object
+			logger := log.WithFields(logrus.Fields{
+				"prefix": "wasm",
+				"api_id": object.Spec["APIID"],
+				"hook":   object.HookName,
+			})
+
+			msg := wasmReadString(m, msgPtr, msgLen)
+			switch level {
+			case 0:
+				logger.Debug(msg)
+			case 1:
+				logger.Info(msg)
+			case 2:
+				logger.Warning(msg)
+			default:
+				logger.Error(msg)
+			}
+		},
+	}
+}
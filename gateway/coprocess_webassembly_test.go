@@ -0,0 +1,183 @@
+package gateway
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/coprocess"
+)
+
+func wasmVector(items ...[]byte) []byte {
+	out := []byte{byte(len(items))}
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func wasmName(name string) []byte {
+	return append([]byte{byte(len(name))}, name...)
+}
+
+func wasmSection(id byte, content []byte) []byte {
+	return append([]byte{id, byte(len(content))}, content...)
+}
+
+// testWASMModule is a module importing two host functions and exporting these hooks:
+//   - CopyHeader sets X-Wasm to the value of X-In,
+//   - Loop never returns,
+//   - Fail returns 1,
+//   - Grow fails when its memory can't grow by 100 pages.
+func testWASMModule() []byte {
+	const i32 = 0x7f
+
+	types := wasmVector(
+		[]byte{0x60, 4, i32, i32, i32, i32, 0},      // set_request_header
+		[]byte{0x60, 4, i32, i32, i32, i32, 1, i32}, // get_request_header
+		[]byte{0x60, 0, 1, i32},                     // hooks
+	)
+
+	imports := wasmVector(
+		append(append(wasmName("tyk"), wasmName("set_request_header")...), 0x00, 0),
+		append(append(wasmName("tyk"), wasmName("get_request_header")...), 0x00, 1),
+	)
+
+	functions := wasmVector([]byte{2}, []byte{2}, []byte{2}, []byte{2})
+
+	memory := wasmVector([]byte{0x00, 1})
+
+	exports := wasmVector(
+		append(wasmName("memory"), 0x02, 0),
+		append(wasmName("CopyHeader"), 0x00, 2),
+		append(wasmName("Loop"), 0x00, 3),
+		append(wasmName("Fail"), 0x00, 4),
+		append(wasmName("Grow"), 0x00, 5),
+	)
+
+	body := func(locals []byte, code ...byte) []byte {
+		b := append(locals, code...)
+		return append([]byte{byte(len(b))}, b...)
+	}
+	code := wasmVector(
+		body([]byte{1, 1, i32},
+			0x41, 16, 0x41, 4, 0x41, 32, 0x41, 16, 0x10, 1, 0x21, 0, // n = get_request_header("X-In", buf)
+			0x41, 0, 0x41, 6, 0x41, 32, 0x20, 0, 0x10, 0, // set_request_header("X-Wasm", buf[:n])
+			0x41, 0, 0x0b),
+		body([]byte{0}, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x41, 0, 0x0b),
+		body([]byte{0}, 0x41, 1, 0x0b),
+		body([]byte{0}, 0x41, 0xe4, 0x00, 0x40, 0x00, 0x41, 0x7f, 0x46, 0x0b),
+	)
+
+	data := wasmVector(
+		append([]byte{0x00, 0x41, 0, 0x0b}, wasmName("X-Wasm")...),
+		append([]byte{0x00, 0x41, 16, 0x0b}, wasmName("X-In")...),
+	)
+
+	module := []byte{0x00, 'a', 's', 'm', 1, 0, 0, 0}
+	for _, section := range [][]byte{
+		wasmSection(1, types),
+		wasmSection(2, imports),
+		wasmSection(3, functions),
+		wasmSection(5, memory),
+		wasmSection(7, exports),
+		wasmSection(10, code),
+		wasmSection(11, data),
+	} {
+		module = append(module, section...)
+	}
+
+	return module
+}
+
+func TestWASMDispatcher(t *testing.T) {
+	basePath := filepath.Join(t.TempDir(), "bundle-hash")
+	require.NoError(t, os.Mkdir(basePath, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(basePath, "plugin.wasm"), testWASMModule(), 0600))
+
+	conf := config.Config{}
+	conf.CoProcessOptions.WASMMaxMemoryPages = 16
+	conf.CoProcessOptions.WASMTimeout = 50
+
+	dispatcher, err := NewWASMDispatcher(conf)
+	require.NoError(t, err)
+
+	dispatcher.HandleMiddlewareCache(&apidef.BundleManifest{
+		FileList: []string{"plugin.wasm"},
+		CustomMiddleware: apidef.MiddlewareSection{
+			Driver: apidef.WASMDriver,
+			Pre: []apidef.MiddlewareDefinition{
+				{Name: "CopyHeader"},
+				{Name: "Loop"},
+				{Name: "Fail", Path: "plugin.wasm"},
+				{Name: "Grow"},
+			},
+		},
+	}, basePath)
+
+	object := func(hookName string) *coprocess.Object {
+		return &coprocess.Object{
+			HookName: hookName,
+			HookType: coprocess.HookType_Pre,
+			Spec:     map[string]string{"bundle_hash": "bundle-hash"},
+			Request: &coprocess.MiniRequestObject{
+				Headers:         map[string]string{"X-In": "hello"},
+				SetHeaders:      map[string]string{},
+				ReturnOverrides: &coprocess.ReturnOverrides{ResponseCode: -1},
+			},
+		}
+	}
+
+	t.Run("hooks act on the request", func(t *testing.T) {
+		in := object("CopyHeader")
+
+		out, err := dispatcher.Dispatch(in)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"X-Wasm": "hello"}, out.Request.SetHeaders)
+		assert.Equal(t, "hello", out.Request.Headers["X-Wasm"])
+		assert.Empty(t, in.Request.SetHeaders, "the original object is left unchanged")
+	})
+
+	t.Run("calls are limited in time", func(t *testing.T) {
+		start := time.Now()
+		_, err := dispatcher.Dispatch(object("Loop"))
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("calls are limited in memory", func(t *testing.T) {
+		_, err := dispatcher.Dispatch(object("Grow"))
+		assert.Error(t, err)
+	})
+
+	t.Run("modules outside of the bundle", func(t *testing.T) {
+		escapePath := filepath.Join(filepath.Dir(basePath), "escape-hash")
+		require.NoError(t, os.Mkdir(escapePath, 0700))
+
+		dispatcher.HandleMiddlewareCache(&apidef.BundleManifest{
+			CustomMiddleware: apidef.MiddlewareSection{
+				Driver: apidef.WASMDriver,
+				Pre:    []apidef.MiddlewareDefinition{{Name: "CopyHeader", Path: "../bundle-hash/plugin.wasm"}},
+			},
+		}, escapePath)
+
+		in := object("CopyHeader")
+		in.Spec["bundle_hash"] = "escape-hash"
+		_, err := dispatcher.Dispatch(in)
+		assert.Error(t, err)
+	})
+
+	t.Run("failed hooks", func(t *testing.T) {
+		_, err := dispatcher.Dispatch(object("Fail"))
+		assert.Error(t, err)
+
+		_, err = dispatcher.Dispatch(object("Missing"))
+		assert.Error(t, err)
+	})
+}
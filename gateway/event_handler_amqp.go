@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// amqpConfirmTimeout is how long a batch waits for the broker to confirm it.
+const amqpConfirmTimeout = 5 * time.Second
+
+// amqpEventSink publishes events to an AMQP 0.9.1 exchange, on a channel in confirm mode.
+type amqpEventSink struct {
+	conf config.AMQPEventHandlerConf
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+}
+
+func newAMQPEventSink(handlerConf interface{}) (eventSink, config.EventSinkConf, error) {
+	var conf config.AMQPEventHandlerConf
+	if err := decodeEventHandlerConf(handlerConf, &conf); err != nil {
+		return nil, conf.EventSinkConf, err
+	}
+
+	if conf.URL == "" {
+		return nil, conf.EventSinkConf, errors.New("AMQP URL is required")
+	}
+	if _, err := amqp.ParseURI(conf.URL); err != nil {
+		return nil, conf.EventSinkConf, err
+	}
+
+	return &amqpEventSink{conf: conf}, conf.EventSinkConf, nil
+}
+
+// connect opens the connection and the channel, again after the broker closed them.
+func (s *amqpEventSink) connect() error {
+	if s.channel != nil && !s.channel.IsClosed() {
+		return nil
+	}
+	s.close()
+
+	conn, err := amqp.DialConfig(s.conf.URL, amqp.Config{
+		Heartbeat:       10 * time.Second,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: s.conf.SSLInsecureSkipVerify},
+		Properties:      amqp.Table{"connection_name": "tyk"},
+	})
+	if err != nil {
+		return err
+	}
+
+	channel, err := conn.Channel()
+	if err == nil {
+		err = channel.Confirm(false)
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	s.conn, s.channel = conn, channel
+	return nil
+}
+
+// Send publishes the events and waits for the broker to confirm them, the connection is made on the first batch.
+func (s *amqpEventSink) Send(events []sinkEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), amqpConfirmTimeout)
+	defer cancel()
+
+	confirms := make([]*amqp.DeferredConfirmation, 0, len(events))
+	for _, event := range events {
+		routingKey := s.conf.RoutingKey
+		if routingKey == "" {
+			routingKey = string(event.Type)
+		}
+
+		confirm, err := s.channel.PublishWithDeferredConfirmWithContext(ctx, s.conf.Exchange, routingKey, false, false, amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Timestamp:    time.Now(),
+			Type:         string(event.Type),
+			Body:         event.Body,
+		})
+		if err != nil {
+			return err
+		}
+		confirms = append(confirms, confirm)
+	}
+
+	for _, confirm := range confirms {
+		acked, err := confirm.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		if !acked {
+			return fmt.Errorf("event %d of the batch was rejected by the broker", confirm.DeliveryTag)
+		}
+	}
+
+	return nil
+}
+
+func (s *amqpEventSink) close() error {
+	var err error
+	if s.conn != nil && !s.conn.IsClosed() {
+		err = s.conn.Close()
+	}
+	s.conn, s.channel = nil, nil
+	return err
+}
+
+func (s *amqpEventSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.close()
+}
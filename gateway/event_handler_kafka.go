@@ -0,0 +1,98 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"errors"
+	"sync"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// newKafkaProducer creates the producers of the Kafka event sinks, replaced in tests.
+var newKafkaProducer = sarama.NewSyncProducer
+
+// kafkaEventSink produces events to a Kafka topic, keyed by event type.
+type kafkaEventSink struct {
+	conf       config.KafkaEventHandlerConf
+	saramaConf *sarama.Config
+
+	mu       sync.Mutex
+	producer sarama.SyncProducer
+}
+
+func newKafkaEventSink(handlerConf interface{}) (eventSink, config.EventSinkConf, error) {
+	var conf config.KafkaEventHandlerConf
+	if err := decodeEventHandlerConf(handlerConf, &conf); err != nil {
+		return nil, conf.EventSinkConf, err
+	}
+
+	if len(conf.Brokers) == 0 || conf.Topic == "" {
+		return nil, conf.EventSinkConf, errors.New("Kafka brokers and topic are required")
+	}
+
+	saramaConf := sarama.NewConfig()
+	saramaConf.ClientID = "tyk"
+	if conf.ClientID != "" {
+		saramaConf.ClientID = conf.ClientID
+	}
+	saramaConf.Producer.Return.Successes = true
+	saramaConf.Producer.RequiredAcks = sarama.WaitForAll
+	// the event sink handler retries failed batches
+	saramaConf.Producer.Retry.Max = 0
+
+	if conf.UseTLS {
+		saramaConf.Net.TLS.Enable = true
+		saramaConf.Net.TLS.Config = &tls.Config{InsecureSkipVerify: conf.SSLInsecureSkipVerify}
+	}
+
+	if conf.SASLUsername != "" {
+		saramaConf.Net.SASL.Enable = true
+		saramaConf.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		saramaConf.Net.SASL.User = conf.SASLUsername
+		saramaConf.Net.SASL.Password = conf.SASLPassword
+	}
+
+	if err := saramaConf.Validate(); err != nil {
+		return nil, conf.EventSinkConf, err
+	}
+
+	return &kafkaEventSink{conf: conf, saramaConf: saramaConf}, conf.EventSinkConf, nil
+}
+
+// Send produces the events, the producer is created on the first batch so that the brokers don't have to be
+// available when the handler is loaded.
+func (s *kafkaEventSink) Send(events []sinkEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.producer == nil {
+		producer, err := newKafkaProducer(s.conf.Brokers, s.saramaConf)
+		if err != nil {
+			return err
+		}
+		s.producer = producer
+	}
+
+	msgs := make([]*sarama.ProducerMessage, len(events))
+	for i, event := range events {
+		msgs[i] = &sarama.ProducerMessage{
+			Topic: s.conf.Topic,
+			Key:   sarama.StringEncoder(event.Type),
+			Value: sarama.ByteEncoder(event.Body),
+		}
+	}
+
+	return s.producer.SendMessages(msgs)
+}
+
+func (s *kafkaEventSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.producer == nil {
+		return nil
+	}
+	return s.producer.Close()
+}
@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// natsFlushTimeout is how long a batch waits for the NATS server to acknowledge it.
+const natsFlushTimeout = 5 * time.Second
+
+// natsEventSink publishes events to a NATS subject.
+type natsEventSink struct {
+	conf config.NATSEventHandlerConf
+
+	mu   sync.Mutex
+	conn *nats.Conn
+}
+
+func newNATSEventSink(handlerConf interface{}) (eventSink, config.EventSinkConf, error) {
+	var conf config.NATSEventHandlerConf
+	if err := decodeEventHandlerConf(handlerConf, &conf); err != nil {
+		return nil, conf.EventSinkConf, err
+	}
+
+	if conf.URL == "" || conf.Subject == "" {
+		return nil, conf.EventSinkConf, errors.New("NATS URL and subject are required")
+	}
+
+	return &natsEventSink{conf: conf}, conf.EventSinkConf, nil
+}
+
+// subject returns the subject of an event, the event type is appended to subjects ending with a dot.
+func (s *natsEventSink) subject(event sinkEvent) string {
+	if strings.HasSuffix(s.conf.Subject, ".") {
+		return s.conf.Subject + string(event.Type)
+	}
+	return s.conf.Subject
+}
+
+// Send publishes the events and waits for the server to process them, the connection is made on the first batch.
+func (s *natsEventSink) Send(events []sinkEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		opts := []nats.Option{nats.Name("tyk"), nats.MaxReconnects(-1)}
+		if s.conf.Token != "" {
+			opts = append(opts, nats.Token(s.conf.Token))
+		}
+		if s.conf.Username != "" {
+			opts = append(opts, nats.UserInfo(s.conf.Username, s.conf.Password))
+		}
+
+		conn, err := nats.Connect(s.conf.URL, opts...)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	for _, event := range events {
+		if err := s.conn.Publish(s.subject(event), event.Body); err != nil {
+			return err
+		}
+	}
+
+	return s.conn.FlushTimeout(natsFlushTimeout)
+}
+
+func (s *natsEventSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return nil
+}
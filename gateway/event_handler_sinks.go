@@ -0,0 +1,277 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+const (
+	EH_KafkaHandler  apidef.TykEventHandlerName = "eh_kafka_handler"
+	EH_NATSHandler   apidef.TykEventHandlerName = "eh_nats_handler"
+	EH_AMQPHandler   apidef.TykEventHandlerName = "eh_amqp_handler"
+	EH_SyslogHandler apidef.TykEventHandlerName = "eh_syslog_handler"
+
+	defaultEventSinkBatchSize     = 100
+	defaultEventSinkFlushInterval = time.Second
+	defaultEventSinkQueueSize     = 1000
+	defaultEventSinkMaxRetries    = 3
+	defaultEventSinkRetryBackoff  = 500 * time.Millisecond
+)
+
+// sinkEvent is an event rendered by the template of an event sink handler.
+type sinkEvent struct {
+	Type apidef.TykEvent
+	Body []byte
+}
+
+// eventSink sends batches of events to a message broker or a log server.
+type eventSink interface {
+	Send(events []sinkEvent) error
+	Close() error
+}
+
+// eventSinks creates the sinks of the event sink handlers from their handler configuration.
+var eventSinks = map[apidef.TykEventHandlerName]func(handlerConf interface{}) (eventSink, config.EventSinkConf, error){
+	EH_KafkaHandler:  newKafkaEventSink,
+	EH_NATSHandler:   newNATSEventSink,
+	EH_AMQPHandler:   newAMQPEventSink,
+	EH_SyslogHandler: newSyslogEventSink,
+}
+
+// decodeEventHandlerConf decodes the handler configuration of an event handler into conf.
+func decodeEventHandlerConf(handlerConf interface{}, conf interface{}) error {
+	asJSON, err := json.Marshal(handlerConf)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(asJSON, conf)
+}
+
+// EventSinkHandler is an event handler sending the events rendered by the webhook templates to Kafka, NATS,
+// AMQP or syslog. Events are sent in batches by a worker, failed batches are retried and the events which
+// can't be sent are appended to a dead-letter file.
+type EventSinkHandler struct {
+	Name apidef.TykEventHandlerName
+	Gw   *Gateway
+
+	conf     config.EventSinkConf
+	template *template.Template
+	sink     eventSink
+	logger   *logrus.Entry
+
+	mu     sync.RWMutex // guards closed and the queue against Close
+	closed bool
+	queue  chan sinkEvent
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	deadLetterMu sync.Mutex
+}
+
+// Init creates the sink and starts the worker sending the events.
+func (h *EventSinkHandler) Init(handlerConf interface{}) error {
+	h.logger = log.WithFields(logrus.Fields{
+		"prefix":  "events",
+		"handler": h.Name,
+	})
+
+	newSink, ok := eventSinks[h.Name]
+	if !ok {
+		return fmt.Errorf("unknown event sink %q", h.Name)
+	}
+
+	var err error
+	h.sink, h.conf, err = newSink(handlerConf)
+	if err != nil {
+		h.logger.WithError(err).Error("Problem getting configuration, skipping.")
+		return err
+	}
+
+	h.template, _, err = h.Gw.loadEventTemplate(h.conf.TemplatePath, h.logger)
+	if err != nil {
+		h.sink.Close()
+		return err
+	}
+
+	if h.conf.BatchSize <= 0 {
+		h.conf.BatchSize = defaultEventSinkBatchSize
+	}
+	if h.conf.QueueSize <= 0 {
+		h.conf.QueueSize = defaultEventSinkQueueSize
+	}
+	if h.conf.MaxRetries == 0 {
+		h.conf.MaxRetries = defaultEventSinkMaxRetries
+	}
+
+	h.queue = make(chan sinkEvent, h.conf.QueueSize)
+	h.done = make(chan struct{})
+	h.wg.Add(1)
+	go h.run()
+
+	return nil
+}
+
+// HandleEvent renders the event and queues it for the worker.
+func (h *EventSinkHandler) HandleEvent(em config.EventMessage) {
+	var body bytes.Buffer
+	if err := h.template.Execute(&body, em); err != nil {
+		h.logger.WithError(err).Error("Couldn't render event")
+		return
+	}
+	event := sinkEvent{Type: em.Type, Body: body.Bytes()}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		h.deadLetter([]sinkEvent{event}, errors.New("handler is closed"))
+		return
+	}
+
+	select {
+	case h.queue <- event:
+	default:
+		h.deadLetter([]sinkEvent{event}, errors.New("queue is full"))
+	}
+}
+
+// Close sends the queued events and closes the sink.
+func (h *EventSinkHandler) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	h.mu.Unlock()
+
+	close(h.done)
+	h.wg.Wait()
+
+	return h.sink.Close()
+}
+
+func (h *EventSinkHandler) run() {
+	defer h.wg.Done()
+
+	flushInterval := time.Duration(h.conf.FlushInterval) * time.Millisecond
+	if flushInterval <= 0 {
+		flushInterval = defaultEventSinkFlushInterval
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]sinkEvent, 0, h.conf.BatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			h.send(batch)
+			batch = make([]sinkEvent, 0, h.conf.BatchSize)
+		}
+	}
+
+	for {
+		select {
+		case event := <-h.queue:
+			batch = append(batch, event)
+			if len(batch) >= h.conf.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-h.done:
+			// no events are queued once the handler is closed
+			for {
+				select {
+				case event := <-h.queue:
+					batch = append(batch, event)
+					if len(batch) >= h.conf.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send sends a batch, retrying with an exponential backoff, the batch is written to the dead-letter file if
+// it can't be sent.
+func (h *EventSinkHandler) send(batch []sinkEvent) {
+	backoff := time.Duration(h.conf.RetryBackoff) * time.Millisecond
+	if backoff <= 0 {
+		backoff = defaultEventSinkRetryBackoff
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = h.sink.Send(batch); err == nil {
+			return
+		}
+
+		if attempt >= h.conf.MaxRetries {
+			break
+		}
+
+		h.logger.WithError(err).Debugf("Couldn't send %d events, retrying in %s", len(batch), backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	h.logger.WithError(err).Errorf("Couldn't send %d events", len(batch))
+	h.deadLetter(batch, err)
+}
+
+// deadLetterRecord is a line of the dead-letter file.
+type deadLetterRecord struct {
+	Time    time.Time                  `json:"time"`
+	Handler apidef.TykEventHandlerName `json:"handler"`
+	Type    apidef.TykEvent            `json:"type"`
+	Error   string                     `json:"error"`
+	Event   string                     `json:"event"`
+}
+
+// deadLetter appends events which couldn't be sent to the dead-letter file.
+func (h *EventSinkHandler) deadLetter(events []sinkEvent, cause error) {
+	if h.conf.DeadLetterPath == "" {
+		h.logger.WithError(cause).Warningf("Dropped %d events", len(events))
+		return
+	}
+
+	h.deadLetterMu.Lock()
+	defer h.deadLetterMu.Unlock()
+
+	f, err := os.OpenFile(h.conf.DeadLetterPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		h.logger.WithError(err).Errorf("Couldn't open the dead-letter file, dropped %d events", len(events))
+		return
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, event := range events {
+		err := enc.Encode(deadLetterRecord{
+			Time:    time.Now().UTC(),
+			Handler: h.Name,
+			Type:    event.Type,
+			Error:   cause.Error(),
+			Event:   string(event.Body),
+		})
+		if err != nil {
+			h.logger.WithError(err).Error("Couldn't write to the dead-letter file")
+			return
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+const testEventSinkHandler apidef.TykEventHandlerName = "eh_test_handler"
+
+// testEventSink records the batches it's sent, failing the first failures batches.
+type testEventSink struct {
+	mu       sync.Mutex
+	failures int
+	batches  [][]sinkEvent
+	closed   bool
+}
+
+func (s *testEventSink) Send(events []sinkEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("sink is down")
+	}
+	s.batches = append(s.batches, events)
+	return nil
+}
+
+func (s *testEventSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	return nil
+}
+
+func (s *testEventSink) batchSizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sizes := make([]int, len(s.batches))
+	for i, batch := range s.batches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+func newTestEventSinkHandler(t *testing.T, sink eventSink, conf config.EventSinkConf) *EventSinkHandler {
+	t.Helper()
+
+	eventSinks[testEventSinkHandler] = func(interface{}) (eventSink, config.EventSinkConf, error) {
+		return sink, conf, nil
+	}
+	t.Cleanup(func() {
+		delete(eventSinks, testEventSinkHandler)
+	})
+
+	h := &EventSinkHandler{Name: testEventSinkHandler}
+	require.NoError(t, h.Init(nil))
+	return h
+}
+
+func testSinkEventMessage(key string) config.EventMessage {
+	return config.EventMessage{
+		Type: EventAuthFailure,
+		Meta: EventKeyFailureMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Auth Failure"},
+			Path:             "/test",
+			Origin:           "127.0.0.1",
+			Key:              key,
+		},
+	}
+}
+
+func readDeadLetters(t *testing.T, path string) []deadLetterRecord {
+	t.Helper()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []deadLetterRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record deadLetterRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestEventSinkHandler_Batching(t *testing.T) {
+	sink := &testEventSink{}
+	h := newTestEventSinkHandler(t, sink, config.EventSinkConf{
+		TemplatePath:  "../templates/default_webhook.json",
+		BatchSize:     2,
+		FlushInterval: 50,
+	})
+
+	for i := 0; i < 5; i++ {
+		h.HandleEvent(testSinkEventMessage("key" + strconv.Itoa(i)))
+	}
+
+	assert.Eventually(t, func() bool {
+		total := 0
+		for _, size := range sink.batchSizes() {
+			total += size
+		}
+		return total == 5
+	}, time.Second, 10*time.Millisecond)
+
+	for _, size := range sink.batchSizes() {
+		assert.LessOrEqual(t, size, 2)
+	}
+
+	sink.mu.Lock()
+	event := sink.batches[0][0]
+	sink.mu.Unlock()
+	assert.Equal(t, EventAuthFailure, event.Type)
+	assert.Contains(t, string(event.Body), `"key": "key0"`)
+
+	require.NoError(t, h.Close())
+	assert.True(t, sink.closed)
+}
+
+func TestEventSinkHandler_CloseFlushes(t *testing.T) {
+	sink := &testEventSink{}
+	h := newTestEventSinkHandler(t, sink, config.EventSinkConf{
+		TemplatePath:  "../templates/default_webhook.json",
+		FlushInterval: 60000,
+	})
+
+	h.HandleEvent(testSinkEventMessage("key"))
+	require.NoError(t, h.Close())
+	assert.Equal(t, []int{1}, sink.batchSizes())
+
+	// events handled once closed are dead letters
+	h.HandleEvent(testSinkEventMessage("key"))
+	assert.Equal(t, []int{1}, sink.batchSizes())
+}
+
+func TestEventSinkHandler_Retries(t *testing.T) {
+	deadLetterPath := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+
+	t.Run("sent after retrying", func(t *testing.T) {
+		sink := &testEventSink{failures: 2}
+		h := newTestEventSinkHandler(t, sink, config.EventSinkConf{
+			TemplatePath:   "../templates/default_webhook.json",
+			MaxRetries:     2,
+			RetryBackoff:   1,
+			DeadLetterPath: deadLetterPath,
+		})
+
+		h.HandleEvent(testSinkEventMessage("key"))
+		require.NoError(t, h.Close())
+
+		assert.Equal(t, []int{1}, sink.batchSizes())
+		assert.NoFileExists(t, deadLetterPath)
+	})
+
+	t.Run("dead letters", func(t *testing.T) {
+		sink := &testEventSink{failures: 3}
+		h := newTestEventSinkHandler(t, sink, config.EventSinkConf{
+			TemplatePath:   "../templates/default_webhook.json",
+			MaxRetries:     2,
+			RetryBackoff:   1,
+			DeadLetterPath: deadLetterPath,
+		})
+
+		h.HandleEvent(testSinkEventMessage("key1"))
+		h.HandleEvent(testSinkEventMessage("key2"))
+		require.NoError(t, h.Close())
+
+		assert.Empty(t, sink.batchSizes())
+
+		records := readDeadLetters(t, deadLetterPath)
+		require.Len(t, records, 2)
+		assert.Equal(t, testEventSinkHandler, records[0].Handler)
+		assert.Equal(t, EventAuthFailure, records[0].Type)
+		assert.Equal(t, "sink is down", records[0].Error)
+		assert.Contains(t, records[1].Event, `"key": "key2"`)
+	})
+
+	t.Run("retries disabled", func(t *testing.T) {
+		sink := &testEventSink{failures: 1}
+		h := newTestEventSinkHandler(t, sink, config.EventSinkConf{
+			TemplatePath:   "../templates/default_webhook.json",
+			MaxRetries:     -1,
+			DeadLetterPath: deadLetterPath,
+		})
+
+		h.HandleEvent(testSinkEventMessage("key3"))
+		require.NoError(t, h.Close())
+
+		assert.Empty(t, sink.batchSizes())
+		assert.Len(t, readDeadLetters(t, deadLetterPath), 3)
+	})
+}
+
+func TestEventSinkHandler_InvalidConfig(t *testing.T) {
+	for name, conf := range map[apidef.TykEventHandlerName]map[string]interface{}{
+		EH_KafkaHandler:  {"brokers": []string{"localhost:9092"}},
+		EH_NATSHandler:   {"url": "nats://localhost:4222"},
+		EH_AMQPHandler:   {"url": "http://localhost"},
+		EH_SyslogHandler: {"address": "localhost:514", "network": "unix"},
+	} {
+		t.Run(string(name), func(t *testing.T) {
+			h := &EventSinkHandler{Name: name}
+			assert.Error(t, h.Init(conf))
+		})
+	}
+}
+
+func TestKafkaEventSink(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(val []byte) error {
+		if !strings.Contains(string(val), `"event": "AuthFailure"`) {
+			return errors.New("unexpected event " + string(val))
+		}
+		return nil
+	})
+
+	defer func(newProducer func([]string, *sarama.Config) (sarama.SyncProducer, error)) {
+		newKafkaProducer = newProducer
+	}(newKafkaProducer)
+	newKafkaProducer = func(brokers []string, conf *sarama.Config) (sarama.SyncProducer, error) {
+		assert.Equal(t, []string{"localhost:9092"}, brokers)
+		assert.Equal(t, "tyk-gateway", conf.ClientID)
+		return producer, nil
+	}
+
+	h := &EventSinkHandler{Name: EH_KafkaHandler}
+	require.NoError(t, h.Init(map[string]interface{}{
+		"brokers":       []string{"localhost:9092"},
+		"topic":         "tyk-events",
+		"client_id":     "tyk-gateway",
+		"template_path": "../templates/default_webhook.json",
+	}))
+
+	h.HandleEvent(testSinkEventMessage("key"))
+	require.NoError(t, h.Close())
+}
+
+var syslogMessage = regexp.MustCompile(`^<(\d+)>1 \S+ host tyk-test \d+ (\S+) - (.*)$`)
+
+func TestSyslogEventSink(t *testing.T) {
+	t.Run("udp", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		h := &EventSinkHandler{Name: EH_SyslogHandler}
+		require.NoError(t, h.Init(map[string]interface{}{
+			"address":       conn.LocalAddr().String(),
+			"hostname":      "host",
+			"app_name":      "tyk-test",
+			"template_path": "../templates/default_webhook.json",
+		}))
+		h.HandleEvent(testSinkEventMessage("key"))
+		require.NoError(t, h.Close())
+
+		buf := make([]byte, 4096)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+
+		match := syslogMessage.FindStringSubmatch(strings.ReplaceAll(string(buf[:n]), "\n", " "))
+		require.NotNil(t, match, string(buf[:n]))
+		assert.Equal(t, "132", match[1]) // local0.warning
+		assert.Equal(t, string(EventAuthFailure), match[2])
+		assert.Contains(t, match[3], `"key": "key"`)
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+
+		h := &EventSinkHandler{Name: EH_SyslogHandler}
+		require.NoError(t, h.Init(map[string]interface{}{
+			"network":       "tcp",
+			"address":       ln.Addr().String(),
+			"hostname":      "host",
+			"app_name":      "tyk-test",
+			"facility":      1,
+			"template_path": "../templates/default_webhook.json",
+		}))
+		h.HandleEvent(testSinkEventMessage("key1"))
+		h.HandleEvent(config.EventMessage{Type: EventBreakerTripped, Meta: EventCurcuitBreakerMeta{}})
+		require.NoError(t, h.Close())
+
+		conn, err := ln.Accept()
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+
+		reader := bufio.NewReader(conn)
+		var msgs []string
+		for i := 0; i < 2; i++ {
+			length, err := reader.ReadString(' ')
+			require.NoError(t, err)
+			n, err := strconv.Atoi(strings.TrimSpace(length))
+			require.NoError(t, err)
+
+			msg := make([]byte, n)
+			_, err = io.ReadFull(reader, msg)
+			require.NoError(t, err)
+			msgs = append(msgs, strings.ReplaceAll(string(msg), "\n", " "))
+		}
+
+		match := syslogMessage.FindStringSubmatch(msgs[0])
+		require.NotNil(t, match, msgs[0])
+		assert.Equal(t, "12", match[1]) // user.warning
+		assert.Contains(t, match[3], `"key": "key1"`)
+
+		match = syslogMessage.FindStringSubmatch(msgs[1])
+		require.NotNil(t, match, msgs[1])
+		assert.Equal(t, "11", match[1]) // user.err
+		assert.Equal(t, string(EventBreakerTripped), match[2])
+	})
+}
+
+func TestAMQPEventSink_Unreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	deadLetterPath := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	h := &EventSinkHandler{Name: EH_AMQPHandler}
+	require.NoError(t, h.Init(map[string]interface{}{
+		"url":              "amqp://guest:guest@" + addr + "/",
+		"exchange":         "tyk",
+		"max_retries":      1,
+		"retry_backoff":    1,
+		"dead_letter_path": deadLetterPath,
+		"template_path":    "../templates/default_webhook.json",
+	}))
+	h.HandleEvent(testSinkEventMessage("key"))
+	require.NoError(t, h.Close())
+
+	records := readDeadLetters(t, deadLetterPath)
+	require.Len(t, records, 1)
+	assert.Equal(t, EH_AMQPHandler, records[0].Handler)
+	assert.NotEmpty(t, records[0].Error)
+}
@@ -0,0 +1,181 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+const (
+	syslogDialTimeout  = 5 * time.Second
+	syslogWriteTimeout = 5 * time.Second
+
+	// syslog facility and severities, RFC 5424 section 6.2.1
+	syslogFacilityLocal0 = 16
+	syslogError          = 3
+	syslogWarning        = 4
+	syslogNotice         = 5
+)
+
+// syslogSeverities are the severities of the events, other events are notices.
+var syslogSeverities = map[apidef.TykEvent]int{
+	EventBreakerTripped:       syslogError,
+	EventHOSTDOWN:             syslogError,
+	EventQuotaExceeded:        syslogWarning,
+	EventRateLimitExceeded:    syslogWarning,
+	EventOrgQuotaExceeded:     syslogWarning,
+	EventOrgRateLimitExceeded: syslogWarning,
+	EventTriggerExceeded:      syslogWarning,
+	EventBreakerTriggered:     syslogWarning,
+	EventAuthFailure:          syslogWarning,
+	EventKeyExpired:           syslogWarning,
+	EventVersionFailure:       syslogWarning,
+}
+
+// syslogEventSink writes events to a syslog server as RFC 5424 messages, with octet counting framing over TCP.
+type syslogEventSink struct {
+	conf     config.SyslogEventHandlerConf
+	hostname string
+	procID   string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogEventSink(handlerConf interface{}) (eventSink, config.EventSinkConf, error) {
+	var conf config.SyslogEventHandlerConf
+	if err := decodeEventHandlerConf(handlerConf, &conf); err != nil {
+		return nil, conf.EventSinkConf, err
+	}
+
+	if conf.Address == "" {
+		return nil, conf.EventSinkConf, errors.New("syslog address is required")
+	}
+
+	switch conf.Network {
+	case "":
+		conf.Network = "udp"
+	case "udp", "tcp", "tls":
+	default:
+		return nil, conf.EventSinkConf, fmt.Errorf("unsupported syslog network %q", conf.Network)
+	}
+
+	if conf.Facility == 0 {
+		conf.Facility = syslogFacilityLocal0
+	}
+	if conf.Facility < 0 || conf.Facility > 23 {
+		return nil, conf.EventSinkConf, fmt.Errorf("invalid syslog facility %d", conf.Facility)
+	}
+	if conf.AppName == "" {
+		conf.AppName = "tyk"
+	}
+
+	hostname := conf.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	return &syslogEventSink{
+		conf:     conf,
+		hostname: syslogHeaderField(hostname, 255),
+		procID:   strconv.Itoa(os.Getpid()),
+	}, conf.EventSinkConf, nil
+}
+
+// syslogHeaderField returns a header field of at most max printable ASCII characters, the nil value is used when empty.
+func syslogHeaderField(value string, max int) string {
+	field := make([]byte, 0, len(value))
+	for i := 0; i < len(value) && len(field) < max; i++ {
+		if c := value[i]; c > ' ' && c < 127 {
+			field = append(field, c)
+		}
+	}
+
+	if len(field) == 0 {
+		return "-"
+	}
+	return string(field)
+}
+
+// format formats an event as an RFC 5424 message, the event type is the message ID.
+func (s *syslogEventSink) format(event sinkEvent, now time.Time) []byte {
+	severity, ok := syslogSeverities[event.Type]
+	if !ok {
+		severity = syslogNotice
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "<%d>1 %s %s %s %s %s - ",
+		s.conf.Facility*8+severity,
+		now.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname,
+		syslogHeaderField(s.conf.AppName, 48),
+		s.procID,
+		syslogHeaderField(string(event.Type), 32),
+	)
+	msg.Write(event.Body)
+
+	return msg.Bytes()
+}
+
+func (s *syslogEventSink) dial() (net.Conn, error) {
+	if s.conf.Network == "tls" {
+		dialer := &net.Dialer{Timeout: syslogDialTimeout}
+		return tls.DialWithDialer(dialer, "tcp", s.conf.Address, &tls.Config{InsecureSkipVerify: s.conf.SSLInsecureSkipVerify})
+	}
+	return net.DialTimeout(s.conf.Network, s.conf.Address, syslogDialTimeout)
+}
+
+// Send writes the events, the connection is made on the first batch and again after a write failed.
+func (s *syslogEventSink) Send(events []sinkEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	now := time.Now()
+	for _, event := range events {
+		msg := s.format(event, now)
+		if s.conf.Network != "udp" {
+			// octet counting framing, RFC 6587 section 3.4.1
+			msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+		if _, err := s.conn.Write(msg); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *syslogEventSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
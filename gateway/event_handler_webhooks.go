@@ -2,15 +2,23 @@ package gateway
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -18,6 +26,7 @@ import (
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/internal/uuid"
 	"github.com/TykTechnologies/tyk/storage"
 )
 
@@ -34,7 +43,9 @@ const (
 	EH_WebHook apidef.TykEventHandlerName = "eh_web_hook_handler"
 )
 
-// WebHookHandler is an event handler that triggers web hooks
+// WebHookHandler is an event handler that triggers web hooks. Deliveries go through a Redis outbox
+// and are retried with an exponential backoff, the ones which keep failing are moved to a dead-letter
+// list which can be replayed through the control API.
 type WebHookHandler struct {
 	conf     config.WebHookHandlerConf
 	template *template.Template // non-nil if Init is run without error
@@ -43,6 +54,17 @@ type WebHookHandler struct {
 	contentType      string
 	dashboardService DashboardServiceSender
 	Gw               *Gateway
+	Spec             *APISpec // nil for global handlers
+
+	id     string
+	secret []byte
+	outbox *webhookOutbox
+	client *http.Client
+
+	ctx    context.Context // cancelled when the handler is closed
+	cancel context.CancelFunc
+	wake   chan struct{}
+	wg     sync.WaitGroup
 }
 
 // createConfigObject by default tyk will provide a map[string]interface{} type as a conf, converting it
@@ -76,36 +98,12 @@ func (w *WebHookHandler) Init(handlerConf interface{}) error {
 	w.store.Connect()
 
 	// Pre-load template on init
-	if w.conf.TemplatePath != "" {
-		w.template, err = template.ParseFiles(w.conf.TemplatePath)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"prefix": "webhooks",
-				"target": w.conf.TargetPath,
-			}).Warning("Custom template load failure, using default: ", err)
-		}
-
-		if strings.HasSuffix(w.conf.TemplatePath, ".json") {
-			w.contentType = header.ApplicationJSON
-		}
-	}
-
-	// We use the default if TemplatePath was empty or if we failed
-	// to load it.
-	if w.template == nil {
-		log.WithFields(logrus.Fields{
-			"prefix": "webhooks",
-			"target": w.conf.TargetPath,
-		}).Info("Loading default template.")
-		defaultPath := filepath.Join(w.Gw.GetConfig().TemplatePath, "default_webhook.json")
-		w.template, err = template.ParseFiles(defaultPath)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"prefix": "webhooks",
-			}).Error("Could not load the default template: ", err)
-			return err
-		}
-		w.contentType = header.ApplicationJSON
+	w.template, w.contentType, err = w.Gw.loadEventTemplate(w.conf.TemplatePath, log.WithFields(logrus.Fields{
+		"prefix": "webhooks",
+		"target": w.conf.TargetPath,
+	}))
+	if err != nil {
+		return err
 	}
 
 	log.WithFields(logrus.Fields{
@@ -123,9 +121,272 @@ func (w *WebHookHandler) Init(handlerConf interface{}) error {
 		w.dashboardService = w.Gw.DashService
 	}
 
+	w.secret = []byte(w.conf.Secret)
+	if strings.HasPrefix(w.conf.Secret, "whsec_") {
+		w.secret, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(w.conf.Secret, "whsec_"))
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "webhooks",
+			}).Error("Invalid webhook secret: ", err)
+			return err
+		}
+	}
+
+	w.id = w.conf.ID
+	if w.id == "" {
+		apiID := ""
+		if w.Spec != nil {
+			apiID = w.Spec.APIID
+		}
+		h := md5.Sum([]byte(apiID + " " + string(w.getRequestMethod(w.conf.Method)) + " " + w.conf.TargetPath))
+		w.id = hex.EncodeToString(h[:])
+	}
+
+	w.outbox = w.Gw.newWebhookOutbox(w.id)
+	w.client = &http.Client{Timeout: 30 * time.Second}
+	w.start()
+
+	return nil
+}
+
+// start starts the workers sending the deliveries of the outbox.
+func (w *WebHookHandler) start() {
+	concurrency := w.conf.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	w.ctx, w.cancel = context.WithCancel(w.Gw.ctx)
+	w.wake = make(chan struct{}, 1)
+
+	jobs := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		w.wg.Add(1)
+		go w.worker(jobs)
+	}
+
+	w.wg.Add(1)
+	go w.run(jobs)
+
+	w.Gw.webhooks.add(w)
+}
+
+// Close stops the workers, cancelling the deliveries being sent. The pending deliveries stay in the outbox
+// for the next handler of the webhook.
+func (w *WebHookHandler) Close() error {
+	if w.cancel == nil {
+		return nil
+	}
+
+	w.cancel()
+	w.wg.Wait()
+	w.Gw.webhooks.remove(w)
 	return nil
 }
 
+// notify wakes the workers up for a delivery due now.
+func (w *WebHookHandler) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run claims the deliveries which are due and hands them over to the workers.
+func (w *WebHookHandler) run(jobs chan<- string) {
+	defer w.wg.Done()
+	defer close(jobs)
+
+	ticker := time.NewTicker(webhookOutboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if !w.dispatch(jobs) {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-w.wake:
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *WebHookHandler) dispatch(jobs chan<- string) bool {
+	if !w.Gw.RedisController.Connected() {
+		return true
+	}
+
+	ids, err := w.outbox.ready(time.Now())
+	if err != nil {
+		return true
+	}
+
+	for _, id := range ids {
+		if !w.outbox.claim(id) {
+			continue
+		}
+
+		select {
+		case jobs <- id:
+		case <-w.ctx.Done():
+			w.outbox.release(id)
+			return false
+		}
+	}
+
+	return true
+}
+
+func (w *WebHookHandler) worker(jobs <-chan string) {
+	defer w.wg.Done()
+
+	for id := range jobs {
+		w.deliver(id)
+	}
+}
+
+// deliver sends a claimed delivery, it's scheduled for a retry or moved to the dead letters if it fails.
+func (w *WebHookHandler) deliver(id string) {
+	defer w.outbox.release(id)
+
+	d, err := w.outbox.get(id)
+	if err != nil {
+		// delivered by another gateway in the meantime
+		w.outbox.done(id)
+		return
+	}
+	if time.Now().Before(d.NextAttempt) {
+		// rescheduled since it was found due
+		return
+	}
+
+	err = w.send(d)
+	if err == nil {
+		w.outbox.done(id)
+		return
+	}
+	if w.ctx.Err() != nil {
+		// cancelled by Close, it's still due for the next handler
+		return
+	}
+
+	d.Attempts++
+	d.LastAttempt = time.Now()
+	d.LastError = err.Error()
+
+	logger := log.WithFields(logrus.Fields{
+		"prefix":   "webhooks",
+		"target":   w.conf.TargetPath,
+		"delivery": d.ID,
+		"attempts": d.Attempts,
+	})
+
+	maxRetries := w.conf.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultWebhookMaxRetries
+	}
+	if d.Attempts > maxRetries {
+		logger.WithError(err).Error("Webhook delivery failed, moving it to the dead letters")
+		if err := w.outbox.kill(d); err != nil {
+			logger.WithError(err).Error("Couldn't move the delivery to the dead letters")
+		}
+		return
+	}
+
+	backoff := time.Duration(w.conf.RetryBackoff) * time.Millisecond
+	if backoff <= 0 {
+		backoff = defaultWebhookRetryBackoff
+	}
+	for i := 1; i < d.Attempts && backoff < maxWebhookRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxWebhookRetryBackoff {
+		backoff = maxWebhookRetryBackoff
+	}
+
+	logger.WithError(err).Warningf("Webhook delivery failed, retrying in %s", backoff)
+	if err := w.outbox.add(d, d.LastAttempt.Add(backoff)); err != nil {
+		logger.WithError(err).Error("Couldn't schedule the delivery")
+	}
+}
+
+// send sends a delivery to the target, failing unless the target responds with a 2xx status.
+func (w *WebHookHandler) send(d *webhookDelivery) error {
+	req, err := w.BuildRequest(d.Body)
+	if err != nil {
+		return err
+	}
+	w.signRequest(req, d.ID, d.Body, time.Now())
+
+	resp, err := w.client.Do(req.WithContext(w.ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	if err == nil {
+		log.WithFields(logrus.Fields{
+			"prefix":       "webhooks",
+			"responseCode": resp.StatusCode,
+		}).Debug(string(content))
+	}
+	return nil
+}
+
+// signRequest signs the payload as specified by Standard Webhooks, the signature covers the delivery ID
+// and the timestamp so that receivers can reject replayed requests.
+func (w *WebHookHandler) signRequest(req *http.Request, id, body string, now time.Time) {
+	if len(w.secret) == 0 {
+		return
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write([]byte(id + "." + timestamp + "." + body))
+
+	req.Header.Set(header.WebhookID, id)
+	req.Header.Set(header.WebhookTimestamp, timestamp)
+	req.Header.Set(header.WebhookSignature, "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// loadEventTemplate loads the template of event handlers rendering events, the default webhook template is
+// used if the path is empty or the template can't be loaded. The content type is JSON for .json templates.
+func (gw *Gateway) loadEventTemplate(templatePath string, logger *logrus.Entry) (tmpl *template.Template, contentType string, err error) {
+	if templatePath != "" {
+		tmpl, err = template.ParseFiles(templatePath)
+		if err != nil {
+			logger.Warning("Custom template load failure, using default: ", err)
+		}
+
+		if strings.HasSuffix(templatePath, ".json") {
+			contentType = header.ApplicationJSON
+		}
+	}
+
+	// We use the default if TemplatePath was empty or if we failed
+	// to load it.
+	if tmpl == nil {
+		logger.Info("Loading default template.")
+		defaultPath := filepath.Join(gw.GetConfig().TemplatePath, "default_webhook.json")
+		tmpl, err = template.ParseFiles(defaultPath)
+		if err != nil {
+			logger.Error("Could not load the default template: ", err)
+			return nil, "", err
+		}
+		contentType = header.ApplicationJSON
+	}
+
+	return tmpl, contentType, nil
+}
+
 // hookFired checks if an event has been fired within the EventTimeout setting
 func (w *WebHookHandler) WasHookFired(checksum string) bool {
 	if _, err := w.store.GetKey(checksum); err != nil {
@@ -220,9 +481,8 @@ func (w *WebHookHandler) HandleEvent(em config.EventMessage) {
 	// Inject event message into template, render to string
 	reqBody, _ := w.CreateBody(em)
 
-	// Construct request (method, body, params)
-	req, err := w.BuildRequest(reqBody)
-	if err != nil {
+	// Check the request can be built (method, body, params)
+	if _, err := w.BuildRequest(reqBody); err != nil {
 		return
 	}
 
@@ -234,34 +494,25 @@ func (w *WebHookHandler) HandleEvent(em config.EventMessage) {
 		return
 	}
 
-	cli := &http.Client{Timeout: 30 * time.Second}
+	d := &webhookDelivery{
+		ID:      uuid.NewHex(),
+		Event:   em.Type,
+		Body:    reqBody,
+		Created: time.Now(),
+	}
 
-	resp, err := cli.Do(req)
-	if err != nil {
+	if err := w.outbox.add(d, d.Created); err != nil {
 		log.WithFields(logrus.Fields{
 			"prefix": "webhooks",
-		}).Error("Webhook request failed: ", err)
-	} else {
-		defer resp.Body.Close()
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			content, err := ioutil.ReadAll(resp.Body)
-			if err == nil {
-				log.WithFields(logrus.Fields{
-					"prefix":       "webhooks",
-					"responseCode": resp.StatusCode,
-				}).Debug(string(content))
-			} else {
-				log.WithFields(logrus.Fields{
-					"prefix": "webhooks",
-				}).Error(err)
-			}
-
-		} else {
+		}).WithError(err).Warning("Couldn't store the webhook delivery, sending it without retries")
+
+		if err := w.send(d); err != nil {
 			log.WithFields(logrus.Fields{
-				"prefix":       "webhooks",
-				"responseCode": resp.StatusCode,
-			}).Error("Request to webhook failed")
+				"prefix": "webhooks",
+			}).Error("Webhook request failed: ", err)
 		}
+	} else {
+		w.notify()
 	}
 
 	if w.dashboardService != nil && em.Type == EventTriggerExceeded {
@@ -1,13 +1,27 @@
 package gateway
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 
 	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/internal/uuid"
+	"github.com/TykTechnologies/tyk/test"
 )
 
 func (ts *Test) createGetHandler() *WebHookHandler {
@@ -322,3 +336,223 @@ func TestWebhookContentTypeHeader(t *testing.T) {
 	}
 
 }
+
+func (ts *Test) createOutboxHandler(t *testing.T, targetPath string, conf config.WebHookHandlerConf) *WebHookHandler {
+	t.Helper()
+
+	conf.TargetPath = targetPath
+	conf.Method = "POST"
+	conf.TemplatePath = "../templates/default_webhook.json"
+	if conf.ID == "" {
+		conf.ID = uuid.NewHex()
+	}
+
+	h := &WebHookHandler{Gw: ts.Gw}
+	if err := h.Init(conf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		h.Close()
+	})
+	return h
+}
+
+func outboxEventMessage(key string) config.EventMessage {
+	return config.EventMessage{
+		Type: EventHOSTDOWN,
+		Meta: EventHostStatusMeta{
+			EventMetaDefault: EventMetaDefault{Message: key},
+			HostInfo:         HostHealthReport{HostData: HostData{CheckURL: "http://upstream/" + key}},
+		},
+	}
+}
+
+func TestWebHookHandler_Signature(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	type received struct {
+		header http.Header
+		body   string
+	}
+	requests := make(chan received, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{r.Header, string(body)}
+	}))
+	defer target.Close()
+
+	secret := []byte("0123456789abcdef")
+	hook := ts.createOutboxHandler(t, target.URL, config.WebHookHandlerConf{
+		Secret: "whsec_" + base64.StdEncoding.EncodeToString(secret),
+	})
+	hook.HandleEvent(outboxEventMessage("signed"))
+
+	var req received
+	select {
+	case req = <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook wasn't delivered")
+	}
+
+	id := req.header.Get(header.WebhookID)
+	timestamp := req.header.Get(header.WebhookTimestamp)
+	assert.NotEmpty(t, id)
+	assert.NotEmpty(t, timestamp)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id + "." + timestamp + "." + req.body))
+	assert.Equal(t, "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)), req.header.Get(header.WebhookSignature))
+	assert.Contains(t, req.body, "http://upstream/signed")
+
+	t.Run("invalid secret", func(t *testing.T) {
+		h := &WebHookHandler{Gw: ts.Gw}
+		assert.Error(t, h.Init(config.WebHookHandlerConf{TargetPath: target.URL, Secret: "whsec_!"}))
+	})
+}
+
+func TestWebHookHandler_Retries(t *testing.T) {
+	defer func(interval time.Duration) {
+		webhookOutboxPollInterval = interval
+	}(webhookOutboxPollInterval)
+	webhookOutboxPollInterval = 10 * time.Millisecond
+
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	var calls int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer target.Close()
+
+	hook := ts.createOutboxHandler(t, target.URL, config.WebHookHandlerConf{RetryBackoff: 1})
+	hook.HandleEvent(outboxEventMessage("retried"))
+
+	assert.Eventually(t, func() bool {
+		pending, dead, err := hook.outbox.count()
+		return err == nil && pending == 0 && dead == 0 && atomic.LoadInt32(&calls) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWebHookHandler_Concurrency(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	var inFlight, maxInFlight int32
+	release := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		<-release
+	}))
+	defer target.Close()
+
+	hook := ts.createOutboxHandler(t, target.URL, config.WebHookHandlerConf{Concurrency: 2})
+	for i := 0; i < 4; i++ {
+		hook.HandleEvent(outboxEventMessage(strconv.Itoa(i)))
+	}
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&inFlight) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&maxInFlight))
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		pending, _, err := hook.outbox.count()
+		return err == nil && pending == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWebHookHandler_DeadLetters(t *testing.T) {
+	defer func(interval time.Duration) {
+		webhookOutboxPollInterval = interval
+	}(webhookOutboxPollInterval)
+	webhookOutboxPollInterval = 10 * time.Millisecond
+
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	var up int32
+	var delivered []string
+	var mu sync.Mutex
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&up) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		delivered = append(delivered, r.Header.Get(header.WebhookID))
+		mu.Unlock()
+	}))
+	defer target.Close()
+
+	hook := ts.createOutboxHandler(t, target.URL, config.WebHookHandlerConf{
+		ID:           "hostdown-hook",
+		Secret:       "secret",
+		MaxRetries:   1,
+		RetryBackoff: 1,
+	})
+	hook.HandleEvent(outboxEventMessage("first"))
+	hook.HandleEvent(outboxEventMessage("second"))
+
+	assert.Eventually(t, func() bool {
+		pending, dead, err := hook.outbox.count()
+		return err == nil && pending == 0 && dead == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	deadLetters, err := hook.outbox.deadLetters()
+	if err != nil || len(deadLetters) != 2 {
+		t.Fatal("expected 2 dead letters", deadLetters, err)
+	}
+	first := deadLetters[0]
+	assert.Equal(t, 2, first.Attempts)
+	assert.Equal(t, "webhook responded with status 500", first.LastError)
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/tyk/webhooks", AdminAuth: true, Code: http.StatusOK, BodyMatchFunc: func(body []byte) bool {
+			var webhooks []webhookStatus
+			if err := json.Unmarshal(body, &webhooks); err != nil {
+				return false
+			}
+			for _, webhook := range webhooks {
+				if webhook.ID == "hostdown-hook" {
+					return webhook.TargetPath == target.URL && webhook.Method == "POST" && webhook.DeadLetters == 2
+				}
+			}
+			return false
+		}},
+		{Path: "/tyk/webhooks/hostdown-hook/dead-letters", AdminAuth: true, Code: http.StatusOK, BodyMatch: first.ID},
+		{Method: http.MethodPost, Path: "/tyk/webhooks/hostdown-hook/dead-letters/missing/replay", AdminAuth: true, Code: http.StatusNotFound},
+		{Method: http.MethodDelete, Path: "/tyk/webhooks/hostdown-hook/dead-letters/missing", AdminAuth: true, Code: http.StatusNotFound},
+		{Method: http.MethodDelete, Path: "/tyk/webhooks/hostdown-hook/dead-letters/" + deadLetters[1].ID, AdminAuth: true, Code: http.StatusOK},
+	}...)
+
+	atomic.StoreInt32(&up, 1)
+	_, _ = ts.Run(t, test.TestCase{
+		Method: http.MethodPost, Path: "/tyk/webhooks/hostdown-hook/dead-letters/replay", AdminAuth: true,
+		Code: http.StatusOK, BodyMatch: `1 dead letters replayed`,
+	})
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(delivered) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{first.ID}, delivered)
+
+	pending, dead, err := hook.outbox.count()
+	assert.NoError(t, err)
+	assert.Zero(t, pending)
+	assert.Zero(t, dead)
+}
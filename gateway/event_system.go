@@ -36,6 +36,11 @@ const (
 	EventTokenCreated         apidef.TykEvent = "TokenCreated"
 	EventTokenUpdated         apidef.TykEvent = "TokenUpdated"
 	EventTokenDeleted         apidef.TykEvent = "TokenDeleted"
+	EventTokensCreated        apidef.TykEvent = "TokensCreated"
+	EventTokensUpdated        apidef.TykEvent = "TokensUpdated"
+	EventTokensDeleted        apidef.TykEvent = "TokensDeleted"
+	EventKeyGracePeriodEnded  apidef.TykEvent = "KeyGracePeriodEnded"
+	EventCreditBalanceLow     apidef.TykEvent = "CreditBalanceLow"
 )
 
 // EventMetaDefault is a standard embedded struct to be used with custom event metadata types, gives an interface for
@@ -57,6 +62,9 @@ type EventKeyFailureMeta struct {
 	Path   string
 	Origin string
 	Key    string
+	// Limit is the level of the limit exceeded, key or group, and Group the ID of the group of the key.
+	Limit string
+	Group string
 }
 
 // EventCurcuitBreakerMeta is the event status for a circuit breaker tripping
@@ -84,12 +92,36 @@ type EventTriggerExceededMeta struct {
 	UsagePercentage int64  `json:"usage_percentage"`
 }
 
+// EventCreditBalanceLowMeta is the metadata of a low balance event, fired when a request brings the usage of the
+// quota of a key over a trigger limit.
+type EventCreditBalanceLowMeta struct {
+	EventTriggerExceededMeta
+	Balance int64 `json:"balance"`
+}
+
 type EventTokenMeta struct {
 	EventMetaDefault
 	Org string
 	Key string
 }
 
+// EventKeyRotationMeta is the metadata of the event fired when the grace period of a rotated key ends, the keys
+// are hashed if key hashing is enabled.
+type EventKeyRotationMeta struct {
+	EventMetaDefault
+	Org    string
+	Key    string
+	NewKey string
+}
+
+// EventTokenBatchMeta is the metadata of the events fired once for all the keys of an org changed by a bulk key
+// operation, instead of an event per key.
+type EventTokenBatchMeta struct {
+	EventMetaDefault
+	Org  string
+	Keys []string
+}
+
 // EncodeRequestToEvent will write the request out in wire protocol and
 // encode it to base64 and store it in an Event object
 func EncodeRequestToEvent(r *http.Request) string {
@@ -109,7 +141,7 @@ func (gw *Gateway) EventHandlerByName(handlerConf apidef.EventHandlerTriggerConf
 		err := h.Init(conf)
 		return h, err
 	case EH_WebHook:
-		h := &WebHookHandler{Gw: gw}
+		h := &WebHookHandler{Gw: gw, Spec: spec}
 		err := h.Init(conf)
 		return h, err
 	case EH_JSVMHandler:
@@ -122,6 +154,10 @@ func (gw *Gateway) EventHandlerByName(handlerConf apidef.EventHandlerTriggerConf
 			}
 			return h, err
 		}
+	case EH_KafkaHandler, EH_NATSHandler, EH_AMQPHandler, EH_SyslogHandler:
+		h := &EventSinkHandler{Name: handlerConf.Handler, Gw: gw}
+		err := h.Init(conf)
+		return h, err
 	case EH_CoProcessHandler:
 		if spec != nil {
 			dispatcher := loadedDrivers[spec.CustomMiddleware.Driver]
@@ -134,6 +134,13 @@ func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMs
 	defer e.Base().UpdateRequestSession(r)
 	response := &http.Response{}
 
+	var grpcTags []string
+	if writeResponse && e.Spec.GRPC.Enabled && isGRPCCall(r) {
+		code := writeGRPCError(w, r, errMsg, errCode, response)
+		grpcTags = []string{grpcAnalyticsStatusTagPrefix + strconv.Itoa(int(code))}
+		writeResponse = false
+	}
+
 	if writeResponse {
 		var templateExtension string
 		contentType := r.Header.Get(header.ContentType)
@@ -260,6 +267,8 @@ func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMs
 			tags = append(tags, e.Spec.Tags...)
 		}
 
+		tags = append(tags, grpcTags...)
+
 		rawRequest := ""
 		rawResponse := ""
 
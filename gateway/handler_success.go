@@ -157,6 +157,10 @@ func (s *SuccessHandler) RecordHit(r *http.Request, timing analytics.Latency, co
 			tags = append(tags, s.Spec.Tags...)
 		}
 
+		if s.Spec.GRPC.Enabled {
+			tags = append(tags, grpcAnalyticsTags(responseCopy)...)
+		}
+
 		rawRequest := ""
 		rawResponse := ""
 
@@ -236,6 +240,12 @@ func (s *SuccessHandler) RecordHit(r *http.Request, timing analytics.Latency, co
 			record.GetGeo(ip, s.Gw.Analytics.GeoIPDB)
 		}
 
+		// the handshake is recorded once the WebSocket connection is closed
+		if wsConn := ctxGetWebSocketConn(r); wsConn != nil {
+			record.Network = wsConn.networkStats()
+			record.Tags = append(record.Tags, wsConn.analyticsTags()...)
+		}
+
 		// skip tagging subgraph requests for graphpump, it only handles generated supergraph requests
 		if s.Spec.GraphQL.Enabled && s.Spec.GraphQL.ExecutionMode != apidef.GraphQLExecutionModeSubgraph {
 			record.Tags = append(record.Tags, "tyk-graph-analytics")
@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultJSVMMaxCallStackSize = 1024
+
+var errJSVMTimeout = errors.New("timeout")
+
+// gojaPool runs the JS code of an API using the goja engine. VMs are reused across calls
+// instead of being copied for each, so scripts shouldn't keep request state in globals.
+//
+// goja doesn't limit the memory of a VM, calls are limited in time and call stack depth.
+type gojaPool struct {
+	api              map[string]jsFunc
+	maxCallStackSize int
+	log              *logrus.Entry
+
+	mu       sync.RWMutex
+	programs []*goja.Program
+	// generation changes as programs are loaded, VMs of older generations are discarded.
+	generation int
+
+	vms sync.Pool
+}
+
+type gojaVM struct {
+	rt         *goja.Runtime
+	generation int
+}
+
+func newGojaPool(api map[string]jsFunc, maxCallStackSize int, logger *logrus.Entry) (*gojaPool, error) {
+	if maxCallStackSize <= 0 {
+		maxCallStackSize = defaultJSVMMaxCallStackSize
+	}
+
+	p := &gojaPool{
+		api:              api,
+		maxCallStackSize: maxCallStackSize,
+		log:              logger,
+	}
+
+	// Init TykJS namespace, constructors etc.
+	if err := p.load("core.js", coreJS); err != nil {
+		return nil, err
+	}
+	if err := p.load("response.js", tykJsResponseJS); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// load compiles the source, it runs in the VMs created from now on.
+func (p *gojaPool) load(name string, src interface{}) error {
+	var code string
+	switch src := src.(type) {
+	case string:
+		code = src
+	case []byte:
+		code = string(src)
+	case io.Reader:
+		b, err := ioutil.ReadAll(src)
+		if err != nil {
+			return err
+		}
+		code = string(b)
+	default:
+		return fmt.Errorf("unsupported JS source type %T", src)
+	}
+
+	program, err := goja.Compile(name, code, false)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.programs = append(p.programs, program)
+	p.generation++
+	p.mu.Unlock()
+
+	return nil
+}
+
+func (p *gojaPool) newVM() *gojaVM {
+	rt := goja.New()
+	rt.SetMaxCallStackSize(p.maxCallStackSize)
+
+	for name, fn := range p.api {
+		fn := fn
+		rt.Set(name, func(call goja.FunctionCall) goja.Value {
+			args := make(jsArgs, len(call.Arguments))
+			for i, arg := range call.Arguments {
+				args[i] = arg.String()
+			}
+
+			ret, ok := fn(args)
+			if !ok {
+				return goja.Undefined()
+			}
+			return rt.ToValue(ret)
+		})
+	}
+
+	p.mu.RLock()
+	programs, generation := p.programs, p.generation
+	p.mu.RUnlock()
+
+	for _, program := range programs {
+		if _, err := rt.RunProgram(program); err != nil {
+			p.log.WithError(err).Error("Failed to load JS")
+		}
+	}
+
+	return &gojaVM{rt: rt, generation: generation}
+}
+
+func (p *gojaPool) get() *gojaVM {
+	p.mu.RLock()
+	generation := p.generation
+	p.mu.RUnlock()
+
+	if vm, ok := p.vms.Get().(*gojaVM); ok && vm.generation == generation {
+		return vm
+	}
+
+	return p.newVM()
+}
+
+// run evaluates the expression on a VM of the pool, interrupting it after the timeout.
+func (p *gojaPool) run(expr string, timeout time.Duration) (string, error) {
+	vm := p.get()
+
+	timer := time.AfterFunc(timeout, func() {
+		vm.rt.Interrupt(errJSVMTimeout)
+	})
+	value, err := vm.rt.RunString(expr)
+	if !timer.Stop() {
+		// the VM may be left in any state by the interruption
+		return "", fmt.Errorf("JS middleware timed out after %s", timeout)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	p.vms.Put(vm)
+	return value.String(), nil
+}
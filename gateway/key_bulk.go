@@ -0,0 +1,541 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	bulkKeyOpCreate        = "create"
+	bulkKeyOpUpdate        = "update"
+	bulkKeyOpDelete        = "delete"
+	bulkKeyOpResetQuota    = "reset-quota"
+	bulkKeyOpApplyPolicies = "apply-policies"
+
+	maxBulkKeyOperations = 10000
+
+	bulkKeyIdempotencyPrefix = "keys.bulk."
+	// bulkKeyIdempotencyTTL is how long the response of a bulk request is kept for its retries, in seconds.
+	bulkKeyIdempotencyTTL = 24 * 60 * 60
+	// bulkKeyIdempotencyLease is how long a bulk request holds its idempotency key while it runs, in seconds.
+	bulkKeyIdempotencyLease = 5 * 60
+)
+
+// bulkKeyOperation is an operation on a key of a bulk request.
+type bulkKeyOperation struct {
+	Op string `json:"op"`
+	// Key is the key name, or its hash if Hashed is set. It's generated for created keys when empty.
+	Key           string             `json:"key,omitempty"`
+	Hashed        bool               `json:"hashed,omitempty"`
+	OrgID         string             `json:"org_id,omitempty"`
+	SuppressReset bool               `json:"suppress_reset,omitempty"`
+	Policies      []string           `json:"policies,omitempty"`
+	Session       *user.SessionState `json:"session,omitempty"`
+}
+
+// bulkKeyResult is the result of an operation of a bulk request, in the order of the operations.
+type bulkKeyResult struct {
+	Index   int    `json:"index"`
+	Op      string `json:"op"`
+	Key     string `json:"key,omitempty"`
+	KeyHash string `json:"key_hash,omitempty"`
+	Status  string `json:"status"`
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type bulkKeyResponse struct {
+	Status    string          `json:"status"`
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	Results   []bulkKeyResult `json:"results"`
+}
+
+// bulkKeyIdempotentResponse is the response of a bulk request stored under its idempotency key.
+type bulkKeyIdempotentResponse struct {
+	RequestHash string          `json:"request_hash"`
+	Code        int             `json:"code"`
+	Response    json.RawMessage `json:"response"`
+}
+
+// bulkKeyJob is an operation being run.
+type bulkKeyJob struct {
+	op     bulkKeyOperation
+	result *bulkKeyResult
+
+	// keyName is the key as passed to the session manager, keyID the key as stored.
+	keyName string
+	keyID   string
+	// candidates are the key IDs the key can be stored under, with the legacy and the custom key formats.
+	candidates []string
+}
+
+// bulkKeyState is the state of a key once the operations preceding the current one ran.
+type bulkKeyState struct {
+	session  *user.SessionState
+	lifetime int64
+	deleted  bool
+}
+
+func (j *bulkKeyJob) fail(code int, msg string) {
+	j.result.Status = "error"
+	j.result.Code = code
+	j.result.Message = msg
+}
+
+// decodeBulkKeyOperations decodes the operations of a JSON array or of NDJSON, the operations which can't be
+// decoded are returned with their error.
+func decodeBulkKeyOperations(body []byte, ndjson bool) ([]bulkKeyOperation, []error, error) {
+	var items []json.RawMessage
+	if ndjson || !bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			items = append(items, append(json.RawMessage(nil), line...))
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, nil, err
+		}
+	} else if err := json.Unmarshal(body, &items); err != nil {
+		return nil, nil, err
+	}
+
+	if len(items) > maxBulkKeyOperations {
+		return nil, nil, fmt.Errorf("too many operations, the maximum is %d", maxBulkKeyOperations)
+	}
+
+	ops := make([]bulkKeyOperation, len(items))
+	errs := make([]error, len(items))
+	for i, item := range items {
+		errs[i] = json.Unmarshal(item, &ops[i])
+	}
+	return ops, errs, nil
+}
+
+// bulkKeyQuotaKeys returns the raw quota and rate limiter keys reset with the quota of a key.
+func bulkKeyQuotaKeys(keyID string, session *user.SessionState) []string {
+	keys := []string{QuotaKeyPrefix + keyID, RateLimitKeyPrefix + keyID + ".BLOCKED"}
+	for _, acl := range session.AccessRights {
+		keys = append(keys, QuotaKeyPrefix+acl.AllowanceScope+"-"+keyID)
+	}
+	return keys
+}
+
+// prepareBulkSession applies the policies of a session to be saved, as when a key is added or updated one by
+// one. It returns whether the quota of the key can be reset.
+func (gw *Gateway) prepareBulkSession(session *user.SessionState) (bool, error) {
+	resetQuota := true
+
+	if len(session.AccessRights) == 0 {
+		if !gw.GetConfig().AllowMasterKeys {
+			return false, errors.New("Master keys not allowed")
+		}
+
+		mw := BaseMiddleware{Gw: gw}
+		return resetQuota, mw.ApplyPolicies(session)
+	}
+
+	resetAPILimits(session.AccessRights)
+	for apiID := range session.AccessRights {
+		spec := gw.getApiSpec(apiID)
+		if spec == nil {
+			return false, fmt.Errorf("API %s must be active to add keys", apiID)
+		}
+		if spec.DontSetQuotasOnCreate {
+			resetQuota = false
+		}
+
+		mw := BaseMiddleware{Spec: spec, Gw: gw}
+		if err := mw.ApplyPolicies(session); err != nil {
+			return false, err
+		}
+	}
+	return resetQuota, nil
+}
+
+// applyTrialPeriod expires a new key if one of its policies forces an expiry.
+func (gw *Gateway) applyTrialPeriod(session *user.SessionState) {
+	for _, polID := range session.PolicyIDs() {
+		if policy, err := gw.resolvedPolicy(polID); err == nil && policy.KeyExpiresIn > 0 {
+			session.Expires = time.Now().Unix() + policy.KeyExpiresIn
+		}
+	}
+}
+
+// handleBulkKeys runs the operations of a bulk request. The keys are read and written at once by the session
+// manager, and the key events are fired once per org and operation instead of once per key.
+func (gw *Gateway) handleBulkKeys(ops []bulkKeyOperation, errs []error) *bulkKeyResponse {
+	gwConfig := gw.GetConfig()
+
+	response := &bulkKeyResponse{Results: make([]bulkKeyResult, len(ops))}
+	jobs := make([]*bulkKeyJob, len(ops))
+	var lookup []string
+
+	for i, op := range ops {
+		job := &bulkKeyJob{op: op, result: &response.Results[i]}
+		jobs[i] = job
+		*job.result = bulkKeyResult{Index: i, Op: op.Op, Status: "ok", Code: http.StatusOK}
+
+		if errs[i] != nil {
+			job.fail(http.StatusBadRequest, "Malformed operation: "+errs[i].Error())
+			continue
+		}
+
+		switch op.Op {
+		case bulkKeyOpCreate:
+			if op.Session == nil {
+				job.fail(http.StatusBadRequest, "Session is required")
+				continue
+			}
+			job.keyName = gw.generateToken(op.Session.OrgID, op.Key)
+			job.keyID = storage.HashKey(job.keyName, gwConfig.HashKeys)
+			job.candidates = []string{job.keyID}
+		case bulkKeyOpUpdate, bulkKeyOpDelete, bulkKeyOpResetQuota, bulkKeyOpApplyPolicies:
+			if op.Key == "" {
+				job.fail(http.StatusBadRequest, "Key is required")
+				continue
+			}
+			if op.Op == bulkKeyOpUpdate && op.Session == nil {
+				job.fail(http.StatusBadRequest, "Session is required")
+				continue
+			}
+
+			orgID := op.OrgID
+			if orgID == "" && op.Session != nil {
+				orgID = op.Session.OrgID
+			}
+
+			if op.Hashed {
+				if !gwConfig.HashKeys {
+					job.fail(http.StatusBadRequest, "Key requested by hash but key hashing is not enabled")
+					continue
+				}
+				job.candidates = []string{op.Key}
+			} else {
+				job.candidates = []string{storage.HashKey(op.Key, gwConfig.HashKeys)}
+				if custom := gw.generateToken(orgID, op.Key); custom != op.Key {
+					job.candidates = append(job.candidates, storage.HashKey(custom, gwConfig.HashKeys))
+				}
+			}
+		default:
+			job.fail(http.StatusBadRequest, fmt.Sprintf("Unknown operation %q", op.Op))
+			continue
+		}
+
+		lookup = append(lookup, job.candidates...)
+	}
+
+	// load all the keys in one go
+	states := make(map[string]*bulkKeyState, len(lookup))
+	for keyID, session := range gw.GlobalSessionManager.SessionDetails(lookup) {
+		states[keyID] = &bulkKeyState{session: session}
+	}
+
+	var (
+		quotaKeys []string
+		written   []string
+		created   = map[string][]string{}
+		updated   = map[string][]string{}
+		deleted   = map[string][]string{}
+	)
+
+	for _, job := range jobs {
+		if job.result.Status != "ok" {
+			continue
+		}
+		op := job.op
+
+		var state *bulkKeyState
+		for _, keyID := range job.candidates {
+			if s := states[keyID]; s != nil && !s.deleted {
+				state = s
+				job.keyID = keyID
+				break
+			}
+		}
+
+		if op.Op != bulkKeyOpCreate && state == nil {
+			job.fail(http.StatusNotFound, "Key is not found")
+			continue
+		}
+		if job.keyName == "" {
+			job.keyName = op.Key
+		}
+
+		session := op.Session
+		resetQuota := !op.SuppressReset
+
+		switch op.Op {
+		case bulkKeyOpCreate, bulkKeyOpUpdate:
+			var original user.SessionState
+			if op.Op == bulkKeyOpUpdate {
+				original = state.session.Clone()
+
+				if session.Certificate != original.Certificate {
+					if session.Certificate == "" {
+						job.fail(http.StatusBadRequest, "Key cannot be used without a certificate")
+						continue
+					}
+					if _, err := gw.CertificateManager.GetRaw(session.Certificate); err != nil {
+						job.fail(http.StatusBadRequest, "Key must be used with an existent certificate")
+						continue
+					}
+				}
+
+				session.DateCreated = original.DateCreated
+				if op.SuppressReset {
+					session.QuotaRenews = original.QuotaRenews
+					session.LastUpdated = original.LastUpdated
+				}
+			} else {
+				session.DateCreated = time.Now()
+			}
+
+			if time.Now().After(time.Unix(session.Expires, 0)) && session.Expires > 1 {
+				session.Expires = original.Expires
+			}
+
+			if session.IsBasicAuth() {
+				if op.Op == bulkKeyOpCreate || original.BasicAuthData.Password != session.BasicAuthData.Password {
+					gw.setBasicAuthSessionPassword(session)
+				}
+			} else if original.IsBasicAuth() {
+				session.BasicAuthData.Hash = original.BasicAuthData.Hash
+				session.BasicAuthData.Password = original.BasicAuthData.Password
+			}
+		case bulkKeyOpApplyPolicies:
+			session = state.session
+			if op.Policies != nil {
+				session.SetPolicies(op.Policies...)
+			}
+		case bulkKeyOpResetQuota:
+			quotaKeys = append(quotaKeys, bulkKeyQuotaKeys(job.keyID, state.session)...)
+			updated[state.session.OrgID] = append(updated[state.session.OrgID], job.keyName)
+			job.result.Key = job.keyName
+			continue
+		case bulkKeyOpDelete:
+			if resetQuota {
+				quotaKeys = append(quotaKeys, bulkKeyQuotaKeys(job.keyID, state.session)...)
+			}
+			state.deleted = true
+			written = append(written, job.keyID)
+			deleted[state.session.OrgID] = append(deleted[state.session.OrgID], job.keyName)
+			job.result.Key = job.keyName
+			continue
+		}
+
+		if !op.SuppressReset {
+			session.LastUpdated = strconv.Itoa(int(time.Now().Unix()))
+		}
+
+		canResetQuota, err := gw.prepareBulkSession(session)
+		if err != nil {
+			job.fail(http.StatusBadRequest, err.Error())
+			continue
+		}
+
+		if op.Op == bulkKeyOpCreate && state == nil {
+			gw.applyTrialPeriod(session)
+		}
+
+		if op.Op != bulkKeyOpApplyPolicies && resetQuota && canResetQuota {
+			quotaKeys = append(quotaKeys, bulkKeyQuotaKeys(job.keyID, session)...)
+			session.QuotaRenews = sessionQuotaRenews(session)
+		}
+
+		if state == nil {
+			state = &bulkKeyState{}
+			states[job.keyID] = state
+		}
+		state.session = session
+		state.lifetime = gw.ApplyLifetime(session, nil)
+		state.deleted = false
+		written = append(written, job.keyID)
+
+		job.result.Key = job.keyName
+		if op.Op == bulkKeyOpCreate {
+			created[session.OrgID] = append(created[session.OrgID], job.keyName)
+			if gwConfig.HashKeys {
+				if session.IsBasicAuth() {
+					job.result.Key = ""
+				}
+				job.result.KeyHash = job.keyID
+			}
+		} else {
+			updated[session.OrgID] = append(updated[session.OrgID], job.keyName)
+		}
+	}
+
+	// write the final state of the keys in one go
+	var (
+		updates []sessionUpdate
+		seen    = make(map[string]bool, len(written))
+	)
+	for _, keyID := range written {
+		if seen[keyID] {
+			continue
+		}
+		seen[keyID] = true
+
+		state := states[keyID]
+		update := sessionUpdate{KeyID: keyID, OrgID: state.session.OrgID}
+		if !state.deleted {
+			update.Session = state.session
+			update.ResetTTLTo = state.lifetime
+		}
+		updates = append(updates, update)
+	}
+
+	if err := gw.GlobalSessionManager.UpdateSessions(updates, quotaKeys); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"status": "fail",
+		}).WithError(err).Error("Failed to run bulk key operations.")
+
+		for _, job := range jobs {
+			if job.result.Status == "ok" {
+				job.fail(http.StatusInternalServerError, "Failed to save keys")
+			}
+		}
+		response.count()
+		return response
+	}
+
+	for org, keys := range created {
+		gw.FireSystemEvent(EventTokensCreated, EventTokenBatchMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Keys added."},
+			Org:              org,
+			Keys:             keys,
+		})
+	}
+	for org, keys := range updated {
+		gw.FireSystemEvent(EventTokensUpdated, EventTokenBatchMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Keys modified."},
+			Org:              org,
+			Keys:             keys,
+		})
+	}
+	for org, keys := range deleted {
+		gw.FireSystemEvent(EventTokensDeleted, EventTokenBatchMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Keys deleted."},
+			Org:              org,
+			Keys:             keys,
+		})
+	}
+
+	response.count()
+	return response
+}
+
+func (r *bulkKeyResponse) count() {
+	r.Succeeded, r.Failed = 0, 0
+	for _, result := range r.Results {
+		if result.Status == "ok" {
+			r.Succeeded++
+		} else {
+			r.Failed++
+		}
+	}
+
+	switch {
+	case r.Failed == 0:
+		r.Status = "ok"
+	case r.Succeeded == 0:
+		r.Status = "error"
+	default:
+		r.Status = "partial"
+	}
+}
+
+// bulkKeysHandler runs a JSON array or NDJSON of key operations. A request with an Idempotency-Key header
+// is only run once, its retries get the response of the first request.
+func (gw *Gateway) bulkKeysHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Couldn't read the request"))
+		return
+	}
+
+	idempotencyKey := r.Header.Get(header.IdempotencyKey)
+	if idempotencyKey == "" {
+		obj, code := gw.runBulkKeys(r, body)
+		doJSONWrite(w, code, obj)
+		return
+	}
+
+	store := &storage.RedisCluster{KeyPrefix: bulkKeyIdempotencyPrefix, RedisController: gw.RedisController}
+	requestHash := sha256.Sum256(body)
+	hash := hex.EncodeToString(requestHash[:])
+
+	if value, err := store.GetKey(idempotencyKey); err == nil {
+		stored := bulkKeyIdempotentResponse{}
+		if err := json.Unmarshal([]byte(value), &stored); err == nil {
+			if stored.RequestHash != hash {
+				doJSONWrite(w, http.StatusUnprocessableEntity, apiError("The idempotency key was used for a different request"))
+				return
+			}
+
+			w.Header().Set(header.ContentType, header.ApplicationJSON)
+			w.WriteHeader(stored.Code)
+			w.Write(stored.Response)
+			return
+		}
+	}
+
+	lock := bulkKeyIdempotencyPrefix + idempotencyKey + ".lock"
+	if store.IncrememntWithExpire(lock, bulkKeyIdempotencyLease) != 1 {
+		doJSONWrite(w, http.StatusConflict, apiError("A request with the idempotency key is in progress"))
+		return
+	}
+	defer store.DeleteRawKey(lock)
+
+	obj, code := gw.runBulkKeys(r, body)
+
+	response, _ := json.Marshal(obj)
+	stored, _ := json.Marshal(bulkKeyIdempotentResponse{RequestHash: hash, Code: code, Response: response})
+	if err := store.SetKey(idempotencyKey, string(stored), bulkKeyIdempotencyTTL); err != nil {
+		log.WithError(err).Error("Couldn't store the response of the bulk key request")
+	}
+
+	doJSONWrite(w, code, obj)
+}
+
+func (gw *Gateway) runBulkKeys(r *http.Request, body []byte) (interface{}, int) {
+	ndjson := strings.HasPrefix(r.Header.Get(header.ContentType), header.ApplicationNDJSON)
+	ops, errs, err := decodeBulkKeyOperations(body, ndjson)
+	if err != nil {
+		log.WithError(err).Error("Couldn't decode bulk key operations")
+		return apiError("Request malformed: " + err.Error()), http.StatusBadRequest
+	}
+
+	response := gw.handleBulkKeys(ops, errs)
+
+	log.WithFields(logrus.Fields{
+		"prefix":    "api",
+		"status":    response.Status,
+		"succeeded": response.Succeeded,
+		"failed":    response.Failed,
+	}).Info("Ran bulk key operations.")
+
+	return response, http.StatusOK
+}
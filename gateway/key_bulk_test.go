@@ -0,0 +1,219 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func runBulkKeys(t *testing.T, ts *Test, tc test.TestCase) bulkKeyResponse {
+	t.Helper()
+
+	tc.Method = http.MethodPost
+	tc.Path = "/tyk/keys/bulk"
+	tc.AdminAuth = true
+	if tc.Code == 0 {
+		tc.Code = http.StatusOK
+	}
+
+	resp, err := ts.Run(t, tc)
+	require.NoError(t, err)
+
+	var response bulkKeyResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+	return response
+}
+
+func bulkKeySession(apiID string) *user.SessionState {
+	session := CreateStandardSession()
+	session.AccessRights = map[string]user.AccessDefinition{apiID: {APIID: apiID, Versions: []string{"v1"}}}
+	return session
+}
+
+func TestKeyHandler_Bulk(t *testing.T) {
+	var (
+		eventsMu sync.Mutex
+		events   = map[apidef.TykEvent][]EventTokenBatchMeta{}
+	)
+	handler := &testEventHandler{cb: func(em config.EventMessage) {
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		events[em.Type] = append(events[em.Type], em.Meta.(EventTokenBatchMeta))
+	}}
+
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.SetEventTriggers(map[apidef.TykEvent][]config.TykEventHandler{
+			EventTokensCreated: {handler},
+			EventTokensUpdated: {handler},
+			EventTokensDeleted: {handler},
+		})
+	})
+	defer ts.Close()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "bulk"
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/bulk/"
+	})
+	polID := ts.CreatePolicy(func(p *user.Policy) {
+		p.Tags = []string{"bulk-policy"}
+	})
+
+	ops := []bulkKeyOperation{
+		{Op: bulkKeyOpCreate, Session: bulkKeySession("bulk")},
+		{Op: bulkKeyOpCreate, Key: "bulk-custom", Session: bulkKeySession("bulk")},
+		{Op: bulkKeyOpCreate, Session: bulkKeySession("unknown")},
+		{Op: "rename"},
+		{Op: bulkKeyOpDelete},
+	}
+	body, _ := json.Marshal(ops)
+
+	response := runBulkKeys(t, ts, test.TestCase{Data: string(body)})
+	assert.Equal(t, "partial", response.Status)
+	assert.Equal(t, 2, response.Succeeded)
+	assert.Equal(t, 3, response.Failed)
+	require.Len(t, response.Results, 5)
+
+	for i, code := range []int{http.StatusOK, http.StatusOK, http.StatusBadRequest, http.StatusBadRequest, http.StatusBadRequest} {
+		assert.Equal(t, i, response.Results[i].Index)
+		assert.Equal(t, code, response.Results[i].Code, response.Results[i].Message)
+	}
+	assert.Contains(t, response.Results[2].Message, "must be active")
+
+	key, custom := response.Results[0].Key, response.Results[1].Key
+	assert.Equal(t, ts.Gw.generateToken("default", "bulk-custom"), custom)
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodGet, Path: "/bulk/", Headers: map[string]string{header.Authorization: key}, Code: http.StatusOK},
+		{Method: http.MethodGet, Path: "/bulk/", Headers: map[string]string{header.Authorization: custom}, Code: http.StatusOK},
+	}...)
+
+	t.Run("ndjson", func(t *testing.T) {
+		updated := bulkKeySession("bulk")
+		updated.Alias = "bulk-updated"
+		updatedJSON, _ := json.Marshal(bulkKeyOperation{Op: bulkKeyOpUpdate, Key: key, Session: updated})
+
+		lines := []string{
+			string(updatedJSON),
+			`{"op":"apply-policies","key":"bulk-custom","org_id":"default","policies":["` + polID + `"]}`,
+			`{"op":"reset-quota","key":"` + key + `"}`,
+			`{"op":`,
+			``,
+			`{"op":"update","key":"missing","session":{}}`,
+		}
+		response := runBulkKeys(t, ts, test.TestCase{
+			Data:    strings.Join(lines, "\n"),
+			Headers: map[string]string{header.ContentType: header.ApplicationNDJSON},
+		})
+
+		require.Len(t, response.Results, 5)
+		assert.Equal(t, http.StatusOK, response.Results[0].Code, response.Results[0].Message)
+		assert.Equal(t, http.StatusOK, response.Results[1].Code, response.Results[1].Message)
+		assert.Equal(t, http.StatusOK, response.Results[2].Code, response.Results[2].Message)
+		assert.Equal(t, http.StatusBadRequest, response.Results[3].Code)
+		assert.Equal(t, http.StatusNotFound, response.Results[4].Code)
+
+		session, found := ts.Gw.GlobalSessionManager.SessionDetail("default", key, false)
+		require.True(t, found)
+		assert.Equal(t, "bulk-updated", session.Alias)
+
+		session, found = ts.Gw.GlobalSessionManager.SessionDetail("default", custom, false)
+		require.True(t, found)
+		assert.Equal(t, []string{polID}, session.PolicyIDs())
+		assert.Contains(t, session.Tags, "bulk-policy")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		response := runBulkKeys(t, ts, test.TestCase{Data: `[{"op":"delete","key":"` + custom + `"},{"op":"delete","key":"` + custom + `"}]`})
+		assert.Equal(t, http.StatusOK, response.Results[0].Code)
+		assert.Equal(t, http.StatusNotFound, response.Results[1].Code)
+
+		_, _ = ts.Run(t, test.TestCase{Method: http.MethodGet, Path: "/bulk/", Headers: map[string]string{header.Authorization: custom}, Code: http.StatusForbidden})
+	})
+
+	t.Run("events", func(t *testing.T) {
+		assert.Eventually(t, func() bool {
+			eventsMu.Lock()
+			defer eventsMu.Unlock()
+			return len(events[EventTokensCreated]) == 1 && len(events[EventTokensUpdated]) == 1 && len(events[EventTokensDeleted]) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		assert.Equal(t, []string{key, custom}, events[EventTokensCreated][0].Keys)
+		assert.Equal(t, []string{key, "bulk-custom", key}, events[EventTokensUpdated][0].Keys)
+		assert.Equal(t, []string{custom}, events[EventTokensDeleted][0].Keys)
+	})
+
+	t.Run("store without pipelines", func(t *testing.T) {
+		sessionManager := ts.Gw.GlobalSessionManager.(*DefaultSessionManager)
+		store := sessionManager.store
+		// like the RPC store, the keys are written one by one
+		sessionManager.store = unbatchedStore{store}
+		defer func() { sessionManager.store = store }()
+
+		response := runBulkKeys(t, ts, test.TestCase{Data: `[{"op":"create","key":"bulk-unbatched","session":{"org_id":"default","access_rights":{"bulk":{"api_id":"bulk","versions":["v1"]}}}}]`})
+		require.Len(t, response.Results, 1)
+		assert.Equal(t, http.StatusOK, response.Results[0].Code, response.Results[0].Message)
+
+		unbatched := response.Results[0].Key
+		_, found := ts.Gw.GlobalSessionManager.SessionDetail("default", unbatched, false)
+		assert.True(t, found)
+
+		response = runBulkKeys(t, ts, test.TestCase{Data: `[{"op":"delete","key":"` + unbatched + `"}]`})
+		assert.Equal(t, http.StatusOK, response.Results[0].Code, response.Results[0].Message)
+		_, found = ts.Gw.GlobalSessionManager.SessionDetail("default", unbatched, false)
+		assert.False(t, found)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/keys/bulk", AdminAuth: true, Data: `[{"op":`, Code: http.StatusBadRequest})
+	})
+}
+
+// unbatchedStore hides the pipelined methods of a store.
+type unbatchedStore struct {
+	storage.Handler
+}
+
+func TestKeyHandler_BulkIdempotency(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "bulk"
+		spec.UseKeylessAccess = false
+	})
+
+	ops, _ := json.Marshal([]bulkKeyOperation{{Op: bulkKeyOpCreate, Session: bulkKeySession("bulk")}})
+	idempotencyKey := map[string]string{header.IdempotencyKey: "bulk-" + time.Now().Format(time.RFC3339Nano)}
+
+	first := runBulkKeys(t, ts, test.TestCase{Data: string(ops), Headers: idempotencyKey})
+	require.Len(t, first.Results, 1)
+
+	retry := runBulkKeys(t, ts, test.TestCase{Data: string(ops), Headers: idempotencyKey})
+	assert.Equal(t, first, retry)
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/tyk/keys/bulk", AdminAuth: true, Data: "[]", Headers: idempotencyKey, Code: http.StatusUnprocessableEntity},
+	}...)
+
+	// a retry while the first request runs is rejected
+	inProgress := map[string]string{header.IdempotencyKey: "bulk-in-progress-" + time.Now().Format(time.RFC3339Nano)}
+	store := &storage.RedisCluster{KeyPrefix: bulkKeyIdempotencyPrefix, RedisController: ts.Gw.RedisController}
+	store.IncrememntWithExpire(bulkKeyIdempotencyPrefix+inProgress[header.IdempotencyKey]+".lock", 60)
+	_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/keys/bulk", AdminAuth: true, Data: string(ops), Headers: inProgress, Code: http.StatusConflict})
+}
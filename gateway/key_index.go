@@ -0,0 +1,318 @@
+package gateway
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	keyIndexPrefix = "keyindex-"
+
+	// keyIndexAll is the set of all the indexed keys.
+	keyIndexAll = "all"
+
+	defaultKeyListLimit = 100
+	maxKeyListLimit     = 1000
+
+	// keyListScanFactor bounds the number of keys scanned for a page, as a multiple of the page size, so
+	// that selective filters return partial pages with a cursor instead of scanning the whole index.
+	keyListScanFactor = 10
+)
+
+// keyIndex is a secondary index of the keys, maintained on every key write so that keys can be listed page by
+// page without scanning the Redis key space. The indexed keys are in sorted sets with equal scores, ordered by
+// key ID: one for all the keys and one for each org, policy, API, tag and alias. The sets of a key are stored
+// along with it so that they can be updated when the key changes.
+type keyIndex struct {
+	store    *storage.RedisCluster
+	sessions *storage.RedisCluster
+}
+
+func newKeyIndex(controller *storage.RedisController) *keyIndex {
+	return &keyIndex{
+		store:    &storage.RedisCluster{KeyPrefix: keyIndexPrefix, RedisController: controller},
+		sessions: &storage.RedisCluster{KeyPrefix: "apikey-", RedisController: controller},
+	}
+}
+
+// keyIndexSets returns the index sets of a session.
+func keyIndexSets(session *user.SessionState) []string {
+	sets := []string{keyIndexAll, "org:" + session.OrgID}
+	for _, polID := range session.PolicyIDs() {
+		sets = append(sets, "policy:"+polID)
+	}
+	for apiID := range session.AccessRights {
+		sets = append(sets, "api:"+apiID)
+	}
+	for _, tag := range session.Tags {
+		sets = append(sets, "tag:"+tag)
+	}
+	if session.Alias != "" {
+		sets = append(sets, "alias:"+session.Alias)
+	}
+
+	sort.Strings(sets)
+	deduped := sets[:0]
+	for i, set := range sets {
+		if i == 0 || set != sets[i-1] {
+			deduped = append(deduped, set)
+		}
+	}
+	return deduped
+}
+
+func (i *keyIndex) entryKey(keyID string) string {
+	return "entry:" + keyID
+}
+
+func (i *keyIndex) entry(keyID string) []string {
+	value, err := i.store.GetKey(i.entryKey(keyID))
+	if err != nil {
+		return nil
+	}
+
+	var sets []string
+	json.Unmarshal([]byte(value), &sets)
+	return sets
+}
+
+// update indexes a key, keyID is the key as stored, hashed if key hashing is enabled.
+func (i *keyIndex) update(keyID string, session *user.SessionState) {
+	sets := keyIndexSets(session)
+	previous := i.entry(keyID)
+
+	if strings.Join(sets, "\n") == strings.Join(previous, "\n") {
+		return
+	}
+
+	current := make(map[string]bool, len(sets))
+	for _, set := range sets {
+		current[set] = true
+	}
+	for _, set := range previous {
+		if !current[set] {
+			i.store.RemoveFromSortedSet(set, keyID)
+		}
+	}
+	for _, set := range sets {
+		i.store.AddToSortedSet(set, keyID, 0)
+	}
+
+	asJSON, _ := json.Marshal(sets)
+	if err := i.store.SetKey(i.entryKey(keyID), string(asJSON), 0); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "auth-mgr",
+		}).WithError(err).Error("Couldn't index key")
+	}
+}
+
+// remove removes a key from the index.
+func (i *keyIndex) remove(keyID string) {
+	sets := i.entry(keyID)
+	if sets == nil {
+		sets = []string{keyIndexAll}
+	}
+
+	for _, set := range sets {
+		i.store.RemoveFromSortedSet(set, keyID)
+	}
+	i.store.DeleteKey(i.entryKey(keyID))
+}
+
+// keyListFilter filters the listed keys.
+type keyListFilter struct {
+	OrgID    string
+	PolicyID string
+	APIID    string
+	Tag      string
+	Alias    string
+
+	// ExpiresAfter and ExpiresBefore are unix timestamps, keys which never expire only match ExpiresAfter.
+	ExpiresAfter  int64
+	ExpiresBefore int64
+
+	Inactive *bool
+}
+
+// set returns the most selective index set of the filter.
+func (f keyListFilter) set() string {
+	switch {
+	case f.Alias != "":
+		return "alias:" + f.Alias
+	case f.PolicyID != "":
+		return "policy:" + f.PolicyID
+	case f.APIID != "":
+		return "api:" + f.APIID
+	case f.Tag != "":
+		return "tag:" + f.Tag
+	case f.OrgID != "":
+		return "org:" + f.OrgID
+	}
+	return keyIndexAll
+}
+
+func (f keyListFilter) matches(session *user.SessionState) bool {
+	if f.OrgID != "" && session.OrgID != f.OrgID {
+		return false
+	}
+	if f.Alias != "" && session.Alias != f.Alias {
+		return false
+	}
+	if f.PolicyID != "" && !containsString(session.PolicyIDs(), f.PolicyID) {
+		return false
+	}
+	if f.APIID != "" {
+		if _, ok := session.AccessRights[f.APIID]; !ok {
+			return false
+		}
+	}
+	if f.Tag != "" && !containsString(session.Tags, f.Tag) {
+		return false
+	}
+
+	neverExpires := session.Expires <= 0
+	if f.ExpiresAfter > 0 && !neverExpires && session.Expires < f.ExpiresAfter {
+		return false
+	}
+	if f.ExpiresBefore > 0 && (neverExpires || session.Expires > f.ExpiresBefore) {
+		return false
+	}
+
+	if f.Inactive != nil && session.IsInactive != *f.Inactive {
+		return false
+	}
+
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSessions returns the sessions of the keys, nil for the keys which couldn't be loaded.
+func (i *keyIndex) loadSessions(keyIDs []string) []*user.SessionState {
+	sessions := make([]*user.SessionState, len(keyIDs))
+
+	values, err := i.sessions.GetMultiKey(keyIDs)
+	if err != nil {
+		return sessions
+	}
+
+	for n, value := range values {
+		if value == "" {
+			continue
+		}
+		session := &user.SessionState{}
+		if err := json.Unmarshal([]byte(value), session); err == nil {
+			sessions[n] = session
+		}
+	}
+	return sessions
+}
+
+// partialSession returns the given fields of a session, with the key ID.
+func partialSession(keyID string, session *user.SessionState, fields []string) map[string]interface{} {
+	var all map[string]interface{}
+	asJSON, _ := json.Marshal(session)
+	json.Unmarshal(asJSON, &all)
+
+	partial := map[string]interface{}{"key_id": keyID}
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			partial[field] = value
+		}
+	}
+	return partial
+}
+
+// list returns a page of the keys matching the filter, in key ID order after the cursor. The next cursor is
+// returned unless the index is exhausted, the page can have less keys than the limit when few keys match.
+func (i *keyIndex) list(filter keyListFilter, cursor string, limit int, fields []string) (*apiKeyList, error) {
+	if limit <= 0 {
+		limit = defaultKeyListLimit
+	}
+	if limit > maxKeyListLimit {
+		limit = maxKeyListLimit
+	}
+
+	page := &apiKeyList{APIKeys: []string{}}
+	if len(fields) > 0 {
+		page.Sessions = []map[string]interface{}{}
+	}
+
+	set := filter.set()
+	min := "-"
+	if cursor != "" {
+		min = "(" + cursor
+	}
+
+	for scanned := 0; scanned < limit*keyListScanFactor; {
+		keyIDs, err := i.store.GetSortedSetRangeByLex(set, min, "+", int64(limit))
+		if err != nil {
+			return nil, err
+		}
+
+		sessions := i.loadSessions(keyIDs)
+		for n, keyID := range keyIDs {
+			scanned++
+			min = "(" + keyID
+
+			if sessions[n] == nil {
+				// expired or deleted without going through the session manager
+				if exists, err := i.sessions.Exists(keyID); err == nil && !exists {
+					i.remove(keyID)
+				}
+				continue
+			}
+			if !filter.matches(sessions[n]) {
+				continue
+			}
+
+			page.APIKeys = append(page.APIKeys, keyID)
+			if len(fields) > 0 {
+				page.Sessions = append(page.Sessions, partialSession(keyID, sessions[n], fields))
+			}
+			if len(page.APIKeys) == limit {
+				page.NextCursor = keyID
+				return page, nil
+			}
+		}
+
+		if len(keyIDs) < limit {
+			return page, nil
+		}
+	}
+
+	page.NextCursor = strings.TrimPrefix(min, "(")
+	return page, nil
+}
+
+// rebuild indexes the keys already stored, it scans the key space.
+func (i *keyIndex) rebuild() int {
+	count := 0
+	for _, keyID := range i.sessions.GetKeys("") {
+		keyID = strings.TrimPrefix(keyID, i.sessions.KeyPrefix)
+		if strings.HasPrefix(keyID, QuotaKeyPrefix) || strings.HasPrefix(keyID, CreditsKeyPrefix) || strings.HasPrefix(keyID, RateLimitKeyPrefix) {
+			continue
+		}
+
+		session := i.loadSessions([]string{keyID})[0]
+		if session == nil {
+			continue
+		}
+		i.update(keyID, session)
+		count++
+	}
+	return count
+}
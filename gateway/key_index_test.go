@@ -0,0 +1,177 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func listKeys(t *testing.T, ts *Test, query string) apiKeyList {
+	t.Helper()
+
+	resp, err := ts.Run(t, test.TestCase{Method: http.MethodGet, Path: "/tyk/keys?" + query, AdminAuth: true, Code: http.StatusOK})
+	require.NoError(t, err)
+
+	var keys apiKeyList
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&keys))
+	return keys
+}
+
+func TestKeyHandler_List(t *testing.T) {
+	for _, hashKeys := range []bool{false, true} {
+		t.Run("hash keys "+strconv.FormatBool(hashKeys), func(t *testing.T) {
+			ts := StartTest(func(globalConf *config.Config) {
+				globalConf.HashKeys = hashKeys
+				globalConf.EnableHashedKeysListing = true
+			})
+			defer ts.Close()
+
+			orgID := "keyindex-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+			expires := time.Now().Add(time.Hour).Unix()
+
+			keyIDs := make(map[string]string)
+			for i := 0; i < 5; i++ {
+				_, key := ts.CreateSession(func(s *user.SessionState) {
+					s.OrgID = orgID
+					s.Alias = "alias-" + strconv.Itoa(i)
+					s.IsInactive = i == 0
+					if i%2 == 0 {
+						s.Tags = []string{"even"}
+						s.Expires = expires
+					}
+					s.AccessRights = map[string]user.AccessDefinition{"api-" + strconv.Itoa(i%2): {APIID: "api-" + strconv.Itoa(i%2)}}
+				})
+				keyIDs[storage.HashKey(key, hashKeys)] = "alias-" + strconv.Itoa(i)
+			}
+
+			t.Run("pages", func(t *testing.T) {
+				var listed []string
+				cursor := ""
+				for pages := 0; pages < 10; pages++ {
+					keys := listKeys(t, ts, "org_id="+orgID+"&limit=2&cursor="+cursor)
+					assert.LessOrEqual(t, len(keys.APIKeys), 2)
+					listed = append(listed, keys.APIKeys...)
+
+					if keys.NextCursor == "" {
+						break
+					}
+					cursor = keys.NextCursor
+				}
+
+				assert.Len(t, listed, 5)
+				assert.True(t, sort.StringsAreSorted(listed))
+				for _, keyID := range listed {
+					assert.Contains(t, keyIDs, keyID)
+				}
+			})
+
+			t.Run("filters", func(t *testing.T) {
+				assert.Len(t, listKeys(t, ts, "org_id="+orgID+"&limit=10").APIKeys, 5)
+				assert.Subset(t, listKeys(t, ts, "api_id=api-1&limit=10").APIKeys, listKeys(t, ts, "org_id="+orgID+"&api_id=api-1&limit=10").APIKeys)
+				assert.Len(t, listKeys(t, ts, "org_id="+orgID+"&tag=even").APIKeys, 3)
+				assert.Len(t, listKeys(t, ts, "org_id="+orgID+"&api_id=api-1&limit=10").APIKeys, 2)
+				assert.Len(t, listKeys(t, ts, "org_id="+orgID+"&inactive=true").APIKeys, 1)
+				assert.Len(t, listKeys(t, ts, "org_id="+orgID+"&inactive=false").APIKeys, 4)
+				assert.Len(t, listKeys(t, ts, "org_id="+orgID+"&expires_before="+strconv.FormatInt(expires+1, 10)).APIKeys, 3)
+				assert.Len(t, listKeys(t, ts, "org_id="+orgID+"&expires_after="+strconv.FormatInt(expires+1, 10)).APIKeys, 2)
+
+				keys := listKeys(t, ts, "alias=alias-3&org_id="+orgID)
+				require.Len(t, keys.APIKeys, 1)
+				assert.Equal(t, "alias-3", keyIDs[keys.APIKeys[0]])
+			})
+
+			t.Run("fields", func(t *testing.T) {
+				keys := listKeys(t, ts, "alias=alias-1&org_id="+orgID+"&fields=alias,tags,unknown")
+				require.Len(t, keys.Sessions, 1)
+				assert.Equal(t, map[string]interface{}{
+					"key_id": keys.APIKeys[0],
+					"alias":  "alias-1",
+					"tags":   []interface{}{},
+				}, keys.Sessions[0])
+			})
+
+			t.Run("invalid parameters", func(t *testing.T) {
+				_, _ = ts.Run(t, []test.TestCase{
+					{Method: http.MethodGet, Path: "/tyk/keys?limit=x", AdminAuth: true, Code: http.StatusBadRequest},
+					{Method: http.MethodGet, Path: "/tyk/keys?inactive=x", AdminAuth: true, Code: http.StatusBadRequest},
+					{Method: http.MethodGet, Path: "/tyk/keys?expires_before=x", AdminAuth: true, Code: http.StatusBadRequest},
+				}...)
+			})
+
+			t.Run("deleted keys", func(t *testing.T) {
+				keyID := listKeys(t, ts, "alias=alias-2&org_id="+orgID).APIKeys[0]
+				assert.True(t, ts.Gw.GlobalSessionManager.RemoveSession(orgID, keyID, true))
+				assert.Empty(t, listKeys(t, ts, "alias=alias-2&org_id="+orgID).APIKeys)
+
+				// keys removed without the session manager are removed from the index when listed
+				keyID = listKeys(t, ts, "alias=alias-4&org_id="+orgID).APIKeys[0]
+				assert.True(t, ts.Gw.keyIndex.sessions.DeleteKey(keyID))
+				assert.Empty(t, listKeys(t, ts, "alias=alias-4&org_id="+orgID).APIKeys)
+				assert.Nil(t, ts.Gw.keyIndex.entry(keyID))
+			})
+
+			t.Run("rebuild", func(t *testing.T) {
+				keyID := listKeys(t, ts, "alias=alias-1&org_id="+orgID).APIKeys[0]
+				ts.Gw.keyIndex.remove(keyID)
+				assert.Empty(t, listKeys(t, ts, "alias=alias-1&org_id="+orgID).APIKeys)
+				// the legacy listing scans the keys
+				assert.Contains(t, listKeys(t, ts, "org_id="+orgID).APIKeys, keyID)
+
+				_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/keys/index/rebuild", AdminAuth: true, Code: http.StatusAccepted})
+				assert.Eventually(t, func() bool {
+					return ts.Gw.keyIndex.entry(keyID) != nil
+				}, 5*time.Second, 10*time.Millisecond)
+				assert.Equal(t, []string{keyID}, listKeys(t, ts, "alias=alias-1&org_id="+orgID).APIKeys)
+			})
+		})
+	}
+
+	t.Run("hashed key listing disabled", func(t *testing.T) {
+		ts := StartTest(func(globalConf *config.Config) {
+			globalConf.HashKeys = true
+			globalConf.EnableHashedKeysListing = false
+		})
+		defer ts.Close()
+
+		_, _ = ts.Run(t, test.TestCase{Method: http.MethodGet, Path: "/tyk/keys?limit=10", AdminAuth: true, Code: http.StatusNotFound})
+	})
+}
+
+func TestKeyIndex_Update(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	session := CreateStandardSession()
+	session.OrgID = "org"
+	session.Tags = []string{"a", "b", "a"}
+	session.AccessRights = map[string]user.AccessDefinition{"api": {APIID: "api"}}
+
+	keyID := "keyindex-update-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	ts.Gw.keyIndex.update(keyID, session)
+	assert.Equal(t, []string{"all", "api:api", "org:org", "tag:a", "tag:b"}, ts.Gw.keyIndex.entry(keyID))
+
+	session.Tags = []string{"b"}
+	ts.Gw.keyIndex.update(keyID, session)
+	assert.Equal(t, []string{"all", "api:api", "org:org", "tag:b"}, ts.Gw.keyIndex.entry(keyID))
+
+	keyIDs, err := ts.Gw.keyIndex.store.GetSortedSetRangeByLex("tag:a", "["+keyID, "["+keyID, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, keyIDs)
+
+	ts.Gw.keyIndex.remove(keyID)
+	assert.Nil(t, ts.Gw.keyIndex.entry(keyID))
+	keyIDs, err = ts.Gw.keyIndex.store.GetSortedSetRangeByLex("tag:b", "["+keyID, "["+keyID, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, keyIDs)
+}
@@ -0,0 +1,345 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	keyRotationPrefix = "key-rotation."
+
+	defaultKeyRotationGracePeriod = time.Hour
+
+	// keyRotationLease is how long the end of a grace period is claimed by a gateway (in seconds).
+	keyRotationLease = 60
+)
+
+// keyRotationPollInterval is how often the grace periods are checked.
+var keyRotationPollInterval = time.Second
+
+var (
+	errKeyAlreadyRotated      = errors.New("Key is already rotated")
+	errKeyRotationBasicAuth   = errors.New("Basic auth keys can't be rotated")
+	errKeyRotationGracePeriod = errors.New("Invalid grace period")
+)
+
+// keyRotation is a key replaced by a new key and valid until the end of its grace period. The keys are stored
+// hashed if key hashing is enabled.
+type keyRotation struct {
+	KeyID           string `json:"key_id"`
+	NewKeyID        string `json:"new_key_id"`
+	OrgID           string `json:"org_id"`
+	GracePeriodEnds int64  `json:"grace_period_ends"`
+
+	// OAuthClientTokens are the client token lists of the APIs the key was added to, if it's an OAuth token.
+	OAuthClientTokens []string `json:"oauth_client_tokens,omitempty"`
+}
+
+// keyRotations stores the rotated keys in Redis, in a sorted set scored by the end of their grace period.
+type keyRotations struct {
+	store *storage.RedisCluster
+}
+
+func newKeyRotations(controller *storage.RedisController) *keyRotations {
+	return &keyRotations{
+		store: &storage.RedisCluster{KeyPrefix: keyRotationPrefix, RedisController: controller},
+	}
+}
+
+func (k *keyRotations) add(rotation *keyRotation) error {
+	asJSON, err := json.Marshal(rotation)
+	if err != nil {
+		return err
+	}
+	if err := k.store.SetKey("key."+rotation.KeyID, string(asJSON), 0); err != nil {
+		return err
+	}
+	k.store.AddToSortedSet("pending", rotation.KeyID, float64(rotation.GracePeriodEnds))
+	return nil
+}
+
+func (k *keyRotations) get(keyID string) (*keyRotation, error) {
+	value, err := k.store.GetKey("key." + keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	rotation := &keyRotation{}
+	if err := json.Unmarshal([]byte(value), rotation); err != nil {
+		return nil, err
+	}
+	return rotation, nil
+}
+
+// due returns the keys whose grace period ended at the given time.
+func (k *keyRotations) due(now time.Time) ([]string, error) {
+	keyIDs, _, err := k.store.GetSortedSetRange("pending", "-inf", strconv.FormatInt(now.Unix(), 10))
+	return keyIDs, err
+}
+
+// claim locks the end of a grace period for a gateway, it returns false if another gateway is ending it.
+func (k *keyRotations) claim(keyID string) bool {
+	return k.store.IncrememntWithExpire(keyRotationPrefix+"lock."+keyID, keyRotationLease) == 1
+}
+
+func (k *keyRotations) done(keyID string) {
+	k.store.RemoveFromSortedSet("pending", keyID)
+	k.store.DeleteKey("key." + keyID)
+	k.store.DeleteRawKey(keyRotationPrefix + "lock." + keyID)
+}
+
+// keyQuotaCounter returns the raw key of a quota counter of a key, scoped if the quota is shared between APIs.
+func keyQuotaCounter(keyID, scope string) string {
+	if scope == "" {
+		return QuotaKeyPrefix + keyID
+	}
+	return QuotaKeyPrefix + scope + "-" + keyID
+}
+
+// keyQuotaScopes returns the scopes of the quota counters of a session.
+func keyQuotaScopes(session *user.SessionState) []string {
+	scopes := []string{""}
+	for _, acl := range session.AccessRights {
+		if acl.AllowanceScope != "" {
+			scopes = append(scopes, acl.AllowanceScope)
+		}
+	}
+	return scopes
+}
+
+// rotateKey creates a new key with the session of a key, the key stays valid until the end of the grace period.
+// The quota counters of the key are copied to the new key, its prepaid credits are moved, and OAuth tokens are added to the tokens of their client.
+func (gw *Gateway) rotateKey(keyID string, session *user.SessionState, gracePeriod time.Duration) (string, *keyRotation, error) {
+	if session.Rotation != nil {
+		return "", nil, errKeyAlreadyRotated
+	}
+	if session.IsBasicAuth() {
+		return "", nil, errKeyRotationBasicAuth
+	}
+
+	now := time.Now()
+	newKeyName := gw.generateToken(session.OrgID, "")
+	rotation := &keyRotation{
+		KeyID:           keyID,
+		NewKeyID:        storage.HashKey(newKeyName, gw.GetConfig().HashKeys),
+		OrgID:           session.OrgID,
+		GracePeriodEnds: now.Add(gracePeriod).Unix(),
+	}
+
+	raw := &storage.RedisCluster{RedisController: gw.RedisController}
+	for _, scope := range keyQuotaScopes(session) {
+		counter := keyQuotaCounter(keyID, scope)
+		value, err := raw.GetKey(counter)
+		if err != nil {
+			continue
+		}
+		ttl, _ := raw.GetKeyTTL(counter)
+		raw.SetKey(keyQuotaCounter(rotation.NewKeyID, scope), value, ttl)
+	}
+	// the prepaid credits are spent by the new key from now on
+	moveKeyCredits(raw, keyID, rotation.NewKeyID, session)
+
+	if session.OauthClientID != "" {
+		for apiID := range session.AccessRights {
+			tokens := generateOAuthPrefix(apiID) + prefixClientTokens + session.OauthClientID
+			keyIDs, scores, err := raw.GetSortedSetRange(tokens, "-inf", "+inf")
+			if err != nil {
+				continue
+			}
+			for i := range keyIDs {
+				if keyIDs[i] == keyID {
+					raw.AddToSortedSet(tokens, rotation.NewKeyID, scores[i])
+					rotation.OAuthClientTokens = append(rotation.OAuthClientTokens, tokens)
+					break
+				}
+			}
+		}
+	}
+
+	newSession := session.Clone()
+	if err := gw.GlobalSessionManager.UpdateSession(rotation.NewKeyID, &newSession, gw.ApplyLifetime(&newSession, nil), true); err != nil {
+		return "", nil, err
+	}
+
+	if gracePeriod <= 0 {
+		gw.endKeyRotation(rotation)
+		return newKeyName, rotation, nil
+	}
+
+	if err := gw.keyRotations.add(rotation); err != nil {
+		return "", nil, err
+	}
+
+	// the key expires at the end of the grace period, even if it wasn't removed yet
+	session.Rotation = &user.KeyRotation{RotatedAt: now.Unix(), GracePeriodEnds: rotation.GracePeriodEnds}
+	if session.Expires <= 0 || session.Expires > rotation.GracePeriodEnds {
+		session.Expires = rotation.GracePeriodEnds
+	}
+	if err := gw.GlobalSessionManager.UpdateSession(keyID, session, gw.ApplyLifetime(session, nil), true); err != nil {
+		return "", nil, err
+	}
+
+	return newKeyName, rotation, nil
+}
+
+// endKeyRotation removes a rotated key at the end of its grace period.
+func (gw *Gateway) endKeyRotation(rotation *keyRotation) {
+	raw := &storage.RedisCluster{RedisController: gw.RedisController}
+	if session, found := gw.GlobalSessionManager.SessionDetail(rotation.OrgID, rotation.KeyID, true); found {
+		for _, scope := range keyQuotaScopes(&session) {
+			raw.DeleteRawKey(keyQuotaCounter(rotation.KeyID, scope))
+		}
+	}
+	gw.GlobalSessionManager.RemoveSession(rotation.OrgID, rotation.KeyID, true)
+
+	for _, tokens := range rotation.OAuthClientTokens {
+		raw.RemoveFromSortedSet(tokens, rotation.KeyID)
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+		"key":    gw.obfuscateKey(rotation.KeyID),
+	}).Info("Removed rotated key at the end of its grace period.")
+
+	gw.FireSystemEvent(EventKeyGracePeriodEnded, EventKeyRotationMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Key grace period ended."},
+		Org:              rotation.OrgID,
+		Key:              rotation.KeyID,
+		NewKey:           rotation.NewKeyID,
+	})
+}
+
+// endKeyRotations removes the rotated keys whose grace period ended.
+func (gw *Gateway) endKeyRotations(now time.Time) {
+	keyIDs, err := gw.keyRotations.due(now)
+	if err != nil {
+		return
+	}
+
+	for _, keyID := range keyIDs {
+		if !gw.keyRotations.claim(keyID) {
+			continue
+		}
+
+		if rotation, err := gw.keyRotations.get(keyID); err == nil {
+			gw.endKeyRotation(rotation)
+		}
+		gw.keyRotations.done(keyID)
+	}
+}
+
+func (gw *Gateway) keyRotationLoop(ctx context.Context) {
+	ticker := time.NewTicker(keyRotationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if gw.RedisController.Connected() {
+				gw.endKeyRotations(now)
+			}
+		}
+	}
+}
+
+// apiRotateKeySuccess is the response of a key rotation, the key is the new key.
+type apiRotateKeySuccess struct {
+	apiModifyKeySuccess
+	GracePeriodEnds int64 `json:"grace_period_ends"`
+}
+
+func (gw *Gateway) rotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyName := mux.Vars(r)["keyName"]
+	isHashed := r.URL.Query().Get("hashed") != ""
+	orgID := r.URL.Query().Get("org_id")
+
+	if isHashed && !gw.GetConfig().HashKeys {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Key requested by hash but key hashing is not enabled"))
+		return
+	}
+
+	gracePeriod := defaultKeyRotationGracePeriod
+	if value := r.URL.Query().Get("grace_period"); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds < 0 {
+			doJSONWrite(w, http.StatusBadRequest, apiError(errKeyRotationGracePeriod.Error()))
+			return
+		}
+		gracePeriod = time.Duration(seconds) * time.Second
+	}
+
+	session, found := gw.GlobalSessionManager.SessionDetail(orgID, keyName, isHashed)
+	if !found {
+		doJSONWrite(w, http.StatusNotFound, apiError("Key not found"))
+		return
+	}
+	keyID := session.KeyID
+	if !isHashed {
+		keyID = storage.HashKey(keyID, gw.GetConfig().HashKeys)
+	}
+
+	newKeyName, rotation, err := gw.rotateKey(keyID, &session, gracePeriod)
+	switch err {
+	case nil:
+	case errKeyAlreadyRotated:
+		doJSONWrite(w, http.StatusConflict, apiError(err.Error()))
+		return
+	case errKeyRotationBasicAuth:
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	default:
+		log.WithError(err).Error("Failed to rotate key")
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to rotate key"))
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix":  "api",
+		"key":     gw.obfuscateKey(keyID),
+		"new_key": gw.obfuscateKey(rotation.NewKeyID),
+		"status":  "ok",
+	}).Info("Rotated key.")
+
+	gw.FireSystemEvent(EventTokenCreated, EventTokenMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Key rotated."},
+		Org:              session.OrgID,
+		Key:              newKeyName,
+	})
+
+	response := apiRotateKeySuccess{
+		apiModifyKeySuccess: apiModifyKeySuccess{
+			Key:    newKeyName,
+			Status: "ok",
+			Action: "rotated",
+		},
+		GracePeriodEnds: rotation.GracePeriodEnds,
+	}
+	if gw.GetConfig().HashKeys {
+		response.KeyHash = rotation.NewKeyID
+	}
+
+	doJSONWrite(w, http.StatusOK, response)
+}
+
+// setKeyRotationHeaders tells the clients of a rotated key that it's deprecated and when it stops working.
+func setKeyRotationHeaders(h http.Header, session *user.SessionState) {
+	if session == nil || session.Rotation == nil {
+		return
+	}
+
+	h.Set(header.Deprecation, "@"+strconv.FormatInt(session.Rotation.RotatedAt, 10))
+	h.Set(header.Sunset, time.Unix(session.Rotation.GracePeriodEnds, 0).UTC().Format(http.TimeFormat))
+}
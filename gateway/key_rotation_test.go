@@ -0,0 +1,177 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestKeyHandler_Rotate(t *testing.T) {
+	t.Run("Without hashing", func(t *testing.T) {
+		testKeyHandlerRotate(t, false)
+	})
+	t.Run("With hashing", func(t *testing.T) {
+		testKeyHandlerRotate(t, true)
+	})
+}
+
+func testKeyHandlerRotate(t *testing.T, hashed bool) {
+	var (
+		eventsMu sync.Mutex
+		events   []EventKeyRotationMeta
+	)
+	handler := &testEventHandler{cb: func(em config.EventMessage) {
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		events = append(events, em.Meta.(EventKeyRotationMeta))
+	}}
+
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.HashKeys = hashed
+		globalConf.SetEventTriggers(map[apidef.TykEvent][]config.TykEventHandler{
+			EventKeyGracePeriodEnded: {handler},
+		})
+	})
+	defer ts.Close()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "rotate"
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/rotate/"
+	})
+
+	_, key := ts.CreateSession(func(s *user.SessionState) {
+		s.QuotaMax = 10
+		s.QuotaRemaining = 10
+		s.AccessRights = map[string]user.AccessDefinition{"rotate": {APIID: "rotate", Versions: []string{"v1"}}}
+	})
+	keyID := storage.HashKey(key, hashed)
+	auth := map[string]string{header.Authorization: key}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/rotate/", Headers: auth, Code: http.StatusOK},
+		{Path: "/rotate/", Headers: auth, Code: http.StatusOK},
+	}...)
+
+	rotatePath := "/tyk/keys/" + key + "/rotate?grace_period=60"
+	if hashed {
+		rotatePath = "/tyk/keys/" + keyID + "/rotate?hashed=1&grace_period=60"
+	}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/tyk/keys/" + key + "/rotate?grace_period=-1", AdminAuth: true, Code: http.StatusBadRequest},
+		{Method: http.MethodPost, Path: "/tyk/keys/missing/rotate", AdminAuth: true, Code: http.StatusNotFound},
+	}...)
+
+	resp, err := ts.Run(t, test.TestCase{Method: http.MethodPost, Path: rotatePath, AdminAuth: true, Code: http.StatusOK})
+	require.NoError(t, err)
+
+	var rotated apiRotateKeySuccess
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rotated))
+	assert.Equal(t, "rotated", rotated.Action)
+	assert.NotEqual(t, key, rotated.Key)
+	newKeyID := storage.HashKey(rotated.Key, hashed)
+	if hashed {
+		assert.Equal(t, newKeyID, rotated.KeyHash)
+	} else {
+		assert.Empty(t, rotated.KeyHash)
+	}
+
+	t.Run("both keys work during the grace period", func(t *testing.T) {
+		resp, err := ts.Run(t, test.TestCase{Path: "/rotate/", Headers: auth, Code: http.StatusOK})
+		require.NoError(t, err)
+		assert.NotEmpty(t, resp.Header.Get(header.Deprecation))
+		assert.Equal(t, time.Unix(rotated.GracePeriodEnds, 0).UTC().Format(http.TimeFormat), resp.Header.Get(header.Sunset))
+
+		// the quota used by the old key before the rotation is carried over
+		resp, err = ts.Run(t, test.TestCase{
+			Path:         "/rotate/",
+			Headers:      map[string]string{header.Authorization: rotated.Key},
+			HeadersMatch: map[string]string{header.XRateLimitRemaining: "7"},
+			Code:         http.StatusOK,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, resp.Header.Get(header.Deprecation))
+	})
+
+	t.Run("a key is rotated once", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: rotatePath, AdminAuth: true, Code: http.StatusConflict})
+	})
+
+	t.Run("grace period end", func(t *testing.T) {
+		ts.Gw.endKeyRotations(time.Now().Add(2 * time.Minute))
+
+		_, _ = ts.Run(t, []test.TestCase{
+			{Path: "/rotate/", Headers: auth, Code: http.StatusForbidden},
+			{Path: "/rotate/", Headers: map[string]string{header.Authorization: rotated.Key}, Code: http.StatusOK},
+		}...)
+
+		_, err := ts.Gw.GlobalSessionManager.Store().GetRawKey(QuotaKeyPrefix + keyID)
+		assert.Error(t, err)
+
+		assert.Eventually(t, func() bool {
+			eventsMu.Lock()
+			defer eventsMu.Unlock()
+			return len(events) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		assert.Equal(t, keyID, events[0].Key)
+		assert.Equal(t, newKeyID, events[0].NewKey)
+		assert.Equal(t, "default", events[0].Org)
+	})
+}
+
+func TestRotateKey_OAuthClient(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	session := CreateStandardSession()
+	session.OauthClientID = "rotate-client"
+	session.AccessRights = map[string]user.AccessDefinition{"rotate": {APIID: "rotate"}}
+
+	keyID := "rotate-oauth-token"
+	require.NoError(t, ts.Gw.GlobalSessionManager.UpdateSession(keyID, session, 0, true))
+
+	raw := &storage.RedisCluster{RedisController: ts.Gw.RedisController}
+	tokens := generateOAuthPrefix("rotate") + prefixClientTokens + session.OauthClientID
+	expires := float64(time.Now().Add(time.Hour).Unix())
+	raw.AddToSortedSet(tokens, keyID, expires)
+	defer raw.DeleteRawKey(tokens)
+
+	newKeyName, rotation, err := ts.Gw.rotateKey(keyID, session, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{tokens}, rotation.OAuthClientTokens)
+
+	newSession, found := ts.Gw.GlobalSessionManager.SessionDetail("default", newKeyName, false)
+	require.True(t, found)
+	assert.Equal(t, "rotate-client", newSession.OauthClientID)
+	assert.Nil(t, newSession.Rotation)
+
+	keyIDs, scores, err := raw.GetSortedSetRange(tokens, "-inf", "+inf")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{keyID, rotation.NewKeyID}, keyIDs)
+	assert.Equal(t, []float64{expires, expires}, scores)
+
+	ts.Gw.endKeyRotations(time.Now().Add(2 * time.Minute))
+
+	keyIDs, _, err = raw.GetSortedSetRange(tokens, "-inf", "+inf")
+	require.NoError(t, err)
+	assert.Equal(t, []string{rotation.NewKeyID}, keyIDs)
+
+	_, found = ts.Gw.GlobalSessionManager.SessionDetail("default", keyID, true)
+	assert.False(t, found)
+}
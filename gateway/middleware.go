@@ -303,16 +303,8 @@ func (t BaseMiddleware) UpdateRequestSession(r *http.Request) bool {
 
 // clearSession clears the quota, rate limit and complexity values so that partitioned policies can apply their values.
 // Otherwise, if the session has already a higher value, an applied policy will not win, and its values will be ignored.
-func (t BaseMiddleware) clearSession(session *user.SessionState) {
-	policies := session.PolicyIDs()
-	for _, polID := range policies {
-		t.Gw.policiesMu.RLock()
-		policy, ok := t.Gw.policiesByID[polID]
-		t.Gw.policiesMu.RUnlock()
-		if !ok {
-			continue
-		}
-
+func (t BaseMiddleware) clearSession(session *user.SessionState, policies []user.Policy) {
+	for _, policy := range policies {
 		all := !(policy.Partitions.Quota || policy.Partitions.RateLimit || policy.Partitions.Acl || policy.Partitions.Complexity)
 
 		if policy.Partitions.Quota || all {
@@ -330,9 +322,43 @@ func (t BaseMiddleware) clearSession(session *user.SessionState) {
 		if policy.Partitions.Complexity || all {
 			session.MaxQueryDepth = 0
 		}
+
+		// the group limits are reset along with the key limits
+		if policy.Partitions.Quota || policy.Partitions.RateLimit || all {
+			session.Group = nil
+		}
 	}
 }
 
+// sessionPolicies returns the policies applied to a key, resolved from the policies they extend. Policies declaring
+// merge strategies are composed into one policy first. A policy which can't be resolved is skipped when the key has
+// others.
+func (t BaseMiddleware) sessionPolicies(polIDs []string) ([]user.Policy, error) {
+	composed, err := t.Gw.composePolicies(polIDs)
+	if err != nil {
+		t.Logger().Error(err)
+		return nil, err
+	}
+	if composed != nil {
+		return []user.Policy{composed.Policy}, nil
+	}
+
+	policies := make([]user.Policy, 0, len(polIDs))
+	for _, polID := range polIDs {
+		policy, err := t.Gw.resolvedPolicy(polID)
+		if err != nil {
+			t.Logger().Error(err)
+			if len(polIDs) > 1 {
+				continue
+			}
+
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
 // ApplyPolicies will check if any policies are loaded. If any are, it
 // will overwrite the session state to use the policy values.
 func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
@@ -342,24 +368,16 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 		session.MetaData = make(map[string]interface{})
 	}
 
-	t.clearSession(session)
+	policies, err := t.sessionPolicies(session.PolicyIDs())
+	if err != nil {
+		return err
+	}
+
+	t.clearSession(session, policies)
 
 	didQuota, didRateLimit, didACL, didComplexity := make(map[string]bool), make(map[string]bool), make(map[string]bool), make(map[string]bool)
-	policies := session.PolicyIDs()
-
-	for _, polID := range policies {
-		t.Gw.policiesMu.RLock()
-		policy, ok := t.Gw.policiesByID[polID]
-		t.Gw.policiesMu.RUnlock()
-		if !ok {
-			err := fmt.Errorf("policy not found: %q", polID)
-			t.Logger().Error(err)
-			if len(policies) > 1 {
-				continue
-			}
 
-			return err
-		}
+	for _, policy := range policies {
 		// Check ownership, policy org owner must be the same as API,
 		// otherwise you could overwrite a session key with a policy from a different org!
 		if t.Spec != nil && policy.OrgID != t.Spec.OrgID {
@@ -390,13 +408,15 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 					// limit was not specified on API level so we will populate it from policy
 					idForScope = policy.ID
 					accessRights.Limit = user.APILimit{
-						QuotaMax:           policy.QuotaMax,
-						QuotaRenewalRate:   policy.QuotaRenewalRate,
-						Rate:               policy.Rate,
-						Per:                policy.Per,
-						ThrottleInterval:   policy.ThrottleInterval,
-						ThrottleRetryLimit: policy.ThrottleRetryLimit,
-						MaxQueryDepth:      policy.MaxQueryDepth,
+						QuotaMax:             policy.QuotaMax,
+						QuotaRenewalRate:     policy.QuotaRenewalRate,
+						QuotaRenewalMode:     policy.QuotaRenewalMode,
+						QuotaRenewalTimezone: policy.QuotaRenewalTimezone,
+						Rate:                 policy.Rate,
+						Per:                  policy.Per,
+						ThrottleInterval:     policy.ThrottleInterval,
+						ThrottleRetryLimit:   policy.ThrottleRetryLimit,
+						MaxQueryDepth:        policy.MaxQueryDepth,
 					}
 				}
 				accessRights.AllowanceScope = idForScope
@@ -512,6 +532,14 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 							session.QuotaRenewalRate = policy.QuotaRenewalRate
 						}
 					}
+
+					// a calendar renewal takes precedence over the renewal rate
+					if policy.QuotaRenewalMode != user.QuotaRenewalRolling {
+						ar.Limit.QuotaRenewalMode = policy.QuotaRenewalMode
+						ar.Limit.QuotaRenewalTimezone = policy.QuotaRenewalTimezone
+						session.QuotaRenewalMode = policy.QuotaRenewalMode
+						session.QuotaRenewalTimezone = policy.QuotaRenewalTimezone
+					}
 				}
 
 				if !usePartitions || policy.Partitions.RateLimit {
@@ -581,6 +609,8 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 				if !usePartitions || policy.Partitions.Quota {
 					session.QuotaMax = policy.QuotaMax
 					session.QuotaRenewalRate = policy.QuotaRenewalRate
+					session.QuotaRenewalMode = policy.QuotaRenewalMode
+					session.QuotaRenewalTimezone = policy.QuotaRenewalTimezone
 				}
 			}
 
@@ -603,6 +633,11 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 			session.MetaData[k] = v
 		}
 
+		if policy.Group != nil {
+			group := *policy.Group
+			session.Group = &group
+		}
+
 		if policy.LastUpdated > session.LastUpdated {
 			session.LastUpdated = policy.LastUpdated
 		}
@@ -657,6 +692,8 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 		if !didQuota[k] {
 			v.Limit.QuotaMax = session.QuotaMax
 			v.Limit.QuotaRenewalRate = session.QuotaRenewalRate
+			v.Limit.QuotaRenewalMode = session.QuotaRenewalMode
+			v.Limit.QuotaRenewalTimezone = session.QuotaRenewalTimezone
 			v.Limit.QuotaRenews = session.QuotaRenews
 		}
 
@@ -684,6 +721,8 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 				session.QuotaMax = v.Limit.QuotaMax
 				session.QuotaRenews = v.Limit.QuotaRenews
 				session.QuotaRenewalRate = v.Limit.QuotaRenewalRate
+				session.QuotaRenewalMode = v.Limit.QuotaRenewalMode
+				session.QuotaRenewalTimezone = v.Limit.QuotaRenewalTimezone
 			}
 
 			if len(didComplexity) == 1 {
@@ -896,7 +935,7 @@ func (gw *Gateway) responseProcessorByName(name string) TykResponseHandler {
 	case "custom_mw_res_hook":
 		return &CustomMiddlewareResponseHook{Gw: gw}
 	case "goplugin_res_hook":
-		return &ResponseGoPluginMiddleware{}
+		return &ResponseGoPluginMiddleware{Gw: gw}
 	}
 
 	return nil
@@ -71,19 +71,58 @@ func (m Monitor) checkLimit(sessionData *user.SessionState, key string, quotaMax
 		return false
 	}
 
-	if m.Gw.GetConfig().Monitor.GlobalTriggerLimit > 0.0 && usagePerc >= m.Gw.GetConfig().Monitor.GlobalTriggerLimit {
+	if triggerLimit := m.triggerLimit(sessionData, usagePerc); triggerLimit > 0.0 {
 		log.Info("Firing...")
-		m.Fire(sessionData, key, m.Gw.GetConfig().Monitor.GlobalTriggerLimit, usagePerc)
+		m.Fire(sessionData, key, triggerLimit, usagePerc)
 		return true
 	}
 
+	return false
+}
+
+// triggerLimit returns the trigger limit reached by a usage percentage of a quota, or zero.
+func (m Monitor) triggerLimit(sessionData *user.SessionState, usagePerc float64) float64 {
+	globalTriggerLimit := m.Gw.GetConfig().Monitor.GlobalTriggerLimit
+	if globalTriggerLimit > 0.0 && usagePerc >= globalTriggerLimit {
+		return globalTriggerLimit
+	}
+
 	for _, triggerLimit := range sessionData.Monitor.TriggerLimits {
-		if usagePerc >= triggerLimit && triggerLimit != m.Gw.GetConfig().Monitor.GlobalTriggerLimit {
-			log.Info("Firing...")
-			m.Fire(sessionData, key, triggerLimit, usagePerc)
-			return true
+		if usagePerc >= triggerLimit && triggerLimit != globalTriggerLimit {
+			return triggerLimit
 		}
 	}
 
-	return false
+	return 0.0
+}
+
+// CheckBalance fires a low balance event when the balance of the quota of a key, its prepaid credits included, is
+// within a trigger limit of Check. Unlike Check, the quotas which never renew are checked too.
+func (m Monitor) CheckBalance(sessionData *user.SessionState, key string, quotaMax, balance int64) {
+	if !m.Enabled() || quotaMax <= 0 {
+		return
+	}
+
+	usagePerc := (float64(quotaMax-balance) / float64(quotaMax)) * 100.0
+	triggerLimit := m.triggerLimit(sessionData, usagePerc)
+	if triggerLimit == 0.0 {
+		return
+	}
+
+	em := config.EventMessage{
+		Type: EventCreditBalanceLow,
+		Meta: EventCreditBalanceLowMeta{
+			EventTriggerExceededMeta: EventTriggerExceededMeta{
+				EventMetaDefault: EventMetaDefault{Message: "Credit balance low"},
+				OrgID:            sessionData.OrgID,
+				Key:              key,
+				TriggerLimit:     int64(triggerLimit),
+				UsagePercentage:  int64(usagePerc),
+			},
+			Balance: balance,
+		},
+		TimeStamp: time.Now().String(),
+	}
+
+	go m.Gw.MonitoringHandler.HandleEvent(em)
 }
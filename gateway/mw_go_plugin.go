@@ -15,6 +15,7 @@ import (
 
 	"github.com/TykTechnologies/tyk/ctx"
 	"github.com/TykTechnologies/tyk/goplugin"
+	"github.com/TykTechnologies/tyk/goplugin/sdk"
 	"github.com/TykTechnologies/tyk/request"
 )
 
@@ -95,6 +96,7 @@ type GoPluginMiddleware struct {
 	successHandler *SuccessHandler // to record analytics
 	Meta           apidef.GoPluginMeta
 	APILevel       bool
+	Hook           sdk.Hook // hook the plugin is used as, passed to SDK plugins
 }
 
 func (m *GoPluginMiddleware) Name() string {
@@ -154,7 +156,20 @@ func (m *GoPluginMiddleware) loadPlugin() bool {
 		}
 	}()
 
-	if m.handler, err = goplugin.GetHandler(m.Path, m.SymbolName); err != nil {
+	// plugins exporting an SDK registry are instantiated for the API
+	var inst *goPluginInstance
+	if m.Gw != nil {
+		inst, err = m.Gw.goPluginInstance(m.Spec, m.Path, m.SymbolName)
+	}
+
+	switch {
+	case err != nil:
+	case inst != nil:
+		m.handler, err = inst.requestHandler(m.Hook)
+	default:
+		m.handler, err = goplugin.GetHandler(m.Path, m.SymbolName)
+	}
+	if err != nil {
 		m.logger.WithError(err).Error("Could not load Go-plugin")
 		return false
 	}
@@ -0,0 +1,221 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk/goplugin"
+	"github.com/TykTechnologies/tyk/goplugin/sdk"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+// goPluginInstances holds the instances of the SDK Go plugins, by API, plugin file and symbol.
+type goPluginInstances struct {
+	mu        sync.Mutex
+	instances map[string]*goPluginInstance
+}
+
+// goPluginInstance is the instance of an SDK Go plugin for an API, shared by the hooks of the API.
+// It's owned by the spec of the API it's created or reloaded for, and closed when the spec is released.
+type goPluginInstance struct {
+	key      string
+	registry *sdk.Registry
+	plugin   sdk.Plugin
+	api      *sdk.APIConfig
+	owner    *APISpec
+	set      *goPluginInstances
+}
+
+// sdkRegistry returns the SDK registry exported by a Go plugin symbol, if it's one.
+func sdkRegistry(symbol interface{}) (*sdk.Registry, bool) {
+	switch registry := symbol.(type) {
+	case *sdk.Registry:
+		return registry, registry != nil
+	case **sdk.Registry:
+		return *registry, *registry != nil
+	}
+	return nil, false
+}
+
+// goPluginInstance returns the instance of the SDK Go plugin of the symbol for the API, it's nil for
+// plugins exporting bare handler functions.
+func (gw *Gateway) goPluginInstance(spec *APISpec, path, symbolName string) (*goPluginInstance, error) {
+	if spec == nil {
+		return nil, nil
+	}
+
+	// lookup errors are reported by the bare handler loaders
+	symbol, err := goplugin.GetSymbol(path, symbolName)
+	if err != nil {
+		return nil, nil
+	}
+	registry, ok := sdkRegistry(symbol)
+	if !ok {
+		return nil, nil
+	}
+
+	return gw.loadGoPluginInstance(spec, path+":"+symbolName, registry)
+}
+
+func (gw *Gateway) loadGoPluginInstance(spec *APISpec, name string, registry *sdk.Registry) (*goPluginInstance, error) {
+	if err := registry.Check(VERSION); err != nil {
+		return nil, err
+	}
+
+	set := &gw.goPlugins
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	if set.instances == nil {
+		set.instances = map[string]*goPluginInstance{}
+	}
+
+	key := spec.APIID + ":" + name
+	api := gw.goPluginAPIConfig(spec)
+
+	if inst := set.instances[key]; inst != nil && inst.registry == registry {
+		// hooks of the same API share the instance
+		if inst.owner == spec {
+			return inst, nil
+		}
+
+		if reloader, ok := inst.plugin.(sdk.Reloader); ok {
+			err := callGoPlugin(func() error { return reloader.Reload(api) })
+			if err == nil {
+				inst.api = api
+				inst.owner = spec
+				spec.goPlugins = append(spec.goPlugins, inst)
+				return inst, nil
+			}
+			api.Logger.WithError(err).Warning("Couldn't reload Go plugin, creating a new instance")
+		}
+	}
+
+	var plugin sdk.Plugin
+	err := callGoPlugin(func() error {
+		if plugin = registry.New(); plugin == nil {
+			return fmt.Errorf("plugin constructor returned nil")
+		}
+		return plugin.Init(api)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't initialise Go plugin: %w", err)
+	}
+
+	inst := &goPluginInstance{
+		key:      key,
+		registry: registry,
+		plugin:   plugin,
+		api:      api,
+		owner:    spec,
+		set:      set,
+	}
+	set.instances[key] = inst
+	spec.goPlugins = append(spec.goPlugins, inst)
+
+	return inst, nil
+}
+
+// goPluginAPIConfig returns the configuration of the API given to SDK Go plugins.
+func (gw *Gateway) goPluginAPIConfig(spec *APISpec) *sdk.APIConfig {
+	api := &sdk.APIConfig{
+		APIID:      spec.APIID,
+		OrgID:      spec.OrgID,
+		Name:       spec.Name,
+		Definition: spec.APIDefinition,
+		Cache: goPluginCache{&storage.RedisCluster{
+			KeyPrefix:       "goplugin-cache-" + spec.APIID + "-",
+			IsCache:         true,
+			RedisController: gw.RedisController,
+		}},
+		Logger: log.WithFields(logrus.Fields{
+			"prefix": "goplugin",
+			"api_id": spec.APIID,
+		}),
+	}
+	if !spec.ConfigDataDisabled {
+		api.ConfigData = spec.ConfigData
+	}
+	return api
+}
+
+// callGoPlugin calls into a Go plugin, recovering from its panics.
+func callGoPlugin(fn func() error) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("plugin panicked: %v", e)
+		}
+	}()
+	return fn()
+}
+
+// release closes the instance, unless it was taken over by a reload of the API.
+func (i *goPluginInstance) release(spec *APISpec) {
+	i.set.mu.Lock()
+	if i.owner != spec {
+		i.set.mu.Unlock()
+		return
+	}
+	if i.set.instances[i.key] == i {
+		delete(i.set.instances, i.key)
+	}
+	i.set.mu.Unlock()
+
+	if err := callGoPlugin(i.plugin.Close); err != nil {
+		i.api.Logger.WithError(err).Error("Couldn't close Go plugin")
+	}
+}
+
+func (i *goPluginInstance) requestHandler(hook sdk.Hook) (http.HandlerFunc, error) {
+	handler, ok := i.plugin.(sdk.RequestHandler)
+	if !ok {
+		return nil, fmt.Errorf("Go plugin doesn't handle requests, it's used as a %s hook", hook)
+	}
+
+	api := i.api
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleRequest(w, &sdk.Request{Request: r, Hook: hook, API: api})
+	}, nil
+}
+
+func (i *goPluginInstance) responseHandler() (func(http.ResponseWriter, *http.Response, *http.Request), error) {
+	handler, ok := i.plugin.(sdk.ResponseHandler)
+	if !ok {
+		return nil, fmt.Errorf("Go plugin doesn't handle responses, it's used as a %s hook", sdk.HookResponse)
+	}
+
+	api := i.api
+	return func(w http.ResponseWriter, res *http.Response, r *http.Request) {
+		handler.HandleResponse(w, res, &sdk.Request{Request: r, Hook: sdk.HookResponse, API: api})
+	}, nil
+}
+
+func (i *goPluginInstance) analyticsHandler() (func(*analytics.AnalyticsRecord), error) {
+	handler, ok := i.plugin.(sdk.AnalyticsHandler)
+	if !ok {
+		return nil, fmt.Errorf("Go plugin doesn't handle analytics records")
+	}
+	return handler.HandleAnalytics, nil
+}
+
+// goPluginCache is the cache store of SDK Go plugins.
+type goPluginCache struct {
+	store storage.Handler
+}
+
+func (c goPluginCache) Get(key string) (string, error) {
+	return c.store.GetKey(key)
+}
+
+func (c goPluginCache) Set(key, value string, ttl time.Duration) error {
+	return c.store.SetKey(key, value, int64(ttl/time.Second))
+}
+
+func (c goPluginCache) Delete(key string) bool {
+	return c.store.DeleteKey(key)
+}
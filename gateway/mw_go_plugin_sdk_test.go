@@ -0,0 +1,183 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/goplugin/sdk"
+)
+
+type testSDKPlugin struct {
+	api      *sdk.APIConfig
+	initErr  error
+	closed   int
+	reloaded int
+}
+
+func (p *testSDKPlugin) Init(api *sdk.APIConfig) error {
+	p.api = api
+	return p.initErr
+}
+
+func (p *testSDKPlugin) Close() error {
+	p.closed++
+	return nil
+}
+
+func (p *testSDKPlugin) HandleRequest(w http.ResponseWriter, r *sdk.Request) {
+	var conf struct {
+		Team string `json:"team"`
+	}
+	_ = r.API.DecodeConfig(&conf)
+	r.Header.Set("X-Team", conf.Team)
+	r.Header.Set("X-Hook", string(r.Hook))
+}
+
+type testSDKReloader struct {
+	testSDKPlugin
+}
+
+func (p *testSDKReloader) Reload(api *sdk.APIConfig) error {
+	p.api = api
+	p.reloaded++
+	return nil
+}
+
+func TestGoPluginInstance(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	newSpec := func(team string) *APISpec {
+		return &APISpec{APIDefinition: &apidef.APIDefinition{
+			APIID:      "orders",
+			OrgID:      "default",
+			ConfigData: map[string]interface{}{"team": team},
+		}}
+	}
+
+	t.Run("shared by the hooks of the API and closed with it", func(t *testing.T) {
+		var plugins []*testSDKPlugin
+		registry := sdk.Register(func() sdk.Plugin {
+			p := &testSDKPlugin{}
+			plugins = append(plugins, p)
+			return p
+		})
+
+		spec := newSpec("a")
+		inst, err := ts.Gw.loadGoPluginInstance(spec, "shared.so:Plugin", registry)
+		require.NoError(t, err)
+		again, err := ts.Gw.loadGoPluginInstance(spec, "shared.so:Plugin", registry)
+		require.NoError(t, err)
+		assert.Same(t, inst, again)
+		require.Len(t, plugins, 1)
+		assert.Equal(t, "orders", plugins[0].api.APIID)
+
+		handler, err := inst.requestHandler(sdk.HookPre)
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		handler(httptest.NewRecorder(), r)
+		assert.Equal(t, "a", r.Header.Get("X-Team"))
+		assert.Equal(t, "pre", r.Header.Get("X-Hook"))
+
+		_, err = inst.responseHandler()
+		assert.Error(t, err)
+
+		// a reloaded API gets a new instance, the old one is closed with its spec
+		reloaded := newSpec("b")
+		inst, err = ts.Gw.loadGoPluginInstance(reloaded, "shared.so:Plugin", registry)
+		require.NoError(t, err)
+		require.Len(t, plugins, 2)
+		assert.Equal(t, "b", plugins[1].api.ConfigData["team"])
+
+		spec.Release()
+		assert.Equal(t, 1, plugins[0].closed)
+		reloaded.Release()
+		assert.Equal(t, 1, plugins[1].closed)
+		assert.Empty(t, ts.Gw.goPlugins.instances)
+	})
+
+	t.Run("kept by reloaders", func(t *testing.T) {
+		plugin := &testSDKReloader{}
+		registry := sdk.Register(func() sdk.Plugin { return plugin })
+
+		spec := newSpec("a")
+		_, err := ts.Gw.loadGoPluginInstance(spec, "reloader.so:Plugin", registry)
+		require.NoError(t, err)
+
+		reloaded := newSpec("b")
+		_, err = ts.Gw.loadGoPluginInstance(reloaded, "reloader.so:Plugin", registry)
+		require.NoError(t, err)
+		assert.Equal(t, 1, plugin.reloaded)
+		assert.Equal(t, "b", plugin.api.ConfigData["team"])
+
+		// the instance is taken over by the reloaded API
+		spec.Release()
+		assert.Equal(t, 0, plugin.closed)
+		reloaded.Release()
+		assert.Equal(t, 1, plugin.closed)
+	})
+
+	t.Run("config data disabled", func(t *testing.T) {
+		registry := sdk.Register(func() sdk.Plugin { return &testSDKPlugin{} })
+
+		spec := newSpec("a")
+		spec.ConfigDataDisabled = true
+		inst, err := ts.Gw.loadGoPluginInstance(spec, "disabled.so:Plugin", registry)
+		require.NoError(t, err)
+		defer spec.Release()
+		assert.Nil(t, inst.api.ConfigData)
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		registry := sdk.Register(func() sdk.Plugin { return &testSDKPlugin{} })
+
+		spec := newSpec("a")
+		inst, err := ts.Gw.loadGoPluginInstance(spec, "cache.so:Plugin", registry)
+		require.NoError(t, err)
+		defer spec.Release()
+
+		cache := inst.api.Cache
+		require.NoError(t, cache.Set("counter", "1", time.Minute))
+		value, err := cache.Get("counter")
+		require.NoError(t, err)
+		assert.Equal(t, "1", value)
+		assert.True(t, cache.Delete("counter"))
+		_, err = cache.Get("counter")
+		assert.Error(t, err)
+	})
+
+	t.Run("load errors", func(t *testing.T) {
+		spec := newSpec("a")
+		defer spec.Release()
+
+		_, err := ts.Gw.loadGoPluginInstance(spec, "init.so:Plugin", sdk.Register(func() sdk.Plugin {
+			return &testSDKPlugin{initErr: errors.New("missing config")}
+		}))
+		assert.EqualError(t, err, "couldn't initialise Go plugin: missing config")
+
+		_, err = ts.Gw.loadGoPluginInstance(spec, "panic.so:Plugin", sdk.Register(func() sdk.Plugin {
+			panic("boom")
+		}))
+		assert.EqualError(t, err, "couldn't initialise Go plugin: plugin panicked: boom")
+
+		_, err = ts.Gw.loadGoPluginInstance(spec, "nil.so:Plugin", sdk.Register(func() sdk.Plugin {
+			return nil
+		}))
+		assert.EqualError(t, err, "couldn't initialise Go plugin: plugin constructor returned nil")
+
+		_, err = ts.Gw.loadGoPluginInstance(spec, "version.so:Plugin", &sdk.Registry{
+			SDKVersion: "2.0",
+			New:        func() sdk.Plugin { return &testSDKPlugin{} },
+		})
+		assert.Error(t, err)
+
+		assert.Empty(t, spec.goPlugins)
+	})
+}
@@ -0,0 +1,313 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/TykTechnologies/graphql-go-tools/pkg/ast"
+	"github.com/TykTechnologies/graphql-go-tools/pkg/astnormalization"
+	"github.com/TykTechnologies/graphql-go-tools/pkg/astparser"
+
+	"github.com/TykTechnologies/tyk/apidef"
+
+	gql "github.com/TykTechnologies/graphql-go-tools/pkg/graphql"
+)
+
+const (
+	cacheControlDirectiveName = "cacheControl"
+	cacheControlMaxAgeArg     = "maxAge"
+	cacheControlScopeArg      = "scope"
+	cacheControlScopePrivate  = "PRIVATE"
+)
+
+var errGraphQLOperationNotCacheable = errors.New("graphql operation is not cacheable")
+
+// graphQLCacheEnabled reports whether GraphQL aware caching is configured for the spec.
+func graphQLCacheEnabled(spec *APISpec) bool {
+	return spec.GraphQL.Enabled && spec.GraphQL.Cache.Enabled
+}
+
+// graphQLCacheEntry describes a cacheable GraphQL operation.
+type graphQLCacheEntry struct {
+	// operation is the canonical form of the operation, independent of whitespace, fragment usage and field order.
+	operation string
+	// variables is the canonical JSON form of the variables used by the operation.
+	variables string
+	// maxAge is the smallest @cacheControl max-age found in the selection set, -1 when there is no hint.
+	maxAge int64
+	// private is set when any selected field is hinted with scope PRIVATE.
+	private bool
+}
+
+// graphQLCacheKeyBuilder normalises GraphQL requests against the schema of an API
+// in order to build cache keys and collect cache control hints.
+type graphQLCacheKeyBuilder struct {
+	definition ast.Document
+	withHints  bool
+}
+
+func newGraphQLCacheKeyBuilder(schema *gql.Schema, config apidef.GraphQLCacheConfig) (*graphQLCacheKeyBuilder, error) {
+	if schema == nil {
+		return nil, gql.ErrNilSchema
+	}
+
+	definition, report := astparser.ParseGraphqlDocumentBytes(schema.Document())
+	if report.HasErrors() {
+		return nil, report
+	}
+
+	return &graphQLCacheKeyBuilder{
+		definition: definition,
+		withHints:  !config.DisableCacheControlHints,
+	}, nil
+}
+
+// Entry normalises the given request and returns its cacheable representation.
+// Mutations, subscriptions and operations hinted with a max-age of zero return errGraphQLOperationNotCacheable.
+func (b *graphQLCacheKeyBuilder) Entry(gqlRequest *gql.Request) (*graphQLCacheEntry, error) {
+	operation, report := astparser.ParseGraphqlDocumentString(gqlRequest.Query)
+	if report.HasErrors() {
+		return nil, report
+	}
+
+	normalizer := astnormalization.NewWithOpts(astnormalization.WithRemoveFragmentDefinitions())
+	if gqlRequest.OperationName != "" {
+		normalizer.NormalizeNamedOperation(&operation, &b.definition, []byte(gqlRequest.OperationName), &report)
+	} else {
+		normalizer.NormalizeOperation(&operation, &b.definition, &report)
+	}
+
+	if report.HasErrors() {
+		return nil, report
+	}
+
+	opRef, ok := b.findOperation(&operation, gqlRequest.OperationName)
+	if !ok {
+		return nil, errors.New("graphql operation not found")
+	}
+
+	opDef := operation.OperationDefinitions[opRef]
+	if opDef.OperationType != ast.OperationTypeQuery {
+		return nil, errGraphQLOperationNotCacheable
+	}
+
+	entry := &graphQLCacheEntry{maxAge: -1}
+
+	var buf bytes.Buffer
+	buf.WriteString(gqlRequest.OperationName)
+	if opDef.HasSelections {
+		b.writeSelectionSet(&buf, &operation, opDef.SelectionSet, string(b.definition.Index.QueryTypeName), entry)
+	}
+
+	if entry.maxAge == 0 {
+		return nil, errGraphQLOperationNotCacheable
+	}
+
+	variables, err := canonicalGraphQLVariables(&operation, opDef, gqlRequest.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.operation = buf.String()
+	entry.variables = variables
+
+	return entry, nil
+}
+
+func (b *graphQLCacheKeyBuilder) findOperation(operation *ast.Document, operationName string) (int, bool) {
+	for _, rootNode := range operation.RootNodes {
+		if rootNode.Kind != ast.NodeKindOperationDefinition {
+			continue
+		}
+
+		if operationName != "" && operation.OperationDefinitionNameString(rootNode.Ref) != operationName {
+			continue
+		}
+
+		return rootNode.Ref, true
+	}
+
+	return -1, false
+}
+
+// writeSelectionSet writes the selections of the set sorted by their printed form,
+// so that the same selections in a different order produce the same output.
+func (b *graphQLCacheKeyBuilder) writeSelectionSet(buf *bytes.Buffer, operation *ast.Document, setRef int, typeName string, entry *graphQLCacheEntry) {
+	selections := make([]string, 0, len(operation.SelectionSets[setRef].SelectionRefs))
+
+	for _, selectionRef := range operation.SelectionSets[setRef].SelectionRefs {
+		var selBuf bytes.Buffer
+
+		selection := operation.Selections[selectionRef]
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			b.writeField(&selBuf, operation, selection.Ref, typeName, entry)
+		case ast.SelectionKindInlineFragment:
+			fragment := operation.InlineFragments[selection.Ref]
+			fragmentTypeName := typeName
+			selBuf.WriteString("...")
+			if operation.InlineFragmentHasTypeCondition(selection.Ref) {
+				fragmentTypeName = operation.InlineFragmentTypeConditionNameString(selection.Ref)
+				selBuf.WriteString(" on " + fragmentTypeName)
+			}
+			writeGraphQLDirectives(&selBuf, operation, fragment.Directives.Refs)
+			if fragment.HasSelections {
+				b.writeSelectionSet(&selBuf, operation, fragment.SelectionSet, fragmentTypeName, entry)
+			}
+		default:
+			// fragment spreads are inlined by the normalizer
+			continue
+		}
+
+		selections = append(selections, selBuf.String())
+	}
+
+	sort.Strings(selections)
+
+	buf.WriteByte('{')
+	for i, selection := range selections {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(selection)
+	}
+	buf.WriteByte('}')
+}
+
+func (b *graphQLCacheKeyBuilder) writeField(buf *bytes.Buffer, operation *ast.Document, fieldRef int, typeName string, entry *graphQLCacheEntry) {
+	field := operation.Fields[fieldRef]
+	fieldName := operation.FieldNameString(fieldRef)
+
+	if operation.FieldAliasIsDefined(fieldRef) {
+		buf.WriteString(operation.FieldAliasString(fieldRef) + ":")
+	}
+	buf.WriteString(fieldName)
+
+	if field.HasArguments {
+		args := make([]string, 0, len(field.Arguments.Refs))
+		for _, argRef := range field.Arguments.Refs {
+			value, _ := operation.PrintValueBytes(operation.ArgumentValue(argRef), nil)
+			args = append(args, operation.ArgumentNameString(argRef)+":"+string(value))
+		}
+		sort.Strings(args)
+
+		buf.WriteByte('(')
+		for i, arg := range args {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(arg)
+		}
+		buf.WriteByte(')')
+	}
+
+	writeGraphQLDirectives(buf, operation, field.Directives.Refs)
+
+	fieldTypeName := b.applyCacheHints(typeName, fieldName, entry)
+	if field.HasSelections {
+		b.writeSelectionSet(buf, operation, field.SelectionSet, fieldTypeName, entry)
+	}
+}
+
+// applyCacheHints applies the @cacheControl hints of the field definition, or of its type if the
+// field itself carries none, to the entry. It returns the name of the type the field resolves to.
+func (b *graphQLCacheKeyBuilder) applyCacheHints(typeName, fieldName string, entry *graphQLCacheEntry) string {
+	typeNode, ok := b.definition.Index.FirstNodeByNameStr(typeName)
+	if !ok {
+		return ""
+	}
+
+	fieldDefRef, ok := b.definition.NodeFieldDefinitionByName(typeNode, []byte(fieldName))
+	if !ok {
+		return ""
+	}
+
+	fieldTypeName := b.definition.ResolveTypeNameString(b.definition.FieldDefinitionType(fieldDefRef))
+	if !b.withHints {
+		return fieldTypeName
+	}
+
+	if b.applyCacheControlDirectives(b.definition.FieldDefinitionDirectives(fieldDefRef), entry) {
+		return fieldTypeName
+	}
+
+	if fieldTypeNode, ok := b.definition.Index.FirstNodeByNameStr(fieldTypeName); ok {
+		b.applyCacheControlDirectives(b.definition.NodeDirectives(fieldTypeNode), entry)
+	}
+
+	return fieldTypeName
+}
+
+func (b *graphQLCacheKeyBuilder) applyCacheControlDirectives(directiveRefs []int, entry *graphQLCacheEntry) (found bool) {
+	for _, directiveRef := range directiveRefs {
+		if b.definition.DirectiveNameString(directiveRef) != cacheControlDirectiveName {
+			continue
+		}
+
+		found = true
+
+		if value, ok := b.definition.DirectiveArgumentValueByName(directiveRef, []byte(cacheControlMaxAgeArg)); ok && value.Kind == ast.ValueKindInteger {
+			maxAge := b.definition.IntValueAsInt(value.Ref)
+			if entry.maxAge < 0 || maxAge < entry.maxAge {
+				entry.maxAge = maxAge
+			}
+		}
+
+		if value, ok := b.definition.DirectiveArgumentValueByName(directiveRef, []byte(cacheControlScopeArg)); ok && value.Kind == ast.ValueKindEnum {
+			if b.definition.EnumValueNameString(value.Ref) == cacheControlScopePrivate {
+				entry.private = true
+			}
+		}
+	}
+
+	return found
+}
+
+func writeGraphQLDirectives(buf *bytes.Buffer, operation *ast.Document, directiveRefs []int) {
+	for _, directiveRef := range directiveRefs {
+		_ = operation.PrintDirective(directiveRef, buf)
+	}
+}
+
+// canonicalGraphQLVariables returns the variables declared by the operation as JSON with sorted keys.
+// Variables that are not declared by the operation do not change the result and are left out.
+func canonicalGraphQLVariables(operation *ast.Document, opDef ast.OperationDefinition, variables json.RawMessage) (string, error) {
+	if !opDef.HasVariableDefinitions || len(variables) == 0 {
+		return "", nil
+	}
+
+	var all map[string]interface{}
+	if err := json.Unmarshal(variables, &all); err != nil {
+		return "", err
+	}
+
+	used := make(map[string]interface{}, len(opDef.VariableDefinitions.Refs))
+	for _, ref := range opDef.VariableDefinitions.Refs {
+		name := operation.VariableDefinitionNameString(ref)
+		if value, ok := all[name]; ok {
+			used[name] = value
+		}
+	}
+
+	// encoding/json sorts map keys, which gives a stable representation
+	canonical, err := json.Marshal(used)
+	if err != nil {
+		return "", err
+	}
+
+	return string(canonical), nil
+}
+
+// errorsInGraphQLResponse reports whether a GraphQL response body carries an errors array.
+func errorsInGraphQLResponse(body []byte) bool {
+	var response struct {
+		Errors []json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return true
+	}
+
+	return len(response.Errors) > 0
+}
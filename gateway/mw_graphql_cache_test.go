@@ -0,0 +1,231 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+
+	gql "github.com/TykTechnologies/graphql-go-tools/pkg/graphql"
+)
+
+const testGraphQLCacheSchema = `
+directive @cacheControl(maxAge: Int, scope: CacheControlScope) on FIELD_DEFINITION | OBJECT | INTERFACE
+
+enum CacheControlScope {
+	PUBLIC
+	PRIVATE
+}
+
+type Query {
+	country(code: ID!): Country
+	countries: [Country!]!
+	me: User @cacheControl(scope: PRIVATE)
+}
+
+type Mutation {
+	rename(code: ID!, name: String!): Country
+}
+
+type Country @cacheControl(maxAge: 60) {
+	code: ID!
+	name: String!
+	population: Int @cacheControl(maxAge: 10)
+	capital: String @cacheControl(maxAge: 0)
+}
+
+type User {
+	name: String
+}
+`
+
+func newTestGraphQLCacheKeyBuilder(t *testing.T, config apidef.GraphQLCacheConfig) *graphQLCacheKeyBuilder {
+	t.Helper()
+
+	schema, err := gql.NewSchemaFromString(testGraphQLCacheSchema)
+	require.NoError(t, err)
+	_, err = schema.Normalize()
+	require.NoError(t, err)
+
+	builder, err := newGraphQLCacheKeyBuilder(schema, config)
+	require.NoError(t, err)
+
+	return builder
+}
+
+func TestGraphQLCacheKeyBuilder_Entry(t *testing.T) {
+	builder := newTestGraphQLCacheKeyBuilder(t, apidef.GraphQLCacheConfig{Enabled: true})
+
+	entry := func(t *testing.T, req gql.Request) *graphQLCacheEntry {
+		t.Helper()
+		e, err := builder.Entry(&req)
+		require.NoError(t, err)
+		return e
+	}
+
+	t.Run("whitespace and field order", func(t *testing.T) {
+		a := entry(t, gql.Request{Query: `{ country(code: "DE") { code name } }`})
+		b := entry(t, gql.Request{Query: "query {\n  country(code: \"DE\") {\n    name\n    code\n  }\n}"})
+		assert.Equal(t, a.operation, b.operation)
+	})
+
+	t.Run("fragments", func(t *testing.T) {
+		a := entry(t, gql.Request{Query: `{ countries { code name } }`})
+		b := entry(t, gql.Request{Query: `query { countries { ...F } } fragment F on Country { name code }`})
+		assert.Equal(t, a.operation, b.operation)
+	})
+
+	t.Run("different arguments", func(t *testing.T) {
+		a := entry(t, gql.Request{Query: `{ country(code: "DE") { code } }`})
+		b := entry(t, gql.Request{Query: `{ country(code: "FR") { code } }`})
+		assert.NotEqual(t, a.operation, b.operation)
+	})
+
+	t.Run("variables", func(t *testing.T) {
+		query := `query C($code: ID!) { country(code: $code) { code } }`
+		a := entry(t, gql.Request{Query: query, Variables: []byte(`{"code":"DE","unused":1}`)})
+		b := entry(t, gql.Request{Query: query, Variables: []byte(`{ "code": "DE" }`)})
+		c := entry(t, gql.Request{Query: query, Variables: []byte(`{"code":"FR"}`)})
+		assert.Equal(t, a.operation, b.operation)
+		assert.Equal(t, `{"code":"DE"}`, a.variables)
+		assert.Equal(t, a.variables, b.variables)
+		assert.NotEqual(t, a.variables, c.variables)
+	})
+
+	t.Run("cache control hints", func(t *testing.T) {
+		assert.Equal(t, int64(60), entry(t, gql.Request{Query: `{ countries { code } }`}).maxAge)
+		assert.Equal(t, int64(10), entry(t, gql.Request{Query: `{ countries { code population } }`}).maxAge)
+		assert.Equal(t, int64(-1), entry(t, gql.Request{Query: `{ me { name } }`}).maxAge)
+		assert.True(t, entry(t, gql.Request{Query: `{ me { name } }`}).private)
+	})
+
+	t.Run("not cacheable", func(t *testing.T) {
+		_, err := builder.Entry(&gql.Request{Query: `mutation { rename(code: "DE", name: "x") { code } }`})
+		assert.Equal(t, errGraphQLOperationNotCacheable, err)
+
+		_, err = builder.Entry(&gql.Request{Query: `{ countries { capital } }`})
+		assert.Equal(t, errGraphQLOperationNotCacheable, err)
+	})
+
+	t.Run("hints disabled", func(t *testing.T) {
+		builder := newTestGraphQLCacheKeyBuilder(t, apidef.GraphQLCacheConfig{Enabled: true, DisableCacheControlHints: true})
+		e, err := builder.Entry(&gql.Request{Query: `{ countries { capital } }`})
+		require.NoError(t, err)
+		assert.Equal(t, int64(-1), e.maxAge)
+	})
+}
+
+func TestErrorsInGraphQLResponse(t *testing.T) {
+	assert.False(t, errorsInGraphQLResponse([]byte(`{"data":{"a":1}}`)))
+	assert.False(t, errorsInGraphQLResponse([]byte(`{"data":{"a":1},"errors":[]}`)))
+	assert.True(t, errorsInGraphQLResponse([]byte(`{"errors":[{"message":"boom"}]}`)))
+	assert.True(t, errorsInGraphQLResponse([]byte(`not json`)))
+}
+
+func TestGraphQLCache(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+	cache := storage.RedisCluster{KeyPrefix: "cache-", RedisController: ts.Gw.RedisController}
+	defer cache.DeleteScanMatch("*")
+
+	upstreamCalls := 0
+	ts.AddDynamicHandler("/graphql-cache", func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+
+		var gqlRequest struct {
+			Query string `json:"query"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&gqlRequest)
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(strings.ReplaceAll(gqlRequest.Query, "__typename", ""), "name") {
+			_, _ = w.Write([]byte(`{"data":null,"errors":[{"message":"boom"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"countries":[],"me":{"__typename":"User"},"rename":null}}`))
+	})
+
+	api := ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = TestHttpAny + "/graphql-cache"
+		spec.GraphQL.Enabled = true
+		spec.GraphQL.ExecutionMode = apidef.GraphQLExecutionModeProxyOnly
+		spec.GraphQL.Version = apidef.GraphQLConfigVersion2
+		spec.GraphQL.Schema = testGraphQLCacheSchema
+		spec.GraphQL.Cache = apidef.GraphQLCacheConfig{Enabled: true}
+		spec.CacheOptions.CacheTimeout = 120
+	})[0]
+
+	createKey := func() map[string]string {
+		_, key := ts.CreateSession(func(s *user.SessionState) {
+			s.AccessRights = map[string]user.AccessDefinition{api.APIID: {APIID: api.APIID, Versions: []string{"v1"}}}
+		})
+		return map[string]string{header.Authorization: key}
+	}
+	first, second := createKey(), createKey()
+
+	headerCache := map[string]string{cachedResponseHeader: "1"}
+	query := func(headers map[string]string, query string, cached bool) test.TestCase {
+		tc := test.TestCase{Method: http.MethodPost, Path: "/", Headers: headers, Data: gql.Request{Query: query}, Code: http.StatusOK}
+		if cached {
+			tc.HeadersMatch = headerCache
+		} else {
+			tc.HeadersNotMatch = headerCache
+			tc.Delay = 10 * time.Millisecond
+		}
+		return tc
+	}
+
+	t.Run("max age", func(t *testing.T) {
+		defer cache.DeleteScanMatch("*")
+
+		_, _ = ts.Run(t, []test.TestCase{
+			query(first, `{ countries { code population } }`, false),
+			query(second, `{ countries { population code } }`, true),
+		}...)
+
+		keys := cache.GetKeys("")
+		require.Len(t, keys, 1)
+		ttl, err := cache.GetKeyTTL(strings.TrimPrefix(keys[0], cache.KeyPrefix))
+		require.NoError(t, err)
+		assert.InDelta(t, 10, ttl, 1, "the population field is hinted with a max age of 10s")
+	})
+
+	t.Run("private", func(t *testing.T) {
+		defer cache.DeleteScanMatch("*")
+		upstreamCalls = 0
+
+		_, _ = ts.Run(t, []test.TestCase{
+			query(first, `{ me { __typename } }`, false),
+			query(first, `{ me { __typename } }`, true),
+			query(second, `{ me { __typename } }`, false),
+		}...)
+		assert.Equal(t, 2, upstreamCalls)
+	})
+
+	t.Run("mutations", func(t *testing.T) {
+		upstreamCalls = 0
+
+		mutation := `mutation { rename(code: "DE", name: "x") { code } }`
+		_, _ = ts.Run(t, query(first, mutation, false), query(first, mutation, false))
+		assert.Equal(t, 2, upstreamCalls)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		upstreamCalls = 0
+
+		_, _ = ts.Run(t, query(first, `{ countries { name } }`, false), query(first, `{ countries { name } }`, false))
+		assert.Equal(t, 2, upstreamCalls)
+	})
+}
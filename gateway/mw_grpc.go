@@ -0,0 +1,388 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	// grpcWebTrailerFlag marks a gRPC-Web frame carrying trailers instead of a message.
+	grpcWebTrailerFlag byte = 0x80
+
+	grpcAnalyticsStatusTagPrefix = "grpc-status-"
+)
+
+// GRPCMiddleware applies the per-method rules of an API to gRPC calls and
+// translates gRPC-Web requests to gRPC before they are proxied.
+type GRPCMiddleware struct {
+	BaseMiddleware
+
+	loadedAt string
+}
+
+func (m *GRPCMiddleware) Name() string {
+	return "GRPCMiddleware"
+}
+
+func (m *GRPCMiddleware) EnabledForSpec() bool {
+	return m.Spec.GRPC.Enabled
+}
+
+func (m *GRPCMiddleware) Init() {
+	// Use a new rate limit bucket on each load
+	m.loadedAt = strconv.Itoa(int(time.Now().UnixNano()))
+}
+
+// ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
+func (m *GRPCMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	if m.Spec.GRPC.EnableGRPCWeb && isGRPCWebRequest(r) {
+		translateGRPCWebRequest(r)
+	}
+
+	if !isGRPCRequest(r) {
+		return nil, http.StatusOK
+	}
+
+	vInfo, _ := m.Spec.Version(r)
+	found, meta := m.Spec.CheckSpecMatchesStatus(r, m.Spec.RxPaths[vInfo.Name], GRPCMethod)
+	if !found {
+		return nil, http.StatusOK
+	}
+
+	rule := meta.(*apidef.GRPCMethodMeta)
+	if rule.Block {
+		return errors.New("gRPC method is not available"), http.StatusNotImplemented
+	}
+
+	// Skip rate limiting and quotas for looping
+	if !ctxCheckLimits(r) {
+		return nil, http.StatusOK
+	}
+
+	enableRL := rule.RateLimit.Rate > 0
+	enableQ := rule.QuotaMax > 0
+	if !enableRL && !enableQ {
+		return nil, http.StatusOK
+	}
+
+	keyName := m.limiterKey(r, rule.Path)
+	methodSession := &user.SessionState{
+		Rate:             rule.RateLimit.Rate,
+		Per:              rule.RateLimit.Per,
+		QuotaMax:         rule.QuotaMax,
+		QuotaRenewalRate: rule.QuotaRenewalRate,
+		// the quota counter expires after QuotaRenewalRate, until then an exceeded quota stays exceeded
+		QuotaRenews: time.Now().Unix() + rule.QuotaRenewalRate,
+		LastUpdated: m.loadedAt,
+	}
+	methodSession.KeyID = keyName
+	methodSession.SetKeyHash(storage.HashKey(keyName, m.Gw.GetConfig().HashKeys))
+
+	reason := m.Gw.SessionLimiter.ForwardMessage(r, methodSession,
+		keyName,
+		m.Gw.GlobalSessionManager.Store(),
+		enableRL,
+		enableQ,
+		&m.Spec.GlobalConfig,
+		m.Spec,
+		false,
+	)
+
+	switch reason {
+	case sessionFailRateLimit:
+		return m.handleLimitFailure(r, EventRateLimitExceeded, "gRPC method rate limit exceeded", rule.Path), http.StatusTooManyRequests
+	case sessionFailQuota:
+		return m.handleLimitFailure(r, EventQuotaExceeded, "gRPC method quota exceeded", rule.Path), http.StatusForbidden
+	}
+
+	return nil, http.StatusOK
+}
+
+// limiterKey scopes the method limits to the key of the request, or to the API for keyless access.
+func (m *GRPCMiddleware) limiterKey(r *http.Request, method string) string {
+	keyName := "grpc-" + m.Spec.OrgID + m.Spec.APIID + method
+	if session := ctxGetSession(r); session != nil {
+		keyName += "-" + session.KeyHash()
+	}
+
+	return keyName
+}
+
+func (m *GRPCMiddleware) handleLimitFailure(r *http.Request, event apidef.TykEvent, message, method string) error {
+	token := ctxGetAuthToken(r)
+	m.Logger().WithField("key", m.Gw.obfuscateKey(token)).WithField("method", method).Info(message)
+
+	m.FireEvent(event, EventKeyFailureMeta{
+		EventMetaDefault: EventMetaDefault{Message: message, OriginatingRequest: EncodeRequestToEvent(r)},
+		Path:             r.URL.Path,
+		Origin:           request.RealIP(r),
+		Key:              token,
+	})
+
+	if event == EventRateLimitExceeded {
+		reportHealthValue(m.Spec, Throttle, "-1")
+	} else {
+		reportHealthValue(m.Spec, QuotaViolation, "-1")
+	}
+
+	return errors.New(message)
+}
+
+// isGRPCRequest reports whether the request is a gRPC call, gRPC-Web calls excluded.
+func isGRPCRequest(r *http.Request) bool {
+	contentType := r.Header.Get(header.ContentType)
+	if !strings.HasPrefix(contentType, header.ApplicationGRPC) {
+		return false
+	}
+
+	rest := contentType[len(header.ApplicationGRPC):]
+	return rest == "" || rest[0] == '+' || rest[0] == ';'
+}
+
+// isGRPCWebRequest reports whether the request is a gRPC-Web call, in binary or text mode.
+func isGRPCWebRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get(header.ContentType), header.ApplicationGRPCWeb)
+}
+
+// translateGRPCWebRequest turns a gRPC-Web request into a gRPC request in place.
+// The original content type is kept in the request context for the response translation.
+func translateGRPCWebRequest(r *http.Request) {
+	contentType := r.Header.Get(header.ContentType)
+	ctxSetGRPCWebContentType(r, contentType)
+
+	prefix := header.ApplicationGRPCWeb
+	if strings.HasPrefix(contentType, header.ApplicationGRPCWebText) {
+		prefix = header.ApplicationGRPCWebText
+		r.Body = ioutil.NopCloser(base64.NewDecoder(base64.StdEncoding, r.Body))
+		r.ContentLength = -1
+		r.Header.Del(header.ContentLength)
+	}
+
+	r.Header.Set(header.ContentType, header.ApplicationGRPC+strings.TrimPrefix(contentType, prefix))
+	r.Header.Set("Te", "trailers")
+	r.Header.Del("X-Grpc-Web")
+}
+
+// grpcWebResponse returns a copy of a gRPC upstream response translated to gRPC-Web.
+// The trailers of the upstream response are sent as the last frame of the body.
+func grpcWebResponse(res *http.Response, contentType string) *http.Response {
+	translated := *res
+	translated.Header = res.Header.Clone()
+	translated.Trailer = nil
+	translated.ContentLength = -1
+	translated.Header.Del(header.ContentLength)
+
+	text := strings.HasPrefix(contentType, header.ApplicationGRPCWebText)
+	prefix := header.ApplicationGRPCWeb
+	if text {
+		prefix = header.ApplicationGRPCWebText
+	}
+
+	upstreamContentType := res.Header.Get(header.ContentType)
+	translated.Header.Set(header.ContentType, prefix+strings.TrimPrefix(upstreamContentType, header.ApplicationGRPC))
+	translated.Body = &grpcWebResponseBody{upstream: res, text: text}
+
+	return &translated
+}
+
+// grpcWebResponseBody streams the body of a gRPC response followed by a gRPC-Web trailer frame.
+// In text mode every chunk is base64 encoded.
+type grpcWebResponseBody struct {
+	upstream *http.Response
+	text     bool
+	pending  bytes.Buffer
+	done     bool
+}
+
+func (b *grpcWebResponseBody) Read(p []byte) (int, error) {
+	for b.pending.Len() == 0 {
+		if b.done {
+			return 0, io.EOF
+		}
+
+		buf := make([]byte, len(p))
+		n, err := b.upstream.Body.Read(buf)
+		if n > 0 {
+			b.write(buf[:n])
+		}
+
+		if err == io.EOF {
+			// trailers of the upstream response are populated once its body is fully read
+			b.write(grpcWebTrailerFrame(grpcStatusTrailer(b.upstream)))
+			b.done = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	return b.pending.Read(p)
+}
+
+func (b *grpcWebResponseBody) write(data []byte) {
+	if !b.text {
+		b.pending.Write(data)
+		return
+	}
+
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(encoded, data)
+	b.pending.Write(encoded)
+}
+
+func (b *grpcWebResponseBody) Close() error {
+	return b.upstream.Body.Close()
+}
+
+// grpcWebTrailerFrame encodes trailers as a gRPC-Web trailer frame.
+func grpcWebTrailerFrame(trailer http.Header) []byte {
+	keys := make([]string, 0, len(trailer))
+	for k := range trailer {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var block bytes.Buffer
+	for _, k := range keys {
+		for _, v := range trailer[k] {
+			block.WriteString(strings.ToLower(k) + ": " + v + "\r\n")
+		}
+	}
+
+	frame := make([]byte, 5, 5+block.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(block.Len()))
+
+	return append(frame, block.Bytes()...)
+}
+
+// grpcStatusTrailer returns the trailers of a gRPC response. For trailers-only responses
+// the grpc-status and grpc-message headers are returned instead.
+func grpcStatusTrailer(res *http.Response) http.Header {
+	if res.Trailer.Get(header.GRPCStatus) != "" {
+		return res.Trailer.Clone()
+	}
+
+	trailer := http.Header{}
+	if status := res.Header.Get(header.GRPCStatus); status != "" {
+		trailer.Set(header.GRPCStatus, status)
+		if message := res.Header.Get(header.GRPCMessage); message != "" {
+			trailer.Set(header.GRPCMessage, message)
+		}
+	}
+
+	return trailer
+}
+
+// grpcAnalyticsTags returns the analytics tags recording the gRPC status of a response.
+func grpcAnalyticsTags(res *http.Response) []string {
+	if res == nil {
+		return nil
+	}
+
+	status := res.Trailer.Get(header.GRPCStatus)
+	if status == "" {
+		status = res.Header.Get(header.GRPCStatus)
+	}
+
+	if status == "" {
+		return nil
+	}
+
+	return []string{grpcAnalyticsStatusTagPrefix + status}
+}
+
+// grpcCodeFromHTTPStatus maps the HTTP status of a gateway error to a gRPC status code.
+func grpcCodeFromHTTPStatus(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+
+	if status >= http.StatusInternalServerError {
+		return codes.Internal
+	}
+
+	return codes.Unknown
+}
+
+// encodeGRPCMessage percent-encodes a grpc-message value as defined by the gRPC HTTP/2 protocol.
+func encodeGRPCMessage(msg string) string {
+	var sb strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+
+	return sb.String()
+}
+
+// writeGRPCError writes a gateway error as a trailers-only gRPC response and returns the gRPC status code.
+func writeGRPCError(w http.ResponseWriter, r *http.Request, errMsg string, errCode int, response *http.Response) codes.Code {
+	code := grpcCodeFromHTTPStatus(errCode)
+
+	contentType := header.ApplicationGRPC
+	if webContentType := ctxGetGRPCWebContentType(r); webContentType != "" {
+		contentType = webContentType
+	} else if isGRPCWebRequest(r) {
+		contentType = r.Header.Get(header.ContentType)
+	}
+
+	response.Header = http.Header{}
+	response.Header.Set(header.ContentType, contentType)
+	response.Header.Set(header.GRPCStatus, strconv.Itoa(int(code)))
+	response.Header.Set(header.GRPCMessage, encodeGRPCMessage(errMsg))
+	response.StatusCode = http.StatusOK
+
+	copyHeader(w.Header(), response.Header, false)
+	w.WriteHeader(http.StatusOK)
+
+	return code
+}
+
+// isGRPCCall reports whether the request is a gRPC or gRPC-Web call.
+// REST requests transcoded to gRPC are not, their clients expect JSON.
+func isGRPCCall(r *http.Request) bool {
+	if ctxGetGRPCTranscodingRoute(r) != nil {
+		return false
+	}
+
+	return isGRPCRequest(r) || isGRPCWebRequest(r) || ctxGetGRPCWebContentType(r) != ""
+}
@@ -0,0 +1,162 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+
+	"github.com/TykTechnologies/tyk/header"
+)
+
+func TestIsGRPCRequest(t *testing.T) {
+	tests := []struct {
+		contentType string
+		grpc        bool
+		grpcWeb     bool
+	}{
+		{"application/grpc", true, false},
+		{"application/grpc+proto", true, false},
+		{"application/grpc;charset=utf-8", true, false},
+		{"application/grpc-web", false, true},
+		{"application/grpc-web+proto", false, true},
+		{"application/grpc-web-text", false, true},
+		{"application/json", false, false},
+	}
+
+	for _, tc := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+		r.Header.Set(header.ContentType, tc.contentType)
+
+		assert.Equal(t, tc.grpc, isGRPCRequest(r), tc.contentType)
+		assert.Equal(t, tc.grpcWeb, isGRPCWebRequest(r), tc.contentType)
+	}
+}
+
+func TestTranslateGRPCWebRequest(t *testing.T) {
+	frame := []byte{0, 0, 0, 0, 2, 8, 1}
+
+	t.Run("binary", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", bytes.NewReader(frame))
+		r.Header.Set(header.ContentType, "application/grpc-web+proto")
+
+		translateGRPCWebRequest(r)
+
+		assert.Equal(t, "application/grpc+proto", r.Header.Get(header.ContentType))
+		assert.Equal(t, "trailers", r.Header.Get("Te"))
+		assert.Equal(t, "application/grpc-web+proto", ctxGetGRPCWebContentType(r))
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, frame, body)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", strings.NewReader(base64.StdEncoding.EncodeToString(frame)))
+		r.Header.Set(header.ContentType, "application/grpc-web-text")
+
+		translateGRPCWebRequest(r)
+
+		assert.Equal(t, "application/grpc", r.Header.Get(header.ContentType))
+		assert.Equal(t, int64(-1), r.ContentLength)
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, frame, body)
+	})
+}
+
+func TestGRPCWebResponse(t *testing.T) {
+	message := []byte{0, 0, 0, 0, 2, 8, 1}
+	trailer := http.Header{}
+
+	upstream := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{header.ContentType: {"application/grpc+proto"}},
+		Body:       ioutil.NopCloser(bytes.NewReader(message)),
+		Trailer:    trailer,
+	}
+
+	// trailers are only populated once the upstream body is read
+	trailer.Set(header.GRPCStatus, "0")
+
+	expected := append(append([]byte{}, message...), grpcWebTrailerFrame(http.Header{header.GRPCStatus: {"0"}})...)
+
+	t.Run("binary", func(t *testing.T) {
+		res := grpcWebResponse(upstream, "application/grpc-web+proto")
+		assert.Equal(t, "application/grpc-web+proto", res.Header.Get(header.ContentType))
+		assert.Nil(t, res.Trailer)
+
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, expected, body)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		upstream.Body = ioutil.NopCloser(bytes.NewReader(message))
+		res := grpcWebResponse(upstream, "application/grpc-web-text")
+		assert.Equal(t, "application/grpc-web-text+proto", res.Header.Get(header.ContentType))
+
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+
+		// chunks are encoded separately
+		assert.Equal(t, base64.StdEncoding.EncodeToString(message)+base64.StdEncoding.EncodeToString(expected[len(message):]), string(body))
+	})
+}
+
+func TestGRPCWebTrailerFrame(t *testing.T) {
+	frame := grpcWebTrailerFrame(http.Header{
+		header.GRPCStatus:  {"5"},
+		header.GRPCMessage: {"not found"},
+	})
+
+	block := "grpc-message: not found\r\ngrpc-status: 5\r\n"
+	assert.Equal(t, append([]byte{0x80, 0, 0, 0, byte(len(block))}, block...), frame)
+}
+
+func TestGRPCStatusTrailer(t *testing.T) {
+	res := &http.Response{Header: http.Header{}, Trailer: http.Header{}}
+	assert.Empty(t, grpcStatusTrailer(res))
+	assert.Nil(t, grpcAnalyticsTags(res))
+
+	res.Header.Set(header.GRPCStatus, "7")
+	assert.Equal(t, "7", grpcStatusTrailer(res).Get(header.GRPCStatus))
+	assert.Equal(t, []string{"grpc-status-7"}, grpcAnalyticsTags(res))
+
+	res.Trailer.Set(header.GRPCStatus, "0")
+	assert.Equal(t, "0", grpcStatusTrailer(res).Get(header.GRPCStatus))
+	assert.Equal(t, []string{"grpc-status-0"}, grpcAnalyticsTags(res))
+}
+
+func TestGRPCCodeFromHTTPStatus(t *testing.T) {
+	assert.Equal(t, codes.Unauthenticated, grpcCodeFromHTTPStatus(http.StatusUnauthorized))
+	assert.Equal(t, codes.PermissionDenied, grpcCodeFromHTTPStatus(http.StatusForbidden))
+	assert.Equal(t, codes.ResourceExhausted, grpcCodeFromHTTPStatus(http.StatusTooManyRequests))
+	assert.Equal(t, codes.Unimplemented, grpcCodeFromHTTPStatus(http.StatusNotImplemented))
+	assert.Equal(t, codes.Unavailable, grpcCodeFromHTTPStatus(http.StatusServiceUnavailable))
+	assert.Equal(t, codes.Internal, grpcCodeFromHTTPStatus(http.StatusInternalServerError))
+	assert.Equal(t, codes.Unknown, grpcCodeFromHTTPStatus(http.StatusTeapot))
+}
+
+func TestWriteGRPCError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+	r.Header.Set(header.ContentType, "application/grpc")
+
+	w := httptest.NewRecorder()
+	response := &http.Response{}
+	code := writeGRPCError(w, r, "Key not authorised: 100%", http.StatusForbidden, response)
+
+	assert.Equal(t, codes.PermissionDenied, code)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/grpc", w.Header().Get(header.ContentType))
+	assert.Equal(t, "7", w.Header().Get(header.GRPCStatus))
+	assert.Equal(t, "Key not authorised: 100%25", w.Header().Get(header.GRPCMessage))
+}
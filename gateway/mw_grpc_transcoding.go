@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/internal/transcoding"
+)
+
+// GRPCTranscodingMiddleware turns JSON REST requests into calls of the gRPC methods
+// mapped to their routes with google.api.http annotations.
+type GRPCTranscodingMiddleware struct {
+	BaseMiddleware
+
+	transcoder *transcoding.Transcoder
+}
+
+func (m *GRPCTranscodingMiddleware) Name() string {
+	return "GRPCTranscodingMiddleware"
+}
+
+func (m *GRPCTranscodingMiddleware) EnabledForSpec() bool {
+	return m.Spec.GRPC.Transcoding.Enabled
+}
+
+func (m *GRPCTranscodingMiddleware) Init() {
+	transcoder, err := newGRPCTranscoder(m.Spec.GRPC.Transcoding)
+	if err != nil {
+		m.Logger().WithError(err).Error("Couldn't load gRPC descriptor set")
+		return
+	}
+
+	m.transcoder = transcoder
+}
+
+// ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
+func (m *GRPCTranscodingMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	// native gRPC calls are proxied as they are
+	if isGRPCCall(r) {
+		return nil, http.StatusOK
+	}
+
+	if m.transcoder == nil {
+		return errors.New("gRPC transcoding is not configured correctly"), http.StatusInternalServerError
+	}
+
+	urlPath := m.Spec.StripListenPath(r, r.URL.Path)
+	route, params := m.transcoder.Match(r.Method, urlPath)
+	if route == nil {
+		return errors.New("no gRPC method matches the request"), http.StatusNotFound
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err, http.StatusBadRequest
+	}
+
+	message, err := route.NewRequest(body, params, r.URL.Query())
+	if err != nil {
+		return err, http.StatusBadRequest
+	}
+
+	listenPathPrefix := strings.TrimSuffix(r.URL.Path, urlPath)
+	transcodeGRPCRequest(r, route, message)
+
+	// the listen path is stripped from the upstream path later on
+	if m.Spec.Proxy.StripListenPath {
+		r.URL.Path = listenPathPrefix + r.URL.Path
+	}
+
+	return nil, http.StatusOK
+}
+
+func newGRPCTranscoder(config apidef.GRPCTranscodingConfig) (*transcoding.Transcoder, error) {
+	descriptorSet, err := base64.StdEncoding.DecodeString(config.DescriptorSet)
+	if err != nil {
+		return nil, err
+	}
+
+	return transcoding.New(descriptorSet)
+}
+
+// transcodeGRPCRequest turns the request into a gRPC call of the route's method carrying the message.
+func transcodeGRPCRequest(r *http.Request, route *transcoding.Route, message []byte) {
+	ctxSetGRPCTranscodingRoute(r, route)
+
+	body := transcoding.EncodeMessage(message)
+
+	r.Method = http.MethodPost
+	r.URL.Path = route.GRPCPath()
+	r.URL.RawPath = ""
+	r.URL.RawQuery = ""
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set(header.ContentLength, strconv.Itoa(len(body)))
+	r.Header.Set(header.ContentType, header.ApplicationGRPC+"+proto")
+	r.Header.Set("Te", "trailers")
+}
+
+// grpcTranscodingError is the JSON body of a failed transcoded call, in the form of a google.rpc.Status.
+type grpcTranscodingError struct {
+	Code    codes.Code `json:"code"`
+	Message string     `json:"message"`
+}
+
+// grpcTranscodedResponse returns a copy of a gRPC upstream response transcoded to JSON.
+// The gRPC status of the call is mapped to the HTTP status code.
+func grpcTranscodedResponse(res *http.Response, route *transcoding.Route) *http.Response {
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	translated := *res
+	translated.Header = res.Header.Clone()
+	translated.Trailer = nil
+	translated.Header.Del(header.GRPCStatus)
+	translated.Header.Del(header.GRPCMessage)
+	translated.Header.Del("Grpc-Encoding")
+	translated.Header.Del("Grpc-Accept-Encoding")
+	translated.Header.Set(header.ContentType, header.ApplicationJSON)
+
+	code, message := codes.Unavailable, "upstream response could not be read"
+	if err == nil {
+		code, message = grpcStatusFromResponse(res)
+	}
+
+	if code == codes.OK {
+		var messages [][]byte
+		if messages, err = transcoding.DecodeMessages(body); err == nil {
+			body, err = route.Response(messages)
+		}
+
+		if err != nil {
+			code, message = codes.Internal, err.Error()
+		}
+	}
+
+	if code != codes.OK {
+		body, _ = json.Marshal(grpcTranscodingError{Code: code, Message: message})
+	}
+
+	translated.StatusCode = transcoding.HTTPStatusFromCode(code)
+	translated.Status = strconv.Itoa(translated.StatusCode) + " " + http.StatusText(translated.StatusCode)
+	translated.Body = ioutil.NopCloser(bytes.NewReader(body))
+	translated.ContentLength = int64(len(body))
+	translated.Header.Set(header.ContentLength, strconv.Itoa(len(body)))
+
+	return &translated
+}
+
+// grpcStatusFromResponse returns the gRPC status of a fully read upstream response.
+func grpcStatusFromResponse(res *http.Response) (codes.Code, string) {
+	trailer := grpcStatusTrailer(res)
+
+	status := trailer.Get(header.GRPCStatus)
+	if status == "" {
+		if res.StatusCode != http.StatusOK {
+			return grpcCodeFromHTTPStatus(res.StatusCode), "upstream responded with " + res.Status
+		}
+
+		return codes.Internal, "upstream response is missing the gRPC status"
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return codes.Unknown, "invalid gRPC status " + status
+	}
+
+	message, err := url.PathUnescape(trailer.Get(header.GRPCMessage))
+	if err != nil {
+		message = trailer.Get(header.GRPCMessage)
+	}
+
+	return codes.Code(code), message
+}
@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/internal/transcoding"
+)
+
+func newTestEchoTranscoder(t *testing.T) *transcoding.Transcoder {
+	t.Helper()
+
+	opts := &descriptorpb.MethodOptions{}
+	proto.SetExtension(opts, annotations.E_Http, &annotations.HttpRule{
+		Pattern: &annotations.HttpRule_Get{Get: "/v1/echo/{message}"},
+	})
+
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:       proto.String("echo.proto"),
+		Package:    proto.String("echo"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/api/annotations.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Echo"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:   proto.String("message"),
+				Number: proto.Int32(1),
+				Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("EchoService"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Echo"),
+				InputType:  proto.String(".echo.Echo"),
+				OutputType: proto.String(".echo.Echo"),
+				Options:    opts,
+			}},
+		}},
+	}}})
+	require.NoError(t, err)
+
+	transcoder, err := transcoding.New(set)
+	require.NoError(t, err)
+
+	return transcoder
+}
+
+func TestTranscodeGRPCRequest(t *testing.T) {
+	route, params := newTestEchoTranscoder(t).Match(http.MethodGet, "/v1/echo/hello")
+	require.NotNil(t, route)
+
+	message, err := route.NewRequest(nil, params, nil)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/echo/hello?unknown=1", nil)
+	transcodeGRPCRequest(r, route, message)
+
+	assert.Equal(t, http.MethodPost, r.Method)
+	assert.Equal(t, "/echo.EchoService/Echo", r.URL.Path)
+	assert.Empty(t, r.URL.RawQuery)
+	assert.Equal(t, "application/grpc+proto", r.Header.Get(header.ContentType))
+	assert.Equal(t, route, ctxGetGRPCTranscodingRoute(r))
+	assert.False(t, isGRPCCall(r), "transcoded requests get JSON errors")
+
+	body, err := ioutil.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, transcoding.EncodeMessage(message), body)
+	assert.Equal(t, int64(len(body)), r.ContentLength)
+}
+
+func TestGRPCTranscodedResponse(t *testing.T) {
+	route, params := newTestEchoTranscoder(t).Match(http.MethodGet, "/v1/echo/hello")
+	require.NotNil(t, route)
+
+	message, err := route.NewRequest(nil, params, nil)
+	require.NoError(t, err)
+
+	upstream := func(body []byte, trailer http.Header) *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{header.ContentType: {"application/grpc"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+			Trailer:    trailer,
+		}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		res := grpcTranscodedResponse(upstream(transcoding.EncodeMessage(message), http.Header{header.GRPCStatus: {"0"}}), route)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, header.ApplicationJSON, res.Header.Get(header.ContentType))
+
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"message":"hello"}`, string(body))
+		assert.Equal(t, int64(len(body)), res.ContentLength)
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		res := grpcTranscodedResponse(upstream(nil, http.Header{
+			header.GRPCStatus:  {"5"},
+			header.GRPCMessage: {"no echo%20here"},
+		}), route)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"code":5,"message":"no echo here"}`, string(body))
+	})
+
+	t.Run("trailers only", func(t *testing.T) {
+		res := upstream(nil, http.Header{})
+		res.Header.Set(header.GRPCStatus, "16")
+
+		res = grpcTranscodedResponse(res, route)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		assert.Empty(t, res.Header.Get(header.GRPCStatus))
+	})
+
+	t.Run("missing status", func(t *testing.T) {
+		res := grpcTranscodedResponse(upstream(transcoding.EncodeMessage(message), http.Header{}), route)
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	})
+
+	t.Run("invalid message", func(t *testing.T) {
+		res := grpcTranscodedResponse(upstream([]byte{0, 0, 0, 0, 9}, http.Header{header.GRPCStatus: {"0"}}), route)
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	})
+}
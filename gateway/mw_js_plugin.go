@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -180,48 +181,16 @@ func (d *DynamicMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Reques
 
 	// Run the middleware
 	middlewareClassname := d.MiddlewareClassName
-	if d.Spec.JSVM.VM == nil {
+	if d.Spec.JSVM.VM == nil && d.Spec.JSVM.pool == nil {
 		logger.WithError(err).Error("JSVM isn't enabled, check your gateway settings")
 		return errors.New("Middleware error"), 500
 	}
-	vm := d.Spec.JSVM.VM.Copy()
-	vm.Interrupt = make(chan func(), 1)
 	logger.Debug("Running: ", middlewareClassname)
-	// buffered, leaving no chance of a goroutine leak since the
-	// spawned goroutine will send 0 or 1 values.
-	ret := make(chan otto.Value, 1)
-	errRet := make(chan error, 1)
-	go func() {
-		defer func() {
-			// the VM executes the panic func that gets it
-			// to stop, so we must recover here to not crash
-			// the whole Go program.
-			recover()
-		}()
-		returnRaw, err := vm.Run(middlewareClassname + `.DoProcessRequest(` + string(requestAsJson) + `, ` + string(sessionAsJson) + `, ` + specAsJson + `);`)
-		ret <- returnRaw
-		errRet <- err
-	}()
-	var returnRaw otto.Value
-	t := time.NewTimer(d.Spec.JSVM.Timeout)
-	select {
-	case returnRaw = <-ret:
-		if err := <-errRet; err != nil {
-			logger.WithError(err).Error("Failed to run JS middleware")
-			return errors.New(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError
-		}
-		t.Stop()
-	case <-t.C:
-		t.Stop()
-		logger.Error("JS middleware timed out after ", d.Spec.JSVM.Timeout)
-		vm.Interrupt <- func() {
-			// only way to stop the VM is to send it a func
-			// that panics.
-			panic("stop")
-		}
+	returnDataStr, err := d.Spec.JSVM.run(middlewareClassname + `.DoProcessRequest(` + string(requestAsJson) + `, ` + string(sessionAsJson) + `, ` + specAsJson + `);`)
+	if err != nil {
+		logger.WithError(err).Error("Failed to run JS middleware")
 		return errors.New(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError
 	}
-	returnDataStr, _ := returnRaw.ToString()
 
 	// Decode the return object
 	newRequestData := VMReturnObject{}
@@ -327,6 +296,7 @@ func mapStrsToIfaces(m map[string]string) map[string]interface{} {
 type JSVM struct {
 	Spec    *APISpec
 	VM      *otto.Otto `json:"-"`
+	pool    *gojaPool
 	Timeout time.Duration
 	Log     *logrus.Entry  `json:"-"` // logger used by the JS code
 	RawLog  *logrus.Logger `json:"-"` // logger used by `rawlog` func to avoid formatting
@@ -338,34 +308,55 @@ const defaultJSVMTimeout = 5
 // Init creates the JSVM with the core library and sets up a default
 // timeout.
 func (j *JSVM) Init(spec *APISpec, logger *logrus.Entry, gw *Gateway) {
-	vm := otto.New()
 	j.Gw = gw
 	logger = logger.WithField("prefix", "jsvm")
 
-	// Init TykJS namespace, constructors etc.
-	if _, err := vm.Run(coreJS); err != nil {
-		logger.WithError(err).Error("Could not load TykJS")
-		return
-	}
+	if spec != nil && spec.JSVMEngine == apidef.GojaEngine {
+		pool, err := newGojaPool(j.tykJSApi(), gw.GetConfig().JSVMMaxCallStackSize, logger)
+		if err != nil {
+			logger.WithError(err).Error("Could not load TykJS")
+			return
+		}
 
-	// Load user's TykJS on top, if any
-	if path := gw.GetConfig().TykJSPath; path != "" {
-		f, err := os.Open(path)
-		if err == nil {
-			_, err = vm.Run(f)
-			f.Close()
+		// Load user's TykJS on top, if any
+		if path := gw.GetConfig().TykJSPath; path != "" {
+			if src, err := ioutil.ReadFile(path); err == nil {
+				if err := pool.load(path, src); err != nil {
+					logger.WithError(err).Error("Could not load user's TykJS")
+				}
+			}
+		}
 
-			if err != nil {
-				logger.WithError(err).Error("Could not load user's TykJS")
+		j.pool = pool
+		j.Spec = spec
+	} else {
+		vm := otto.New()
+
+		// Init TykJS namespace, constructors etc.
+		if _, err := vm.Run(coreJS); err != nil {
+			logger.WithError(err).Error("Could not load TykJS")
+			return
+		}
+
+		// Load user's TykJS on top, if any
+		if path := gw.GetConfig().TykJSPath; path != "" {
+			f, err := os.Open(path)
+			if err == nil {
+				_, err = vm.Run(f)
+				f.Close()
+
+				if err != nil {
+					logger.WithError(err).Error("Could not load user's TykJS")
+				}
 			}
 		}
-	}
 
-	j.VM = vm
-	j.Spec = spec
+		j.VM = vm
+		j.Spec = spec
 
-	// Add environment API
-	j.LoadTykJSApi()
+		// Add environment API
+		j.LoadTykJSApi()
+	}
 
 	if jsvmTimeout := gw.GetConfig().JSVMTimeout; jsvmTimeout <= 0 {
 		j.Timeout = time.Duration(defaultJSVMTimeout) * time.Second
@@ -380,6 +371,7 @@ func (j *JSVM) Init(spec *APISpec, logger *logrus.Entry, gw *Gateway) {
 }
 
 func (j *JSVM) DeInit() {
+	j.pool = nil
 	j.Spec = nil
 	j.Log = nil
 	j.RawLog = nil
@@ -403,13 +395,66 @@ func (j *JSVM) LoadJSPaths(paths []string, prefix string) {
 			j.Log.WithError(err).Error("Failed to open JS middleware file")
 			continue
 		}
-		if _, err := j.VM.Run(f); err != nil {
+		if err := j.load(mwPath, f); err != nil {
 			j.Log.WithError(err).Error("Failed to load JS middleware")
 		}
 		f.Close()
 	}
 }
 
+// load runs the source in the VM, it's a string, []byte or io.Reader.
+func (j *JSVM) load(name string, src interface{}) error {
+	if j.pool != nil {
+		return j.pool.load(name, src)
+	}
+
+	_, err := j.VM.Run(src)
+	return err
+}
+
+// run evaluates the expression, usually a function call, and returns its result as a string.
+// The evaluation is interrupted once it takes longer than the timeout of the JSVM.
+func (j *JSVM) run(expr string) (string, error) {
+	if j.pool != nil {
+		return j.pool.run(expr, j.Timeout)
+	}
+
+	vm := j.VM.Copy()
+	vm.Interrupt = make(chan func(), 1)
+	// buffered, leaving no chance of a goroutine leak since the
+	// spawned goroutine will send 0 or 1 values.
+	ret := make(chan otto.Value, 1)
+	errRet := make(chan error, 1)
+	go func() {
+		defer func() {
+			// the VM executes the panic func that gets it
+			// to stop, so we must recover here to not crash
+			// the whole Go program.
+			recover()
+		}()
+		returnRaw, err := vm.Run(expr)
+		ret <- returnRaw
+		errRet <- err
+	}()
+	t := time.NewTimer(j.Timeout)
+	select {
+	case returnRaw := <-ret:
+		t.Stop()
+		if err := <-errRet; err != nil {
+			return "", err
+		}
+		returnDataStr, _ := returnRaw.ToString()
+		return returnDataStr, nil
+	case <-t.C:
+		vm.Interrupt <- func() {
+			// only way to stop the VM is to send it a func
+			// that panics.
+			panic("stop")
+		}
+		return "", fmt.Errorf("JS middleware timed out after %s", j.Timeout)
+	}
+}
+
 type TykJSHttpRequest struct {
 	Method   string
 	Body     string
@@ -430,228 +475,225 @@ type TykJSHttpResponse struct {
 	HeadersComp map[string][]string `json:"headers"`
 }
 
+// jsArgs are the arguments of a call from JS code to the Tyk JS API, as strings.
+type jsArgs []string
+
+// get returns the argument at index i, "undefined" when it wasn't passed.
+func (a jsArgs) get(i int) string {
+	if i < len(a) {
+		return a[i]
+	}
+	return "undefined"
+}
+
+// jsFunc is a function of the Tyk JS API, returning undefined when ok is false.
+type jsFunc func(args jsArgs) (ret string, ok bool)
+
+// LoadTykJSApi exposes the Tyk JS API to the VM.
 func (j *JSVM) LoadTykJSApi() {
-	// Enable a log
-	j.VM.Set("log", func(call otto.FunctionCall) otto.Value {
-		j.Log.WithFields(logrus.Fields{
-			"type": "log-msg",
-		}).Info(call.Argument(0).String())
-		return otto.Value{}
-	})
-	j.VM.Set("rawlog", func(call otto.FunctionCall) otto.Value {
-		j.RawLog.Print(call.Argument(0).String() + "\n")
-		return otto.Value{}
-	})
-
-	// these two needed for non-utf8 bodies
-	j.VM.Set("b64dec", func(call otto.FunctionCall) otto.Value {
-		in := call.Argument(0).String()
-		out, err := base64.StdEncoding.DecodeString(in)
-
-		// Fallback to RawStdEncoding:
-		if err != nil {
-			out, err = base64.RawStdEncoding.DecodeString(in)
-			if err != nil {
-				j.Log.WithError(err).Error("Failed to base64 decode")
+	for name, fn := range j.tykJSApi() {
+		fn := fn
+		j.VM.Set(name, func(call otto.FunctionCall) otto.Value {
+			args := make(jsArgs, len(call.ArgumentList))
+			for i, arg := range call.ArgumentList {
+				args[i] = arg.String()
+			}
+
+			ret, ok := fn(args)
+			if !ok {
 				return otto.Value{}
 			}
-		}
-		returnVal, err := j.VM.ToValue(string(out))
-		if err != nil {
-			j.Log.WithError(err).Error("Failed to base64 decode")
-			return otto.Value{}
-		}
-		return returnVal
-	})
-	j.VM.Set("b64enc", func(call otto.FunctionCall) otto.Value {
-		in := []byte(call.Argument(0).String())
-		out := base64.StdEncoding.EncodeToString(in)
-		returnVal, err := j.VM.ToValue(out)
-		if err != nil {
-			j.Log.WithError(err).Error("Failed to base64 encode")
-			return otto.Value{}
-		}
-		return returnVal
-	})
 
-	j.VM.Set("rawb64dec", func(call otto.FunctionCall) otto.Value {
-		in := call.Argument(0).String()
-		out, err := base64.RawStdEncoding.DecodeString(in)
-		if err != nil {
+			returnVal, err := j.VM.ToValue(ret)
 			if err != nil {
-				j.Log.WithError(err).Error("Failed to base64 decode")
+				j.Log.WithError(err).Error("Failed to encode return value")
 				return otto.Value{}
 			}
-		}
-		returnVal, err := j.VM.ToValue(string(out))
-		if err != nil {
-			j.Log.WithError(err).Error("Failed to base64 decode")
-			return otto.Value{}
-		}
-		return returnVal
-	})
-	j.VM.Set("rawb64enc", func(call otto.FunctionCall) otto.Value {
-		in := []byte(call.Argument(0).String())
-		out := base64.RawStdEncoding.EncodeToString(in)
-		returnVal, err := j.VM.ToValue(out)
-		if err != nil {
-			j.Log.WithError(err).Error("Failed to base64 encode")
-			return otto.Value{}
-		}
-		return returnVal
-	})
-	ignoreCanonical := j.Gw.GetConfig().IgnoreCanonicalMIMEHeaderKey
-	// Enable the creation of HTTP Requsts
-	j.VM.Set("TykMakeHttpRequest", func(call otto.FunctionCall) otto.Value {
-		jsonHRO := call.Argument(0).String()
-		if jsonHRO == "undefined" {
-			// Nope, return nothing
-			return otto.Value{}
-		}
-		hro := TykJSHttpRequest{}
-		if err := json.Unmarshal([]byte(jsonHRO), &hro); err != nil {
-			j.Log.WithError(err).Error("JSVM: Failed to deserialise HTTP Request object")
-			return otto.Value{}
-		}
-
-		// Make the request
-		domain := hro.Domain
-		data := url.Values{}
-		for k, v := range hro.FormData {
-			data.Set(k, v)
-		}
-
-		u, _ := url.ParseRequestURI(domain + hro.Resource)
-		urlStr := u.String() // "https://api.com/user/"
-
-		var d string
-		if hro.Body != "" {
-			d = hro.Body
-		} else if len(hro.FormData) > 0 {
-			d = data.Encode()
-		}
-
-		r, _ := http.NewRequest(hro.Method, urlStr, nil)
-
-		if d != "" {
-			r, _ = http.NewRequest(hro.Method, urlStr, strings.NewReader(d))
-		}
-
-		for k, v := range hro.Headers {
-			setCustomHeader(r.Header, k, v, ignoreCanonical)
-		}
-		r.Close = true
+			return returnVal
+		})
+	}
 
-		maxSSLVersion := j.Gw.GetConfig().ProxySSLMaxVersion
-		if j.Spec.Proxy.Transport.SSLMaxVersion > 0 {
-			maxSSLVersion = j.Spec.Proxy.Transport.SSLMaxVersion
-		}
+	j.VM.Run(tykJsResponseJS)
+}
 
-		tr := &http.Transport{TLSClientConfig: &tls.Config{
-			MaxVersion: maxSSLVersion,
-		}}
+const tykJsResponseJS = `function TykJsResponse(response, session_meta) {
+		return JSON.stringify({Response: response, SessionMeta: session_meta})
+	}`
 
-		if cert := j.Gw.getUpstreamCertificate(r.Host, j.Spec); cert != nil {
-			tr.TLSClientConfig.Certificates = []tls.Certificate{*cert}
-		}
+// tykJSApi returns the functions of the Tyk JS API by name, shared by the engines.
+func (j *JSVM) tykJSApi() map[string]jsFunc {
+	ignoreCanonical := j.Gw.GetConfig().IgnoreCanonicalMIMEHeaderKey
+	// Batch request method
+	unsafeBatchHandler := BatchRequestHandler{Gw: j.Gw}
 
-		if j.Gw.GetConfig().ProxySSLInsecureSkipVerify {
-			tr.TLSClientConfig.InsecureSkipVerify = true
-		}
+	return map[string]jsFunc{
+		// Enable a log
+		"log": func(args jsArgs) (string, bool) {
+			j.Log.WithFields(logrus.Fields{
+				"type": "log-msg",
+			}).Info(args.get(0))
+			return "", false
+		},
+		"rawlog": func(args jsArgs) (string, bool) {
+			j.RawLog.Print(args.get(0) + "\n")
+			return "", false
+		},
+
+		// these two needed for non-utf8 bodies
+		"b64dec": func(args jsArgs) (string, bool) {
+			in := args.get(0)
+			out, err := base64.StdEncoding.DecodeString(in)
+
+			// Fallback to RawStdEncoding:
+			if err != nil {
+				out, err = base64.RawStdEncoding.DecodeString(in)
+				if err != nil {
+					j.Log.WithError(err).Error("Failed to base64 decode")
+					return "", false
+				}
+			}
+			return string(out), true
+		},
+		"b64enc": func(args jsArgs) (string, bool) {
+			return base64.StdEncoding.EncodeToString([]byte(args.get(0))), true
+		},
+		"rawb64dec": func(args jsArgs) (string, bool) {
+			out, err := base64.RawStdEncoding.DecodeString(args.get(0))
+			if err != nil {
+				j.Log.WithError(err).Error("Failed to base64 decode")
+				return "", false
+			}
+			return string(out), true
+		},
+		"rawb64enc": func(args jsArgs) (string, bool) {
+			return base64.RawStdEncoding.EncodeToString([]byte(args.get(0))), true
+		},
+
+		// Enable the creation of HTTP Requsts
+		"TykMakeHttpRequest": func(args jsArgs) (string, bool) {
+			jsonHRO := args.get(0)
+			if jsonHRO == "undefined" {
+				// Nope, return nothing
+				return "", false
+			}
+			hro := TykJSHttpRequest{}
+			if err := json.Unmarshal([]byte(jsonHRO), &hro); err != nil {
+				j.Log.WithError(err).Error("JSVM: Failed to deserialise HTTP Request object")
+				return "", false
+			}
 
-		if j.Spec.Proxy.Transport.SSLInsecureSkipVerify {
-			tr.TLSClientConfig.InsecureSkipVerify = true
-		}
+			// Make the request
+			domain := hro.Domain
+			data := url.Values{}
+			for k, v := range hro.FormData {
+				data.Set(k, v)
+			}
 
-		tr.DialTLS = j.Gw.customDialTLSCheck(j.Spec, tr.TLSClientConfig)
+			u, _ := url.ParseRequestURI(domain + hro.Resource)
+			urlStr := u.String() // "https://api.com/user/"
 
-		tr.Proxy = proxyFromAPI(j.Spec)
+			var d string
+			if hro.Body != "" {
+				d = hro.Body
+			} else if len(hro.FormData) > 0 {
+				d = data.Encode()
+			}
 
-		// using new Client each time should be ok, since we closing connection every time
-		client := &http.Client{Transport: tr}
-		resp, err := client.Do(r)
-		if err != nil {
-			j.Log.WithError(err).Error("Request failed")
-			return otto.Value{}
-		}
+			r, _ := http.NewRequest(hro.Method, urlStr, nil)
 
-		body, _ := ioutil.ReadAll(resp.Body)
-		bodyStr := string(body)
-		tykResp := TykJSHttpResponse{
-			Code:        resp.StatusCode,
-			Body:        bodyStr,
-			Headers:     resp.Header,
-			CodeComp:    resp.StatusCode,
-			BodyComp:    bodyStr,
-			HeadersComp: resp.Header,
-		}
+			if d != "" {
+				r, _ = http.NewRequest(hro.Method, urlStr, strings.NewReader(d))
+			}
 
-		retAsStr, _ := json.Marshal(tykResp)
-		returnVal, err := j.VM.ToValue(string(retAsStr))
-		if err != nil {
-			j.Log.WithError(err).Error("Failed to encode return value")
-			return otto.Value{}
-		}
+			for k, v := range hro.Headers {
+				setCustomHeader(r.Header, k, v, ignoreCanonical)
+			}
+			r.Close = true
 
-		return returnVal
-	})
+			maxSSLVersion := j.Gw.GetConfig().ProxySSLMaxVersion
+			if j.Spec.Proxy.Transport.SSLMaxVersion > 0 {
+				maxSSLVersion = j.Spec.Proxy.Transport.SSLMaxVersion
+			}
 
-	// Expose Setters and Getters in the REST API for a key:
-	j.VM.Set("TykGetKeyData", func(call otto.FunctionCall) otto.Value {
-		apiKey := call.Argument(0).String()
-		apiId := call.Argument(1).String()
+			tr := &http.Transport{TLSClientConfig: &tls.Config{
+				MaxVersion: maxSSLVersion,
+			}}
 
-		obj, _ := j.Gw.handleGetDetail(apiKey, apiId, "", false)
-		bs, _ := json.Marshal(obj)
+			if cert := j.Gw.getUpstreamCertificate(r.Host, j.Spec); cert != nil {
+				tr.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+			}
 
-		returnVal, err := j.VM.ToValue(string(bs))
-		if err != nil {
-			j.Log.WithError(err).Error("Failed to encode return value")
-			return otto.Value{}
-		}
+			if j.Gw.GetConfig().ProxySSLInsecureSkipVerify {
+				tr.TLSClientConfig.InsecureSkipVerify = true
+			}
 
-		return returnVal
-	})
+			if j.Spec.Proxy.Transport.SSLInsecureSkipVerify {
+				tr.TLSClientConfig.InsecureSkipVerify = true
+			}
 
-	j.VM.Set("TykSetKeyData", func(call otto.FunctionCall) otto.Value {
-		apiKey := call.Argument(0).String()
-		encoddedSession := call.Argument(1).String()
-		suppressReset := call.Argument(2).String()
+			tr.DialTLS = j.Gw.customDialTLSCheck(j.Spec, tr.TLSClientConfig)
 
-		newSession := user.SessionState{}
-		err := json.Unmarshal([]byte(encoddedSession), &newSession)
-		if err != nil {
-			j.Log.WithError(err).Error("Failed to decode the sesison data")
-			return otto.Value{}
-		}
+			tr.Proxy = proxyFromAPI(j.Spec)
 
-		j.Gw.doAddOrUpdate(apiKey, &newSession, suppressReset == "1", false)
-		return otto.Value{}
-	})
+			// using new Client each time should be ok, since we closing connection every time
+			client := &http.Client{Transport: tr}
+			resp, err := client.Do(r)
+			if err != nil {
+				j.Log.WithError(err).Error("Request failed")
+				return "", false
+			}
 
-	// Batch request method
-	unsafeBatchHandler := BatchRequestHandler{Gw: j.Gw}
-	j.VM.Set("TykBatchRequest", func(call otto.FunctionCall) otto.Value {
-		requestSet := call.Argument(0).String()
-		j.Log.Debug("Batch input is: ", requestSet)
-		bs, err := unsafeBatchHandler.ManualBatchRequest([]byte(requestSet))
-		if err != nil {
-			j.Log.WithError(err).Error("Batch request error")
-			return otto.Value{}
-		}
+			body, _ := ioutil.ReadAll(resp.Body)
+			bodyStr := string(body)
+			tykResp := TykJSHttpResponse{
+				Code:        resp.StatusCode,
+				Body:        bodyStr,
+				Headers:     resp.Header,
+				CodeComp:    resp.StatusCode,
+				BodyComp:    bodyStr,
+				HeadersComp: resp.Header,
+			}
 
-		returnVal, err := j.VM.ToValue(string(bs))
-		if err != nil {
-			j.Log.WithError(err).Error("Failed to encode return value")
-			return otto.Value{}
-		}
+			retAsStr, _ := json.Marshal(tykResp)
+			return string(retAsStr), true
+		},
+
+		// Expose Setters and Getters in the REST API for a key:
+		"TykGetKeyData": func(args jsArgs) (string, bool) {
+			apiKey := args.get(0)
+			apiId := args.get(1)
+
+			obj, _ := j.Gw.handleGetDetail(apiKey, apiId, "", false)
+			bs, _ := json.Marshal(obj)
+			return string(bs), true
+		},
+		"TykSetKeyData": func(args jsArgs) (string, bool) {
+			apiKey := args.get(0)
+			encoddedSession := args.get(1)
+			suppressReset := args.get(2)
+
+			newSession := user.SessionState{}
+			err := json.Unmarshal([]byte(encoddedSession), &newSession)
+			if err != nil {
+				j.Log.WithError(err).Error("Failed to decode the sesison data")
+				return "", false
+			}
 
-		return returnVal
-	})
+			j.Gw.doAddOrUpdate(apiKey, &newSession, suppressReset == "1", false)
+			return "", false
+		},
 
-	j.VM.Run(`function TykJsResponse(response, session_meta) {
-		return JSON.stringify({Response: response, SessionMeta: session_meta})
-	}`)
+		"TykBatchRequest": func(args jsArgs) (string, bool) {
+			requestSet := args.get(0)
+			j.Log.Debug("Batch input is: ", requestSet)
+			bs, err := unsafeBatchHandler.ManualBatchRequest([]byte(requestSet))
+			if err != nil {
+				j.Log.WithError(err).Error("Batch request error")
+				return "", false
+			}
+			return string(bs), true
+		},
+	}
 }
 
 const coreJS = `
@@ -1020,3 +1020,76 @@ func TestJSVM_Auth(t *testing.T) {
 		}},
 	}...)
 }
+
+func TestJSVM_Goja(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	newMiddleware := func(t *testing.T, js string) *DynamicMiddleware {
+		t.Helper()
+
+		spec := &APISpec{APIDefinition: &apidef.APIDefinition{JSVMEngine: apidef.GojaEngine}}
+		spec.JSVM.Init(spec, logrus.NewEntry(log), ts.Gw)
+		if err := spec.JSVM.load("test.js", js); err != nil {
+			t.Fatalf("failed to set up js plugin: %v", err)
+		}
+
+		return &DynamicMiddleware{
+			BaseMiddleware:      BaseMiddleware{Spec: spec, Gw: ts.Gw},
+			MiddlewareClassName: "modernMid",
+			Pre:                 true,
+		}
+	}
+
+	t.Run("modern syntax", func(t *testing.T) {
+		dynMid := newMiddleware(t, `
+const modernMid = new TykJS.TykMiddleware.NewMiddleware({})
+
+modernMid.NewProcessRequest((request, session) => {
+	const { Method, Headers } = request
+	request.SetHeaders["X-Method"] = `+"`${Method} ${Headers?.Missing?.[0] ?? 'none'}`"+`
+	request.SetHeaders["X-Encoded"] = b64enc("abc")
+	return modernMid.ReturnData(request, {})
+})`)
+
+		req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+		err, code := dynMid.ProcessRequest(nil, req, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "GET none", req.Header.Get("X-Method"))
+		assert.Equal(t, "YWJj", req.Header.Get("X-Encoded"))
+
+		// VMs are reused
+		req = httptest.NewRequest(http.MethodPost, "/foo", nil)
+		_, _ = dynMid.ProcessRequest(nil, req, nil)
+		assert.Equal(t, "POST none", req.Header.Get("X-Method"))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		dynMid := newMiddleware(t, `
+const modernMid = new TykJS.TykMiddleware.NewMiddleware({})
+
+modernMid.NewProcessRequest((request, session) => {
+	for (;;) {}
+})`)
+		dynMid.Spec.JSVM.Timeout = 10 * time.Millisecond
+
+		start := time.Now()
+		err, code := dynMid.ProcessRequest(nil, httptest.NewRequest(http.MethodGet, "/foo", nil), nil)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, code)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("call stack limit", func(t *testing.T) {
+		dynMid := newMiddleware(t, `
+const modernMid = new TykJS.TykMiddleware.NewMiddleware({})
+const recurse = (n) => recurse(n + 1)
+
+modernMid.NewProcessRequest((request, session) => recurse(0))`)
+
+		err, code := dynMid.ProcessRequest(nil, httptest.NewRequest(http.MethodGet, "/foo", nil), nil)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, code)
+	})
+}
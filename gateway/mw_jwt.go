@@ -811,6 +811,8 @@ func (gw *Gateway) generateSessionFromPolicy(policyID, orgID string, enforceOrg
 	session.MaxQueryDepth = policy.MaxQueryDepth
 	session.QuotaMax = policy.QuotaMax
 	session.QuotaRenewalRate = policy.QuotaRenewalRate
+	session.QuotaRenewalMode = policy.QuotaRenewalMode
+	session.QuotaRenewalTimezone = policy.QuotaRenewalTimezone
 	session.AccessRights = make(map[string]user.AccessDefinition)
 	for apiID, access := range policy.AccessRights {
 		session.AccessRights[apiID] = access
@@ -24,6 +24,9 @@ type OrganizationMonitor struct {
 	BaseMiddleware
 	sessionlimiter SessionLimiter
 	mon            Monitor
+	// deferQuota leaves the quota to RateLimitAndQuotaCheck in the chains authenticating keys, it's counted together
+	// with the quotas of the key and its group unless the org is processed off thread
+	deferQuota bool
 }
 
 func (k *OrganizationMonitor) Name() string {
@@ -101,6 +104,8 @@ func (k *OrganizationMonitor) ProcessRequestLive(r *http.Request, orgSession *us
 		return errors.New("this organisation access has been disabled, please contact your API administrator"), http.StatusForbidden
 	}
 
+	deferQuota := k.deferQuota && !k.Spec.DisableQuota
+
 	// We found a session, apply the quota and rate limiter
 	reason := k.Gw.SessionLimiter.ForwardMessage(
 		r,
@@ -108,43 +113,21 @@ func (k *OrganizationMonitor) ProcessRequestLive(r *http.Request, orgSession *us
 		k.Spec.OrgID,
 		k.Spec.OrgSessionManager.Store(),
 		orgSession.Per > 0 && orgSession.Rate > 0,
-		true,
+		!deferQuota,
 		&k.Spec.GlobalConfig,
 		k.Spec,
 		false,
 	)
 
-	sessionLifeTime := orgSession.Lifetime(k.Spec.GetSessionLifetimeRespectsKeyExpiration(), k.Spec.SessionLifetime, k.Gw.GetConfig().ForceGlobalSessionLifetime, k.Gw.GetConfig().GlobalSessionLifetime)
-
-	if err := k.Spec.OrgSessionManager.UpdateSession(k.Spec.OrgID, orgSession, sessionLifeTime, false); err == nil {
-		// update in-app cache if needed
-		if !k.Spec.GlobalConfig.LocalSessionCache.DisableCacheSessionState {
-			k.Gw.SessionCache.Set(k.Spec.OrgID, orgSession.Clone(), sessionLifeTime)
-		}
-	} else {
-		logger.WithError(err).Error("Could not update org session")
+	if !deferQuota || reason != sessionFailNone {
+		k.saveOrgSession(orgSession)
 	}
 
 	switch reason {
 	case sessionFailNone:
 		// all good, keep org active
 	case sessionFailQuota:
-		logger.Warning("Organisation quota has been exceeded.", k.Spec.OrgID)
-
-		// Fire a quota exceeded event
-		k.FireEvent(
-			EventOrgQuotaExceeded,
-			EventKeyFailureMeta{
-				EventMetaDefault: EventMetaDefault{
-					Message:            "Organisation quota has been exceeded",
-					OriginatingRequest: EncodeRequestToEvent(r),
-				},
-				Path:   r.URL.Path,
-				Origin: request.RealIP(r),
-				Key:    k.Spec.OrgID,
-			})
-
-		return errors.New("This organisation quota has been exceeded, please contact your API administrator"), http.StatusForbidden
+		return k.orgQuotaExceeded(r)
 	case sessionFailRateLimit:
 		logger.Warning("Organisation rate limit has been exceeded.", k.Spec.OrgID)
 
@@ -164,7 +147,9 @@ func (k *OrganizationMonitor) ProcessRequestLive(r *http.Request, orgSession *us
 		return errors.New("This organisation rate limit has been exceeded, please contact your API administrator"), http.StatusForbidden
 	}
 
-	if k.Spec.GlobalConfig.Monitor.MonitorOrgKeys {
+	if deferQuota {
+		ctxSetOrgQuota(r, orgSession)
+	} else if k.Spec.GlobalConfig.Monitor.MonitorOrgKeys {
 		// Run the trigger monitor
 		k.mon.Check(orgSession, "")
 	}
@@ -176,6 +161,40 @@ func (k *OrganizationMonitor) ProcessRequestLive(r *http.Request, orgSession *us
 	return nil, http.StatusOK
 }
 
+// saveOrgSession stores the org session updated by the limits of a request, and updates the in-app cache.
+func (t BaseMiddleware) saveOrgSession(orgSession *user.SessionState) {
+	sessionLifeTime := orgSession.Lifetime(t.Spec.GetSessionLifetimeRespectsKeyExpiration(), t.Spec.SessionLifetime, t.Gw.GetConfig().ForceGlobalSessionLifetime, t.Gw.GetConfig().GlobalSessionLifetime)
+
+	if err := t.Spec.OrgSessionManager.UpdateSession(t.Spec.OrgID, orgSession, sessionLifeTime, false); err == nil {
+		// update in-app cache if needed
+		if !t.Spec.GlobalConfig.LocalSessionCache.DisableCacheSessionState {
+			t.Gw.SessionCache.Set(t.Spec.OrgID, orgSession.Clone(), sessionLifeTime)
+		}
+	} else {
+		t.Logger().WithError(err).Error("Could not update org session")
+	}
+}
+
+// orgQuotaExceeded fires the event of a request exceeding the quota of its organisation and returns its error.
+func (t BaseMiddleware) orgQuotaExceeded(r *http.Request) (error, int) {
+	t.Logger().Warning("Organisation quota has been exceeded.", t.Spec.OrgID)
+
+	// Fire a quota exceeded event
+	t.FireEvent(
+		EventOrgQuotaExceeded,
+		EventKeyFailureMeta{
+			EventMetaDefault: EventMetaDefault{
+				Message:            "Organisation quota has been exceeded",
+				OriginatingRequest: EncodeRequestToEvent(r),
+			},
+			Path:   r.URL.Path,
+			Origin: request.RealIP(r),
+			Key:    t.Spec.OrgID,
+		})
+
+	return errors.New("This organisation quota has been exceeded, please contact your API administrator"), http.StatusForbidden
+}
+
 func (k *OrganizationMonitor) SetOrgSentinel(orgChan chan bool, orgId string) {
 	for isActive := range orgChan {
 		k.Logger().Debug("Chan got:", isActive)
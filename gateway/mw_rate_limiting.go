@@ -7,7 +7,10 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
 )
 
 // RateLimitAndQuotaCheck will check the incomming request and key whether it is within it's quota and
@@ -24,43 +27,157 @@ func (k *RateLimitAndQuotaCheck) EnabledForSpec() bool {
 	return !k.Spec.DisableRateLimit || !k.Spec.DisableQuota
 }
 
-func (k *RateLimitAndQuotaCheck) handleRateLimitFailure(r *http.Request, token string) (error, int) {
-	k.Logger().WithField("key", k.Gw.obfuscateKey(token)).Info("Key rate limit exceeded.")
+func (k *RateLimitAndQuotaCheck) handleRateLimitFailure(r *http.Request, token string, group *user.SessionState, level string) (error, int) {
+	if level == limitLevelGroup {
+		k.Logger().WithField("key", k.Gw.obfuscateKey(token)).WithField("group", group.Group.ID).Info("Group rate limit exceeded.")
+	} else {
+		k.Logger().WithField("key", k.Gw.obfuscateKey(token)).Info("Key rate limit exceeded.")
+	}
 
 	// Fire a rate limit exceeded event
-	k.FireEvent(EventRateLimitExceeded, EventKeyFailureMeta{
-		EventMetaDefault: EventMetaDefault{Message: "Key Rate Limit Exceeded", OriginatingRequest: EncodeRequestToEvent(r)},
-		Path:             r.URL.Path,
-		Origin:           request.RealIP(r),
-		Key:              token,
-	})
+	k.FireEvent(EventRateLimitExceeded, k.limitFailureMeta(r, token, group, level, "Rate Limit Exceeded"))
 
 	// Report in health check
 	reportHealthValue(k.Spec, Throttle, "-1")
 
+	if level == limitLevelGroup {
+		return errors.New("Group rate limit exceeded"), http.StatusTooManyRequests
+	}
 	return errors.New("Rate limit exceeded"), http.StatusTooManyRequests
 }
 
-func (k *RateLimitAndQuotaCheck) handleQuotaFailure(r *http.Request, token string) (error, int) {
-	k.Logger().WithField("key", k.Gw.obfuscateKey(token)).Info("Key quota limit exceeded.")
+func (k *RateLimitAndQuotaCheck) handleQuotaFailure(r *http.Request, token string, group *user.SessionState, level string) (error, int) {
+	if level == limitLevelGroup {
+		k.Logger().WithField("key", k.Gw.obfuscateKey(token)).WithField("group", group.Group.ID).Info("Group quota limit exceeded.")
+	} else {
+		k.Logger().WithField("key", k.Gw.obfuscateKey(token)).Info("Key quota limit exceeded.")
+	}
 
 	// Fire a quota exceeded event
-	k.FireEvent(EventQuotaExceeded, EventKeyFailureMeta{
-		EventMetaDefault: EventMetaDefault{Message: "Key Quota Limit Exceeded", OriginatingRequest: EncodeRequestToEvent(r)},
-		Path:             r.URL.Path,
-		Origin:           request.RealIP(r),
-		Key:              token,
-	})
+	k.FireEvent(EventQuotaExceeded, k.limitFailureMeta(r, token, group, level, "Quota Limit Exceeded"))
 
 	// Report in health check
 	reportHealthValue(k.Spec, QuotaViolation, "-1")
 
+	if level == limitLevelGroup {
+		return errors.New("Group quota exceeded"), http.StatusForbidden
+	}
 	return errors.New("Quota exceeded"), http.StatusForbidden
 }
 
+func (k *RateLimitAndQuotaCheck) limitFailureMeta(r *http.Request, token string, group *user.SessionState, level, message string) EventKeyFailureMeta {
+	meta := EventKeyFailureMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Key " + message, OriginatingRequest: EncodeRequestToEvent(r)},
+		Path:             r.URL.Path,
+		Origin:           request.RealIP(r),
+		Key:              token,
+		Limit:            limitLevelKey,
+	}
+	if group != nil {
+		meta.Group = group.Group.ID
+	}
+	if level == limitLevelGroup {
+		meta.Message = "Group " + message
+		meta.Limit = limitLevelGroup
+	}
+	return meta
+}
+
+// quotaCharge returns the charge of a request to the quotas, weighted by the cost of its endpoint.
+func (k *RateLimitAndQuotaCheck) quotaCharge(r *http.Request) *quotaCharge {
+	charge := &quotaCharge{Cost: 1}
+
+	versionInfo, _ := k.Spec.Version(r)
+	if found, meta := k.Spec.CheckSpecMatchesStatus(r, k.Spec.RxPaths[versionInfo.Name], RequestCost); found {
+		cost := meta.(*apidef.CostMeta)
+		// an endpoint priced by its upstream is counted as 1 until the response reports the actual cost
+		if cost.Cost > 0 || (cost.Cost == 0 && cost.ResponseHeader == "") {
+			charge.Cost = cost.Cost
+		}
+		charge.Header = cost.ResponseHeader
+	}
+	return charge
+}
+
+// groupSession returns the session holding the limits of the group of a key, or nil when the key isn't in a group.
+func (k *RateLimitAndQuotaCheck) groupSession(r *http.Request, session *user.SessionState) *user.SessionState {
+	if session.Group == nil {
+		return nil
+	}
+	id := k.Gw.replaceTykVariables(r, session.Group.ID, false)
+	if id == "" {
+		// the variables are empty for this key
+		return nil
+	}
+
+	group := &user.SessionState{
+		OrgID:                session.OrgID,
+		Rate:                 session.Group.Rate,
+		Per:                  session.Group.Per,
+		QuotaMax:             session.Group.QuotaMax,
+		QuotaRenewalRate:     session.Group.QuotaRenewalRate,
+		QuotaRenewalMode:     session.Group.QuotaRenewalMode,
+		QuotaRenewalTimezone: session.Group.QuotaRenewalTimezone,
+		Group:                &user.GroupLimit{ID: id},
+	}
+	group.KeyID = "group-" + session.OrgID + "-" + id
+	group.SetKeyHash(storage.HashKey(group.KeyID, k.Gw.GetConfig().HashKeys))
+	return group
+}
+
+func (k *RateLimitAndQuotaCheck) forwardMessage(r *http.Request, session, group, orgSession *user.SessionState, token string, store storage.Handler, dryRun bool) (sessionFailReason, string) {
+	if group == nil && orgSession == nil {
+		reason := k.Gw.SessionLimiter.ForwardMessage(
+			r,
+			session,
+			token,
+			store,
+			!k.Spec.DisableRateLimit,
+			!k.Spec.DisableQuota,
+			&k.Spec.GlobalConfig,
+			k.Spec,
+			dryRun,
+		)
+		return reason, limitLevelKey
+	}
+
+	return k.Gw.SessionLimiter.ForwardGroupMessage(
+		r,
+		session,
+		token,
+		group,
+		orgSession,
+		store,
+		!k.Spec.DisableRateLimit,
+		!k.Spec.DisableQuota,
+		&k.Spec.GlobalConfig,
+		k.Spec,
+		dryRun,
+	)
+}
+
+// countOrgQuota counts a request against the quota of its organisation alone, for the requests whose key limits are
+// ignored.
+func (k *RateLimitAndQuotaCheck) countOrgQuota(r *http.Request, orgSession *user.SessionState) (error, int) {
+	reason := k.Gw.SessionLimiter.ForwardMessage(r, orgSession, k.Spec.OrgID, k.Spec.OrgSessionManager.Store(), false, true, &k.Spec.GlobalConfig, k.Spec, false)
+	k.saveOrgSession(orgSession)
+	ctxSetOrgQuota(r, nil)
+	if reason == sessionFailQuota {
+		return k.orgQuotaExceeded(r)
+	}
+	if k.Spec.GlobalConfig.Monitor.MonitorOrgKeys {
+		k.Gw.SessionMonitor.Check(orgSession, "")
+	}
+	return nil, http.StatusOK
+}
+
 // ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
 func (k *RateLimitAndQuotaCheck) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	orgSession := ctxGetOrgQuota(r)
 	if ctxGetRequestStatus(r) == StatusOkAndIgnore {
+		if orgSession != nil {
+			return k.countOrgQuota(r, orgSession)
+		}
 		return nil, http.StatusOK
 	}
 
@@ -73,17 +190,15 @@ func (k *RateLimitAndQuotaCheck) ProcessRequest(w http.ResponseWriter, r *http.R
 	token := ctxGetAuthToken(r)
 
 	storeRef := k.Gw.GlobalSessionManager.Store()
-	reason := k.Gw.SessionLimiter.ForwardMessage(
-		r,
-		session,
-		token,
-		storeRef,
-		!k.Spec.DisableRateLimit,
-		!k.Spec.DisableQuota,
-		&k.Spec.GlobalConfig,
-		k.Spec,
-		false,
-	)
+	group := k.groupSession(r, session)
+	charge := k.quotaCharge(r)
+	ctxSetQuotaCharge(r, charge)
+	reason, level := k.forwardMessage(r, session, group, orgSession, token, storeRef, false)
+	if orgSession != nil && (reason == sessionFailNone || level == limitLevelOrg) {
+		// the org quota has been counted
+		k.saveOrgSession(orgSession)
+		ctxSetOrgQuota(r, nil)
+	}
 
 	throttleRetryLimit := session.ThrottleRetryLimit
 	throttleInterval := session.ThrottleInterval
@@ -100,23 +215,13 @@ func (k *RateLimitAndQuotaCheck) ProcessRequest(w http.ResponseWriter, r *http.R
 	switch reason {
 	case sessionFailNone:
 	case sessionFailRateLimit:
-		err, errCode := k.handleRateLimitFailure(r, token)
+		err, errCode := k.handleRateLimitFailure(r, token, group, level)
 		if throttleRetryLimit > 0 {
 			for {
 				ctxIncThrottleLevel(r, throttleRetryLimit)
 				time.Sleep(time.Duration(throttleInterval * float64(time.Second)))
 
-				reason = k.Gw.SessionLimiter.ForwardMessage(
-					r,
-					session,
-					token,
-					storeRef,
-					!k.Spec.DisableRateLimit,
-					!k.Spec.DisableQuota,
-					&k.Spec.GlobalConfig,
-					k.Spec,
-					true,
-				)
+				reason, _ = k.forwardMessage(r, session, group, ctxGetOrgQuota(r), token, storeRef, true)
 
 				log.WithFields(logrus.Fields{
 					"middleware": "RateLimitAndQuotaCheck",
@@ -135,16 +240,25 @@ func (k *RateLimitAndQuotaCheck) ProcessRequest(w http.ResponseWriter, r *http.R
 		return err, errCode
 
 	case sessionFailQuota:
-		return k.handleQuotaFailure(r, token)
+		if level == limitLevelOrg {
+			return k.orgQuotaExceeded(r)
+		}
+		return k.handleQuotaFailure(r, token, group, level)
 	case sessionFailInternalServerError:
 		return ProxyingRequestFailedErr, http.StatusInternalServerError
 	default:
 		// Other reason? Still not allowed
 		return errors.New("Access denied"), http.StatusForbidden
 	}
-	// Run the trigger monitor
+	// Run the trigger monitors
+	if orgSession != nil && k.Spec.GlobalConfig.Monitor.MonitorOrgKeys {
+		k.Gw.SessionMonitor.Check(orgSession, "")
+	}
 	if k.Spec.GlobalConfig.Monitor.MonitorUserKeys {
 		k.Gw.SessionMonitor.Check(session, token)
+		if charge.Cost > 0 && charge.QuotaMax > 0 {
+			k.Gw.SessionMonitor.CheckBalance(session, token, charge.QuotaMax, charge.balance(storeRef))
+		}
 	}
 
 	// Request is valid, carry on
@@ -2,13 +2,21 @@ package gateway
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/TykTechnologies/graphql-go-tools/pkg/graphql"
 
+	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/internal/uuid"
+	"github.com/TykTechnologies/tyk/storage"
 	"github.com/TykTechnologies/tyk/test"
 	"github.com/TykTechnologies/tyk/user"
 )
@@ -193,3 +201,200 @@ func TestMwRateLimiting_DepthLimit(t *testing.T) {
 		}...)
 	})
 }
+
+func TestGroupLimits(t *testing.T) {
+	g := StartTest(nil)
+	defer g.Close()
+
+	// the counters of the groups outlive the test
+	run := uuid.New()
+
+	g.Gw.DRLManager.SetCurrentTokenValue(1)
+	g.Gw.DRLManager.RequestTokenValue = 1
+
+	api := g.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.UseKeylessAccess = false
+	})[0]
+
+	createKey := func(appID string, keyRate float64, keyQuota int64, group user.GroupLimit) map[string]string {
+		_, key := g.CreateSession(func(s *user.SessionState) {
+			s.AccessRights = map[string]user.AccessDefinition{
+				api.APIID: {APIName: api.Name, APIID: api.APIID},
+			}
+			s.Rate = keyRate
+			s.QuotaMax = keyQuota
+			s.QuotaRenewalRate = 60
+			s.MetaData = map[string]interface{}{"app_id": appID}
+			s.Group = &group
+		})
+		return map[string]string{header.Authorization: key}
+	}
+
+	t.Run("quota", func(t *testing.T) {
+		group := user.GroupLimit{ID: "$tyk_meta.app_id", QuotaMax: 3, QuotaRenewalRate: 60}
+		first, second := createKey("quota-app-"+run, 1000, 2, group), createKey("quota-app-"+run, 1000, -1, group)
+		other := createKey("other-app-"+run, 1000, -1, group)
+
+		_, _ = g.Run(t, []test.TestCase{
+			{Headers: first, Code: http.StatusOK},
+			{Headers: first, Code: http.StatusOK},
+			{Headers: first, Code: http.StatusForbidden, BodyMatch: "Quota exceeded"},
+			// the request rejected by the key quota isn't counted against the group
+			{Headers: second, Code: http.StatusOK},
+			{Headers: second, Code: http.StatusForbidden, BodyMatch: "Group quota exceeded"},
+			{Headers: other, Code: http.StatusOK},
+		}...)
+
+		count, err := g.Gw.GlobalSessionManager.Store().GetRawKey(QuotaKeyPrefix + "group-default-quota-app-" + run)
+		assert.NoError(t, err)
+		assert.Equal(t, "3", count)
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		group := user.GroupLimit{ID: "$tyk_meta.app_id", Rate: 1, Per: 60}
+		first, second := createKey("rate-app-"+run, 1, -1, group), createKey("rate-app-"+run, 1, -1, group)
+
+		_, _ = g.Run(t, []test.TestCase{
+			{Headers: first, Code: http.StatusOK},
+			{Headers: second, Code: http.StatusTooManyRequests, BodyMatch: "Group rate limit exceeded"},
+		}...)
+
+		// the request rejected by the group isn't counted against the key
+		key := second[header.Authorization]
+		session, found := g.Gw.GlobalSessionManager.SessionDetail("default", key, false)
+		require.True(t, found)
+		conf := g.Gw.GetConfig()
+		reason := g.Gw.SessionLimiter.ForwardMessage(httptest.NewRequest(http.MethodGet, "/", nil), &session, key,
+			g.Gw.GlobalSessionManager.Store(), true, false, &conf, api, true)
+		assert.Equal(t, sessionFailNone, reason)
+	})
+
+	t.Run("calendar quota", func(t *testing.T) {
+		group := user.GroupLimit{ID: "$tyk_meta.app_id", QuotaMax: 1, QuotaRenewalMode: user.QuotaRenewalDaily}
+		key := createKey("calendar-app-"+run, 1000, -1, group)
+
+		_, _ = g.Run(t, []test.TestCase{
+			{Headers: key, Code: http.StatusOK},
+			{Headers: key, Code: http.StatusForbidden, BodyMatch: "Group quota exceeded"},
+		}...)
+
+		midnight, err := quotaPeriodEnd(user.QuotaRenewalDaily, "", time.Now())
+		require.NoError(t, err)
+		store := &storage.RedisCluster{RedisController: g.Gw.RedisController}
+		ttl, err := store.GetKeyTTL(QuotaKeyPrefix + "group-default-calendar-app-" + run)
+		require.NoError(t, err)
+		assert.InDelta(t, time.Until(midnight).Seconds(), ttl, 2)
+	})
+
+	t.Run("no group", func(t *testing.T) {
+		group := user.GroupLimit{ID: "$tyk_meta.missing", QuotaMax: 1, QuotaRenewalRate: 60}
+		key := createKey("", 1000, -1, group)
+
+		_, _ = g.Run(t, []test.TestCase{
+			{Headers: key, Code: http.StatusOK},
+			{Headers: key, Code: http.StatusOK},
+		}...)
+	})
+}
+
+func TestGroupLimits_ConcurrentRateLimit(t *testing.T) {
+	g := StartTest(func(globalConf *config.Config) {
+		globalConf.EnableRedisRollingLimiter = true
+	})
+	defer g.Close()
+
+	api := g.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.UseKeylessAccess = false
+	})[0]
+
+	run := uuid.New()
+	var keys []string
+	for i := 0; i < 2; i++ {
+		_, key := g.CreateSession(func(s *user.SessionState) {
+			s.AccessRights = map[string]user.AccessDefinition{
+				api.APIID: {APIName: api.Name, APIID: api.APIID},
+			}
+			s.Rate, s.Per = 100, 60
+			s.Group = &user.GroupLimit{ID: "concurrent-app-" + run, Rate: 5, Per: 60}
+		})
+		keys = append(keys, key)
+	}
+
+	var passed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			resp, err := g.Run(t, test.TestCase{Headers: map[string]string{header.Authorization: key}})
+			if err == nil && resp.StatusCode == http.StatusOK {
+				atomic.AddInt64(&passed, 1)
+			}
+		}(keys[i%2])
+	}
+	wg.Wait()
+	assert.Equal(t, int64(5), passed)
+
+	// the requests rejected by the group aren't counted by the rate limits of the keys
+	store := &storage.RedisCluster{RedisController: g.Gw.RedisController}
+	var counted int64
+	for _, key := range keys {
+		count, err := store.GetSortedSetCard(RateLimitKeyPrefix + storage.HashKey(key, g.Gw.GetConfig().HashKeys))
+		require.NoError(t, err)
+		counted += count
+	}
+	assert.Equal(t, passed, counted)
+}
+
+func TestGroupLimits_OrgQuota(t *testing.T) {
+	g := StartTest(func(globalConf *config.Config) {
+		globalConf.EnforceOrgQuotas = true
+		globalConf.ExperimentalProcessOrgOffThread = false
+	})
+	defer g.Close()
+
+	orgID := "group-org-" + uuid.New()
+	_, _ = g.Run(t, test.TestCase{
+		Method:    http.MethodPost,
+		Path:      "/tyk/org/keys/" + orgID + "?reset_quota=1",
+		AdminAuth: true,
+		Data:      map[string]interface{}{"org_id": orgID, "quota_max": 3, "quota_renewal_rate": 60},
+		Code:      http.StatusOK,
+	})
+
+	api := g.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.UseKeylessAccess = false
+		spec.OrgID = orgID
+	})[0]
+
+	createKey := func(keyQuota int64) map[string]string {
+		_, key := g.CreateSession(func(s *user.SessionState) {
+			s.OrgID = orgID
+			s.AccessRights = map[string]user.AccessDefinition{
+				api.APIID: {APIName: api.Name, APIID: api.APIID},
+			}
+			s.QuotaMax = keyQuota
+			s.QuotaRenewalRate = 60
+			s.Group = &user.GroupLimit{ID: "org-app", QuotaMax: 10, QuotaRenewalRate: 60}
+		})
+		return map[string]string{header.Authorization: key}
+	}
+	first, second := createKey(1), createKey(-1)
+
+	_, _ = g.Run(t, []test.TestCase{
+		{Headers: first, Code: http.StatusOK},
+		// the request rejected by the key quota isn't counted against the org
+		{Headers: first, Code: http.StatusForbidden, BodyMatch: "Quota exceeded"},
+		{Headers: second, Code: http.StatusOK},
+		{Headers: second, Code: http.StatusOK},
+		{Headers: second, Code: http.StatusForbidden, BodyMatch: "organisation quota has been exceeded"},
+	}...)
+
+	// the request rejected by the org quota isn't counted against the group
+	count, err := g.Gw.GlobalSessionManager.Store().GetRawKey(QuotaKeyPrefix + "group-" + orgID + "-org-app")
+	assert.NoError(t, err)
+	assert.Equal(t, "3", count)
+}
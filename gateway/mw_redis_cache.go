@@ -33,6 +33,8 @@ type RedisCacheMiddleware struct {
 
 	store storage.Handler
 	sh    SuccessHandler
+
+	graphQLKeyBuilder *graphQLCacheKeyBuilder
 }
 
 func (m *RedisCacheMiddleware) Name() string {
@@ -41,10 +43,18 @@ func (m *RedisCacheMiddleware) Name() string {
 
 func (m *RedisCacheMiddleware) Init() {
 	m.sh = SuccessHandler{m.BaseMiddleware}
+
+	if graphQLCacheEnabled(m.Spec) {
+		var err error
+		m.graphQLKeyBuilder, err = newGraphQLCacheKeyBuilder(m.Spec.GraphQLExecutor.Schema, m.Spec.GraphQL.Cache)
+		if err != nil {
+			m.Logger().WithError(err).Error("Could not initialise GraphQL cache, GraphQL requests won't be cached")
+		}
+	}
 }
 
 func (m *RedisCacheMiddleware) EnabledForSpec() bool {
-	return m.Spec.CacheOptions.EnableCache
+	return m.Spec.CacheOptions.EnableCache || graphQLCacheEnabled(m.Spec)
 }
 
 func (m *RedisCacheMiddleware) CreateCheckSum(req *http.Request, keyName string, regex string, additionalKeyFromHeaders string) (string, error) {
@@ -146,12 +156,94 @@ func (m *RedisCacheMiddleware) decodePayload(payload string) (string, string, er
 type cacheOptions struct {
 	key                    string
 	cacheOnlyResponseCodes []int
+	// ttl overrides the cache timeout of the API when greater than zero
+	ttl int64
+	// graphQL marks the response as a GraphQL response, which is not cached when it carries errors
+	graphQL bool
+}
+
+// CreateGraphQLCheckSum builds a cache key from the normalised GraphQL operation and its variables.
+// The session identity is part of the key when CacheBySession is enabled or a selected field is hinted as private.
+func (m *RedisCacheMiddleware) CreateGraphQLCheckSum(r *http.Request, entry *graphQLCacheEntry) (string, error) {
+	h := md5.New()
+
+	key := entry.operation + "-" + entry.variables
+	if additionalKeyFromHeaders := m.getCacheKeyFromHeaders(r); additionalKeyFromHeaders != "" {
+		key = key + "-" + additionalKeyFromHeaders
+	}
+
+	_, err := io.WriteString(h, key)
+	if err != nil {
+		return "", err
+	}
+
+	identity := ""
+	if m.Spec.GraphQL.Cache.CacheBySession || entry.private {
+		identity = ctxGetAuthToken(r)
+		if identity == "" {
+			identity = request.RealIP(r)
+		}
+	}
+
+	reqChecksum := hex.EncodeToString(h.Sum(nil))
+	return m.Spec.APIID + "-graphql-" + identity + reqChecksum, nil
+}
+
+// graphQLCacheOptions returns the cache options for a GraphQL request, or nil if the request must not be cached.
+func (m *RedisCacheMiddleware) graphQLCacheOptions(r *http.Request) *cacheOptions {
+	if m.graphQLKeyBuilder == nil {
+		return nil
+	}
+
+	gqlRequest := ctxGetGraphQLRequest(r)
+	if gqlRequest == nil {
+		return nil
+	}
+
+	entry, err := m.graphQLKeyBuilder.Entry(gqlRequest)
+	if err != nil {
+		if err != errGraphQLOperationNotCacheable {
+			m.Logger().WithError(err).Debug("Could not normalise GraphQL operation. Skipping cache check")
+		}
+		return nil
+	}
+
+	key, err := m.CreateGraphQLCheckSum(r, entry)
+	if err != nil {
+		m.Logger().Debug("Error creating checksum. Skipping cache check")
+		return nil
+	}
+
+	ttl := m.Spec.GraphQL.Cache.Timeout
+	if ttl <= 0 {
+		ttl = m.Spec.CacheOptions.CacheTimeout
+	}
+	if entry.maxAge > 0 && (ttl <= 0 || entry.maxAge < ttl) {
+		ttl = entry.maxAge
+	}
+
+	return &cacheOptions{
+		key:                    key,
+		cacheOnlyResponseCodes: []int{http.StatusOK},
+		ttl:                    ttl,
+		graphQL:                true,
+	}
 }
 
 // ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
 func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
 	t1 := time.Now()
 
+	if graphQLCacheEnabled(m.Spec) {
+		options := m.graphQLCacheOptions(r)
+		if options == nil {
+			return nil, http.StatusOK
+		}
+
+		ctxSetCacheOptions(r, options)
+		return m.serveFromCache(w, r, options.key, t1)
+	}
+
 	var stat RequestStatus
 	var cacheKeyRegex string
 	var cacheMeta *EndPointCacheMeta
@@ -185,7 +277,6 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 		token = request.RealIP(r)
 	}
 
-	var retBlob string
 	key, err := m.CreateCheckSum(r, token, cacheKeyRegex, m.getCacheKeyFromHeaders(r))
 	if err != nil {
 		m.Logger().Debug("Error creating checksum. Skipping cache check")
@@ -203,7 +294,12 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 		cacheOnlyResponseCodes: cacheOnlyResponseCodes,
 	})
 
-	retBlob, err = m.store.GetKey(key)
+	return m.serveFromCache(w, r, key, t1)
+}
+
+// serveFromCache writes the response stored under key, if there is a valid one, and stops the chain.
+func (m *RedisCacheMiddleware) serveFromCache(w http.ResponseWriter, r *http.Request, key string, t1 time.Time) (error, int) {
+	retBlob, err := m.store.GetKey(key)
 	if err != nil {
 		// Record not found, continue with the middleware chain
 		return nil, http.StatusOK
@@ -244,6 +340,7 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 		newRes.Header.Set(header.XRateLimitLimit, strconv.Itoa(int(quotaMax)))
 		newRes.Header.Set(header.XRateLimitRemaining, strconv.Itoa(int(quotaRemaining)))
 		newRes.Header.Set(header.XRateLimitReset, strconv.Itoa(int(quotaRenews)))
+		setKeyRotationHeaders(newRes.Header, session)
 	}
 	newRes.Header.Set(cachedResponseHeader, "1")
 
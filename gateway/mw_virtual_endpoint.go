@@ -16,7 +16,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/robertkrimen/otto"
 	_ "github.com/robertkrimen/otto/underscore"
 
 	"github.com/TykTechnologies/tyk-pump/analytics"
@@ -88,7 +87,7 @@ func (gw *Gateway) preLoadVirtualMetaCode(meta *apidef.VirtualMeta, j *JSVM) {
 		j.Log.Error("Type must be either file or blob (base64)!")
 		return
 	}
-	if _, err := j.VM.Run(src); err != nil {
+	if err := j.load(meta.ResponseFunctionName, src); err != nil {
 		j.Log.WithError(err).Error("Could not load virtual endpoint JS")
 	}
 }
@@ -173,44 +172,11 @@ func (d *VirtualEndpoint) ServeHTTPForCache(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Run the middleware
-
-	vm := d.Spec.JSVM.VM.Copy()
-	vm.Interrupt = make(chan func(), 1)
 	d.Logger().Debug("Running: ", vmeta.ResponseFunctionName)
-	// buffered, leaving no chance of a goroutine leak since the
-	// spawned goroutine will send 0 or 1 values.
-	ret := make(chan otto.Value, 1)
-	errRet := make(chan error, 1)
-	go func() {
-		defer func() {
-			// the VM executes the panic func that gets it
-			// to stop, so we must recover here to not crash
-			// the whole Go program.
-			recover()
-		}()
-		returnRaw, err := vm.Run(vmeta.ResponseFunctionName + `(` + string(requestAsJson) + `, ` + string(sessionAsJson) + `, ` + specAsJson + `);`)
-		ret <- returnRaw
-		errRet <- err
-	}()
-	var returnRaw otto.Value
-	t := time.NewTimer(d.Spec.JSVM.Timeout)
-	select {
-	case returnRaw = <-ret:
-		if err := <-errRet; err != nil {
-			return nil, fmt.Errorf("Failed to run JS middleware: %w", err)
-		}
-		t.Stop()
-	case <-t.C:
-		t.Stop()
-		d.Logger().Error("JS middleware timed out after ", d.Spec.JSVM.Timeout)
-		vm.Interrupt <- func() {
-			// only way to stop the VM is to send it a func
-			// that panics.
-			panic("stop")
-		}
-		return nil, fmt.Errorf("JS middleware timed out after %s", d.Spec.JSVM.Timeout)
+	returnDataStr, err := d.Spec.JSVM.run(vmeta.ResponseFunctionName + `(` + string(requestAsJson) + `, ` + string(sessionAsJson) + `, ` + specAsJson + `);`)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to run JS middleware: %w", err)
 	}
-	returnDataStr, _ := returnRaw.ToString()
 
 	// Decode the return object
 	newResponseData := VMResponseObject{}
@@ -340,6 +306,7 @@ func (gw *Gateway) handleForcedResponse(rw http.ResponseWriter, res *http.Respon
 		res.Header.Set(header.XRateLimitLimit, strconv.Itoa(int(quotaMax)))
 		res.Header.Set(header.XRateLimitRemaining, strconv.Itoa(int(quotaRemaining)))
 		res.Header.Set(header.XRateLimitReset, strconv.Itoa(int(quotaRenews)))
+		setKeyRotationHeaders(res.Header, ses)
 	}
 
 	copyHeader(rw.Header(), res.Header, gw.GetConfig().IgnoreCanonicalMIMEHeaderKey)
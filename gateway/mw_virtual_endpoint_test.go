@@ -255,3 +255,45 @@ func TestVirtualEndpointDisabled(t *testing.T) {
 		},
 	)
 }
+
+func TestVirtualEndpoint_Goja(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	const js = `
+const testVirtData = (request, session, config) => {
+	const { foo, bar: { y } } = config.config_data
+	return TykJsResponse({
+		Body: JSON.stringify({ foo, y, url: request.URL }),
+		Headers: { "data-foo": ` + "`${foo}-${y}`" + ` },
+		Code: 202,
+	}, session.meta_data)
+}`
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.JSVMEngine = apidef.GojaEngine
+		spec.ConfigData = map[string]interface{}{
+			"foo": "x",
+			"bar": map[string]interface{}{"y": 3},
+		}
+
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.Virtual = []apidef.VirtualMeta{{
+				ResponseFunctionName: "testVirtData",
+				FunctionSourceType:   apidef.UseBlob,
+				FunctionSourceURI:    base64.StdEncoding.EncodeToString([]byte(js)),
+				Path:                 "/virt",
+				Method:               http.MethodGet,
+			}}
+		})
+	})
+
+	_, _ = ts.Run(t, test.TestCase{
+		Path:         "/virt",
+		Code:         http.StatusAccepted,
+		BodyMatch:    `{"foo":"x","y":3,"url":"/virt"}`,
+		HeadersMatch: map[string]string{"data-foo": "x-3"},
+	})
+}
@@ -0,0 +1,403 @@
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TykTechnologies/gojsonschema"
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+
+	"github.com/TykTechnologies/tyk/internal/wsframe"
+	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	webSocketMessagesInTagPrefix  = "ws-messages-in-"
+	webSocketMessagesOutTagPrefix = "ws-messages-out-"
+	webSocketCloseTagPrefix       = "ws-close-"
+
+	webSocketCloseTimeout = time.Second
+)
+
+// webSocketHeldMessageSize caps the client text messages held back for schema validation
+// when the API doesn't set a max message size.
+var webSocketHeldMessageSize int64 = 1 << 20
+
+// WebSocketMiddleware prepares the message level policies of WebSocket handshakes.
+// They are applied by the reverse proxy once the upstream accepted the upgrade.
+type WebSocketMiddleware struct {
+	BaseMiddleware
+
+	schema   *gojsonschema.Schema
+	loadedAt string
+}
+
+func (m *WebSocketMiddleware) Name() string {
+	return "WebSocketMiddleware"
+}
+
+func (m *WebSocketMiddleware) EnabledForSpec() bool {
+	return m.Spec.WebSocket.Enabled && m.Gw.GetConfig().HttpServerOptions.EnableWebSockets
+}
+
+func (m *WebSocketMiddleware) Init() {
+	// Use a new rate limit bucket on each load
+	m.loadedAt = strconv.Itoa(int(time.Now().UnixNano()))
+
+	if m.Spec.WebSocket.Schema == "" {
+		return
+	}
+
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(m.Spec.WebSocket.Schema))
+	if err != nil {
+		m.Logger().WithError(err).Error("Couldn't load WebSocket message schema")
+		return
+	}
+
+	m.schema = schema
+}
+
+// ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
+func (m *WebSocketMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		return nil, http.StatusOK
+	}
+
+	if m.Spec.WebSocket.Schema != "" && m.schema == nil {
+		return errors.New("WebSocket message schema is not configured correctly"), http.StatusInternalServerError
+	}
+
+	conn := &webSocketConn{
+		maxMessageSize: m.Spec.WebSocket.MaxMessageSize,
+		idleTimeout:    time.Duration(m.Spec.WebSocket.IdleTimeout) * time.Second,
+		schema:         m.schema,
+	}
+
+	if limit := m.Spec.WebSocket.ConnectionRateLimit; limit.Rate > 0 && limit.Per > 0 {
+		burst := int(limit.Rate)
+		if burst < 1 {
+			burst = 1
+		}
+		conn.limiter = rate.NewLimiter(rate.Limit(limit.Rate/limit.Per), burst)
+	}
+
+	// Skip the key limit for looping
+	if m.Spec.WebSocket.KeyRateLimit.Rate > 0 && ctxCheckLimits(r) {
+		conn.allowKeyMessage = func() bool {
+			return m.allowKeyMessage(r)
+		}
+	}
+
+	conn.onLimitExceeded = func(message string) {
+		m.handleLimitFailure(r, message)
+	}
+
+	ctxSetWebSocketConn(r, conn)
+
+	return nil, http.StatusOK
+}
+
+// allowKeyMessage counts a client message against the message rate limit shared by
+// all connections of the key, or of the API for keyless access.
+func (m *WebSocketMiddleware) allowKeyMessage(r *http.Request) bool {
+	keyName := "ws-" + m.Spec.OrgID + m.Spec.APIID
+	if session := ctxGetSession(r); session != nil {
+		keyName += "-" + session.KeyHash()
+	}
+
+	limit := m.Spec.WebSocket.KeyRateLimit
+	messageSession := &user.SessionState{
+		Rate:        limit.Rate,
+		Per:         limit.Per,
+		LastUpdated: m.loadedAt,
+	}
+	messageSession.KeyID = keyName
+	messageSession.SetKeyHash(storage.HashKey(keyName, m.Gw.GetConfig().HashKeys))
+
+	reason := m.Gw.SessionLimiter.ForwardMessage(r, messageSession,
+		keyName,
+		m.Gw.GlobalSessionManager.Store(),
+		true,
+		false,
+		&m.Spec.GlobalConfig,
+		m.Spec,
+		false,
+	)
+
+	return reason != sessionFailRateLimit
+}
+
+func (m *WebSocketMiddleware) handleLimitFailure(r *http.Request, message string) {
+	token := ctxGetAuthToken(r)
+	m.Logger().WithField("key", m.Gw.obfuscateKey(token)).Info(message)
+
+	m.FireEvent(EventRateLimitExceeded, EventKeyFailureMeta{
+		EventMetaDefault: EventMetaDefault{Message: message, OriginatingRequest: EncodeRequestToEvent(r)},
+		Path:             r.URL.Path,
+		Origin:           request.RealIP(r),
+		Key:              token,
+	})
+
+	reportHealthValue(m.Spec, Throttle, "-1")
+}
+
+// webSocketConn applies the message policies of an API to an upgraded connection
+// and counts the traffic for the analytics record of the handshake.
+type webSocketConn struct {
+	maxMessageSize int64
+	idleTimeout    time.Duration
+	schema         *gojsonschema.Schema
+
+	// limiter limits the messages of the client on this connection, nil without limit.
+	limiter *rate.Limiter
+	// allowKeyMessage checks the message limit of the key, nil without limit.
+	allowKeyMessage func() bool
+	onLimitExceeded func(message string)
+
+	upgraded    int32
+	closeCode   int32
+	messagesIn  int64
+	messagesOut int64
+	bytesIn     int64
+	bytesOut    int64
+
+	client, backend *webSocketWriter
+	idle            *time.Timer
+}
+
+// webSocketWriter serialises the frames written to one side of the connection,
+// as close frames sent by the gateway may interleave with forwarded ones.
+type webSocketWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	masked bool
+}
+
+func (w *webSocketWriter) writeFrame(header []byte, payload io.Reader, length int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.w.Write(header); err != nil {
+		return err
+	}
+
+	if length == 0 {
+		return nil
+	}
+
+	_, err := io.CopyN(w.w, payload, length)
+	return err
+}
+
+// errWebSocketPolicy is returned when the gateway closed the connection.
+var errWebSocketPolicy = errors.New("WebSocket connection closed by policy")
+
+// serve proxies frames between the client and the upstream, sending the first
+// error of either direction to errc.
+func (c *webSocketConn) serve(errc chan<- error, client io.ReadWriteCloser, clientReader io.Reader, backend io.ReadWriteCloser) {
+	atomic.StoreInt32(&c.upgraded, 1)
+
+	c.client = &webSocketWriter{w: client}
+	c.backend = &webSocketWriter{w: backend, masked: true}
+
+	if c.idleTimeout > 0 {
+		c.idle = time.AfterFunc(c.idleTimeout, func() {
+			c.close(wsframe.CloseGoingAway, "idle timeout")
+			client.Close()
+			backend.Close()
+		})
+	}
+
+	go func() {
+		errc <- c.pipe(c.backend, clientReader, true)
+	}()
+	go func() {
+		errc <- c.pipe(c.client, backend, false)
+	}()
+}
+
+// stop releases the idle timer once the connection is closed.
+func (c *webSocketConn) stop() {
+	if c.idle != nil {
+		c.idle.Stop()
+	}
+}
+
+// pipe forwards the frames read from src. Messages are checked against the policies
+// before their frames are written, text messages of the client are held back until
+// they are validated.
+func (c *webSocketConn) pipe(dst *webSocketWriter, src io.Reader, fromClient bool) error {
+	var (
+		opcode      wsframe.Opcode
+		messageSize int64
+		held        bytes.Buffer
+		message     bytes.Buffer
+	)
+
+	for {
+		h, err := wsframe.ReadHeader(src)
+		if err != nil {
+			return err
+		}
+
+		c.count(fromClient, int64(len(h.Raw))+h.Length, false)
+
+		// control frames may be sent between the fragments of a message
+		if h.Opcode.IsControl() {
+			if err := dst.writeFrame(h.Raw, src, h.Length); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if h.Opcode != wsframe.OpContinuation {
+			opcode, messageSize = h.Opcode, 0
+			if c.idle != nil {
+				c.idle.Reset(c.idleTimeout)
+			}
+
+			if fromClient && !c.allowMessage() {
+				c.close(wsframe.ClosePolicyViolation, "message rate limit exceeded")
+				return errWebSocketPolicy
+			}
+		}
+
+		messageSize += h.Length
+		maxMessageSize := c.maxMessageSize
+		if maxMessageSize == 0 && fromClient && c.schema != nil && opcode == wsframe.OpText {
+			maxMessageSize = webSocketHeldMessageSize
+		}
+		if maxMessageSize > 0 && messageSize > maxMessageSize {
+			c.close(wsframe.CloseMessageTooBig, "message too big")
+			return errWebSocketPolicy
+		}
+
+		if h.Fin {
+			c.count(fromClient, 0, true)
+		}
+
+		if !fromClient || c.schema == nil || opcode != wsframe.OpText {
+			if err := dst.writeFrame(h.Raw, src, h.Length); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var payload bytes.Buffer
+		if _, err := io.CopyN(&payload, src, h.Length); err != nil {
+			return err
+		}
+
+		held.Write(h.Raw)
+		held.Write(payload.Bytes())
+
+		if h.Masked {
+			wsframe.Unmask(h.MaskKey, payload.Bytes())
+		}
+		message.Write(payload.Bytes())
+
+		if !h.Fin {
+			continue
+		}
+
+		result, err := c.schema.Validate(gojsonschema.NewBytesLoader(message.Bytes()))
+		if err != nil || !result.Valid() {
+			c.close(wsframe.ClosePolicyViolation, "message doesn't match the schema")
+			return errWebSocketPolicy
+		}
+
+		if err := dst.writeFrame(nil, &held, int64(held.Len())); err != nil {
+			return err
+		}
+		held.Reset()
+		message.Reset()
+	}
+}
+
+func (c *webSocketConn) allowMessage() bool {
+	if c.limiter != nil && !c.limiter.Allow() {
+		c.onLimitExceeded("WebSocket connection message rate limit exceeded")
+		return false
+	}
+
+	if c.allowKeyMessage != nil && !c.allowKeyMessage() {
+		c.onLimitExceeded("WebSocket key message rate limit exceeded")
+		return false
+	}
+
+	return true
+}
+
+// close sends close frames with the status code to both sides. Sending them is best
+// effort, a peer not reading them doesn't keep the connection open.
+func (c *webSocketConn) close(code uint16, reason string) {
+	atomic.CompareAndSwapInt32(&c.closeCode, 0, int32(code))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.client.writeFrame(wsframe.CloseFrame(code, reason, c.client.masked), nil, 0)
+		_ = c.backend.writeFrame(wsframe.CloseFrame(code, reason, c.backend.masked), nil, 0)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(webSocketCloseTimeout):
+	}
+}
+
+func (c *webSocketConn) count(fromClient bool, bytes int64, message bool) {
+	switch {
+	case fromClient && message:
+		atomic.AddInt64(&c.messagesIn, 1)
+	case message:
+		atomic.AddInt64(&c.messagesOut, 1)
+	case fromClient:
+		atomic.AddInt64(&c.bytesIn, bytes)
+	default:
+		atomic.AddInt64(&c.bytesOut, bytes)
+	}
+}
+
+// networkStats returns the bytes sent in each direction over the upgraded connection.
+func (c *webSocketConn) networkStats() analytics.NetworkStats {
+	if atomic.LoadInt32(&c.upgraded) == 0 {
+		return analytics.NetworkStats{}
+	}
+
+	return analytics.NetworkStats{
+		OpenConnections:  1,
+		ClosedConnection: 1,
+		BytesIn:          atomic.LoadInt64(&c.bytesIn),
+		BytesOut:         atomic.LoadInt64(&c.bytesOut),
+	}
+}
+
+// analyticsTags returns the message counts of the connection, and the status code
+// it was closed with when the gateway closed it.
+func (c *webSocketConn) analyticsTags() []string {
+	if atomic.LoadInt32(&c.upgraded) == 0 {
+		return nil
+	}
+
+	tags := []string{
+		webSocketMessagesInTagPrefix + strconv.FormatInt(atomic.LoadInt64(&c.messagesIn), 10),
+		webSocketMessagesOutTagPrefix + strconv.FormatInt(atomic.LoadInt64(&c.messagesOut), 10),
+	}
+
+	if code := atomic.LoadInt32(&c.closeCode); code != 0 {
+		tags = append(tags, webSocketCloseTagPrefix+strconv.Itoa(int(code)))
+	}
+
+	return tags
+}
@@ -0,0 +1,211 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/gojsonschema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/TykTechnologies/tyk/internal/wsframe"
+)
+
+func testWebSocketFrame(fin bool, opcode wsframe.Opcode, payload string, masked bool) []byte {
+	frame := []byte{byte(opcode), byte(len(payload))}
+	if fin {
+		frame[0] |= 0x80
+	}
+
+	data := []byte(payload)
+	if masked {
+		key := [4]byte{7, 1, 3, 5}
+		wsframe.Unmask(key, data)
+		frame[1] |= 0x80
+		frame = append(frame, key[:]...)
+	}
+
+	return append(frame, data...)
+}
+
+func testWebSocketCloseCode(t *testing.T, frames []byte) uint16 {
+	t.Helper()
+
+	r := bytes.NewReader(frames)
+	for {
+		h, err := wsframe.ReadHeader(r)
+		require.NoError(t, err, "no close frame found")
+
+		payload := make([]byte, h.Length)
+		_, err = io.ReadFull(r, payload)
+		require.NoError(t, err)
+
+		if h.Opcode == wsframe.OpClose {
+			if h.Masked {
+				wsframe.Unmask(h.MaskKey, payload)
+			}
+			return binary.BigEndian.Uint16(payload)
+		}
+	}
+}
+
+func newTestWebSocketConn(c *webSocketConn) (client, backend *bytes.Buffer) {
+	client, backend = &bytes.Buffer{}, &bytes.Buffer{}
+	c.client = &webSocketWriter{w: client}
+	c.backend = &webSocketWriter{w: backend, masked: true}
+	c.upgraded = 1
+	return client, backend
+}
+
+func TestWebSocketConn_Pipe(t *testing.T) {
+	t.Run("frames are forwarded unchanged and counted", func(t *testing.T) {
+		c := &webSocketConn{maxMessageSize: 10}
+		_, backend := newTestWebSocketConn(c)
+
+		src := bytes.Join([][]byte{
+			testWebSocketFrame(false, wsframe.OpText, "hello ", true),
+			testWebSocketFrame(true, wsframe.OpPing, "", true),
+			testWebSocketFrame(true, wsframe.OpContinuation, "you", true),
+			testWebSocketFrame(true, wsframe.OpBinary, "data", true),
+		}, nil)
+
+		err := c.pipe(c.backend, bytes.NewReader(src), true)
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, src, backend.Bytes())
+
+		assert.Equal(t, int64(len(src)), c.networkStats().BytesIn)
+		assert.Equal(t, []string{"ws-messages-in-2", "ws-messages-out-0"}, c.analyticsTags())
+	})
+
+	t.Run("message too big", func(t *testing.T) {
+		c := &webSocketConn{maxMessageSize: 8}
+		client, backend := newTestWebSocketConn(c)
+
+		src := bytes.Join([][]byte{
+			testWebSocketFrame(false, wsframe.OpText, "hello ", false),
+			testWebSocketFrame(true, wsframe.OpContinuation, "you", false),
+		}, nil)
+
+		err := c.pipe(c.client, bytes.NewReader(src), false)
+		assert.Equal(t, errWebSocketPolicy, err)
+		assert.Equal(t, wsframe.CloseMessageTooBig, testWebSocketCloseCode(t, client.Bytes()))
+		assert.Equal(t, wsframe.CloseMessageTooBig, testWebSocketCloseCode(t, backend.Bytes()))
+		assert.Contains(t, c.analyticsTags(), "ws-close-1009")
+	})
+
+	t.Run("connection rate limit", func(t *testing.T) {
+		var exceeded []string
+		c := &webSocketConn{
+			limiter:         rate.NewLimiter(rate.Every(time.Hour), 1),
+			onLimitExceeded: func(message string) { exceeded = append(exceeded, message) },
+		}
+		client, backend := newTestWebSocketConn(c)
+
+		message := testWebSocketFrame(true, wsframe.OpText, "hi", true)
+		err := c.pipe(c.backend, bytes.NewReader(bytes.Repeat(message, 2)), true)
+		assert.Equal(t, errWebSocketPolicy, err)
+		assert.Len(t, exceeded, 1)
+		assert.Equal(t, message, backend.Bytes()[:len(message)])
+		assert.Equal(t, wsframe.ClosePolicyViolation, testWebSocketCloseCode(t, client.Bytes()))
+	})
+
+	t.Run("key rate limit", func(t *testing.T) {
+		c := &webSocketConn{
+			allowKeyMessage: func() bool { return false },
+			onLimitExceeded: func(string) {},
+		}
+		client, _ := newTestWebSocketConn(c)
+
+		// the upstream isn't limited
+		err := c.pipe(c.client, bytes.NewReader(testWebSocketFrame(true, wsframe.OpText, "hi", false)), false)
+		assert.Equal(t, io.EOF, err)
+
+		err = c.pipe(c.backend, bytes.NewReader(testWebSocketFrame(true, wsframe.OpText, "hi", true)), true)
+		assert.Equal(t, errWebSocketPolicy, err)
+		assert.Equal(t, wsframe.ClosePolicyViolation, testWebSocketCloseCode(t, client.Bytes()))
+	})
+
+	t.Run("schema validation", func(t *testing.T) {
+		schema, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(`{"type": "object", "required": ["op"]}`))
+		require.NoError(t, err)
+
+		c := &webSocketConn{schema: schema}
+		client, backend := newTestWebSocketConn(c)
+
+		valid := bytes.Join([][]byte{
+			testWebSocketFrame(false, wsframe.OpText, `{"op":`, true),
+			testWebSocketFrame(true, wsframe.OpContinuation, `"sub"}`, true),
+			testWebSocketFrame(true, wsframe.OpBinary, `not json`, true),
+		}, nil)
+		invalid := testWebSocketFrame(true, wsframe.OpText, `{}`, true)
+
+		err = c.pipe(c.backend, bytes.NewReader(append(valid, invalid...)), true)
+		assert.Equal(t, errWebSocketPolicy, err)
+		assert.Equal(t, valid, backend.Bytes()[:len(valid)])
+		assert.Equal(t, wsframe.ClosePolicyViolation, testWebSocketCloseCode(t, backend.Bytes()[len(valid):]))
+		assert.Equal(t, wsframe.ClosePolicyViolation, testWebSocketCloseCode(t, client.Bytes()))
+	})
+
+	t.Run("held message too big", func(t *testing.T) {
+		defer func(size int64) { webSocketHeldMessageSize = size }(webSocketHeldMessageSize)
+		webSocketHeldMessageSize = 8
+
+		schema, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(`{"type": "object"}`))
+		require.NoError(t, err)
+
+		c := &webSocketConn{schema: schema}
+		client, backend := newTestWebSocketConn(c)
+
+		src := bytes.Join([][]byte{
+			testWebSocketFrame(true, wsframe.OpBinary, `not json data`, true),
+			testWebSocketFrame(false, wsframe.OpText, `{"op":`, true),
+			testWebSocketFrame(false, wsframe.OpContinuation, `"sub"`, true),
+			testWebSocketFrame(true, wsframe.OpContinuation, `}`, true),
+		}, nil)
+
+		err = c.pipe(c.backend, bytes.NewReader(src), true)
+		assert.Equal(t, errWebSocketPolicy, err)
+		assert.Equal(t, wsframe.CloseMessageTooBig, testWebSocketCloseCode(t, backend.Bytes()))
+		assert.Equal(t, wsframe.CloseMessageTooBig, testWebSocketCloseCode(t, client.Bytes()))
+	})
+}
+
+func TestWebSocketConn_IdleTimeout(t *testing.T) {
+	client, clientPeer := net.Pipe()
+	backend, backendPeer := net.Pipe()
+	defer clientPeer.Close()
+	defer backendPeer.Close()
+
+	c := &webSocketConn{idleTimeout: 50 * time.Millisecond}
+	errc := make(chan error, 2)
+	c.serve(errc, client, client, backend)
+	defer c.stop()
+
+	go func() {
+		_, _ = io.Copy(io.Discard, backendPeer)
+	}()
+
+	h, err := wsframe.ReadHeader(clientPeer)
+	require.NoError(t, err)
+	assert.Equal(t, wsframe.OpClose, h.Opcode)
+
+	_, err = io.CopyN(io.Discard, clientPeer, h.Length)
+	require.NoError(t, err)
+
+	select {
+	case <-errc:
+	case <-time.After(time.Second):
+		t.Fatal("connection wasn't closed")
+	}
+}
+
+func TestWebSocketConn_NotUpgraded(t *testing.T) {
+	c := &webSocketConn{}
+	assert.Empty(t, c.analyticsTags())
+	assert.Zero(t, c.networkStats())
+}
@@ -0,0 +1,380 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/cli/plugin"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const pluginHarnessAPIID = "plugin-test"
+
+// the Redis server is embedded by the plugintest module, which keeps its dependencies out of the gateway
+func init() {
+	plugin.NewGatewayHarness = newPluginHarness
+}
+
+// pluginHarness runs the requests of `tyk plugin test` through the middleware chain of an API, in a
+// gateway backed by the Redis of the options, with the upstream stubbed by the recorded responses of the fixture.
+type pluginHarness struct {
+	gw       *Gateway
+	cancel   context.CancelFunc
+	upstream *httptest.Server
+	dir      string
+	apiID    string
+
+	mu        sync.Mutex
+	responses []plugin.RecordedResponse
+	requests  []plugin.RecordedRequest
+}
+
+func newPluginHarness(opts plugin.HarnessOptions) (_ plugin.Harness, err error) {
+	// the report goes to stdout, only errors of the gateway are worth showing along with it
+	log.SetLevel(logrus.ErrorLevel)
+
+	h := &pluginHarness{}
+	defer func() {
+		if err != nil {
+			h.Close()
+		}
+	}()
+
+	if h.dir, err = os.MkdirTemp("", "tyk-plugin-test-"); err != nil {
+		return nil, err
+	}
+	h.upstream = httptest.NewServer(http.HandlerFunc(h.serveUpstream))
+
+	conf, err := h.config(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.writeAPI(opts, conf.AppPath); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+
+	gw := NewGateway(conf, ctx)
+	gw.afterConfSetup()
+	config.Global = gw.GetConfig
+	h.gw = gw
+
+	conf = gw.GetConfig()
+	go gw.RedisController.ConnectToRedis(ctx, nil, &conf)
+
+	timeout, cancelTimeout := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelTimeout()
+	if !gw.RedisController.WaitConnect(timeout) {
+		return nil, errors.New("couldn't connect to Redis")
+	}
+
+	if matches, _ := filepath.Glob(filepath.Join(conf.TemplatePath, "error*")); len(matches) == 0 {
+		return nil, fmt.Errorf("no error templates found in %q, set template_path in the gateway configuration", conf.TemplatePath)
+	}
+
+	gw.SetNodeID("plugin-test")
+	gw.keyGen = DefaultKeyGenerator{Gw: gw}
+	gw.setupGlobals()
+	gw.DefaultOrgStore.Init(gw.getGlobalStorageHandler("orgkey.", false))
+	gw.DefaultQuotaStore.Init(gw.getGlobalStorageHandler("orgkey.", false))
+	gw.setupPortsWhitelist()
+	gw.startServer()
+
+	spec := gw.getApiSpec(h.apiID)
+	if spec == nil {
+		return nil, errors.New("API couldn't be loaded")
+	}
+	if !spec.CustomMiddlewareBundleDisabled && spec.CustomMiddlewareBundle != "" {
+		if _, err := os.Stat(gw.getBundleDestPath(spec)); err != nil {
+			return nil, fmt.Errorf("bundle couldn't be loaded: %s", spec.CustomMiddlewareBundle)
+		}
+	}
+	if err := gw.bundleInitError(spec); err != nil {
+		return nil, fmt.Errorf("plugins couldn't be loaded: %w", err)
+	}
+
+	return h, nil
+}
+
+// config returns the gateway configuration of the harness, the storage, listeners and anything
+// reaching out of the process are overridden.
+func (h *pluginHarness) config(opts plugin.HarnessOptions) (config.Config, error) {
+	conf := config.Default
+	if opts.ConfPath != "" {
+		conf = config.Config{}
+		if err := config.Load([]string{opts.ConfPath}, &conf); err != nil {
+			return conf, err
+		}
+	}
+
+	conf.Storage = config.StorageOptionsConf{Type: "redis", Host: opts.RedisHost, Port: opts.RedisPort}
+	conf.CacheStorage = config.StorageOptionsConf{}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return conf, err
+	}
+	conf.ListenAddress = "127.0.0.1"
+	conf.ListenPort = l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	conf.ControlAPIPort = 0
+	conf.ControlAPIHostname = ""
+	conf.HttpServerOptions.UseSSL = false
+
+	conf.AppPath = filepath.Join(h.dir, "apps")
+	conf.MiddlewarePath = filepath.Join(h.dir, "middleware")
+	if err := os.MkdirAll(conf.AppPath, 0700); err != nil {
+		return conf, err
+	}
+
+	conf.UseDBAppConfigs = false
+	conf.SlaveOptions.UseRPC = false
+	conf.DisableDashboardZeroConf = true
+	if conf.Policies.PolicySource == "service" || conf.Policies.PolicySource == "rpc" {
+		conf.Policies.PolicySource = ""
+	}
+
+	conf.EnableAnalytics = false
+	conf.UptimeTests.Disable = true
+	conf.Monitor.EnableTriggerMonitors = false
+	conf.SuppressRedisSignalReload = true
+	conf.LocalSessionCache.DisableCacheSessionState = true
+
+	conf.EnableJSVM = true
+	conf.CoProcessOptions.EnableCoProcess = true
+	conf.BundleRefreshInterval = 0
+	if opts.BundlePath != "" {
+		bundlePath, err := filepath.Abs(opts.BundlePath)
+		if err != nil {
+			return conf, err
+		}
+		conf.EnableBundleDownloader = true
+		conf.BundleBaseURL = "file://" + filepath.Dir(bundlePath)
+	}
+
+	return conf, nil
+}
+
+// writeAPI writes the API definition to the app path, proxying to the stubbed upstream and loading
+// the bundle or the Go plugin under test.
+func (h *pluginHarness) writeAPI(opts plugin.HarnessOptions, appPath string) error {
+	data, err := os.ReadFile(opts.APIPath)
+	if err != nil {
+		return err
+	}
+
+	var def apidef.APIDefinition
+	if err := json.Unmarshal(data, &def); err != nil {
+		return fmt.Errorf("couldn't parse the API definition: %w", err)
+	}
+	if def.IsOAS {
+		return errors.New("OAS API definitions aren't supported, use the classic API definition")
+	}
+
+	if def.APIID == "" {
+		def.APIID = pluginHarnessAPIID
+	}
+	h.apiID = def.APIID
+
+	def.Active = true
+	def.Domain = ""
+	def.ListenPort = 0
+	def.Protocol = ""
+	def.Proxy.TargetURL = h.upstream.URL
+	def.Proxy.EnableLoadBalancing = false
+	def.Proxy.ServiceDiscovery.UseDiscoveryService = false
+
+	if opts.BundlePath != "" {
+		def.CustomMiddlewareBundle = filepath.Base(opts.BundlePath)
+		def.CustomMiddlewareBundleDisabled = false
+	}
+
+	if opts.PluginPath != "" {
+		if def.CustomMiddleware.Driver != apidef.GoPluginDriver {
+			return errors.New("API doesn't use the Go plugin driver")
+		}
+		pluginPath, err := filepath.Abs(opts.PluginPath)
+		if err != nil {
+			return err
+		}
+
+		section := &def.CustomMiddleware
+		if section.AuthCheck.Name != "" {
+			section.AuthCheck.Path = pluginPath
+		}
+		for _, hooks := range [][]apidef.MiddlewareDefinition{section.Pre, section.PostKeyAuth, section.Post, section.Response} {
+			for i := range hooks {
+				hooks[i].Path = pluginPath
+			}
+		}
+	}
+
+	data, err = json.Marshal(def)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(appPath, "api.json"), data, 0600)
+}
+
+// Run sends the request of the test to the gateway.
+func (h *pluginHarness) Run(test *plugin.FixtureTest, upstream []plugin.RecordedResponse) (*plugin.Result, error) {
+	h.mu.Lock()
+	h.responses = upstream
+	h.requests = nil
+	h.mu.Unlock()
+
+	spec := h.gw.getApiSpec(h.apiID)
+
+	var key, orgID string
+	if len(test.Session) > 0 {
+		session := user.NewSessionState()
+		session.OrgID = spec.OrgID
+		session.QuotaMax = -1
+		if err := json.Unmarshal(test.Session, session); err != nil {
+			return nil, fmt.Errorf("couldn't parse the session: %w", err)
+		}
+
+		key, orgID = test.Key, session.OrgID
+		if key == "" {
+			key = h.gw.generateToken(orgID, "")
+		}
+
+		hashKeys := h.gw.GetConfig().HashKeys
+		if err := h.gw.GlobalSessionManager.UpdateSession(storage.HashKey(key, hashKeys), session, 0, hashKeys); err != nil {
+			return nil, fmt.Errorf("couldn't create the session: %w", err)
+		}
+	}
+
+	method := test.Request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req := httptest.NewRequest(method, test.Request.Path, strings.NewReader(test.Request.Body))
+	for name, value := range test.Request.Headers {
+		req.Header.Set(name, value)
+	}
+	if key != "" {
+		authConfig, ok := spec.AuthConfigs[apidef.AuthTokenType]
+		if !ok {
+			authConfig = spec.Auth
+		}
+		headerName := authConfig.AuthHeaderName
+		if headerName == "" {
+			headerName = header.Authorization
+		}
+		if req.Header.Get(headerName) == "" {
+			req.Header.Set(headerName, key)
+		}
+	}
+
+	router := h.gw.DefaultProxyMux.router(h.gw.GetConfig().ListenPort, "", h.gw.GetConfig())
+	if router == nil {
+		return nil, errors.New("gateway router isn't running")
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	res := &plugin.Result{
+		Status:  rec.Code,
+		Headers: flattenHeader(rec.Header()),
+		Body:    rec.Body.String(),
+	}
+
+	h.mu.Lock()
+	res.Upstream = h.requests
+	h.mu.Unlock()
+
+	if key != "" {
+		if session, found := h.gw.GlobalSessionManager.SessionDetail(orgID, key, false); found {
+			res.Session, _ = json.Marshal(session)
+		}
+	}
+
+	return res, nil
+}
+
+// serveUpstream serves the first recorded response matching the request.
+func (h *pluginHarness) serveUpstream(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	recorded := plugin.RecordedRequest{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Headers: flattenHeader(r.Header),
+		Body:    string(body),
+	}
+
+	h.mu.Lock()
+	var res *plugin.RecordedResponse
+	for i := range h.responses {
+		if h.responses[i].Matches(r.Method, r.URL.Path) {
+			res = &h.responses[i]
+			break
+		}
+	}
+	recorded.Unmatched = res == nil
+	h.requests = append(h.requests, recorded)
+	h.mu.Unlock()
+
+	if res == nil {
+		http.Error(w, "no recorded response", http.StatusNotFound)
+		return
+	}
+
+	for name, value := range res.Headers {
+		w.Header().Set(name, value)
+	}
+	status := res.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, res.Body)
+}
+
+func (h *pluginHarness) Close() {
+	if h.cancel != nil {
+		h.cancel()
+	}
+	if h.gw != nil {
+		for _, p := range h.gw.DefaultProxyMux.proxies {
+			if p.listener != nil {
+				p.listener.Close()
+			}
+		}
+	}
+	if h.upstream != nil {
+		h.upstream.Close()
+	}
+	if h.dir != "" {
+		os.RemoveAll(h.dir)
+	}
+}
+
+// flattenHeader joins the values of every header.
+func flattenHeader(h http.Header) map[string]string {
+	flat := make(map[string]string, len(h))
+	for name, values := range h {
+		flat[name] = strings.Join(values, ", ")
+	}
+	return flat
+}
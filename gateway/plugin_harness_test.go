@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/cli"
+	"github.com/TykTechnologies/tyk/cli/plugin"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func TestPluginHarness(t *testing.T) {
+	// the harness runs from the command line, after the flags are set up
+	cli.Init(VERSION, confPaths)
+
+	dir := t.TempDir()
+	writeFile := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0600))
+		return path
+	}
+
+	_, b, _, _ := runtime.Caller(0)
+	templatePath := filepath.Join(filepath.Dir(filepath.Dir(b)), "templates")
+
+	// the Redis server of the tests
+	opts := plugin.HarnessOptions{
+		RedisHost:  config.Default.Storage.Host,
+		RedisPort:  config.Default.Storage.Port,
+		ConfPath:   writeFile("tyk.conf", []byte(`{"template_path": "`+templatePath+`", "hash_keys": true}`)),
+		BundlePath: writeFile("bundle.zip", testJSBundleArchive(t, "a")),
+		APIPath: writeFile("api.json", []byte(`{
+			"name": "orders",
+			"org_id": "default",
+			"use_keyless": false,
+			"auth": {"auth_header_name": "Authorization"},
+			"version_data": {"not_versioned": true, "versions": {"Default": {"name": "Default"}}},
+			"proxy": {"listen_path": "/orders/", "target_url": "http://example.com", "strip_listen_path": true}
+		}`)),
+	}
+
+	fixture := writeFile("fixture.yaml", []byte(`
+upstream:
+  - path: /items
+    status: 201
+    headers:
+      X-Upstream: stub
+    body: created
+tests:
+  - name: authorised
+    session:
+      meta_data:
+        team: a
+    request:
+      method: POST
+      path: /orders/items
+      body: item
+    expect:
+      status: 201
+      headers:
+        X-Upstream: stub
+      body: created
+      session:
+        meta_data:
+          team: a
+      upstream_request:
+        method: POST
+        path: /items
+        headers:
+          X-Bundle: a
+        body: item
+  - name: no key
+    request:
+      path: /orders/items
+    expect:
+      status: 401
+      body_contains: Authorization field missing
+  - name: unrecorded upstream
+    session: {}
+    request:
+      path: /orders/other
+    expect:
+      status: 200
+      session:
+        meta_data:
+          team: b
+`))
+
+	h, err := newPluginHarness(opts)
+	require.NoError(t, err)
+	defer h.Close()
+
+	loaded, err := plugin.LoadFixture(fixture)
+	require.NoError(t, err)
+
+	suite := plugin.RunFixture(h, "fixture.yaml", loaded)
+	assert.Equal(t, 3, suite.Tests)
+	assert.Equal(t, 0, suite.Errors)
+	assert.Equal(t, 1, suite.Failures)
+
+	assert.Nil(t, suite.TestCases[0].Failure)
+	assert.Nil(t, suite.TestCases[1].Failure)
+	require.NotNil(t, suite.TestCases[2].Failure)
+	assert.Equal(t, "no recorded upstream response for GET /other\n"+
+		"status: expected 200, got 404\n"+
+		"session.meta_data: expected an object, got null", suite.TestCases[2].Failure.Contents)
+
+	t.Run("invalid bundle", func(t *testing.T) {
+		opts := opts
+		opts.BundlePath = writeFile("invalid.zip", []byte("invalid"))
+		_, err := newPluginHarness(opts)
+		assert.Error(t, err)
+	})
+}
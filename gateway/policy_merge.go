@@ -0,0 +1,586 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/user"
+)
+
+var errPolicyNotFound = errors.New("policy not found")
+
+var (
+	limitStrategies = []user.MergeStrategy{user.MergeOverride, user.MergeMin, user.MergeMax}
+	setStrategies   = []user.MergeStrategy{user.MergeOverride, user.MergeUnion, user.MergeIntersect}
+)
+
+// policyMergeStrategies are the strategies each field of a policy can be merged with.
+var policyMergeStrategies = map[string][]user.MergeStrategy{
+	"rate":                 limitStrategies,
+	"per":                  limitStrategies,
+	"quota_max":            limitStrategies,
+	"quota_renewal_rate":   limitStrategies,
+	"throttle_interval":    limitStrategies,
+	"throttle_retry_limit": limitStrategies,
+	"max_query_depth":      limitStrategies,
+	"key_expires_in":       limitStrategies,
+	"access_rights":        setStrategies,
+	"tags":                 setStrategies,
+	"meta_data":            {user.MergeOverride, user.MergeUnion},
+}
+
+// policyLimits returns the limits of a policy by field, as *float64, *int64 or *int.
+func policyLimits(pol *user.Policy) map[string]interface{} {
+	return map[string]interface{}{
+		"rate":                 &pol.Rate,
+		"per":                  &pol.Per,
+		"quota_max":            &pol.QuotaMax,
+		"quota_renewal_rate":   &pol.QuotaRenewalRate,
+		"throttle_interval":    &pol.ThrottleInterval,
+		"throttle_retry_limit": &pol.ThrottleRetryLimit,
+		"max_query_depth":      &pol.MaxQueryDepth,
+		"key_expires_in":       &pol.KeyExpiresIn,
+	}
+}
+
+// inheritedStrategies are the default strategies of an extending policy, it overrides the limits and access rights
+// of its parent, and adds to its tags and metadata.
+var inheritedStrategies = map[string]user.MergeStrategy{
+	"access_rights": user.MergeOverride,
+	"tags":          user.MergeUnion,
+	"meta_data":     user.MergeUnion,
+}
+
+// composedStrategies are the default strategies of composed policies, the same as the implicit merge of the
+// policies of a key: the highest limits win, and the access rights, tags and metadata add up.
+var composedStrategies = map[string]user.MergeStrategy{
+	"rate":                 user.MergeMax,
+	"per":                  user.MergeMax,
+	"quota_max":            user.MergeMax,
+	"quota_renewal_rate":   user.MergeMax,
+	"throttle_interval":    user.MergeMax,
+	"throttle_retry_limit": user.MergeMax,
+	"max_query_depth":      user.MergeMax,
+	"key_expires_in":       user.MergeMax,
+	"access_rights":        user.MergeUnion,
+	"tags":                 user.MergeUnion,
+	"meta_data":            user.MergeUnion,
+}
+
+// effectivePolicy is a policy resolved from the policies it extends, or composed of several policies, along with
+// the policy which supplied each of its values.
+type effectivePolicy struct {
+	Policy user.Policy `json:"policy"`
+	// Sources are the IDs of the policies which supplied the values, by field. The access rights, tags and metadata
+	// are listed by API, tag and key, e.g. access_rights.{apiID}.
+	Sources map[string]string `json:"sources"`
+	// Implicit is set when none of the composed policies declares merge strategies, keys then merge them with the
+	// implicit rules of their partitions, which match the default strategies for policies without partitions.
+	Implicit bool `json:"implicit,omitempty"`
+}
+
+// validatePolicyMerge checks the merge strategies a policy declares.
+func validatePolicyMerge(pol user.Policy) error {
+	if pol.Extends != "" && pol.Extends == pol.ID {
+		return fmt.Errorf("policy %s can't extend itself", pol.ID)
+	}
+
+	for field, strategy := range pol.Merge {
+		allowed, ok := policyMergeStrategies[field]
+		if !ok {
+			return fmt.Errorf("policy %s: field %q can't be merged", pol.ID, field)
+		}
+
+		valid := false
+		for _, s := range allowed {
+			valid = valid || s == strategy
+		}
+		if !valid {
+			return fmt.Errorf("policy %s: field %q can't be merged with the %q strategy", pol.ID, field, strategy)
+		}
+	}
+	return nil
+}
+
+// newEffectivePolicy copies a policy, all of its values supplied by itself.
+func newEffectivePolicy(pol user.Policy) *effectivePolicy {
+	p := &effectivePolicy{Policy: pol, Sources: map[string]string{}}
+
+	p.Policy.AccessRights = make(map[string]user.AccessDefinition, len(pol.AccessRights))
+	for apiID, ad := range pol.AccessRights {
+		p.Policy.AccessRights[apiID] = ad
+		p.Sources["access_rights."+apiID] = pol.ID
+	}
+	p.Policy.Tags = append([]string(nil), pol.Tags...)
+	for _, tag := range pol.Tags {
+		p.Sources["tags."+tag] = pol.ID
+	}
+	p.Policy.MetaData = make(map[string]interface{}, len(pol.MetaData))
+	for k, v := range pol.MetaData {
+		p.Policy.MetaData[k] = v
+		p.Sources["meta_data."+k] = pol.ID
+	}
+	p.Policy.Merge = make(map[string]user.MergeStrategy, len(pol.Merge))
+	for k, v := range pol.Merge {
+		p.Policy.Merge[k] = v
+	}
+	if pol.Group != nil {
+		group := *pol.Group
+		p.Policy.Group = &group
+		p.Sources["group"] = pol.ID
+	}
+	if pol.QuotaRenewalMode != user.QuotaRenewalRolling {
+		p.Sources["quota_renewal_mode"] = pol.ID
+	}
+	if pol.GraphQL != nil {
+		p.Policy.GraphQL = make(map[string]user.GraphAccessDefinition, len(pol.GraphQL))
+		for k, v := range pol.GraphQL {
+			p.Policy.GraphQL[k] = v
+		}
+	}
+
+	for field, limit := range policyLimits(&p.Policy) {
+		if limitValue(limit) != 0 {
+			p.Sources[field] = pol.ID
+		}
+	}
+	return p
+}
+
+// resolvePolicy resolves a policy from the policies it extends, with the schedules active at a time. The path is
+// the IDs of its children.
+func (gw *Gateway) resolvePolicy(polID string, at time.Time, path ...string) (*effectivePolicy, error) {
+	gw.policiesMu.RLock()
+	pol, ok := gw.policiesByID[polID]
+	windows := gw.policySchedules[polID]
+	gw.policiesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errPolicyNotFound, polID)
+	}
+	if len(windows) != len(pol.Schedules) {
+		// the policy wasn't stored by syncPolicies
+		var err error
+		if windows, err = compilePolicySchedules(pol); err != nil {
+			return nil, err
+		}
+	}
+
+	self := newEffectivePolicy(pol)
+	self.schedule(windows, at)
+	if pol.Extends == "" {
+		return self, nil
+	}
+
+	path = append(path, polID)
+	if contains(path, pol.Extends) {
+		return nil, fmt.Errorf("policy inheritance cycle: %s -> %s", strings.Join(path, " -> "), pol.Extends)
+	}
+	resolved, err := gw.resolvePolicy(pol.Extends, at, path...)
+	if err != nil {
+		return nil, err
+	}
+	if resolved.Policy.OrgID != pol.OrgID {
+		return nil, fmt.Errorf("policy %s can't extend policy %s of another organisation", polID, pol.Extends)
+	}
+
+	resolved.merge(self, inheritedStrategies)
+
+	// the identity of the policy isn't inherited
+	resolved.Policy.MID, resolved.Policy.ID, resolved.Policy.Name = pol.MID, pol.ID, pol.Name
+	resolved.Policy.Active, resolved.Policy.Extends = pol.Active, pol.Extends
+	resolved.Policy.Schedules = pol.Schedules
+	if isPartitioned(pol) {
+		resolved.Policy.Partitions = pol.Partitions
+	}
+
+	// the strategies of the parent still apply when the resolved policy is composed
+	for field, strategy := range pol.Merge {
+		resolved.Policy.Merge[field] = strategy
+	}
+	return resolved, nil
+}
+
+// resolvedPolicy returns a policy resolved from the policies it extends, with its schedules active now. Policies
+// which neither extend another nor have schedules are returned as loaded.
+func (gw *Gateway) resolvedPolicy(polID string) (user.Policy, error) {
+	gw.policiesMu.RLock()
+	pol, ok := gw.policiesByID[polID]
+	gw.policiesMu.RUnlock()
+	if ok && pol.Extends == "" && len(pol.Schedules) == 0 {
+		return pol, nil
+	}
+
+	resolved, err := gw.resolvePolicy(polID, time.Now())
+	if err != nil {
+		return user.Policy{}, err
+	}
+	return resolved.Policy, nil
+}
+
+// composePolicies composes the policies of a key into one policy with the merge strategies they declare. It
+// returns nil when none of them declares any, the policies are then merged with the implicit partition rules.
+func (gw *Gateway) composePolicies(polIDs []string) (*effectivePolicy, error) {
+	if len(polIDs) < 2 || !gw.declareMerge(polIDs) {
+		return nil, nil
+	}
+
+	resolved := make([]*effectivePolicy, 0, len(polIDs))
+	now := time.Now()
+	for _, polID := range polIDs {
+		pol, err := gw.resolvePolicy(polID, now)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, pol)
+	}
+	return mergePolicies(resolved)
+}
+
+// declareMerge tells if any of the policies, or of the policies they extend, declares merge strategies.
+func (gw *Gateway) declareMerge(polIDs []string) bool {
+	gw.policiesMu.RLock()
+	defer gw.policiesMu.RUnlock()
+
+	for _, polID := range polIDs {
+		// the length of the chain is bounded in case of an inheritance cycle
+		for i := 0; polID != "" && i <= len(gw.policiesByID); i++ {
+			pol, ok := gw.policiesByID[polID]
+			if !ok {
+				break
+			}
+			if len(pol.Merge) > 0 {
+				return true
+			}
+			polID = pol.Extends
+		}
+	}
+	return false
+}
+
+// validatePolicies skips the policies declaring invalid merge strategies or schedules, they're checked once as
+// policies are loaded rather than as they're applied. It returns the time windows of the schedules by policy.
+func validatePolicies(pols map[string]user.Policy) map[string][]scheduleWindow {
+	schedules := make(map[string][]scheduleWindow)
+	for polID, pol := range pols {
+		err := validatePolicyMerge(pol)
+		if err == nil {
+			schedules[polID], err = compilePolicySchedules(pol)
+		}
+		if err != nil {
+			mainLog.WithError(err).Errorf("Policy %s skipped", polID)
+			delete(pols, polID)
+			delete(schedules, polID)
+		}
+	}
+	return schedules
+}
+
+// mergePolicies composes resolved policies in order, each merged into the previous ones with its strategies.
+func mergePolicies(resolved []*effectivePolicy) (*effectivePolicy, error) {
+	composed := resolved[0]
+	if len(resolved) == 1 {
+		return composed, nil
+	}
+
+	ids := make([]string, 0, len(resolved))
+	explicit := false
+	for _, pol := range resolved {
+		if isPartitioned(pol.Policy) {
+			return nil, fmt.Errorf("policy %s has partitions, it can't be composed", pol.Policy.ID)
+		}
+		if pol.Policy.OrgID != composed.Policy.OrgID {
+			return nil, fmt.Errorf("policies %s and %s belong to different organisations", composed.Policy.ID, pol.Policy.ID)
+		}
+		explicit = explicit || len(pol.Policy.Merge) > 0
+		ids = append(ids, pol.Policy.ID)
+	}
+
+	for _, pol := range resolved[1:] {
+		composed.merge(pol, composedStrategies)
+	}
+
+	composed.Policy.ID = strings.Join(ids, "+")
+	composed.Policy.Name = ""
+	composed.Policy.Extends = ""
+	composed.Policy.Merge = nil
+	composed.Implicit = !explicit
+	return composed, nil
+}
+
+func isPartitioned(pol user.Policy) bool {
+	return pol.Partitions.Quota || pol.Partitions.RateLimit || pol.Partitions.Acl || pol.Partitions.Complexity || pol.Partitions.PerAPI
+}
+
+// merge merges the values of src into p, with the strategies src declares or the default ones.
+func (p *effectivePolicy) merge(src *effectivePolicy, defaults map[string]user.MergeStrategy) {
+	strategy := func(field string) user.MergeStrategy {
+		if s, ok := src.Policy.Merge[field]; ok {
+			return s
+		}
+		if s, ok := defaults[field]; ok {
+			return s
+		}
+		return user.MergeOverride
+	}
+
+	srcLimits := policyLimits(&src.Policy)
+	for field, limit := range policyLimits(&p.Policy) {
+		if mergeLimit(strategy(field), limit, srcLimits[field]) {
+			p.Sources[field] = src.Sources[field]
+		}
+	}
+
+	p.Policy.AccessRights = mergeAccessRights(strategy("access_rights"), p.Policy.AccessRights, src.Policy.AccessRights)
+	apiIDs := make([]string, 0, len(p.Policy.AccessRights))
+	for apiID := range p.Policy.AccessRights {
+		apiIDs = append(apiIDs, apiID)
+	}
+	p.updateSources("access_rights.", apiIDs, src)
+
+	p.Policy.Tags = mergeTags(strategy("tags"), p.Policy.Tags, src.Policy.Tags)
+	p.updateSources("tags.", p.Policy.Tags, src)
+
+	if len(src.Policy.MetaData) > 0 {
+		if strategy("meta_data") == user.MergeOverride {
+			p.Policy.MetaData = map[string]interface{}{}
+		}
+		for k, v := range src.Policy.MetaData {
+			p.Policy.MetaData[k] = v
+		}
+		keys := make([]string, 0, len(p.Policy.MetaData))
+		for k := range p.Policy.MetaData {
+			keys = append(keys, k)
+		}
+		p.updateSources("meta_data.", keys, src)
+	}
+
+	if src.Policy.Group != nil {
+		p.Policy.Group = src.Policy.Group
+		p.Sources["group"] = src.Sources["group"]
+	}
+
+	// the calendar renewal of the quota comes with its time zone
+	if src.Policy.QuotaRenewalMode != user.QuotaRenewalRolling {
+		p.Policy.QuotaRenewalMode = src.Policy.QuotaRenewalMode
+		p.Policy.QuotaRenewalTimezone = src.Policy.QuotaRenewalTimezone
+		p.Sources["quota_renewal_mode"] = src.Sources["quota_renewal_mode"]
+	}
+
+	for k, v := range src.Policy.GraphQL {
+		if p.Policy.GraphQL == nil {
+			p.Policy.GraphQL = map[string]user.GraphAccessDefinition{}
+		}
+		p.Policy.GraphQL[k] = v
+	}
+
+	p.Policy.HMACEnabled = p.Policy.HMACEnabled || src.Policy.HMACEnabled
+	p.Policy.EnableHTTPSignatureValidation = p.Policy.EnableHTTPSignatureValidation || src.Policy.EnableHTTPSignatureValidation
+	p.Policy.IsInactive = p.Policy.IsInactive || src.Policy.IsInactive
+	if src.Policy.LastUpdated > p.Policy.LastUpdated {
+		p.Policy.LastUpdated = src.Policy.LastUpdated
+	}
+}
+
+// updateSources sets the sources of the values under a prefix after a merge: the values src has are supplied by
+// it, the others keep their source, and the sources of the values merged away are dropped.
+func (p *effectivePolicy) updateSources(prefix string, keys []string, src *effectivePolicy) {
+	sources := make(map[string]string, len(keys))
+	for _, key := range keys {
+		key = prefix + key
+		if source, ok := src.Sources[key]; ok {
+			sources[key] = source
+		} else {
+			sources[key] = p.Sources[key]
+		}
+	}
+
+	for key := range p.Sources {
+		if strings.HasPrefix(key, prefix) {
+			delete(p.Sources, key)
+		}
+	}
+	for key, source := range sources {
+		p.Sources[key] = source
+	}
+}
+
+// limitValue returns the value of a *float64, *int64 or *int limit.
+func limitValue(limit interface{}) float64 {
+	switch v := limit.(type) {
+	case *float64:
+		return *v
+	case *int64:
+		return float64(*v)
+	case *int:
+		return float64(*v)
+	}
+	return 0
+}
+
+// mergeLimit merges the next value of a limit into the previous one, and tells if it was replaced. -1 is unlimited,
+// and 0 is unset.
+func mergeLimit(strategy user.MergeStrategy, prev, next interface{}) bool {
+	prevValue, nextValue := limitValue(prev), limitValue(next)
+
+	replace := true
+	switch {
+	case nextValue == 0:
+		replace = false
+	case prevValue == 0:
+	case strategy == user.MergeMin:
+		replace = greaterThanFloat64(prevValue, nextValue)
+	case strategy == user.MergeMax:
+		replace = greaterThanFloat64(nextValue, prevValue)
+	}
+	if !replace {
+		return false
+	}
+
+	switch v := prev.(type) {
+	case *float64:
+		*v = *next.(*float64)
+	case *int64:
+		*v = *next.(*int64)
+	case *int:
+		*v = *next.(*int)
+	}
+	return true
+}
+
+// mergeTags merges the tags of two policies.
+func mergeTags(strategy user.MergeStrategy, prev, next []string) []string {
+	switch {
+	case len(next) == 0:
+		return prev
+	case len(prev) == 0, strategy == user.MergeOverride:
+		return append([]string(nil), next...)
+	case strategy == user.MergeIntersect:
+		return intersection(prev, next)
+	}
+	return appendIfMissing(prev, next...)
+}
+
+// mergeAccessRights merges the access rights of two policies, by API.
+func mergeAccessRights(strategy user.MergeStrategy, prev, next map[string]user.AccessDefinition) map[string]user.AccessDefinition {
+	switch {
+	case len(next) == 0:
+		return prev
+	case len(prev) == 0, strategy == user.MergeOverride:
+		rights := make(map[string]user.AccessDefinition, len(next))
+		for apiID, ad := range next {
+			rights[apiID] = ad
+		}
+		return rights
+	}
+
+	rights := make(map[string]user.AccessDefinition, len(prev))
+	for apiID, ad := range prev {
+		nextAD, ok := next[apiID]
+		switch {
+		case ok:
+			rights[apiID] = mergeAccessDefinition(strategy, ad, nextAD)
+		case strategy != user.MergeIntersect:
+			rights[apiID] = ad
+		}
+	}
+	if strategy == user.MergeIntersect {
+		return rights
+	}
+
+	for apiID, ad := range next {
+		if _, ok := prev[apiID]; !ok {
+			rights[apiID] = ad
+		}
+	}
+	return rights
+}
+
+// mergeAccessDefinition merges the access rights of two policies to the same API: the versions and allowed URLs of
+// both, or in both only, on top of the next access rights. Empty allowed URLs allow all of them.
+func mergeAccessDefinition(strategy user.MergeStrategy, prev, next user.AccessDefinition) user.AccessDefinition {
+	merged := next
+
+	if strategy == user.MergeIntersect {
+		merged.Versions = intersection(prev.Versions, next.Versions)
+		switch {
+		case len(prev.AllowedURLs) == 0:
+		case len(next.AllowedURLs) == 0:
+			merged.AllowedURLs = prev.AllowedURLs
+		default:
+			merged.AllowedURLs = nil
+			for _, prevURL := range prev.AllowedURLs {
+				for _, nextURL := range next.AllowedURLs {
+					if prevURL.URL == nextURL.URL {
+						if methods := intersection(prevURL.Methods, nextURL.Methods); len(methods) > 0 {
+							merged.AllowedURLs = append(merged.AllowedURLs, user.AccessSpec{URL: prevURL.URL, Methods: methods})
+						}
+					}
+				}
+			}
+		}
+		return merged
+	}
+
+	merged.Versions = appendIfMissing(prev.Versions, next.Versions...)
+	if len(prev.AllowedURLs) == 0 || len(next.AllowedURLs) == 0 {
+		merged.AllowedURLs = nil
+		return merged
+	}
+
+	merged.AllowedURLs = append([]user.AccessSpec(nil), prev.AllowedURLs...)
+	for _, nextURL := range next.AllowedURLs {
+		found := false
+		for i, url := range merged.AllowedURLs {
+			if url.URL == nextURL.URL {
+				found = true
+				merged.AllowedURLs[i].Methods = appendIfMissing(url.Methods, nextURL.Methods...)
+			}
+		}
+		if !found {
+			merged.AllowedURLs = append(merged.AllowedURLs, nextURL)
+		}
+	}
+	return merged
+}
+
+// effectivePolicyHandler shows the policy resolved from a comma separated list of policies, as applied to keys now
+// or at the RFC 3339 time of the at parameter.
+func (gw *Gateway) effectivePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	polIDs := strings.Split(mux.Vars(r)["polID"], ",")
+
+	at := time.Now()
+	if value := r.URL.Query().Get("at"); value != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339, value); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("at must be an RFC 3339 time"))
+			return
+		}
+	}
+
+	resolved := make([]*effectivePolicy, 0, len(polIDs))
+	for _, polID := range polIDs {
+		pol, err := gw.resolvePolicy(polID, at)
+		if err != nil {
+			code := http.StatusBadRequest
+			if errors.Is(err, errPolicyNotFound) {
+				code = http.StatusNotFound
+			}
+			doJSONWrite(w, code, apiError(err.Error()))
+			return
+		}
+		resolved = append(resolved, pol)
+	}
+
+	composed, err := mergePolicies(resolved)
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	}
+
+	doJSONWrite(w, http.StatusOK, composed)
+}
@@ -0,0 +1,189 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func loadMergePolicies(ts *Test) {
+	ts.Gw.policiesMu.Lock()
+	defer ts.Gw.policiesMu.Unlock()
+
+	pols := map[string]user.Policy{
+		"base": {
+			ID:       "base",
+			OrgID:    "default",
+			Rate:     100,
+			Per:      60,
+			QuotaMax: 1000,
+			AccessRights: map[string]user.AccessDefinition{
+				"a": {APIID: "a", Versions: []string{"v1"}},
+				"b": {APIID: "b", Versions: []string{"v1"}},
+			},
+			Tags:     []string{"base"},
+			MetaData: map[string]interface{}{"tier": "base", "team": "core"},
+			Group:    &user.GroupLimit{ID: "$tyk_meta.app_id", QuotaMax: 10000},
+		},
+		"gold": {
+			ID:       "gold",
+			OrgID:    "default",
+			Extends:  "base",
+			Rate:     500,
+			QuotaMax: 500,
+			Tags:     []string{"gold"},
+			MetaData: map[string]interface{}{"tier": "gold"},
+			Merge:    map[string]user.MergeStrategy{"quota_max": user.MergeMax},
+		},
+		"capped": {
+			ID:    "capped",
+			OrgID: "default",
+			Rate:  10,
+			AccessRights: map[string]user.AccessDefinition{
+				"a": {APIID: "a", Versions: []string{"v1", "v2"}},
+			},
+			Merge: map[string]user.MergeStrategy{"rate": user.MergeMin, "access_rights": user.MergeIntersect},
+		},
+		"loop1":    {ID: "loop1", OrgID: "default", Extends: "loop2"},
+		"loop2":    {ID: "loop2", OrgID: "default", Extends: "loop1"},
+		"orphan":   {ID: "orphan", OrgID: "default", Extends: "missing"},
+		"invalid":  {ID: "invalid", OrgID: "default", Merge: map[string]user.MergeStrategy{"tags": user.MergeMin}},
+		"other":    {ID: "other", OrgID: "other", Extends: "base"},
+		"implicit": {ID: "implicit", OrgID: "default", Rate: 1000},
+	}
+	validatePolicies(pols)
+	ts.Gw.policiesByID = pols
+}
+
+func TestResolvePolicy(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+	loadMergePolicies(ts)
+
+	gold, err := ts.Gw.resolvePolicy("gold", time.Now())
+	require.NoError(t, err)
+
+	assert.Equal(t, "gold", gold.Policy.ID)
+	assert.Equal(t, 500.0, gold.Policy.Rate)
+	assert.Equal(t, 60.0, gold.Policy.Per)
+	assert.Equal(t, int64(1000), gold.Policy.QuotaMax)
+	assert.ElementsMatch(t, []string{"a", "b"}, []string{gold.Policy.AccessRights["a"].APIID, gold.Policy.AccessRights["b"].APIID})
+	assert.ElementsMatch(t, []string{"base", "gold"}, gold.Policy.Tags)
+	assert.Equal(t, map[string]interface{}{"tier": "gold", "team": "core"}, gold.Policy.MetaData)
+
+	assert.Equal(t, map[string]string{
+		"rate":            "gold",
+		"per":             "base",
+		"quota_max":       "base",
+		"access_rights.a": "base",
+		"access_rights.b": "base",
+		"tags.base":       "base",
+		"tags.gold":       "gold",
+		"meta_data.tier":  "gold",
+		"meta_data.team":  "base",
+		"group":           "base",
+	}, gold.Sources)
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := ts.Gw.resolvePolicy("loop1", time.Now())
+		assert.EqualError(t, err, "policy inheritance cycle: loop1 -> loop2 -> loop1")
+
+		_, err = ts.Gw.resolvePolicy("orphan", time.Now())
+		assert.ErrorIs(t, err, errPolicyNotFound)
+
+		// policies with invalid merge strategies aren't loaded
+		_, err = ts.Gw.resolvePolicy("invalid", time.Now())
+		assert.ErrorIs(t, err, errPolicyNotFound)
+		assert.EqualError(t, validatePolicyMerge(user.Policy{ID: "invalid", Merge: map[string]user.MergeStrategy{"tags": user.MergeMin}}),
+			`policy invalid: field "tags" can't be merged with the "min" strategy`)
+
+		_, err = ts.Gw.resolvePolicy("other", time.Now())
+		assert.EqualError(t, err, "policy other can't extend policy base of another organisation")
+	})
+}
+
+func TestApplyPolicies_Merge(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+	loadMergePolicies(ts)
+
+	mw := &BaseMiddleware{Gw: ts.Gw}
+
+	t.Run("inherited", func(t *testing.T) {
+		session := &user.SessionState{}
+		session.SetPolicies("gold")
+		require.NoError(t, mw.ApplyPolicies(session))
+
+		assert.Equal(t, 500.0, session.Rate)
+		assert.Equal(t, int64(1000), session.QuotaMax)
+		assert.Len(t, session.AccessRights, 2)
+		assert.Equal(t, "gold", session.MetaData["tier"])
+		require.NotNil(t, session.Group)
+		assert.Equal(t, int64(10000), session.Group.QuotaMax)
+	})
+
+	t.Run("composed", func(t *testing.T) {
+		session := &user.SessionState{}
+		session.SetPolicies("gold", "capped")
+		require.NoError(t, mw.ApplyPolicies(session))
+
+		assert.Equal(t, 10.0, session.Rate)
+		assert.Equal(t, int64(1000), session.QuotaMax)
+		require.Len(t, session.AccessRights, 1)
+		assert.Equal(t, []string{"v1"}, session.AccessRights["a"].Versions)
+		assert.Equal(t, 10.0, session.AccessRights["a"].Limit.Rate)
+	})
+
+	t.Run("implicit", func(t *testing.T) {
+		session := &user.SessionState{}
+		session.SetPolicies("base", "implicit")
+		require.NoError(t, mw.ApplyPolicies(session))
+
+		assert.Equal(t, 1000.0, session.Rate)
+	})
+
+	t.Run("composition errors", func(t *testing.T) {
+		session := &user.SessionState{}
+		session.SetPolicies("capped", "orphan")
+		assert.ErrorIs(t, mw.ApplyPolicies(session), errPolicyNotFound)
+	})
+}
+
+func TestEffectivePolicyHandler(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+	loadMergePolicies(ts)
+
+	resp, err := ts.Run(t, test.TestCase{Path: "/tyk/policies/gold,capped/effective", AdminAuth: true, Code: http.StatusOK})
+	require.NoError(t, err)
+
+	var effective effectivePolicy
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&effective))
+	assert.Equal(t, "gold+capped", effective.Policy.ID)
+	assert.False(t, effective.Implicit)
+	assert.Equal(t, 10.0, effective.Policy.Rate)
+	assert.Equal(t, "capped", effective.Sources["rate"])
+	assert.Equal(t, "base", effective.Sources["quota_max"])
+	assert.Equal(t, "capped", effective.Sources["access_rights.a"])
+	assert.NotContains(t, effective.Sources, "access_rights.b")
+
+	resp, err = ts.Run(t, test.TestCase{Path: "/tyk/policies/base,implicit/effective", AdminAuth: true, Code: http.StatusOK})
+	require.NoError(t, err)
+	effective = effectivePolicy{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&effective))
+	assert.True(t, effective.Implicit)
+	assert.Equal(t, "implicit", effective.Sources["rate"])
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/tyk/policies/gold,missing/effective", AdminAuth: true, Code: http.StatusNotFound},
+		{Path: "/tyk/policies/loop1/effective", AdminAuth: true, Code: http.StatusBadRequest},
+		{Path: "/tyk/policies/gold,other/effective", AdminAuth: true, Code: http.StatusBadRequest},
+	}...)
+}
@@ -0,0 +1,196 @@
+package gateway
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	scheduleTimeLayout = "15:04"
+	scheduleDateLayout = "2006-01-02"
+)
+
+var scheduleDays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// scheduleLocations caches the time zones of the schedules and quota renewals, they're loaded from the file system.
+var scheduleLocations sync.Map
+
+func scheduleLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := scheduleLocations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	scheduleLocations.Store(name, loc)
+	return loc, nil
+}
+
+// scheduleMinutes returns the minutes since midnight of a time of day, or def when it's empty.
+func scheduleMinutes(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	t, err := time.Parse(scheduleTimeLayout, value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// scheduleName names a schedule in the sources of an effective policy.
+func scheduleName(pol user.Policy, i int) string {
+	name := pol.Schedules[i].Name
+	if name == "" {
+		name = strconv.Itoa(i)
+	}
+	return pol.ID + "#" + name
+}
+
+// scheduleWindow is the time window of a policy schedule, parsed as the policy is loaded.
+type scheduleWindow struct {
+	loc *time.Location
+	// from and to are minutes since midnight
+	from, to int
+	days     [7]bool
+	// start and end are the first and the day after the last day of the schedule, when set
+	start, end time.Time
+}
+
+// compileSchedule parses the time window of a policy schedule.
+func compileSchedule(schedule user.PolicySchedule) (w scheduleWindow, err error) {
+	if w.loc, err = scheduleLocation(schedule.Timezone); err != nil {
+		return w, err
+	}
+	if w.from, err = scheduleMinutes(schedule.From, 0); err != nil {
+		return w, err
+	}
+	if w.to, err = scheduleMinutes(schedule.To, 24*60); err != nil {
+		return w, err
+	}
+
+	for _, day := range schedule.Days {
+		weekday, ok := scheduleDays[strings.ToLower(day)]
+		if !ok {
+			return w, fmt.Errorf("unknown day %q", day)
+		}
+		w.days[weekday] = true
+	}
+	if len(schedule.Days) == 0 {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+	}
+
+	if schedule.StartDate != "" {
+		if w.start, err = time.ParseInLocation(scheduleDateLayout, schedule.StartDate, w.loc); err != nil {
+			return w, err
+		}
+	}
+	if schedule.EndDate != "" {
+		if w.end, err = time.ParseInLocation(scheduleDateLayout, schedule.EndDate, w.loc); err != nil {
+			return w, err
+		}
+		w.end = w.end.AddDate(0, 0, 1)
+	}
+	return w, nil
+}
+
+// active tells if the window is active at a time.
+func (w scheduleWindow) active(at time.Time) bool {
+	at = at.In(w.loc)
+	if (!w.start.IsZero() && at.Before(w.start)) || (!w.end.IsZero() && !at.Before(w.end)) {
+		return false
+	}
+
+	minutes := at.Hour()*60 + at.Minute()
+	if w.from < w.to {
+		return w.days[at.Weekday()] && minutes >= w.from && minutes < w.to
+	}
+	// the window spans midnight, it's active until to on the day after it starts
+	yesterday := at.AddDate(0, 0, -1).Weekday()
+	return (w.days[at.Weekday()] && minutes >= w.from) || (w.days[yesterday] && minutes < w.to)
+}
+
+// compilePolicySchedules checks the schedules of a policy and parses their time windows.
+func compilePolicySchedules(pol user.Policy) ([]scheduleWindow, error) {
+	if len(pol.Schedules) == 0 {
+		return nil, nil
+	}
+
+	windows := make([]scheduleWindow, len(pol.Schedules))
+	for i, schedule := range pol.Schedules {
+		w, err := compileSchedule(schedule)
+		if err != nil {
+			return nil, fmt.Errorf("policy schedule %s: %w", scheduleName(pol, i), err)
+		}
+		if schedule.QuotaMultiplier < 0 {
+			return nil, fmt.Errorf("policy schedule %s: negative quota multiplier", scheduleName(pol, i))
+		}
+		windows[i] = w
+	}
+	return windows, nil
+}
+
+// validatePolicySchedules checks the time windows of the schedules of a policy.
+func validatePolicySchedules(pol user.Policy) error {
+	_, err := compilePolicySchedules(pol)
+	return err
+}
+
+// schedule applies the schedules of the policy active at a time, the values they change are supplied by them. The
+// windows are the time windows of the schedules.
+func (p *effectivePolicy) schedule(windows []scheduleWindow, at time.Time) {
+	pol := p.Policy
+	for i, schedule := range pol.Schedules {
+		if !windows[i].active(at) {
+			continue
+		}
+		source := scheduleName(pol, i)
+
+		limits := user.Policy{
+			Rate:               schedule.Rate,
+			Per:                schedule.Per,
+			QuotaMax:           schedule.QuotaMax,
+			QuotaRenewalRate:   schedule.QuotaRenewalRate,
+			ThrottleInterval:   schedule.ThrottleInterval,
+			ThrottleRetryLimit: schedule.ThrottleRetryLimit,
+			MaxQueryDepth:      schedule.MaxQueryDepth,
+		}
+		scheduled := policyLimits(&limits)
+		for field, limit := range policyLimits(&p.Policy) {
+			if mergeLimit(user.MergeOverride, limit, scheduled[field]) {
+				p.Sources[field] = source
+			}
+		}
+
+		if schedule.QuotaMultiplier > 0 && p.Policy.QuotaMax > 0 {
+			p.Policy.QuotaMax = int64(float64(p.Policy.QuotaMax) * schedule.QuotaMultiplier)
+			p.Sources["quota_max"] = source
+		}
+
+		for apiID, ad := range schedule.AccessRights {
+			if prev, ok := p.Policy.AccessRights[apiID]; ok {
+				ad = mergeAccessDefinition(user.MergeUnion, prev, ad)
+			}
+			p.Policy.AccessRights[apiID] = ad
+			p.Sources["access_rights."+apiID] = source
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestScheduleActive(t *testing.T) {
+	businessHours := user.PolicySchedule{Days: []string{"mon", "tue", "wed", "thu", "fri"}, From: "09:00", To: "18:00"}
+	newYork := businessHours
+	newYork.Timezone = "America/New_York"
+	weekendNights := user.PolicySchedule{Days: []string{"Fri", "Sat"}, From: "22:00", To: "06:00"}
+	promotion := user.PolicySchedule{StartDate: "2024-01-05", EndDate: "2024-01-07"}
+
+	// 2024-01-01 is a Monday
+	at := func(value string) time.Time {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	tests := []struct {
+		name     string
+		schedule user.PolicySchedule
+		at       time.Time
+		active   bool
+	}{
+		{"business hours", businessHours, at("2024-01-01T10:00:00Z"), true},
+		{"business hours end", businessHours, at("2024-01-01T18:00:00Z"), false},
+		{"business hours weekend", businessHours, at("2024-01-06T10:00:00Z"), false},
+		{"time zone", newYork, at("2024-01-01T14:30:00Z"), true},
+		{"time zone before", newYork, at("2024-01-01T10:00:00Z"), false},
+		{"time zone evening", newYork, at("2024-01-01T22:30:00Z"), true},
+		{"overnight start", weekendNights, at("2024-01-05T23:00:00Z"), true},
+		{"overnight next day", weekendNights, at("2024-01-07T03:00:00Z"), true},
+		{"overnight end", weekendNights, at("2024-01-07T06:00:00Z"), false},
+		{"overnight other day", weekendNights, at("2024-01-04T23:00:00Z"), false},
+		{"dates", promotion, at("2024-01-07T23:59:00Z"), true},
+		{"before dates", promotion, at("2024-01-04T23:59:00Z"), false},
+		{"after dates", promotion, at("2024-01-08T00:00:00Z"), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			window, err := compileSchedule(tc.schedule)
+			require.NoError(t, err)
+			assert.Equal(t, tc.active, window.active(tc.at))
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, schedule := range []user.PolicySchedule{
+			{Days: []string{"someday"}},
+			{Timezone: "Nowhere/Town"},
+			{From: "9am"},
+			{EndDate: "07/01/2024"},
+		} {
+			_, err := compileSchedule(schedule)
+			assert.Error(t, err)
+		}
+
+		pol := user.Policy{ID: "p", Schedules: []user.PolicySchedule{{Name: "nights", To: "25:00"}}}
+		err := validatePolicySchedules(pol)
+		assert.ErrorContains(t, err, "policy schedule p#nights")
+
+		// policies with invalid schedules aren't loaded
+		pols := map[string]user.Policy{"p": pol, "valid": {ID: "valid", Schedules: []user.PolicySchedule{{From: "09:00"}}}}
+		schedules := validatePolicies(pols)
+		assert.NotContains(t, pols, "p")
+		assert.Len(t, schedules["valid"], 1)
+	})
+}
+
+func TestApplyPolicies_Schedules(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	ts.Gw.policiesMu.Lock()
+	ts.Gw.policiesByID = map[string]user.Policy{
+		"scheduled": {
+			ID:       "scheduled",
+			OrgID:    "default",
+			Rate:     10,
+			Per:      60,
+			QuotaMax: 100,
+			AccessRights: map[string]user.AccessDefinition{
+				"api": {APIID: "api", Versions: []string{"v1"}},
+			},
+			Schedules: []user.PolicySchedule{
+				{Name: "promotion", QuotaMultiplier: 2},
+				{Name: "always", Rate: 50},
+				{
+					Name:         "maintenance",
+					EndDate:      "2000-01-01",
+					AccessRights: map[string]user.AccessDefinition{"admin": {APIID: "admin", Versions: []string{"v1"}}},
+				},
+			},
+		},
+	}
+	ts.Gw.policiesMu.Unlock()
+
+	session := &user.SessionState{}
+	session.SetPolicies("scheduled")
+	require.NoError(t, (&BaseMiddleware{Gw: ts.Gw}).ApplyPolicies(session))
+
+	assert.Equal(t, int64(200), session.QuotaMax)
+	assert.Equal(t, 50.0, session.Rate)
+	assert.Equal(t, 60.0, session.Per)
+	assert.NotContains(t, session.AccessRights, "admin")
+
+	resp, err := ts.Run(t, test.TestCase{Path: "/tyk/policies/scheduled/effective?at=1999-12-31T12:00:00Z", AdminAuth: true, Code: http.StatusOK})
+	require.NoError(t, err)
+
+	var effective effectivePolicy
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&effective))
+	assert.Contains(t, effective.Policy.AccessRights, "admin")
+	assert.Equal(t, "scheduled#maintenance", effective.Sources["access_rights.admin"])
+	assert.Equal(t, "scheduled#promotion", effective.Sources["quota_max"])
+	assert.Equal(t, "scheduled#always", effective.Sources["rate"])
+	assert.Equal(t, "scheduled", effective.Sources["per"])
+
+	_, _ = ts.Run(t, test.TestCase{Path: "/tyk/policies/scheduled/effective?at=yesterday", AdminAuth: true, Code: http.StatusBadRequest})
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/TykTechnologies/storage/persistent/model"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/TykTechnologies/graphql-go-tools/pkg/graphql"
 	"github.com/TykTechnologies/tyk/apidef"
@@ -1665,3 +1666,30 @@ func Test_LoadPoliciesFromRPC(t *testing.T) {
 		assert.Equal(t, 1, len(polMap), "expected 0 policies to be loaded from RPC")
 	})
 }
+
+func TestApplyPolicies_Group(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	setPolicy := func(group *user.GroupLimit) {
+		ts.Gw.policiesMu.Lock()
+		ts.Gw.policiesByID = map[string]user.Policy{
+			"grouped": {ID: "grouped", OrgID: "default", Rate: 10, Per: 60, Group: group},
+		}
+		ts.Gw.policiesMu.Unlock()
+	}
+
+	session := &user.SessionState{}
+	session.SetPolicies("grouped")
+	mw := &BaseMiddleware{Gw: ts.Gw}
+
+	setPolicy(&user.GroupLimit{ID: "$tyk_meta.app_id", QuotaMax: 100, QuotaRenewalRate: 60})
+	require.NoError(t, mw.ApplyPolicies(session))
+	require.NotNil(t, session.Group)
+	assert.Equal(t, int64(100), session.Group.QuotaMax)
+
+	// the group removed from the policy is removed from the key
+	setPolicy(nil)
+	require.NoError(t, mw.ApplyPolicies(session))
+	assert.Nil(t, session.Group)
+}
@@ -0,0 +1,265 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+var errCreditsUnlimited = errors.New("the quota of the key is unlimited")
+
+// quotaCharge is the charge of a request to the quotas: its cost, and the quota counters it's been counted in.
+type quotaCharge struct {
+	// Cost is counted in the quotas instead of 1.
+	Cost int64
+	// Header is the response header the upstream may set to the actual cost of the request.
+	Header string
+
+	// Keys and Expires are the quota counters charged and their renewal rates, the counter of the key first.
+	Keys    []string
+	Expires []int64
+	// QuotaMax and Used are of the quota of the key, once charged, and Credits is the counter of its prepaid credits.
+	QuotaMax int64
+	Used     int64
+	Credits  string
+	// Prepaid tells the cost was drawn from the prepaid credits, the quota of the key being used up.
+	Prepaid bool
+}
+
+// cost returns the cost of a request, 1 when the quotas aren't weighted.
+func (c *quotaCharge) cost() int64 {
+	if c == nil {
+		return 1
+	}
+	return c.Cost
+}
+
+func (c *quotaCharge) add(rawKey string, expire int64) {
+	if c == nil {
+		return
+	}
+	c.Keys = append(c.Keys, rawKey)
+	c.Expires = append(c.Expires, expire)
+}
+
+func (c *quotaCharge) count(quotaMax, used int64, credits string, prepaid bool) {
+	if c == nil {
+		return
+	}
+	c.QuotaMax = quotaMax
+	c.Used = used
+	c.Credits = credits
+	c.Prepaid = prepaid
+}
+
+// adjust charges the quota counters, or the prepaid credits, with the actual cost of the request.
+func (c *quotaCharge) adjust(store storage.Handler, cost int64) error {
+	delta := cost - c.Cost
+	if delta == 0 || (len(c.Keys) == 0 && !c.Prepaid) {
+		return nil
+	}
+
+	incrementer, ok := store.(rawKeysIncrementer)
+	if !ok {
+		return errors.New("the store doesn't support weighted quotas")
+	}
+	if len(c.Keys) > 0 {
+		values, err := incrementer.IncrementRawKeysWithExpire(c.Keys, delta, c.Expires)
+		if err != nil {
+			return err
+		}
+		if c.QuotaMax > 0 && !c.Prepaid {
+			c.Used = values[0]
+		}
+	}
+	if c.Prepaid {
+		// the credits may go below zero, the next top up pays the difference
+		if _, err := incrementer.IncrementRawKeysWithExpire([]string{c.Credits}, -delta, []int64{0}); err != nil {
+			return err
+		}
+	}
+	c.Cost = cost
+	return nil
+}
+
+// balance returns what's left of the quota of the key after the charge, its prepaid credits included.
+func (c *quotaCharge) balance(store storage.Handler) int64 {
+	balance := c.QuotaMax - c.Used
+	if balance < 0 {
+		balance = 0
+	}
+	return balance + keyCredits(store, c.Credits)
+}
+
+// keyCreditsCounter returns the counter of the prepaid credits of a quota counter of a key. Unlike the quota counter,
+// it never expires.
+func keyCreditsCounter(quotaCounter string) string {
+	return CreditsKeyPrefix + strings.TrimPrefix(quotaCounter, QuotaKeyPrefix)
+}
+
+// keyCredits returns the prepaid credits left in a counter.
+func keyCredits(store storage.Handler, counter string) int64 {
+	if counter == "" {
+		return 0
+	}
+	value, err := store.GetRawKey(counter)
+	if err != nil {
+		return 0
+	}
+	credits, _ := strconv.ParseInt(value, 10, 64)
+	return credits
+}
+
+// apiCreditBalance is the balance of the quota of a key: the requests, or the credits spent by costly requests,
+// it has left in the period and in its prepaid credits.
+type apiCreditBalance struct {
+	Key      string `json:"key"`
+	APIID    string `json:"api_id,omitempty"`
+	QuotaMax int64  `json:"quota_max"`
+	Used     int64  `json:"used"`
+	Credits  int64  `json:"credits"`
+	Balance  int64  `json:"balance"`
+}
+
+// apiCreditTopUp adds prepaid credits to the quota of a key, they're spent once the quota of a period is used up.
+type apiCreditTopUp struct {
+	Amount int64  `json:"amount"`
+	APIID  string `json:"api_id"`
+}
+
+// keyCreditLimit returns the quota of a key for an API, or the global quota of the key, and its counter.
+func (gw *Gateway) keyCreditLimit(keyID string, session *user.SessionState, apiID string) (user.APILimit, string, error) {
+	limit := user.APILimit{
+		QuotaMax:             session.QuotaMax,
+		QuotaRenewalRate:     session.QuotaRenewalRate,
+		QuotaRenewalMode:     session.QuotaRenewalMode,
+		QuotaRenewalTimezone: session.QuotaRenewalTimezone,
+	}
+	scope := ""
+	if apiID != "" {
+		acl, ok := session.AccessRights[apiID]
+		if !ok {
+			return limit, "", errors.New("the key has no access to the API")
+		}
+		if !acl.Limit.IsEmpty() {
+			limit = acl.Limit
+			scope = acl.AllowanceScope
+		}
+	}
+
+	if limit.QuotaMax <= 0 {
+		return limit, "", errCreditsUnlimited
+	}
+	return limit, keyQuotaCounter(keyID, scope), nil
+}
+
+func (gw *Gateway) keyCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	keyName := mux.Vars(r)["keyName"]
+	isHashed := r.URL.Query().Get("hashed") != ""
+	orgID := r.URL.Query().Get("org_id")
+
+	if isHashed && !gw.GetConfig().HashKeys {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Key requested by hash but key hashing is not enabled"))
+		return
+	}
+
+	apiID := r.URL.Query().Get("api_id")
+	var topUp apiCreditTopUp
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&topUp); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+			return
+		}
+		if topUp.Amount <= 0 {
+			doJSONWrite(w, http.StatusBadRequest, apiError("The amount of credits must be positive"))
+			return
+		}
+		apiID = topUp.APIID
+	}
+
+	session, found := gw.GlobalSessionManager.SessionDetail(orgID, keyName, isHashed)
+	if !found {
+		doJSONWrite(w, http.StatusNotFound, apiError("Key not found"))
+		return
+	}
+	keyID := session.KeyID
+	if !isHashed {
+		keyID = storage.HashKey(keyID, gw.GetConfig().HashKeys)
+	}
+
+	limit, rawKey, err := gw.keyCreditLimit(keyID, &session, apiID)
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	}
+
+	store := gw.GlobalSessionManager.Store()
+	if r.Method == http.MethodPost {
+		incrementer, ok := store.(rawKeysIncrementer)
+		if !ok {
+			doJSONWrite(w, http.StatusNotImplemented, apiError("Credits can't be added with this storage"))
+			return
+		}
+		// the credits outlive the periods of the quota, their counter never expires
+		if _, err := incrementer.IncrementRawKeysWithExpire([]string{keyCreditsCounter(rawKey)}, topUp.Amount, []int64{0}); err != nil {
+			log.WithError(err).Error("Failed to add credits")
+			doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to add credits"))
+			return
+		}
+
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"key":    gw.obfuscateKey(keyID),
+			"amount": topUp.Amount,
+			"status": "ok",
+		}).Info("Added credits to key.")
+	}
+
+	balance := &quotaCharge{QuotaMax: limit.QuotaMax, Credits: keyCreditsCounter(rawKey)}
+	if value, err := store.GetRawKey(rawKey); err == nil {
+		balance.Used, _ = strconv.ParseInt(value, 10, 64)
+	}
+
+	doJSONWrite(w, http.StatusOK, apiCreditBalance{
+		Key:      keyName,
+		APIID:    apiID,
+		QuotaMax: limit.QuotaMax,
+		Used:     balance.Used,
+		Credits:  keyCredits(store, balance.Credits),
+		Balance:  balance.balance(store),
+	})
+}
+
+// moveKeyCredits moves the prepaid credits of the quotas of a key to another key.
+func moveKeyCredits(store storage.Handler, fromKeyID, toKeyID string, session *user.SessionState) {
+	incrementer, ok := store.(rawKeysIncrementer)
+	if !ok {
+		return
+	}
+	for _, scope := range keyQuotaScopes(session) {
+		from := keyCreditsCounter(keyQuotaCounter(fromKeyID, scope))
+		if credits := keyCredits(store, from); credits != 0 {
+			to := keyCreditsCounter(keyQuotaCounter(toKeyID, scope))
+			if _, err := incrementer.IncrementRawKeysWithExpire([]string{to}, credits, []int64{0}); err != nil {
+				log.WithError(err).Error("Failed to move the credits of a key")
+				continue
+			}
+			store.DeleteRawKey(from)
+		}
+	}
+}
+
+// deleteKeyCredits deletes the prepaid credits of the quotas of a key.
+func deleteKeyCredits(store storage.Handler, keyID string, session *user.SessionState) {
+	for _, scope := range keyQuotaScopes(session) {
+		store.DeleteRawKey(keyCreditsCounter(keyQuotaCounter(keyID, scope)))
+	}
+}
@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestRequestCosts(t *testing.T) {
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.Monitor.MonitorUserKeys = true
+		globalConf.Monitor.GlobalTriggerLimit = 80
+	})
+	defer ts.Close()
+
+	events := make(chan config.EventMessage, 10)
+	ts.Gw.MonitoringHandler = &testEventHandler{cb: func(em config.EventMessage) {
+		if em.Type != EventCreditBalanceLow {
+			return
+		}
+		select {
+		case events <- em:
+		default:
+		}
+	}}
+
+	ts.AddDynamicHandler("/dynamic", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Cost", "3")
+	})
+	ts.AddDynamicHandler("/reported", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Cost", "2")
+	})
+
+	api := ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.UseKeylessAccess = false
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.Costs = []apidef.CostMeta{
+				{Path: "/export", Method: http.MethodGet, Cost: 10},
+				{Path: "/free", Method: http.MethodGet, Cost: 0},
+				{Path: "/dynamic", Method: http.MethodGet, Cost: 1, ResponseHeader: "X-Cost"},
+				{Path: "/reported", Method: http.MethodGet, Cost: 0, ResponseHeader: "X-Cost"},
+			}
+		})
+	})[0]
+
+	_, key := ts.CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{
+			api.APIID: {APIName: api.Name, APIID: api.APIID},
+		}
+		s.QuotaMax = 25
+		s.QuotaRenewalRate = 60
+	})
+	authHeaders := map[string]string{header.Authorization: key}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/export", Headers: authHeaders, Code: http.StatusOK},
+		{Path: "/export", Headers: authHeaders, Code: http.StatusOK},
+		// the rejected charge isn't counted
+		{Path: "/export", Headers: authHeaders, Code: http.StatusForbidden},
+		{Path: "/free", Headers: authHeaders, Code: http.StatusOK},
+		{Path: "/dynamic", Headers: authHeaders, Code: http.StatusOK, HeadersNotMatch: map[string]string{"X-Cost": "3"}},
+		// without a base cost the request is still charged what the upstream reports
+		{Path: "/reported", Headers: authHeaders, Code: http.StatusOK},
+	}...)
+
+	select {
+	case em := <-events:
+		meta, ok := em.Meta.(EventCreditBalanceLowMeta)
+		require.True(t, ok)
+		assert.Equal(t, int64(80), meta.TriggerLimit)
+		assert.Equal(t, int64(5), meta.Balance)
+	case <-time.After(time.Second):
+		t.Fatal("low balance event not fired")
+	}
+
+	balance := func(tc test.TestCase) apiCreditBalance {
+		t.Helper()
+		tc.Path = "/tyk/keys/" + key + "/credits"
+		tc.AdminAuth = true
+		tc.Code = http.StatusOK
+
+		resp, err := ts.Run(t, tc)
+		require.NoError(t, err)
+
+		var balance apiCreditBalance
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&balance))
+		return balance
+	}
+
+	current := balance(test.TestCase{Method: http.MethodGet})
+	assert.Equal(t, int64(25), current.Used)
+	assert.Equal(t, int64(0), current.Credits)
+	assert.Equal(t, int64(0), current.Balance)
+
+	current = balance(test.TestCase{Method: http.MethodPost, Data: apiCreditTopUp{Amount: 10}})
+	assert.Equal(t, int64(10), current.Credits)
+	assert.Equal(t, int64(10), current.Balance)
+
+	// the quota is used up, the request is paid with the credits
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/export", Headers: authHeaders, Code: http.StatusOK},
+		{Path: "/export", Headers: authHeaders, Code: http.StatusForbidden},
+	}...)
+
+	current = balance(test.TestCase{Method: http.MethodGet})
+	assert.Equal(t, int64(25), current.Used)
+	assert.Equal(t, int64(0), current.Credits)
+
+	t.Run("credits survive the renewal of the quota", func(t *testing.T) {
+		balance(test.TestCase{Method: http.MethodPost, Data: apiCreditTopUp{Amount: 10}})
+
+		// the period counter expires with the period
+		rawKey := keyQuotaCounter(storage.HashKey(key, ts.Gw.GetConfig().HashKeys), "")
+		ts.Gw.GlobalSessionManager.Store().DeleteRawKey(rawKey)
+
+		current := balance(test.TestCase{Method: http.MethodGet})
+		assert.Equal(t, int64(0), current.Used)
+		assert.Equal(t, int64(10), current.Credits)
+		assert.Equal(t, int64(35), current.Balance)
+
+		// the quota of the new period is spent before the credits
+		_, _ = ts.Run(t, []test.TestCase{
+			{Path: "/export", Headers: authHeaders, Code: http.StatusOK},
+			{Path: "/export", Headers: authHeaders, Code: http.StatusOK},
+		}...)
+		current = balance(test.TestCase{Method: http.MethodGet})
+		assert.Equal(t, int64(20), current.Used)
+		assert.Equal(t, int64(10), current.Credits)
+
+		_, _ = ts.Run(t, []test.TestCase{
+			{Path: "/export", Headers: authHeaders, Code: http.StatusOK},
+			{Path: "/export", Headers: authHeaders, Code: http.StatusForbidden},
+		}...)
+		current = balance(test.TestCase{Method: http.MethodGet})
+		assert.Equal(t, int64(20), current.Used)
+		assert.Equal(t, int64(0), current.Credits)
+		assert.Equal(t, int64(5), current.Balance)
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/tyk/keys/" + key + "/credits", Data: apiCreditTopUp{Amount: -1}, AdminAuth: true, Code: http.StatusBadRequest},
+		{Method: http.MethodPost, Path: "/tyk/keys/" + key + "/credits", Data: apiCreditTopUp{Amount: 1, APIID: "other"}, AdminAuth: true, Code: http.StatusBadRequest},
+		{Path: "/tyk/keys/missing/credits", AdminAuth: true, Code: http.StatusNotFound},
+	}...)
+}
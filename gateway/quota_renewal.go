@@ -0,0 +1,99 @@
+package gateway
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// quotaPeriodEnd returns the calendar boundary a quota renewed by mode renews at after now: the next top of the hour,
+// midnight or first of the month in the time zone, UTC by default. The boundaries follow the wall clock of the time
+// zone, a day may last 23 or 25 hours across a DST change.
+func quotaPeriodEnd(mode user.QuotaRenewalMode, timezone string, now time.Time) (time.Time, error) {
+	loc, err := scheduleLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid quota renewal time zone %q: %w", timezone, err)
+	}
+	now = now.In(loc)
+
+	var end time.Time
+	switch mode {
+	case user.QuotaRenewalHourly:
+		// the rest of the hour is added to the instant, the hour repeated when the clocks go back renews too
+		sinceHour := time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second + time.Duration(now.Nanosecond())
+		end = now.Add(time.Hour - sinceHour)
+	case user.QuotaRenewalDaily:
+		end = startOfDay(now.Year(), now.Month(), now.Day()+1, loc)
+	case user.QuotaRenewalMonthly:
+		end = startOfDay(now.Year(), now.Month()+1, 1, loc)
+	default:
+		return time.Time{}, fmt.Errorf("invalid quota renewal mode %q", mode)
+	}
+	return end, nil
+}
+
+// startOfDay returns the time a day starts in a time zone: midnight, or the time the clocks go forward to when a DST
+// change skips midnight.
+func startOfDay(year int, month time.Month, day int, loc *time.Location) time.Time {
+	start := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	// time.Date normalises a skipped midnight to the evening before
+	noon := time.Date(year, month, day, 12, 0, 0, 0, loc)
+	for start.Day() != noon.Day() {
+		start = start.Add(time.Hour)
+	}
+	return start
+}
+
+// validateQuotaRenewal checks the renewal mode and time zone of a quota.
+func validateQuotaRenewal(mode user.QuotaRenewalMode, timezone string) error {
+	if mode == user.QuotaRenewalRolling {
+		return nil
+	}
+	_, err := quotaPeriodEnd(mode, timezone, time.Now())
+	return err
+}
+
+// quotaRenewal returns the TTL of the counter of a quota starting a period now, in seconds, and the time the period
+// ends. A rolling quota renews QuotaRenewalRate seconds after its first use, a calendar one on the next boundary.
+func quotaRenewal(limit *user.APILimit, now time.Time) (expire, renews int64) {
+	if limit.QuotaRenewalMode == user.QuotaRenewalRolling {
+		return limit.QuotaRenewalRate, now.Unix() + limit.QuotaRenewalRate
+	}
+
+	end, err := quotaPeriodEnd(limit.QuotaRenewalMode, limit.QuotaRenewalTimezone, now)
+	if err != nil {
+		log.WithError(err).Warning("Quota renewed with its renewal rate")
+		return limit.QuotaRenewalRate, now.Unix() + limit.QuotaRenewalRate
+	}
+	return int64(math.Ceil(end.Sub(now).Seconds())), end.Unix()
+}
+
+// sessionQuotaRenews returns the time the quota of a session starting a period now renews.
+func sessionQuotaRenews(session *user.SessionState) int64 {
+	_, renews := quotaRenewal(&user.APILimit{
+		QuotaRenewalRate:     session.QuotaRenewalRate,
+		QuotaRenewalMode:     session.QuotaRenewalMode,
+		QuotaRenewalTimezone: session.QuotaRenewalTimezone,
+	}, time.Now())
+	return renews
+}
+
+// validateQuotaRenewals checks the renewal of the quotas of a key or a policy, of its group and of its access rights.
+func validateQuotaRenewals(mode user.QuotaRenewalMode, timezone string, group *user.GroupLimit, accessRights map[string]user.AccessDefinition) error {
+	if err := validateQuotaRenewal(mode, timezone); err != nil {
+		return err
+	}
+	if group != nil {
+		if err := validateQuotaRenewal(group.QuotaRenewalMode, group.QuotaRenewalTimezone); err != nil {
+			return fmt.Errorf("group: %w", err)
+		}
+	}
+	for apiID, ad := range accessRights {
+		if err := validateQuotaRenewal(ad.Limit.QuotaRenewalMode, ad.Limit.QuotaRenewalTimezone); err != nil {
+			return fmt.Errorf("API %s: %w", apiID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestQuotaPeriodEnd(t *testing.T) {
+	at := func(value string) time.Time {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	tests := []struct {
+		name     string
+		mode     user.QuotaRenewalMode
+		timezone string
+		now      time.Time
+		end      time.Time
+	}{
+		{"hourly", user.QuotaRenewalHourly, "", at("2024-01-01T10:15:30Z"), at("2024-01-01T11:00:00Z")},
+		{"hourly half hour offset", user.QuotaRenewalHourly, "Asia/Kolkata", at("2024-01-01T10:15:00Z"), at("2024-01-01T10:30:00Z")},
+		// 01:30 EDT, the next hour is 01:00 EST
+		{"hourly clocks back", user.QuotaRenewalHourly, "America/New_York", at("2024-11-03T05:30:00Z"), at("2024-11-03T06:00:00Z")},
+		{"daily", user.QuotaRenewalDaily, "UTC", at("2024-01-01T23:59:59Z"), at("2024-01-02T00:00:00Z")},
+		{"daily time zone", user.QuotaRenewalDaily, "America/New_York", at("2024-01-02T03:00:00Z"), at("2024-01-02T05:00:00Z")},
+		// the day the clocks go forward lasts 23 hours, the day they go back 25
+		{"daily clocks forward", user.QuotaRenewalDaily, "America/New_York", at("2024-03-10T05:00:00Z"), at("2024-03-11T04:00:00Z")},
+		{"daily clocks back", user.QuotaRenewalDaily, "America/New_York", at("2024-11-03T04:00:00Z"), at("2024-11-04T05:00:00Z")},
+		// midnight is skipped, the day starts at 01:00
+		{"daily skipped midnight", user.QuotaRenewalDaily, "America/Santiago", at("2024-09-07T16:00:00Z"), at("2024-09-08T04:00:00Z")},
+		{"monthly", user.QuotaRenewalMonthly, "", at("2024-01-31T12:00:00Z"), at("2024-02-01T00:00:00Z")},
+		{"monthly summer time", user.QuotaRenewalMonthly, "Europe/London", at("2024-03-15T12:00:00Z"), at("2024-03-31T23:00:00Z")},
+		{"monthly new year", user.QuotaRenewalMonthly, "Europe/London", at("2024-12-31T23:59:59Z"), at("2025-01-01T00:00:00Z")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			end, err := quotaPeriodEnd(tc.mode, tc.timezone, tc.now)
+			require.NoError(t, err)
+			assert.True(t, tc.end.Equal(end), "expected %s, got %s", tc.end, end)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		assert.Error(t, validateQuotaRenewal("weekly", ""))
+		assert.Error(t, validateQuotaRenewal(user.QuotaRenewalDaily, "Nowhere/Town"))
+		assert.NoError(t, validateQuotaRenewal(user.QuotaRenewalRolling, "Nowhere/Town"))
+
+		err := validateQuotaRenewals(user.QuotaRenewalRolling, "", nil, map[string]user.AccessDefinition{
+			"api": {Limit: user.APILimit{QuotaRenewalMode: "weekly"}},
+		})
+		assert.ErrorContains(t, err, "API api")
+
+		err = validateQuotaRenewals(user.QuotaRenewalRolling, "", &user.GroupLimit{QuotaRenewalMode: "weekly"}, nil)
+		assert.ErrorContains(t, err, "group")
+	})
+}
+
+func TestRedisQuotaExceeded_Calendar(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	store := &storage.RedisCluster{RedisController: ts.Gw.RedisController}
+	session := &user.SessionState{KeyID: "calendar-quota-key", QuotaMax: 2, QuotaRenewalMode: user.QuotaRenewalDaily}
+	limit := &user.APILimit{QuotaMax: 2, QuotaRenewalMode: user.QuotaRenewalDaily}
+	defer store.DeleteRawKey(quotaRawKey(session, "", false))
+
+	exceeded := func() bool {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		limit.QuotaRenews = session.QuotaRenews
+		return ts.Gw.SessionLimiter.RedisQuotaExceeded(r, session, "", limit, store, false)
+	}
+
+	assert.False(t, exceeded())
+	midnight, err := quotaPeriodEnd(user.QuotaRenewalDaily, "", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, midnight.Unix(), session.QuotaRenews)
+	assert.Equal(t, int64(1), session.QuotaRemaining)
+
+	ttl, err := store.GetKeyTTL(quotaRawKey(session, "", false))
+	require.NoError(t, err)
+	assert.InDelta(t, time.Until(midnight).Seconds(), ttl, 2)
+
+	assert.False(t, exceeded())
+	assert.True(t, exceeded())
+	assert.Equal(t, midnight.Unix(), session.QuotaRenews)
+}
+
+func TestQuotaRenewal_Keys(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	ts.Gw.policiesMu.Lock()
+	ts.Gw.policiesByID = map[string]user.Policy{
+		"monthly": {
+			ID:                   "monthly",
+			OrgID:                "default",
+			QuotaMax:             100,
+			QuotaRenewalRate:     3600,
+			QuotaRenewalMode:     user.QuotaRenewalMonthly,
+			QuotaRenewalTimezone: "Europe/London",
+		},
+	}
+	ts.Gw.policiesMu.Unlock()
+
+	session := &user.SessionState{}
+	session.SetPolicies("monthly")
+	require.NoError(t, (&BaseMiddleware{Gw: ts.Gw}).ApplyPolicies(session))
+	assert.Equal(t, user.QuotaRenewalMonthly, session.QuotaRenewalMode)
+	assert.Equal(t, "Europe/London", session.QuotaRenewalTimezone)
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/tyk/keys/create", Data: user.SessionState{QuotaRenewalMode: "weekly"}, AdminAuth: true, Code: http.StatusBadRequest},
+		{Method: http.MethodPost, Path: "/tyk/keys/calendar", Data: user.SessionState{QuotaRenewalMode: user.QuotaRenewalDaily, QuotaRenewalTimezone: "Nowhere/Town"}, AdminAuth: true, Code: http.StatusBadRequest},
+		{Method: http.MethodPost, Path: "/tyk/policies", Data: user.Policy{ID: "weekly", QuotaRenewalMode: "weekly"}, AdminAuth: true, Code: http.StatusBadRequest},
+	}...)
+}
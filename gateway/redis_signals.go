@@ -33,6 +33,7 @@ const (
 	NoticeGatewayConfigResponse  NotificationCommand = "NoticeGatewayConfigResponse"
 	NoticeGatewayDRLNotification NotificationCommand = "NoticeGatewayDRLNotification"
 	KeySpaceUpdateNotification   NotificationCommand = "KeySpaceUpdateNotification"
+	NoticeBundleReload           NotificationCommand = "BundleReload"
 )
 
 // Notification is a type that encodes a message published to a pub sub channel (shared between implementations)
@@ -130,6 +131,9 @@ func (gw *Gateway) handleRedisEvent(v interface{}, handled func(NotificationComm
 		gw.reloadURLStructure(reloaded)
 	case KeySpaceUpdateNotification:
 		gw.handleKeySpaceEventCacheFlush(notif.Payload)
+	case NoticeBundleReload:
+		pubSubLog.Info("Reloading bundle of API: ", notif.Payload)
+		go gw.handleBundleReload(notif.Payload)
 	default:
 		pubSubLog.Warnf("Unknown notification command: %q", notif.Command)
 		return
@@ -140,6 +144,19 @@ func (gw *Gateway) handleRedisEvent(v interface{}, handled func(NotificationComm
 	}
 }
 
+// handleBundleReload reloads the bundle of the API given as payload, when this gateway loads the API.
+func (gw *Gateway) handleBundleReload(apiID string) {
+	err := gw.reloadAPIBundle(apiID)
+	switch err {
+	case nil:
+		pubSubLog.Info("Reloaded bundle of API: ", apiID)
+	case errBundleReloadAPINotFound:
+		pubSubLog.Debug("API isn't loaded, skipping bundle reload: ", apiID)
+	default:
+		pubSubLog.WithError(err).Error("Couldn't reload bundle of API: ", apiID)
+	}
+}
+
 func (gw *Gateway) handleKeySpaceEventCacheFlush(payload string) {
 
 	keys := strings.Split(payload, ",")
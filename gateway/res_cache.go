@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 	"time"
@@ -38,7 +39,7 @@ func (h *ResponseCacheMiddleware) HandleError(rw http.ResponseWriter, req *http.
 }
 
 func (m *ResponseCacheMiddleware) EnabledForSpec() bool {
-	return m.spec.CacheOptions.EnableCache
+	return m.spec.CacheOptions.EnableCache || graphQLCacheEnabled(m.spec)
 }
 
 func (m *ResponseCacheMiddleware) getTimeTTL(cacheTTL int64) int64 {
@@ -77,6 +78,9 @@ func (m *ResponseCacheMiddleware) HandleResponse(w http.ResponseWriter, res *htt
 
 	cacheThisRequest := true
 	cacheTTL := m.spec.CacheOptions.CacheTimeout
+	if options.ttl > 0 {
+		cacheTTL = options.ttl
+	}
 
 	// make sure the status codes match if specified
 	if len(options.cacheOnlyResponseCodes) > 0 {
@@ -122,6 +126,14 @@ func (m *ResponseCacheMiddleware) HandleResponse(w http.ResponseWriter, res *htt
 			return nil
 		}
 
+		if options.graphQL {
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil || errorsInGraphQLResponse(body) {
+				m.Logger().Debug("GraphQL response carries errors, not caching")
+				return nil
+			}
+		}
+
 		var wireFormatReq bytes.Buffer
 		if err := res.Write(&wireFormatReq); err != nil {
 			m.Logger().WithError(err).Error("error encoding cache")
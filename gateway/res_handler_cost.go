@@ -0,0 +1,64 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// ResponseCostMiddleware charges the quotas with the actual cost of a request, reported by the upstream in a
+// response header.
+type ResponseCostMiddleware struct {
+	spec *APISpec
+	gw   *Gateway
+}
+
+func (ResponseCostMiddleware) Name() string {
+	return "ResponseCostMiddleware"
+}
+
+func (h *ResponseCostMiddleware) Init(c interface{}, spec *APISpec) error {
+	h.spec = spec
+	return nil
+}
+
+func (h *ResponseCostMiddleware) HandleError(rw http.ResponseWriter, req *http.Request) {
+}
+
+func (h *ResponseCostMiddleware) Logger() *logrus.Entry {
+	return log.WithField("mw", h.Name())
+}
+
+func (h *ResponseCostMiddleware) HandleResponse(rw http.ResponseWriter, res *http.Response, req *http.Request, ses *user.SessionState) error {
+	charge := ctxGetQuotaCharge(req)
+	if res == nil || charge == nil || charge.Header == "" {
+		return nil
+	}
+
+	value := res.Header.Get(charge.Header)
+	res.Header.Del(charge.Header)
+	if value == "" {
+		return nil
+	}
+
+	cost, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || cost < 0 {
+		h.Logger().WithField("cost", value).Warning("Invalid request cost reported by the upstream")
+		return nil
+	}
+
+	store := h.gw.GlobalSessionManager.Store()
+	before := charge.Cost
+	if err := charge.adjust(store, cost); err != nil {
+		h.Logger().WithError(err).Error("Couldn't charge the quotas with the request cost")
+		return nil
+	}
+
+	if ses != nil && cost > before && h.spec.GlobalConfig.Monitor.MonitorUserKeys {
+		h.gw.SessionMonitor.CheckBalance(ses, ctxGetAuthToken(req), charge.QuotaMax, charge.balance(store))
+	}
+	return nil
+}
@@ -18,6 +18,7 @@ type ResponseGoPluginMiddleware struct {
 	SymbolName string // function symbol to look up
 	logger     *logrus.Entry
 	Spec       *APISpec
+	Gw         *Gateway
 	ResHandler func(rw http.ResponseWriter, res *http.Response, req *http.Request)
 }
 
@@ -50,8 +51,20 @@ func (h *ResponseGoPluginMiddleware) Init(c interface{}, spec *APISpec) error {
 		h.Path = newPath
 	}
 
-	// try to load plugin
-	if h.ResHandler, err = goplugin.GetResponseHandler(h.Path, h.SymbolName); err != nil {
+	// plugins exporting an SDK registry are instantiated for the API
+	var inst *goPluginInstance
+	if h.Gw != nil {
+		inst, err = h.Gw.goPluginInstance(spec, h.Path, h.SymbolName)
+	}
+
+	switch {
+	case err != nil:
+	case inst != nil:
+		h.ResHandler, err = inst.responseHandler()
+	default:
+		h.ResHandler, err = goplugin.GetResponseHandler(h.Path, h.SymbolName)
+	}
+	if err != nil {
 		h.logger.WithError(err).Error("Could not load Go-plugin")
 		return err
 	}
@@ -381,6 +381,9 @@ type ReverseProxy struct {
 	logger *logrus.Entry
 	sp     sync.Pool
 	Gw     *Gateway `json:"-"`
+
+	// sseStreams holds the upstream event streams shared with SSE fan-out.
+	sseStreams sseStreams
 }
 
 func (p *ReverseProxy) defaultTransport(dialerTimeout float64) *http.Transport {
@@ -1214,6 +1217,11 @@ func (p *ReverseProxy) sendRequestToUpstream(roundTripper *TykRoundTripper, outr
 }
 
 func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Request, withCache bool) ProxyResponse {
+	// requests of the shared stream itself have an *sseStream writer
+	if _, shared := rw.(*sseStream); !shared && p.TykAPISpec.SSE.Enabled && p.TykAPISpec.SSE.FanOut.Enabled && isEventStreamRequest(req) {
+		return p.serveEventStreamFanOut(rw, req)
+	}
+
 	if trace.IsEnabled() {
 		span, ctx := trace.Span(req.Context(), req.URL.Path)
 		defer span.Finish()
@@ -1440,6 +1448,15 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 		return ProxyResponse{UpstreamLatency: upstreamLatency}
 	}
 
+	upstreamRes := res
+	if contentType := ctxGetGRPCWebContentType(req); contentType != "" {
+		res = grpcWebResponse(res, contentType)
+	}
+
+	if route := ctxGetGRPCTranscodingRoute(req); route != nil {
+		res = grpcTranscodedResponse(res, route)
+	}
+
 	upgrade, _ := p.IsUpgrade(req)
 	// Deal with 101 Switching Protocols responses: (WebSocket, h2c, etc)
 	if upgrade && res.StatusCode == 101 {
@@ -1471,7 +1488,8 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	if withCache {
 		*inres = *res // includes shallow copies of maps, but okay
 
-		if !upgrade {
+		// event streams can't be buffered, they may never end
+		if !upgrade && !(p.TykAPISpec.SSE.Enabled && isEventStream(res)) {
 			defer res.Body.Close()
 
 			// Buffer body data
@@ -1491,6 +1509,11 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	inres.StatusCode = res.StatusCode
 	inres.ContentLength = res.ContentLength
 	p.HandleResponse(rw, res, ses)
+
+	if p.TykAPISpec.GRPC.Enabled {
+		// trailers of the upstream response are only complete once the body was copied
+		inres.Trailer = grpcStatusTrailer(upstreamRes)
+	}
 	return ProxyResponse{UpstreamLatency: upstreamLatency, Response: inres}
 }
 
@@ -1523,6 +1546,7 @@ func (p *ReverseProxy) HandleResponse(rw http.ResponseWriter, res *http.Response
 		res.Header.Set(header.XRateLimitLimit, strconv.Itoa(int(quotaMax)))
 		res.Header.Set(header.XRateLimitRemaining, strconv.Itoa(int(quotaRemaining)))
 		res.Header.Set(header.XRateLimitReset, strconv.Itoa(int(quotaRenews)))
+		setKeyRotationHeaders(res.Header, ses)
 	}
 
 	copyHeader(rw.Header(), res.Header, p.Gw.GetConfig().IgnoreCanonicalMIMEHeaderKey)
@@ -1550,7 +1574,11 @@ func (p *ReverseProxy) HandleResponse(rw http.ResponseWriter, res *http.Response
 		}
 	}
 
-	p.CopyResponse(rw, res.Body, p.flushInterval(res))
+	if _, shared := rw.(*sseStream); !shared && p.TykAPISpec.SSE.Enabled && isEventStream(res) {
+		p.copyEventStream(rw, res.Body)
+	} else {
+		p.CopyResponse(rw, res.Body, p.flushInterval(res))
+	}
 
 	if len(res.Trailer) == announcedTrailers {
 		copyHeader(rw.Header(), res.Trailer, p.Gw.GetConfig().IgnoreCanonicalMIMEHeaderKey)
@@ -1682,9 +1710,15 @@ func (p *ReverseProxy) handleUpgradeResponse(rw http.ResponseWriter, req *http.R
 		return fmt.Errorf("response flush: %v", err)
 	}
 	errc := make(chan error, 1)
-	spc := switchProtocolCopier{user: conn, backend: backConn}
-	go spc.copyToBackend(errc)
-	go spc.copyFromBackend(errc)
+	if wsConn := ctxGetWebSocketConn(req); wsConn != nil {
+		// frames the client sent along with the handshake may be buffered already
+		wsConn.serve(errc, conn, brw.Reader, backConn)
+		defer wsConn.stop()
+	} else {
+		spc := switchProtocolCopier{user: conn, backend: backConn}
+		go spc.copyToBackend(errc)
+		go spc.copyFromBackend(errc)
+	}
 	<-errc
 
 	res.Body = ioutil.NopCloser(strings.NewReader(""))
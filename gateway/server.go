@@ -145,6 +145,8 @@ type Gateway struct {
 
 	policiesMu   sync.RWMutex
 	policiesByID map[string]user.Policy
+	// policySchedules are the time windows of the schedules of the policies, by policy ID.
+	policySchedules map[string][]scheduleWindow
 
 	dnsCacheManager dnscache.IDnsCacheManager
 
@@ -182,12 +184,25 @@ type Gateway struct {
 	TestBundles  map[string]map[string]string
 	TestBundleMu sync.Mutex
 
+	// goPlugins holds the instances of SDK Go plugins, reused when their API is reloaded.
+	goPlugins goPluginInstances
+
+	// webhooks holds the webhook handlers by ID, for the dead-letter endpoints of the control API.
+	webhooks webhookHandlers
+
 	templates    *template.Template
 	templatesRaw *textTemplate.Template
 
 	// RedisController keeps track of redis connection and singleton
 	RedisController *storage.RedisController
-	hostDetails     hostDetails
+
+	keyIndex     *keyIndex
+	keyRotations *keyRotations
+
+	// auditLog records the changes made through the control API, it's nil when the audit log is disabled.
+	auditLog *auditLog
+
+	hostDetails hostDetails
 
 	healthCheckInfo atomic.Value
 
@@ -243,6 +258,9 @@ func NewGateway(config config.Config, ctx context.Context) *Gateway {
 	gw.TestBundles = map[string]map[string]string{}
 
 	gw.RedisController = storage.NewRedisController(ctx)
+	gw.keyIndex = newKeyIndex(gw.RedisController)
+	gw.keyRotations = newKeyRotations(gw.RedisController)
+	sessionManager.index = gw.keyIndex
 
 	return &gw
 }
@@ -411,6 +429,19 @@ func (gw *Gateway) setupGlobals() {
 	mainNotifierStore.Connect()
 	gw.MainNotifier = RedisNotifier{mainNotifierStore, RedisPubSubChannel, gw}
 
+	if gwConfig.AuditLog.Enabled {
+		auditLog, err := newAuditLog(gwConfig.AuditLog, gw.RedisController)
+		if err != nil {
+			mainLog.WithError(err).Error("Couldn't open the audit log")
+		} else {
+			gw.auditLog = auditLog
+			go func() {
+				<-gw.ctx.Done()
+				auditLog.Close()
+			}()
+		}
+	}
+
 	if gwConfig.Monitor.EnableTriggerMonitors {
 		h := &WebHookHandler{Gw: gw}
 		if err := h.Init(gwConfig.Monitor.Config); err != nil {
@@ -563,6 +594,7 @@ func (gw *Gateway) syncPolicies() (count int, err error) {
 			pols = LoadPoliciesFromFile(gw.GetConfig().Policies.PolicyRecordName)
 		}
 	}
+	schedules := validatePolicies(pols)
 	mainLog.Infof("Policies found (%d total):", len(pols))
 	for id := range pols {
 		mainLog.Debugf(" - %s", id)
@@ -572,6 +604,7 @@ func (gw *Gateway) syncPolicies() (count int, err error) {
 	defer gw.policiesMu.Unlock()
 	if len(pols) > 0 {
 		gw.policiesByID = pols
+		gw.policySchedules = schedules
 	}
 
 	return len(pols), err
@@ -642,11 +675,14 @@ func (gw *Gateway) loadControlAPIEndpoints(muxer *mux.Router) {
 	}
 
 	r.MethodNotAllowedHandler = MethodNotAllowedHandler{}
+	r.Use(gw.auditControlAPI(r), gw.authorizeControlAPI)
 
 	mainLog.Info("Initialising Tyk REST API Endpoints")
 
 	// set up main API handlers
 	r.HandleFunc("/reload/group", gw.groupResetHandler).Methods("GET")
+	r.HandleFunc("/reload/group/bundle/{apiID}", gw.groupBundleReloadHandler).Methods("GET")
+	r.HandleFunc("/reload/bundle/{apiID}", gw.bundleReloadHandler).Methods("GET")
 	r.HandleFunc("/reload", gw.resetHandler(nil)).Methods("GET")
 
 	if !gw.isRPCMode() {
@@ -675,6 +711,7 @@ func (gw *Gateway) loadControlAPIEndpoints(muxer *mux.Router) {
 		r.HandleFunc("/health", gw.healthCheckhandler).Methods("GET")
 		r.HandleFunc("/policies", gw.polHandler).Methods("GET", "POST", "PUT", "DELETE")
 		r.HandleFunc("/policies/{polID}", gw.polHandler).Methods("GET", "POST", "PUT", "DELETE")
+		r.HandleFunc("/policies/{polID}/effective", gw.effectivePolicyHandler).Methods("GET")
 		r.HandleFunc("/oauth/clients/create", gw.createOauthClient).Methods("POST")
 		r.HandleFunc("/oauth/clients/{apiID}/{keyName:[^/]*}", gw.oAuthClientHandler).Methods("PUT")
 		r.HandleFunc("/oauth/clients/{apiID}/{keyName:[^/]*}/rotate", gw.rotateOauthClientHandler).Methods("PUT")
@@ -689,9 +726,18 @@ func (gw *Gateway) loadControlAPIEndpoints(muxer *mux.Router) {
 
 	r.HandleFunc("/debug", gw.traceHandler).Methods("POST")
 	r.HandleFunc("/cache/{apiID}", gw.invalidateCacheHandler).Methods("DELETE")
+	r.HandleFunc("/webhooks", gw.webhooksHandler).Methods(http.MethodGet)
+	r.HandleFunc("/webhooks/{webhookID}/dead-letters", gw.webhookDeadLettersHandler).Methods(http.MethodGet)
+	r.HandleFunc("/webhooks/{webhookID}/dead-letters/replay", gw.webhookReplayHandler).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks/{webhookID}/dead-letters/{deliveryID}", gw.webhookDeadLetterDeleteHandler).Methods(http.MethodDelete)
+	r.HandleFunc("/webhooks/{webhookID}/dead-letters/{deliveryID}/replay", gw.webhookReplayHandler).Methods(http.MethodPost)
 	r.HandleFunc("/keys", gw.keyHandler).Methods("POST", "PUT", "GET", "DELETE")
 	r.HandleFunc("/keys/preview", gw.previewKeyHandler).Methods("POST")
+	r.HandleFunc("/keys/index/rebuild", gw.keyIndexRebuildHandler).Methods(http.MethodPost)
+	r.HandleFunc("/keys/bulk", gw.bulkKeysHandler).Methods(http.MethodPost)
 	r.HandleFunc("/keys/{keyName:[^/]*}", gw.keyHandler).Methods("POST", "PUT", "GET", "DELETE")
+	r.HandleFunc("/keys/{keyName}/rotate", gw.rotateKeyHandler).Methods(http.MethodPost)
+	r.HandleFunc("/keys/{keyName}/credits", gw.keyCreditsHandler).Methods(http.MethodGet, http.MethodPost)
 	r.HandleFunc("/certs", gw.certHandler).Methods("POST", "GET")
 	r.HandleFunc("/certs/{certID:[^/]*}", gw.certHandler).Methods("POST", "GET", "DELETE")
 	r.HandleFunc("/oauth/clients/{apiID}", gw.oAuthClientHandler).Methods("GET", "DELETE")
@@ -712,11 +758,16 @@ func (gw *Gateway) checkIsAPIOwner(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tykAuthKey := r.Header.Get(header.XTykAuthorization)
 		if tykAuthKey != secret {
-			// Error
-			mainLog.Warning("Attempted administrative access with invalid or missing key!")
+			// the named credentials are limited to their scopes, checked by the router
+			credential := gw.controlAPICredential(r)
+			if credential == nil {
+				// Error
+				mainLog.Warning("Attempted administrative access with invalid or missing key!")
 
-			doJSONWrite(w, http.StatusForbidden, apiError("Attempted administrative access with invalid or missing key!"))
-			return
+				doJSONWrite(w, http.StatusForbidden, apiError("Attempted administrative access with invalid or missing key!"))
+				return
+			}
+			ctxSetControlAPICredential(r, credential)
 		}
 		next.ServeHTTP(w, r)
 	})
@@ -764,7 +815,7 @@ func (gw *Gateway) addOAuthHandlers(spec *APISpec, muxer *mux.Router) *OAuthMana
 	oauthManager := OAuthManager{spec, osinServer, gw}
 	oauthHandlers := OAuthHandlers{oauthManager}
 
-	muxer.Handle(apiAuthorizePath, gw.checkIsAPIOwner(allowMethods(oauthHandlers.HandleGenerateAuthCodeData, "POST")))
+	muxer.Handle(apiAuthorizePath, gw.checkIsAPIOwner(gw.requireControlAPIScope("oauth", controlAPIWrite, allowMethods(oauthHandlers.HandleGenerateAuthCodeData, "POST"))))
 	muxer.HandleFunc(clientAuthPath, allowMethods(oauthHandlers.HandleAuthorizePassthrough, "GET", "POST"))
 	muxer.HandleFunc(clientAccessPath, addSecureAndCacheHeaders(allowMethods(oauthHandlers.HandleAccessRequest, "GET", "POST")))
 	muxer.HandleFunc(revokeToken, oauthHandlers.HandleRevokeToken)
@@ -891,7 +942,7 @@ func (gw *Gateway) createResponseMiddlewareChain(spec *APISpec, responseFuncs []
 	// Prealloc size
 	chainLen := len(spec.ResponseProcessors)
 	// Append capacity
-	chainCapacity := chainLen + 1 + len(responseFuncs)
+	chainCapacity := chainLen + 2 + len(responseFuncs)
 
 	responseChain := make([]TykResponseHandler, chainLen, chainCapacity)
 
@@ -929,6 +980,13 @@ func (gw *Gateway) createResponseMiddlewareChain(spec *APISpec, responseFuncs []
 		responseChain = append(responseChain, processor)
 	}
 
+	// Charge the quotas with the cost reported by the upstream before the response is cached
+	costProcessor := &ResponseCostMiddleware{gw: gw}
+	if err := costProcessor.Init(nil, spec); err != nil {
+		mainLog.WithError(err).Debug("Failed to init processor")
+	}
+	responseChain = append(responseChain, costProcessor)
+
 	keyPrefix := "cache-" + spec.APIID
 	cacheStore := &storage.RedisCluster{KeyPrefix: keyPrefix, IsCache: true, RedisController: gw.RedisController}
 	cacheStore.Connect()
@@ -1357,6 +1415,14 @@ func (gw *Gateway) afterConfSetup() {
 		log.Fatalf("could not retrieve the secret key.. %v", err)
 	}
 
+	for i := range conf.Security.ControlAPICredentials {
+		credential := &conf.Security.ControlAPICredentials[i]
+		credential.Token, err = gw.kvStore(credential.Token)
+		if err != nil {
+			log.Fatalf("could not retrieve the token of the %s control API credential.. %v", credential.Name, err)
+		}
+	}
+
 	conf.NodeSecret, err = gw.kvStore(conf.NodeSecret)
 	if err != nil {
 		log.Fatalf("could not retrieve the NodeSecret key.. %v", err)
@@ -1727,6 +1793,7 @@ func (gw *Gateway) start() {
 	// interval counts from the start of one reload to the next.
 	go gw.reloadLoop(time.Tick(time.Second))
 	go gw.reloadQueueLoop()
+	go gw.keyRotationLoop(gw.ctx)
 }
 
 func dashboardServiceInit(gw *Gateway) {
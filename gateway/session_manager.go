@@ -3,7 +3,9 @@ package gateway
 import (
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/TykTechnologies/leakybucket"
@@ -28,6 +30,7 @@ type PublicSession struct {
 
 const (
 	QuotaKeyPrefix     = "quota-"
+	CreditsKeyPrefix   = "credits-"
 	RateLimitKeyPrefix = "rate-limit-"
 )
 
@@ -255,26 +258,120 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 		return false
 	}
 
-	quotaScope := ""
-	if scope != "" {
-		quotaScope = scope + "-"
+	charge := ctxGetQuotaCharge(r)
+	cost := charge.cost()
+	if cost == 0 {
+		// free endpoint
+		return false
+	}
+
+	rawKey := quotaRawKey(currentSession, scope, hashKeys)
+	expire, _ := quotaRenewal(limit, time.Now())
+
+	log.Debug("[QUOTA] Quota limiter key is: ", rawKey)
+	log.Debug("Renewing with TTL: ", expire)
+	// INCR the key (If it equals the cost - set EXPIRE)
+	qInt := countQuota(store, rawKey, cost, expire)
+
+	if l.quotaCounterExceeded(r, currentSession, scope, limit, store, rawKey, qInt, cost) {
+		prepaid := spendCredits(store, keyCreditsCounter(rawKey), cost)
+		if cost > 1 || prepaid {
+			// the counter is left at the quota max, the requests which cost less can still be made
+			uncountQuota(store, []string{rawKey}, cost)
+		}
+		if !prepaid {
+			return true
+		}
+		charge.count(limit.QuotaMax, qInt-cost, keyCreditsCounter(rawKey), true)
+		return false
+	}
+
+	charge.add(rawKey, expire)
+	charge.count(limit.QuotaMax, qInt, keyCreditsCounter(rawKey), false)
+	return false
+}
+
+// spendCredits draws the cost of a request over its quota from the prepaid credits in a counter, it tells if there
+// were enough credits left.
+func spendCredits(store storage.Handler, counter string, cost int64) bool {
+	incrementer, ok := store.(rawKeysIncrementer)
+	if !ok || keyCredits(store, counter) < cost {
+		return false
+	}
+	values, err := incrementer.IncrementRawKeysWithExpire([]string{counter}, -cost, []int64{0})
+	if err != nil {
+		return false
+	}
+	if values[0] < 0 {
+		// another request spent them first
+		refundCredits(store, counter, cost)
+		return false
 	}
+	return true
+}
+
+// refundCredits gives back the prepaid credits spent by a request which wasn't made.
+func refundCredits(store storage.Handler, counter string, cost int64) {
+	incrementer, ok := store.(rawKeysIncrementer)
+	if !ok {
+		return
+	}
+	if _, err := incrementer.IncrementRawKeysWithExpire([]string{counter}, cost, []int64{0}); err != nil {
+		log.WithError(err).Warning("Couldn't refund the credits of a rejected request")
+	}
+}
 
+// countQuota increments a quota counter by the cost of a request.
+func countQuota(store storage.Handler, rawKey string, cost, expire int64) int64 {
+	if cost == 1 {
+		return store.IncrememntWithExpire(rawKey, expire)
+	}
+
+	if incrementer, ok := store.(rawKeysIncrementer); ok {
+		values, err := incrementer.IncrementRawKeysWithExpire([]string{rawKey}, cost, []int64{expire})
+		if err != nil {
+			return 0
+		}
+		return values[0]
+	}
+
+	var qInt int64
+	for i := int64(0); i < cost; i++ {
+		qInt = store.IncrememntWithExpire(rawKey, expire)
+	}
+	return qInt
+}
+
+// uncountQuota decrements quota counters by the cost of a rejected request.
+func uncountQuota(store storage.Handler, rawKeys []string, cost int64) {
+	incrementer, ok := store.(rawKeysIncrementer)
+	if !ok {
+		return
+	}
+	if err := incrementer.DecrementRawKeys(rawKeys, cost); err != nil {
+		log.WithError(err).Warning("Couldn't uncount a request rejected by a quota")
+	}
+}
+
+// quotaRawKey returns the key of the quota counter of a session.
+func quotaRawKey(currentSession *user.SessionState, scope string, hashKeys bool) string {
 	key := currentSession.KeyID
 
 	if hashKeys {
 		key = storage.HashStr(currentSession.KeyID)
 	}
 
-	rawKey := QuotaKeyPrefix + quotaScope + key
+	return keyQuotaCounter(key, scope)
+}
+
+// quotaCounterExceeded tells if the quota counter of a session, incremented by the cost of a request, exceeds its
+// quota, and updates the remaining quota of the session.
+func (l *SessionLimiter) quotaCounterExceeded(r *http.Request, currentSession *user.SessionState, scope string, limit *user.APILimit, store storage.Handler, rawKey string, qInt, cost int64) bool {
 	quotaRenewalRate := limit.QuotaRenewalRate
 	quotaRenews := limit.QuotaRenews
+	rolling := limit.QuotaRenewalMode == user.QuotaRenewalRolling
 	quotaMax := limit.QuotaMax
 
-	log.Debug("[QUOTA] Quota limiter key is: ", rawKey)
-	log.Debug("Renewing with TTL: ", quotaRenewalRate)
-	// INCR the key (If it equals 1 - set EXPIRE)
-	qInt := store.IncrememntWithExpire(rawKey, quotaRenewalRate)
 	// if the returned val is >= quota: block
 	if qInt-1 >= quotaMax {
 		renewalDate := time.Unix(quotaRenews, 0)
@@ -285,14 +382,14 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 		if time.Now().After(renewalDate) {
 			//for renew quota = never, once we get the quota max we must not allow using it again
 
-			if quotaRenewalRate <= 0 {
+			if rolling && quotaRenewalRate <= 0 {
 				return true
 			}
 			// The renewal date is in the past, we should update the quota!
 			// Also, this fixes legacy issues where there is no TTL on quota buckets
 			log.Debug("Incorrect key expiry setting detected, correcting")
 			go store.DeleteRawKey(rawKey)
-			qInt = 1
+			qInt = cost
 		} else {
 			// Renewal date is in the future and the quota is exceeded
 			return true
@@ -301,9 +398,12 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 	}
 
 	// If this is a new Quota period, ensure we let the end user know
-	if qInt == 1 {
-		quotaRenews = time.Now().Unix() + quotaRenewalRate
+	if qInt == cost {
+		_, quotaRenews = quotaRenewal(limit, time.Now())
 		ctxScheduleSessionUpdate(r)
+	} else if !rolling {
+		// the period ends on the next boundary whenever it started
+		_, quotaRenews = quotaRenewal(limit, time.Now())
 	}
 
 	// If not, pass and set the values of the session to quotamax - counter
@@ -332,6 +432,205 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 	return false
 }
 
+const (
+	limitLevelKey   = "key"
+	limitLevelGroup = "group"
+	limitLevelOrg   = "org"
+)
+
+// rawKeysIncrementer is implemented by the stores which increment several counters at once, by any amount.
+type rawKeysIncrementer interface {
+	IncrementRawKeysWithExpire(keys []string, by int64, expires []int64) ([]int64, error)
+	DecrementRawKeys(keys []string, by int64) error
+}
+
+// groupRateLocks serialise the rate limit checks of the requests of a group, a lock is shared by the groups hashed to it.
+var groupRateLocks [64]sync.Mutex
+
+// groupRateLock returns the lock serialising the rate limit checks of the requests of a group.
+func groupRateLock(groupKey string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(groupKey))
+	return &groupRateLocks[h.Sum32()%uint32(len(groupRateLocks))]
+}
+
+// groupQuotaRawKey returns the key of the quota counter of a group.
+func groupQuotaRawKey(group *user.SessionState) string {
+	return QuotaKeyPrefix + group.KeyID
+}
+
+// quotaCounter is a quota counter charged by a request, of its key, group or organisation.
+type quotaCounter struct {
+	level   string
+	session *user.SessionState
+	scope   string
+	limit   *user.APILimit
+	rawKey  string
+	expire  int64
+}
+
+// ForwardGroupMessage enforces the limits of a key together with the limits of its group and the quota of its
+// organisation, either of which may be nil, the group being a session keyed by its ID. The rate limits of the key and
+// the group are checked then counted one request of the group at a time, and the quotas are counted in one
+// transaction: a request rejected by one of the limits isn't counted against the others. It returns the level of the
+// limit exceeded, key, group or org. A dry run only checks the rate limits.
+func (l *SessionLimiter) ForwardGroupMessage(r *http.Request, currentSession *user.SessionState, key string, group, orgSession *user.SessionState, store storage.Handler, enableRL, enableQ bool, globalConf *config.Config, api *APISpec, dryRun bool) (sessionFailReason, string) {
+	if reason, level := l.limitGroupRate(r, currentSession, key, group, store, enableRL, globalConf, api, dryRun); reason != sessionFailNone {
+		return reason, level
+	}
+	if !enableQ || dryRun {
+		return sessionFailNone, ""
+	}
+
+	accessDef, allowanceScope, err := GetAccessDefinitionByAPIIDOrSession(currentSession, api)
+	if err != nil {
+		return sessionFailQuota, limitLevelKey
+	}
+	if globalConf.LegacyEnableAllowanceCountdown {
+		currentSession.Allowance = currentSession.Allowance - 1
+	}
+
+	charge := ctxGetQuotaCharge(r)
+	cost := charge.cost()
+	if cost == 0 {
+		// free endpoint
+		return sessionFailNone, ""
+	}
+
+	// the counter of the key comes first, like in the charge of the request
+	var counters []quotaCounter
+	if accessDef.Limit.QuotaMax > 0 {
+		counters = append(counters, quotaCounter{
+			level:   limitLevelKey,
+			session: currentSession,
+			scope:   allowanceScope,
+			limit:   &accessDef.Limit,
+			rawKey:  quotaRawKey(currentSession, allowanceScope, globalConf.HashKeys),
+		})
+	}
+	if group != nil && group.QuotaMax > 0 {
+		counters = append(counters, quotaCounter{
+			level:   limitLevelGroup,
+			session: group,
+			limit: &user.APILimit{
+				QuotaMax:             group.QuotaMax,
+				QuotaRenewalRate:     group.QuotaRenewalRate,
+				QuotaRenewalMode:     group.QuotaRenewalMode,
+				QuotaRenewalTimezone: group.QuotaRenewalTimezone,
+			},
+			rawKey: groupQuotaRawKey(group),
+		})
+	}
+	if orgSession != nil {
+		if orgDef, orgScope, err := GetAccessDefinitionByAPIIDOrSession(orgSession, api); err == nil && orgDef.Limit.QuotaMax > 0 {
+			counters = append(counters, quotaCounter{
+				level:   limitLevelOrg,
+				session: orgSession,
+				scope:   orgScope,
+				limit:   &orgDef.Limit,
+				rawKey:  quotaRawKey(orgSession, orgScope, globalConf.HashKeys),
+			})
+		}
+	}
+	if len(counters) == 0 {
+		return sessionFailNone, ""
+	}
+
+	now := time.Now()
+	keys := make([]string, len(counters))
+	expires := make([]int64, len(counters))
+	for i := range counters {
+		counters[i].expire, _ = quotaRenewal(counters[i].limit, now)
+		keys[i], expires[i] = counters[i].rawKey, counters[i].expire
+	}
+
+	var values []int64
+	if incrementer, ok := store.(rawKeysIncrementer); ok {
+		values, err = incrementer.IncrementRawKeysWithExpire(keys, cost, expires)
+		if err != nil {
+			// like IncrememntWithExpire, the quotas aren't enforced while the store is down
+			return sessionFailNone, ""
+		}
+	} else {
+		// the counters can't be incremented at once
+		for i := range keys {
+			values = append(values, countQuota(store, keys[i], cost, expires[i]))
+		}
+	}
+
+	prepaid := false
+	for i, counter := range counters {
+		var exceeded bool
+		if counter.level == limitLevelGroup {
+			// the group session only lives for the request, the counter expires with its period
+			exceeded = values[i]-1 >= counter.limit.QuotaMax
+		} else {
+			exceeded = l.quotaCounterExceeded(r, counter.session, counter.scope, counter.limit, store, keys[i], values[i], cost)
+		}
+		if !exceeded {
+			continue
+		}
+		if counter.level == limitLevelKey && spendCredits(store, keyCreditsCounter(keys[i]), cost) {
+			// the request is paid with the prepaid credits of the key instead of its quota
+			prepaid = true
+			uncountQuota(store, keys[i:i+1], cost)
+			continue
+		}
+
+		// the counters checked before over their quota without a TTL have been deleted
+		var counted []string
+		for j := range keys {
+			if j >= i || (values[j]-1 < counters[j].limit.QuotaMax && !(prepaid && counters[j].level == limitLevelKey)) {
+				counted = append(counted, keys[j])
+			}
+		}
+		uncountQuota(store, counted, cost)
+		if prepaid {
+			refundCredits(store, keyCreditsCounter(keys[0]), cost)
+		}
+		return sessionFailQuota, counter.level
+	}
+
+	for i, counter := range counters {
+		if counter.level != limitLevelKey {
+			charge.add(keys[i], expires[i])
+			continue
+		}
+		if prepaid {
+			charge.count(counter.limit.QuotaMax, values[i]-cost, keyCreditsCounter(keys[i]), true)
+			continue
+		}
+		charge.add(keys[i], expires[i])
+		charge.count(counter.limit.QuotaMax, values[i], keyCreditsCounter(keys[i]), false)
+	}
+	return sessionFailNone, ""
+}
+
+// limitGroupRate enforces the rate limits of a key and of its group. The requests of a group are checked then counted
+// one at a time, a request rejected by one of the limits isn't counted by the other one.
+func (l *SessionLimiter) limitGroupRate(r *http.Request, currentSession *user.SessionState, key string, group *user.SessionState, store storage.Handler, enableRL bool, globalConf *config.Config, api *APISpec, dryRun bool) (sessionFailReason, string) {
+	groupRL := group != nil && enableRL && group.Rate > 0 && group.Per > 0
+	if groupRL && !dryRun {
+		lock := groupRateLock(group.KeyID)
+		lock.Lock()
+		defer lock.Unlock()
+
+		if reason, level := l.limitGroupRate(r, currentSession, key, group, store, enableRL, globalConf, api, true); reason != sessionFailNone {
+			return reason, level
+		}
+	}
+
+	if reason := l.ForwardMessage(r, currentSession, key, store, enableRL, false, globalConf, api, dryRun); reason != sessionFailNone {
+		return reason, limitLevelKey
+	}
+	if groupRL {
+		if reason := l.ForwardMessage(r, group, group.KeyID, store, true, false, globalConf, api, dryRun); reason != sessionFailNone {
+			return reason, limitLevelGroup
+		}
+	}
+	return sessionFailNone, ""
+}
+
 func GetAccessDefinitionByAPIIDOrSession(currentSession *user.SessionState, api *APISpec) (accessDef *user.AccessDefinition, allowanceScope string, err error) {
 	accessDef = &user.AccessDefinition{}
 	if len(currentSession.AccessRights) > 0 {
@@ -348,14 +647,16 @@ func GetAccessDefinitionByAPIIDOrSession(currentSession *user.SessionState, api
 	}
 	if accessDef.Limit.IsEmpty() {
 		accessDef.Limit = user.APILimit{
-			QuotaMax:           currentSession.QuotaMax,
-			QuotaRenewalRate:   currentSession.QuotaRenewalRate,
-			QuotaRenews:        currentSession.QuotaRenews,
-			Rate:               currentSession.Rate,
-			Per:                currentSession.Per,
-			ThrottleInterval:   currentSession.ThrottleInterval,
-			ThrottleRetryLimit: currentSession.ThrottleRetryLimit,
-			MaxQueryDepth:      currentSession.MaxQueryDepth,
+			QuotaMax:             currentSession.QuotaMax,
+			QuotaRenewalRate:     currentSession.QuotaRenewalRate,
+			QuotaRenewalMode:     currentSession.QuotaRenewalMode,
+			QuotaRenewalTimezone: currentSession.QuotaRenewalTimezone,
+			QuotaRenews:          currentSession.QuotaRenews,
+			Rate:                 currentSession.Rate,
+			Per:                  currentSession.Per,
+			ThrottleInterval:     currentSession.ThrottleInterval,
+			ThrottleRetryLimit:   currentSession.ThrottleRetryLimit,
+			MaxQueryDepth:        currentSession.MaxQueryDepth,
 		}
 	}
 
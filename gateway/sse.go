@@ -0,0 +1,438 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/internal/sse"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	sseHeartbeat = ": heartbeat\n\n"
+
+	// sseSubscriberBuffer is the number of events queued for a fan-out client,
+	// clients falling further behind are disconnected and resume with Last-Event-ID.
+	sseSubscriberBuffer = 64
+)
+
+// isEventStream reports whether the response is a Server-Sent Events stream.
+func isEventStream(res *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get(header.ContentType))
+	return mediaType == header.TextEventStream
+}
+
+// isEventStreamRequest reports whether the request asks for a Server-Sent Events stream.
+func isEventStreamRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.Contains(r.Header.Get(header.Accept), header.TextEventStream)
+}
+
+// copyEventStream forwards the events of an upstream stream to the client, flushing after each event.
+func (p *ReverseProxy) copyEventStream(rw http.ResponseWriter, body io.Reader) {
+	events := make(chan []byte)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(events)
+
+		reader := sse.NewReader(body)
+		for {
+			event, err := reader.ReadEvent()
+			if err != nil {
+				return
+			}
+
+			select {
+			case events <- event.Raw:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	p.serveEventStream(rw, events, nil)
+}
+
+// serveEventStream writes events to the client until the events channel is closed, the client
+// goes away or the connection reached its lifetime. Heartbeats are sent while no events arrive.
+func (p *ReverseProxy) serveEventStream(rw http.ResponseWriter, events <-chan []byte, clientGone <-chan struct{}) {
+	flusher, _ := rw.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	// send the headers right away, the first event may take a while
+	flush()
+
+	config := p.TykAPISpec.SSE
+
+	var heartbeat *time.Ticker
+	var heartbeats <-chan time.Time
+	if config.HeartbeatInterval > 0 {
+		heartbeat = time.NewTicker(time.Duration(config.HeartbeatInterval) * time.Second)
+		defer heartbeat.Stop()
+		heartbeats = heartbeat.C
+	}
+
+	var lifetime <-chan time.Time
+	if config.MaxConnectionLifetime > 0 {
+		timer := time.NewTimer(time.Duration(config.MaxConnectionLifetime) * time.Second)
+		defer timer.Stop()
+		lifetime = timer.C
+	}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if _, err := rw.Write(event); err != nil {
+				return
+			}
+			flush()
+
+			if heartbeat != nil {
+				heartbeat.Reset(time.Duration(config.HeartbeatInterval) * time.Second)
+			}
+		case <-heartbeats:
+			if _, err := io.WriteString(rw, sseHeartbeat); err != nil {
+				return
+			}
+			flush()
+		case <-lifetime:
+			// the client reconnects with the Last-Event-ID of the last event it received
+			return
+		case <-clientGone:
+			return
+		}
+	}
+}
+
+// sseChannel returns the fan-out channel of a request. Channels are per key unless the API shares them,
+// so that the events of one key's upstream stream aren't sent to another.
+func (p *ReverseProxy) sseChannel(r *http.Request) string {
+	channel := r.URL.Path + "?" + r.URL.RawQuery
+	for _, name := range p.TykAPISpec.SSE.FanOut.ChannelHeaders {
+		channel += "\n" + name + ": " + r.Header.Get(name)
+	}
+
+	if !p.TykAPISpec.SSE.FanOut.SharedChannels {
+		if token := ctxGetAuthToken(r); token != "" {
+			channel += "\nkey: " + storage.HashStr(token)
+		}
+	}
+
+	return channel
+}
+
+// serveEventStreamFanOut serves the client from the upstream stream of its channel,
+// opening the stream when the channel has no clients yet.
+func (p *ReverseProxy) serveEventStreamFanOut(rw http.ResponseWriter, req *http.Request) ProxyResponse {
+	channel := p.sseChannel(req)
+
+	stream, events, replay := p.sseStreams.join(channel, req.Header.Get(header.LastEventID), func() *sseStream {
+		return p.openEventStream(req, channel)
+	})
+	defer p.sseStreams.leave(stream, events)
+
+	select {
+	case <-stream.responded:
+	case <-req.Context().Done():
+		return ProxyResponse{}
+	}
+
+	res := &http.Response{
+		StatusCode: stream.status,
+		Header:     stream.responseHeader.Clone(),
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+
+	// the rate limit headers of the client opening the stream don't apply to the others
+	res.Header.Del(header.XRateLimitLimit)
+	res.Header.Del(header.XRateLimitRemaining)
+	res.Header.Del(header.XRateLimitReset)
+
+	copyHeader(rw.Header(), res.Header, p.Gw.GetConfig().IgnoreCanonicalMIMEHeaderKey)
+
+	if !stream.streaming {
+		// other responses aren't shared beyond the clients that waited for them
+		select {
+		case <-stream.done:
+		case <-req.Context().Done():
+			return ProxyResponse{}
+		}
+
+		rw.WriteHeader(stream.status)
+		_, _ = rw.Write(stream.body.Bytes())
+		return ProxyResponse{Response: res}
+	}
+
+	rw.WriteHeader(stream.status)
+	for _, event := range replay {
+		if _, err := rw.Write(event.Raw); err != nil {
+			return ProxyResponse{Response: res}
+		}
+	}
+
+	p.serveEventStream(rw, events, req.Context().Done())
+
+	return ProxyResponse{Response: res}
+}
+
+// openEventStream proxies the request to the upstream on behalf of all clients of the channel.
+// The upstream request outlives the client opening it, it's cancelled once the last client left.
+func (p *ReverseProxy) openEventStream(req *http.Request, channel string) *sseStream {
+	ctx, cancel := context.WithCancel(detachedContext{req.Context()})
+
+	originReq := req.Clone(ctx)
+	// the shared stream starts now, clients resume from the replay buffer instead
+	originReq.Header.Del(header.LastEventID)
+
+	pr, pw := io.Pipe()
+	stream := &sseStream{
+		channel:     channel,
+		replaySize:  p.TykAPISpec.SSE.FanOut.ReplayBufferSize,
+		header:      make(http.Header),
+		responded:   make(chan struct{}),
+		done:        make(chan struct{}),
+		broadcasted: make(chan struct{}),
+		subscribers: make(map[chan []byte]struct{}),
+		cancel:      cancel,
+		pw:          pw,
+	}
+
+	go stream.broadcast(pr)
+	go func() {
+		defer p.sseStreams.remove(stream)
+		defer stream.finish()
+		p.WrappedServeHTTP(stream, originReq, false)
+	}()
+
+	return stream
+}
+
+// detachedContext keeps the values of a context without its cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+// sseStreams holds the upstream streams shared by the clients of each channel.
+type sseStreams struct {
+	mu      sync.Mutex
+	streams map[string]*sseStream
+}
+
+// join subscribes to the stream of the channel, opening it when there is none. The events
+// following lastEventID in the replay buffer are returned for the client to catch up.
+func (s *sseStreams) join(channel, lastEventID string, open func() *sseStream) (*sseStream, chan []byte, []sse.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.streams == nil {
+		s.streams = make(map[string]*sseStream)
+	}
+
+	stream, ok := s.streams[channel]
+	if !ok {
+		stream = open()
+		s.streams[channel] = stream
+	}
+
+	events, replay := stream.subscribe(lastEventID)
+	return stream, events, replay
+}
+
+// leave unsubscribes from the stream, which is closed once the last client left.
+func (s *sseStreams) leave(stream *sseStream, events chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stream.unsubscribe(events) > 0 {
+		return
+	}
+
+	if s.streams[stream.channel] == stream {
+		delete(s.streams, stream.channel)
+	}
+	stream.cancel()
+}
+
+// remove forgets the stream once the upstream ended it.
+func (s *sseStreams) remove(stream *sseStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.streams[stream.channel] == stream {
+		delete(s.streams, stream.channel)
+	}
+}
+
+// sseStream is the response writer of a shared upstream request, broadcasting its events to the clients.
+type sseStream struct {
+	channel    string
+	replaySize int
+	header     http.Header
+	cancel     context.CancelFunc
+	pw         *io.PipeWriter
+
+	// responded is closed once status, responseHeader and streaming are set.
+	responded      chan struct{}
+	status         int
+	responseHeader http.Header
+	streaming      bool
+
+	// done is closed once the upstream response ended, body then holds responses other than event streams.
+	done        chan struct{}
+	broadcasted chan struct{}
+	body        bytes.Buffer
+
+	mu          sync.Mutex
+	subscribers map[chan []byte]struct{}
+	replay      []sse.Event
+}
+
+func (s *sseStream) Header() http.Header {
+	return s.header
+}
+
+func (s *sseStream) WriteHeader(status int) {
+	select {
+	case <-s.responded:
+		return
+	default:
+	}
+
+	s.status = status
+	s.responseHeader = s.header.Clone()
+	s.streaming = status == http.StatusOK && isEventStream(&http.Response{Header: s.responseHeader})
+	close(s.responded)
+}
+
+func (s *sseStream) Write(b []byte) (int, error) {
+	s.WriteHeader(http.StatusOK)
+
+	if !s.streaming {
+		return s.body.Write(b)
+	}
+
+	return s.pw.Write(b)
+}
+
+// Flush is a no-op, events are passed on as soon as they are complete.
+func (s *sseStream) Flush() {}
+
+// broadcast sends the events written by the upstream response to the subscribers.
+// Subscribers that can't keep up are disconnected.
+func (s *sseStream) broadcast(r io.Reader) {
+	defer close(s.broadcasted)
+
+	reader := sse.NewReader(r)
+	for {
+		event, err := reader.ReadEvent()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.replaySize > 0 {
+			s.replay = append(s.replay, event)
+			if len(s.replay) > s.replaySize {
+				s.replay = s.replay[len(s.replay)-s.replaySize:]
+			}
+		}
+
+		for events := range s.subscribers {
+			select {
+			case events <- event.Raw:
+			default:
+				delete(s.subscribers, events)
+				close(events)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// finish ends the streams of the subscribers once the upstream response ended.
+func (s *sseStream) finish() {
+	// the upstream request failed without a response
+	s.WriteHeader(http.StatusBadGateway)
+
+	s.pw.Close()
+	<-s.broadcasted
+
+	s.mu.Lock()
+	for events := range s.subscribers {
+		delete(s.subscribers, events)
+		close(events)
+	}
+	close(s.done)
+	s.mu.Unlock()
+
+	s.cancel()
+}
+
+// subscribe adds a subscriber, returning the buffered events following lastEventID.
+func (s *sseStream) subscribe(lastEventID string) (chan []byte, []sse.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make(chan []byte, sseSubscriberBuffer)
+	select {
+	case <-s.done:
+		// the stream ended, the client gets the final response
+		close(events)
+		return events, nil
+	default:
+	}
+	s.subscribers[events] = struct{}{}
+
+	if lastEventID == "" {
+		return events, nil
+	}
+
+	for i := len(s.replay) - 1; i >= 0; i-- {
+		if s.replay[i].ID == lastEventID {
+			return events, append([]sse.Event(nil), s.replay[i+1:]...)
+		}
+	}
+
+	return events, nil
+}
+
+// unsubscribe removes a subscriber and returns the number of subscribers left.
+func (s *sseStream) unsubscribe(events chan []byte) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscribers[events]; ok {
+		delete(s.subscribers, events)
+		close(events)
+	}
+
+	return len(s.subscribers)
+}
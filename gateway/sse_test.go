@@ -0,0 +1,191 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/header"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func newTestSSEProxy(config apidef.SSEConfig) *ReverseProxy {
+	spec := &APISpec{APIDefinition: &apidef.APIDefinition{SSE: config}}
+	return &ReverseProxy{TykAPISpec: spec}
+}
+
+func newTestSSEStream(replaySize int) *sseStream {
+	pr, pw := io.Pipe()
+	stream := &sseStream{
+		channel:     "/events?",
+		replaySize:  replaySize,
+		header:      make(http.Header),
+		responded:   make(chan struct{}),
+		done:        make(chan struct{}),
+		broadcasted: make(chan struct{}),
+		subscribers: make(map[chan []byte]struct{}),
+		cancel:      func() {},
+		pw:          pw,
+	}
+	go stream.broadcast(pr)
+
+	return stream
+}
+
+func TestIsEventStream(t *testing.T) {
+	res := &http.Response{Header: http.Header{header.ContentType: {"text/event-stream; charset=utf-8"}}}
+	assert.True(t, isEventStream(res))
+
+	res.Header.Set(header.ContentType, header.ApplicationJSON)
+	assert.False(t, isEventStream(res))
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	assert.False(t, isEventStreamRequest(req))
+
+	req.Header.Set(header.Accept, header.TextEventStream)
+	assert.True(t, isEventStreamRequest(req))
+}
+
+func TestReverseProxy_CopyEventStream(t *testing.T) {
+	t.Run("events are flushed one at a time", func(t *testing.T) {
+		p := newTestSSEProxy(apidef.SSEConfig{Enabled: true})
+		rec := httptest.NewRecorder()
+
+		p.copyEventStream(rec, strings.NewReader("id: 1\ndata: a\n\ndata: b\n\n"))
+		assert.Equal(t, "id: 1\ndata: a\n\ndata: b\n\n", rec.Body.String())
+		assert.True(t, rec.Flushed)
+	})
+
+	t.Run("heartbeats and lifetime", func(t *testing.T) {
+		p := newTestSSEProxy(apidef.SSEConfig{Enabled: true, HeartbeatInterval: 1, MaxConnectionLifetime: 2})
+		rec := httptest.NewRecorder()
+
+		// the upstream never sends an event
+		body, w := io.Pipe()
+		defer w.Close()
+
+		start := time.Now()
+		p.copyEventStream(rec, body)
+		assert.GreaterOrEqual(t, time.Since(start), 2*time.Second)
+		assert.Contains(t, rec.Body.String(), sseHeartbeat)
+	})
+}
+
+func TestSSEStream(t *testing.T) {
+	stream := newTestSSEStream(2)
+	stream.Header().Set(header.ContentType, header.TextEventStream)
+	stream.WriteHeader(http.StatusOK)
+	require.True(t, stream.streaming)
+
+	first, _ := stream.subscribe("")
+	slow, _ := stream.subscribe("")
+
+	for _, event := range []string{"id: 1\ndata: a\n\n", "id: 2\ndata: b\n\n", "id: 3\ndata: c\n\n"} {
+		_, err := stream.Write([]byte(event))
+		require.NoError(t, err)
+		assert.Equal(t, event, string(<-first))
+	}
+
+	// a client resuming from the second event gets the ones it missed
+	_, replay := stream.subscribe("2")
+	require.Len(t, replay, 1)
+	assert.Equal(t, "3", replay[0].ID)
+
+	_, replay = stream.subscribe("1")
+	assert.Empty(t, replay, "events older than the buffer can't be replayed")
+
+	t.Run("slow subscribers are disconnected", func(t *testing.T) {
+		for i := 0; i < sseSubscriberBuffer; i++ {
+			_, err := stream.Write([]byte("data: x\n\n"))
+			require.NoError(t, err)
+			<-first
+		}
+
+		received := 0
+		for range slow {
+			received++
+		}
+		assert.Equal(t, sseSubscriberBuffer, received)
+	})
+
+	t.Run("subscribers end with the stream", func(t *testing.T) {
+		stream.finish()
+
+		_, ok := <-first
+		assert.False(t, ok)
+
+		late, _ := stream.subscribe("")
+		_, ok = <-late
+		assert.False(t, ok)
+	})
+}
+
+func TestSSEStream_NotStreaming(t *testing.T) {
+	stream := newTestSSEStream(0)
+	stream.Header().Set(header.ContentType, header.ApplicationJSON)
+
+	_, err := stream.Write([]byte(`{"error":"not found"}`))
+	require.NoError(t, err)
+	stream.finish()
+
+	assert.Equal(t, http.StatusOK, stream.status)
+	assert.False(t, stream.streaming)
+	assert.Equal(t, `{"error":"not found"}`, stream.body.String())
+}
+
+func TestSSEStreams(t *testing.T) {
+	var streams sseStreams
+
+	opened := 0
+	open := func() *sseStream {
+		opened++
+		return newTestSSEStream(0)
+	}
+
+	stream, first, _ := streams.join("/events?", "", open)
+	shared, second, _ := streams.join("/events?", "", open)
+	assert.Equal(t, stream, shared)
+	assert.Equal(t, 1, opened)
+
+	streams.leave(stream, first)
+	assert.Len(t, streams.streams, 1)
+
+	streams.leave(stream, second)
+	assert.Empty(t, streams.streams, "the stream is closed once the last client left")
+
+	streams.join("/events?", "", open)
+	assert.Equal(t, 2, opened)
+}
+
+func TestReverseProxy_SSEChannel(t *testing.T) {
+	request := func(key string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/events?topic=a", nil)
+		ctxSetSession(r, &user.SessionState{KeyID: key}, false, false)
+		return r
+	}
+
+	var streams sseStreams
+	opened := 0
+	open := func() *sseStream {
+		opened++
+		return newTestSSEStream(0)
+	}
+
+	p := newTestSSEProxy(apidef.SSEConfig{FanOut: apidef.SSEFanOutConfig{Enabled: true}})
+	assert.Equal(t, p.sseChannel(request("first")), p.sseChannel(request("first")))
+
+	first, _, _ := streams.join(p.sseChannel(request("first")), "", open)
+	second, _, _ := streams.join(p.sseChannel(request("second")), "", open)
+	assert.NotEqual(t, first, second, "different keys don't share a stream")
+	assert.Equal(t, 2, opened)
+
+	p = newTestSSEProxy(apidef.SSEConfig{FanOut: apidef.SSEFanOutConfig{Enabled: true, SharedChannels: true}})
+	assert.Equal(t, p.sseChannel(request("first")), p.sseChannel(request("second")))
+}
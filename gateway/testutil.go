@@ -1198,6 +1198,8 @@ func (s *Test) newGateway(genConf func(globalConf *config.Config)) *Gateway {
 		go gw.reloadQueueLoop(gw.ReloadTestCase.OnQueued)
 	}
 
+	go gw.keyRotationLoop(s.ctx)
+
 	go s.reloadSimulation(s.ctx, gw)
 
 	return gw
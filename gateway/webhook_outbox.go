@@ -0,0 +1,255 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	webhookOutboxPrefix = "webhook.outbox."
+
+	defaultWebhookMaxRetries   = 5
+	defaultWebhookRetryBackoff = time.Second
+	maxWebhookRetryBackoff     = time.Hour
+
+	// webhookDeliveryLease is how long a delivery is claimed by a worker (in seconds), it's delivered
+	// again once the lease expires if the gateway stopped while sending it.
+	webhookDeliveryLease = 60
+)
+
+// webhookOutboxPollInterval is how often the outbox is checked for deliveries due for a retry.
+var webhookOutboxPollInterval = time.Second
+
+var errWebhookDeliveryNotFound = errors.New("delivery not found")
+
+// webhookDelivery is a payload waiting to be delivered to a webhook, or which couldn't be delivered.
+type webhookDelivery struct {
+	ID          string          `json:"id"`
+	Event       apidef.TykEvent `json:"event"`
+	Body        string          `json:"body"`
+	Created     time.Time       `json:"created"`
+	Attempts    int             `json:"attempts"`
+	LastAttempt time.Time       `json:"last_attempt"`
+	LastError   string          `json:"last_error"`
+	NextAttempt time.Time       `json:"next_attempt"`
+}
+
+// webhookOutbox stores the deliveries of a webhook in Redis. The pending deliveries are in a sorted set
+// scored by the time of their next attempt, the dead letters in a sorted set scored by the time they failed.
+type webhookOutbox struct {
+	id    string
+	store *storage.RedisCluster
+}
+
+func (gw *Gateway) newWebhookOutbox(id string) *webhookOutbox {
+	store := &storage.RedisCluster{KeyPrefix: webhookOutboxPrefix, RedisController: gw.RedisController}
+	store.Connect()
+	return &webhookOutbox{id: id, store: store}
+}
+
+func webhookOutboxScore(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+func (o *webhookOutbox) pendingKey() string {
+	return o.id + ".pending"
+}
+
+func (o *webhookOutbox) deadKey() string {
+	return o.id + ".dead"
+}
+
+func (o *webhookOutbox) deliveryKey(id string) string {
+	return o.id + ".delivery." + id
+}
+
+func (o *webhookOutbox) lockKey(id string) string {
+	// locks are incremented as raw keys
+	return webhookOutboxPrefix + o.id + ".lock." + id
+}
+
+func (o *webhookOutbox) save(d *webhookDelivery) error {
+	asJSON, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return o.store.SetKey(o.deliveryKey(d.ID), string(asJSON), 0)
+}
+
+func (o *webhookOutbox) get(id string) (*webhookDelivery, error) {
+	value, err := o.store.GetKey(o.deliveryKey(id))
+	if err != nil {
+		return nil, errWebhookDeliveryNotFound
+	}
+
+	d := &webhookDelivery{}
+	if err := json.Unmarshal([]byte(value), d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// add stores a delivery and schedules it at the given time.
+func (o *webhookOutbox) add(d *webhookDelivery, at time.Time) error {
+	d.NextAttempt = at
+	if err := o.save(d); err != nil {
+		return err
+	}
+	o.store.AddToSortedSet(o.pendingKey(), d.ID, webhookOutboxScore(at))
+	return nil
+}
+
+// ready returns the IDs of the deliveries due at the given time.
+func (o *webhookOutbox) ready(now time.Time) ([]string, error) {
+	ids, _, err := o.store.GetSortedSetRange(o.pendingKey(), "-inf", strconv.FormatFloat(webhookOutboxScore(now), 'f', -1, 64))
+	return ids, err
+}
+
+// claim locks a delivery for a worker, it returns false if the delivery is being sent by another worker.
+func (o *webhookOutbox) claim(id string) bool {
+	return o.store.IncrememntWithExpire(o.lockKey(id), webhookDeliveryLease) == 1
+}
+
+func (o *webhookOutbox) release(id string) {
+	o.store.DeleteRawKey(o.lockKey(id))
+}
+
+// done removes a delivered delivery.
+func (o *webhookOutbox) done(id string) {
+	o.store.RemoveFromSortedSet(o.pendingKey(), id)
+	o.store.DeleteKey(o.deliveryKey(id))
+}
+
+// kill moves a delivery to the dead letters.
+func (o *webhookOutbox) kill(d *webhookDelivery) error {
+	if err := o.save(d); err != nil {
+		return err
+	}
+	o.store.AddToSortedSet(o.deadKey(), d.ID, webhookOutboxScore(time.Now()))
+	return o.store.RemoveFromSortedSet(o.pendingKey(), d.ID)
+}
+
+// count returns the number of pending deliveries and dead letters.
+func (o *webhookOutbox) count() (pending, dead int, err error) {
+	pendingCount, err := o.store.GetSortedSetCard(o.pendingKey())
+	if err != nil {
+		return 0, 0, err
+	}
+	deadCount, err := o.store.GetSortedSetCard(o.deadKey())
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(pendingCount), int(deadCount), nil
+}
+
+// deadLetters returns the dead letters, oldest first.
+func (o *webhookOutbox) deadLetters() ([]*webhookDelivery, error) {
+	ids, _, err := o.store.GetSortedSetRange(o.deadKey(), "-inf", "+inf")
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*webhookDelivery, 0, len(ids))
+	for _, id := range ids {
+		d, err := o.get(id)
+		if err != nil {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+func (o *webhookOutbox) isDead(id string) (bool, error) {
+	_, dead, err := o.store.GetSortedSetScore(o.deadKey(), id)
+	return dead, err
+}
+
+// replay moves a dead letter back to the pending deliveries, with its attempts reset.
+func (o *webhookOutbox) replay(id string) error {
+	if dead, err := o.isDead(id); err != nil {
+		return err
+	} else if !dead {
+		return errWebhookDeliveryNotFound
+	}
+
+	d, err := o.get(id)
+	if err != nil {
+		o.store.RemoveFromSortedSet(o.deadKey(), id)
+		return err
+	}
+
+	d.Attempts = 0
+	d.LastError = ""
+	if err := o.add(d, time.Now()); err != nil {
+		return err
+	}
+	return o.store.RemoveFromSortedSet(o.deadKey(), id)
+}
+
+// remove deletes a dead letter.
+func (o *webhookOutbox) remove(id string) error {
+	if dead, err := o.isDead(id); err != nil {
+		return err
+	} else if !dead {
+		return errWebhookDeliveryNotFound
+	}
+
+	o.store.DeleteKey(o.deliveryKey(id))
+	return o.store.RemoveFromSortedSet(o.deadKey(), id)
+}
+
+// webhookHandlers holds the webhook handlers of the gateway by ID, for the control API.
+type webhookHandlers struct {
+	mu       sync.Mutex
+	handlers map[string]*WebHookHandler
+}
+
+func (h *webhookHandlers) add(handler *WebHookHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.handlers == nil {
+		h.handlers = make(map[string]*WebHookHandler)
+	}
+	h.handlers[handler.id] = handler
+}
+
+func (h *webhookHandlers) remove(handler *WebHookHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// a reloaded API registers its new handler before the old one is closed
+	if h.handlers[handler.id] == handler {
+		delete(h.handlers, handler.id)
+	}
+}
+
+func (h *webhookHandlers) get(id string) *WebHookHandler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.handlers[id]
+}
+
+// list returns the handlers sorted by ID.
+func (h *webhookHandlers) list() []*WebHookHandler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	handlers := make([]*WebHookHandler, 0, len(h.handlers))
+	for _, handler := range h.handlers {
+		handlers = append(handlers, handler)
+	}
+	sort.Slice(handlers, func(i, j int) bool {
+		return handlers[i].id < handlers[j].id
+	})
+	return handlers
+}
@@ -0,0 +1,212 @@
+// Package sdk defines the interfaces of typed Go plugins.
+//
+// A plugin exports a Registry, under the symbol name used as the hook name in the API definition:
+//
+//	var TykPlugin = sdk.Register(func() sdk.Plugin { return &plugin{} })
+//
+// The gateway creates an instance of the plugin for every API using it, shared by the hooks of the
+// API, and calls the methods the instance implements: RequestHandler for the pre, auth check, post
+// key auth, post and per-endpoint hooks, ResponseHandler for response hooks and AnalyticsHandler for
+// the analytics plugin.
+package sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/ctx"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// Version is the version of the SDK, as major.minor. Plugins built with another major version, or
+// a newer minor version, are rejected when they're loaded.
+const Version = "1.0"
+
+// Hook is the hook of the API definition a request is handled for.
+type Hook string
+
+const (
+	HookPre         Hook = "pre"
+	HookAuthCheck   Hook = "auth_check"
+	HookPostKeyAuth Hook = "post_key_auth"
+	HookPost        Hook = "post"
+	HookEndpoint    Hook = "endpoint"
+	HookResponse    Hook = "response"
+)
+
+// Plugin is a plugin instance, created for every API the plugin is used by.
+type Plugin interface {
+	// Init is called once the instance is created, before any hook runs.
+	Init(api *APIConfig) error
+	// Close is called when the API is unloaded.
+	Close() error
+}
+
+// Reloader is implemented by plugins keeping their instance when the API is reloaded, Reload is called
+// with the new configuration of the API instead of creating a new instance. A new instance is created
+// if Reload fails.
+type Reloader interface {
+	Reload(api *APIConfig) error
+}
+
+// RequestHandler handles requests, a response written by the handler is sent to the client and ends
+// the request, an error status code is reported as an error.
+type RequestHandler interface {
+	HandleRequest(w http.ResponseWriter, r *Request)
+}
+
+// ResponseHandler handles the responses of the upstream.
+type ResponseHandler interface {
+	HandleResponse(w http.ResponseWriter, res *http.Response, r *Request)
+}
+
+// AnalyticsHandler handles the analytics records of the API before they're stored.
+type AnalyticsHandler interface {
+	HandleAnalytics(record *analytics.AnalyticsRecord)
+}
+
+// Store is the cache store of the plugin, keys are scoped to the API.
+type Store interface {
+	Get(key string) (string, error)
+	Set(key, value string, ttl time.Duration) error
+	Delete(key string) bool
+}
+
+// APIConfig is the configuration of the API a plugin instance is created for.
+type APIConfig struct {
+	APIID string
+	OrgID string
+	Name  string
+	// ConfigData is the config_data of the API definition.
+	ConfigData map[string]interface{}
+	Definition *apidef.APIDefinition
+	Cache      Store
+	Logger     *logrus.Entry
+}
+
+// DecodeConfig decodes the config_data of the API into v.
+func (c *APIConfig) DecodeConfig(v interface{}) error {
+	data, err := json.Marshal(c.ConfigData)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Request is a request handled by a plugin.
+type Request struct {
+	*http.Request
+	Hook Hook
+	API  *APIConfig
+}
+
+// Session returns the session of the request, it's nil before authentication or for keyless APIs.
+func (r *Request) Session() *user.SessionState {
+	return ctx.GetSession(r.Request)
+}
+
+// SetSession sets the session of the request, auth check hooks authenticate the request with it.
+// The session is saved after the request if scheduleUpdate is set.
+func (r *Request) SetSession(session *user.SessionState, scheduleUpdate bool) {
+	ctx.SetSession(r.Request, session, scheduleUpdate)
+}
+
+// Definition returns the API definition of the request.
+func (r *Request) Definition() *apidef.APIDefinition {
+	if def := ctx.GetDefinition(r.Request); def != nil {
+		return def
+	}
+	return r.API.Definition
+}
+
+// ContextVariable returns a context variable of the request.
+func (r *Request) ContextVariable(name string) (interface{}, bool) {
+	value, ok := ctx.GetContextData(r.Request)[name]
+	return value, ok
+}
+
+// SetContextVariable sets a context variable of the request, available to the following middleware.
+func (r *Request) SetContextVariable(name string, value interface{}) {
+	vars := map[string]interface{}{}
+	for k, v := range ctx.GetContextData(r.Request) {
+		vars[k] = v
+	}
+	vars[name] = value
+	ctx.SetContextData(r.Request, vars)
+}
+
+// Cache returns the cache store of the API.
+func (r *Request) Cache() Store {
+	return r.API.Cache
+}
+
+// Registry is exported by a plugin to create its instances.
+type Registry struct {
+	// SDKVersion is the version of the SDK the plugin is built with.
+	SDKVersion string
+	// MinGatewayVersion is the oldest gateway version the plugin supports, e.g. v5.2.0, any version if it's empty.
+	MinGatewayVersion string
+	// New creates a plugin instance.
+	New func() Plugin
+}
+
+// Register returns the Registry of a plugin built with this version of the SDK.
+func Register(newPlugin func() Plugin) *Registry {
+	return &Registry{SDKVersion: Version, New: newPlugin}
+}
+
+// Check checks the plugin can be loaded by the gateway of version gatewayVersion.
+func (r *Registry) Check(gatewayVersion string) error {
+	if r.New == nil {
+		return errors.New("plugin registry has no constructor")
+	}
+
+	pluginVersion := parseVersion(r.SDKVersion)
+	sdkVersion := parseVersion(Version)
+	if r.SDKVersion == "" || pluginVersion[0] != sdkVersion[0] || compareVersions(pluginVersion, sdkVersion) > 0 {
+		return fmt.Errorf("plugin is built with SDK version %q, the gateway supports %s", r.SDKVersion, Version)
+	}
+
+	if r.MinGatewayVersion != "" && compareVersions(parseVersion(gatewayVersion), parseVersion(r.MinGatewayVersion)) < 0 {
+		return fmt.Errorf("plugin requires gateway %s or later, the gateway is %s", r.MinGatewayVersion, gatewayVersion)
+	}
+
+	return nil
+}
+
+// parseVersion parses the major, minor and patch numbers of a version like v1.2.3-rc1.
+func parseVersion(version string) [3]int {
+	var parsed [3]int
+
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+
+	for i, part := range strings.SplitN(version, ".", 3) {
+		parsed[i], _ = strconv.Atoi(part)
+	}
+
+	return parsed
+}
+
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
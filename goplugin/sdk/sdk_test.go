@@ -0,0 +1,100 @@
+package sdk
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/ctx"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+type testPlugin struct{}
+
+func (testPlugin) Init(*APIConfig) error { return nil }
+func (testPlugin) Close() error          { return nil }
+
+func TestRegistry_Check(t *testing.T) {
+	newPlugin := func() Plugin { return testPlugin{} }
+
+	tests := []struct {
+		name     string
+		registry Registry
+		gateway  string
+		err      string
+	}{
+		{name: "current", registry: *Register(newPlugin), gateway: "v5.2.0"},
+		{name: "older minor", registry: Registry{SDKVersion: "1.0", New: newPlugin}, gateway: "v5.2.0"},
+		{name: "newer minor", registry: Registry{SDKVersion: "1.1", New: newPlugin}, gateway: "v5.2.0", err: `plugin is built with SDK version "1.1"`},
+		{name: "other major", registry: Registry{SDKVersion: "2.0", New: newPlugin}, gateway: "v5.2.0", err: `plugin is built with SDK version "2.0"`},
+		{name: "no version", registry: Registry{New: newPlugin}, gateway: "v5.2.0", err: `plugin is built with SDK version ""`},
+		{name: "no constructor", registry: Registry{SDKVersion: Version}, gateway: "v5.2.0", err: "plugin registry has no constructor"},
+		{name: "gateway supported", registry: Registry{SDKVersion: Version, MinGatewayVersion: "v5.2.0", New: newPlugin}, gateway: "v5.2.1-rc1"},
+		{name: "gateway too old", registry: Registry{SDKVersion: Version, MinGatewayVersion: "5.3", New: newPlugin}, gateway: "v5.2.9", err: "plugin requires gateway 5.3 or later, the gateway is v5.2.9"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.registry.Check(tc.gateway)
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestAPIConfig_DecodeConfig(t *testing.T) {
+	api := &APIConfig{ConfigData: map[string]interface{}{"limit": 10, "name": "orders"}}
+
+	var conf struct {
+		Limit int    `json:"limit"`
+		Name  string `json:"name"`
+	}
+	require.NoError(t, api.DecodeConfig(&conf))
+	assert.Equal(t, 10, conf.Limit)
+	assert.Equal(t, "orders", conf.Name)
+}
+
+func TestRequest(t *testing.T) {
+	def := &apidef.APIDefinition{APIID: "orders"}
+	r := &Request{
+		Request: httptest.NewRequest("GET", "/", nil),
+		Hook:    HookPost,
+		API:     &APIConfig{Definition: def},
+	}
+
+	// the gateway sets the global configuration
+	global := config.Global
+	config.Global = func() config.Config { return config.Config{} }
+	defer func() { config.Global = global }()
+
+	assert.Nil(t, r.Session())
+	session := &user.SessionState{OrgID: "default"}
+	r.SetSession(session, false)
+	assert.Equal(t, "default", r.Session().OrgID)
+
+	assert.Same(t, def, r.Definition())
+
+	ctx.SetContextData(r.Request, map[string]interface{}{"path": "/"})
+	vars := ctx.GetContextData(r.Request)
+
+	r.SetContextVariable("team", "a")
+	value, ok := r.ContextVariable("team")
+	assert.True(t, ok)
+	assert.Equal(t, "a", value)
+	value, _ = r.ContextVariable("path")
+	assert.Equal(t, "/", value)
+
+	// the variables of earlier middleware aren't changed
+	assert.NotContains(t, vars, "team")
+
+	_, ok = r.ContextVariable("missing")
+	assert.False(t, ok)
+}
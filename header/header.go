@@ -14,13 +14,17 @@ const (
 	Expires                 = "Expires"
 	Connection              = "Connection"
 	WWWAuthenticate         = "WWW-Authenticate"
+	IdempotencyKey          = "Idempotency-Key"
+	Deprecation             = "Deprecation"
+	Sunset                  = "Sunset"
 )
 
 const (
-	TykHookshot     = "Tyk-Hookshot"
-	ApplicationJSON = "application/json"
-	ApplicationXML  = "application/xml"
-	TextXML         = "text/xml"
+	TykHookshot       = "Tyk-Hookshot"
+	ApplicationJSON   = "application/json"
+	ApplicationXML    = "application/xml"
+	ApplicationNDJSON = "application/x-ndjson"
+	TextXML           = "text/xml"
 )
 
 const (
@@ -39,6 +43,7 @@ const (
 	XTykHostname        = "x-tyk-hostname"
 	XGenerator          = "X-Generator"
 	XTykAuthorization   = "X-Tyk-Authorization"
+	XTykDashboardUser   = "X-Tyk-Dashboard-User"
 )
 
 // upgrade and websocket
@@ -49,6 +54,28 @@ const (
 	SecWebSocketKey      = "Sec-WebSocket-Key"
 )
 
+// gRPC
+const (
+	GRPCStatus             = "Grpc-Status"
+	GRPCMessage            = "Grpc-Message"
+	ApplicationGRPC        = "application/grpc"
+	ApplicationGRPCWeb     = "application/grpc-web"
+	ApplicationGRPCWebText = "application/grpc-web-text"
+)
+
+// Server-Sent Events
+const (
+	TextEventStream = "text/event-stream"
+	LastEventID     = "Last-Event-ID"
+)
+
+// Standard Webhooks
+const (
+	WebhookID        = "Webhook-Id"
+	WebhookTimestamp = "Webhook-Timestamp"
+	WebhookSignature = "Webhook-Signature"
+)
+
 // Gateway's custom response headers
 const (
 	XRateLimitLimit     = "X-RateLimit-Limit"
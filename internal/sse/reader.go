@@ -0,0 +1,78 @@
+// Package sse reads the events of text/event-stream bodies.
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// Event is a block of lines ended by a blank line.
+type Event struct {
+	// ID is the value of the id field of the event, empty without one.
+	ID string
+	// Raw is the event as read, including the blank line ending it, so it can be forwarded unchanged.
+	Raw []byte
+}
+
+// Reader splits a stream into events.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a reader of the events of r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadEvent returns the next event. Blocks of comments, such as heartbeats, are returned as events.
+// An unterminated event at the end of the stream is returned before io.EOF.
+func (r *Reader) ReadEvent() (Event, error) {
+	var (
+		event     Event
+		hasFields bool
+	)
+
+	for {
+		line, err := r.r.ReadBytes('\n')
+		event.Raw = append(event.Raw, line...)
+
+		if err != nil {
+			if err == io.EOF && len(event.Raw) > 0 {
+				return event, nil
+			}
+			return Event{}, err
+		}
+
+		field := bytes.TrimRight(line, "\r\n")
+		if len(field) == 0 {
+			// blank lines before the first field don't end an event
+			if !hasFields {
+				continue
+			}
+			return event, nil
+		}
+		hasFields = true
+
+		if id, ok := fieldValue(field, "id"); ok {
+			event.ID = id
+		}
+	}
+}
+
+// fieldValue returns the value of a line of the named field.
+func fieldValue(line []byte, name string) (string, bool) {
+	if !bytes.HasPrefix(line, []byte(name)) {
+		return "", false
+	}
+
+	rest := line[len(name):]
+	switch {
+	case len(rest) == 0:
+		return "", true
+	case rest[0] != ':':
+		return "", false
+	}
+
+	return string(bytes.TrimPrefix(rest[1:], []byte(" "))), true
+}
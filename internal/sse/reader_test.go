@@ -0,0 +1,38 @@
+package sse_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/internal/sse"
+)
+
+func TestReader_ReadEvent(t *testing.T) {
+	r := sse.NewReader(strings.NewReader("" +
+		"id: 1\ndata: first\n\n" +
+		"\r\n: heartbeat\r\n\r\n" +
+		"event: update\ndata: {\"a\":1}\nid:2\n\n" +
+		"identity: x\nid\n\n" +
+		"data: partial"))
+
+	expected := []sse.Event{
+		{ID: "1", Raw: []byte("id: 1\ndata: first\n\n")},
+		{Raw: []byte("\r\n: heartbeat\r\n\r\n")},
+		{ID: "2", Raw: []byte("event: update\ndata: {\"a\":1}\nid:2\n\n")},
+		{Raw: []byte("identity: x\nid\n\n")},
+		{Raw: []byte("data: partial")},
+	}
+
+	for _, want := range expected {
+		event, err := r.ReadEvent()
+		require.NoError(t, err)
+		assert.Equal(t, want, event)
+	}
+
+	_, err := r.ReadEvent()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,263 @@
+package transcoding
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var marshalOptions = protojson.MarshalOptions{EmitUnpopulated: true}
+
+// NewRequest builds the protobuf encoded request message of the route from the JSON body,
+// the path variables returned by Match and the query parameters.
+// Query parameters which don't name a field of the request message are ignored.
+func (r *Route) NewRequest(body []byte, params map[string]string, query url.Values) ([]byte, error) {
+	msg := dynamicpb.NewMessage(r.Method.Input())
+
+	if err := r.unmarshalBody(msg, body); err != nil {
+		return nil, err
+	}
+
+	for _, variable := range r.template.variables {
+		fields, _ := fieldPath(msg.Descriptor(), variable)
+		if err := setField(msg, fields, []string{params[variable]}); err != nil {
+			return nil, fmt.Errorf("path variable %q: %w", variable, err)
+		}
+	}
+
+	if r.Body != "*" {
+		for key, values := range query {
+			if r.boundByRoute(key) {
+				continue
+			}
+
+			fields, ok := fieldPath(msg.Descriptor(), key)
+			if !ok {
+				continue
+			}
+
+			if err := setField(msg, fields, values); err != nil {
+				return nil, fmt.Errorf("query parameter %q: %w", key, err)
+			}
+		}
+	}
+
+	return proto.Marshal(msg)
+}
+
+// boundByRoute reports whether a query parameter targets a field already set by the path or body.
+func (r *Route) boundByRoute(key string) bool {
+	for _, bound := range append([]string{r.Body}, r.template.variables...) {
+		if bound != "" && (key == bound || strings.HasPrefix(key, bound+".")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Route) unmarshalBody(msg *dynamicpb.Message, body []byte) error {
+	body = bytes.TrimSpace(body)
+	if r.Body == "" || len(body) == 0 {
+		return nil
+	}
+
+	if r.Body != "*" {
+		// wrapping the body lets protojson handle every kind of field
+		field := findField(msg.Descriptor(), r.Body)
+		wrapped := make([]byte, 0, len(body)+len(field.JSONName())+5)
+		wrapped = append(wrapped, `{"`+field.JSONName()+`":`...)
+		wrapped = append(wrapped, body...)
+		body = append(wrapped, '}')
+	}
+
+	if err := protojson.Unmarshal(body, msg); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	return nil
+}
+
+// Response transcodes the protobuf encoded messages of a gRPC reply to JSON.
+// Server streaming methods reply with a JSON array holding every message.
+func (r *Route) Response(messages [][]byte) ([]byte, error) {
+	if !r.Method.IsStreamingServer() {
+		if len(messages) != 1 {
+			return nil, fmt.Errorf("expected a single response message, got %d", len(messages))
+		}
+
+		return r.marshalResponse(messages[0])
+	}
+
+	items := make([]json.RawMessage, 0, len(messages))
+	for _, message := range messages {
+		item, err := r.marshalResponse(message)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return json.Marshal(items)
+}
+
+func (r *Route) marshalResponse(message []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(r.Method.Output())
+	if err := proto.Unmarshal(message, msg); err != nil {
+		return nil, err
+	}
+
+	data, err := marshalOptions.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.ResponseBody == "" {
+		return data, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields[findField(msg.Descriptor(), r.ResponseBody).JSONName()], nil
+}
+
+// findField looks a field up by its proto name, then by its JSON name.
+func findField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	fields := md.Fields()
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+
+	return fields.ByJSONName(name)
+}
+
+// fieldPath resolves a dotted field path against a message descriptor.
+// Every field but the last must be a singular message field.
+func fieldPath(md protoreflect.MessageDescriptor, path string) ([]protoreflect.FieldDescriptor, bool) {
+	parts := strings.Split(path, ".")
+	fields := make([]protoreflect.FieldDescriptor, 0, len(parts))
+
+	for i, part := range parts {
+		if md == nil {
+			return nil, false
+		}
+
+		fd := findField(md, part)
+		if fd == nil {
+			return nil, false
+		}
+
+		if i < len(parts)-1 && (fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap()) {
+			return nil, false
+		}
+
+		fields = append(fields, fd)
+		md = fd.Message()
+	}
+
+	return fields, true
+}
+
+// setField sets the field at the end of the path from its string representation.
+// Repeated fields get every value, singular fields the last one.
+func setField(msg protoreflect.Message, fields []protoreflect.FieldDescriptor, values []string) error {
+	for _, fd := range fields[:len(fields)-1] {
+		msg = msg.Mutable(fd).Message()
+	}
+
+	fd := fields[len(fields)-1]
+	if fd.IsMap() {
+		return fmt.Errorf("map field %s can't be set from a parameter", fd.Name())
+	}
+
+	if fd.IsList() {
+		list := msg.Mutable(fd).List()
+		for _, value := range values {
+			v, err := parseValue(fd, value)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+
+		return nil
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	v, err := parseValue(fd, values[len(values)-1])
+	if err != nil {
+		return err
+	}
+	msg.Set(fd, v)
+
+	return nil
+}
+
+func parseValue(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(v), err
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BytesKind:
+		v, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			v, err = base64.URLEncoding.DecodeString(s)
+		}
+		return protoreflect.ValueOfBytes(v), err
+	case protoreflect.EnumKind:
+		if value := fd.Enum().Values().ByName(protoreflect.Name(s)); value != nil {
+			return protoreflect.ValueOfEnum(value.Number()), nil
+		}
+
+		v, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("unknown value %q for enum %s", s, fd.Enum().FullName())
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		// well known types such as timestamps and wrappers are given in their JSON string form
+		msg := dynamicpb.NewMessage(fd.Message())
+		if err := protojson.Unmarshal([]byte(strconv.Quote(s)), msg); err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfMessage(msg), nil
+	}
+
+	return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", fd.Kind())
+}
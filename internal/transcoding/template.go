@@ -0,0 +1,131 @@
+package transcoding
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pathTemplate is a compiled google.api.http path template:
+//
+//	Template = "/" Segments [ Verb ] ;
+//	Segments = Segment { "/" Segment } ;
+//	Segment  = "*" | "**" | LITERAL | Variable ;
+//	Variable = "{" FieldPath [ "=" Segments ] "}" ;
+//	Verb     = ":" LITERAL ;
+type pathTemplate struct {
+	re        *regexp.Regexp
+	variables []string
+	oasPath   string
+}
+
+func parsePathTemplate(pattern string) (*pathTemplate, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("path template %q must start with /", pattern)
+	}
+
+	segments, verb := pattern[1:], ""
+	if i := strings.LastIndex(segments, ":"); i > strings.LastIndexAny(segments, "/}") {
+		segments, verb = segments[:i], segments[i+1:]
+	}
+
+	t := &pathTemplate{}
+
+	var expr, oasPath strings.Builder
+	expr.WriteString("^")
+
+	for segments != "" {
+		expr.WriteString("/")
+		oasPath.WriteString("/")
+
+		if segments[0] != '{' {
+			segment := segments
+			if i := strings.IndexByte(segments, '/'); i >= 0 {
+				segment = segments[:i]
+			}
+			segments = strings.TrimPrefix(segments[len(segment):], "/")
+
+			if strings.ContainsAny(segment, "{}") {
+				return nil, fmt.Errorf("path template %q has a malformed segment %q", pattern, segment)
+			}
+
+			expr.WriteString(segmentExpr(segment))
+			oasPath.WriteString(segment)
+			continue
+		}
+
+		end := strings.IndexByte(segments, '}')
+		if end < 0 {
+			return nil, fmt.Errorf("path template %q has an unterminated variable", pattern)
+		}
+
+		variable := segments[1:end]
+		segments = strings.TrimPrefix(segments[end+1:], "/")
+
+		name, subPattern := variable, "*"
+		if i := strings.IndexByte(variable, '='); i >= 0 {
+			name, subPattern = variable[:i], variable[i+1:]
+		}
+
+		if name == "" || subPattern == "" {
+			return nil, fmt.Errorf("path template %q has a malformed variable %q", pattern, variable)
+		}
+
+		subExprs := make([]string, 0, strings.Count(subPattern, "/")+1)
+		for _, segment := range strings.Split(subPattern, "/") {
+			subExprs = append(subExprs, segmentExpr(segment))
+		}
+
+		expr.WriteString("(" + strings.Join(subExprs, "/") + ")")
+		oasPath.WriteString("{" + name + "}")
+		t.variables = append(t.variables, name)
+	}
+
+	if oasPath.Len() == 0 {
+		expr.WriteString("/")
+		oasPath.WriteString("/")
+	}
+
+	if verb != "" {
+		expr.WriteString(regexp.QuoteMeta(":" + verb))
+		oasPath.WriteString(":" + verb)
+	}
+
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	t.re = re
+	t.oasPath = oasPath.String()
+
+	return t, nil
+}
+
+func segmentExpr(segment string) string {
+	switch segment {
+	case "*":
+		return "[^/]+"
+	case "**":
+		return ".+"
+	default:
+		return regexp.QuoteMeta(segment)
+	}
+}
+
+// match reports whether the path matches the template and returns the values of its variables.
+func (t *pathTemplate) match(path string) (map[string]string, bool) {
+	submatches := t.re.FindStringSubmatch(path)
+	if submatches == nil {
+		return nil, false
+	}
+
+	params := make(map[string]string, len(t.variables))
+	for i, variable := range t.variables {
+		params[variable] = submatches[i+1]
+	}
+
+	return params, true
+}
@@ -0,0 +1,248 @@
+// Package transcoding maps JSON REST requests to gRPC methods, following the
+// google.api.http annotations found in a protobuf FileDescriptorSet.
+package transcoding
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	// well known types don't have to be part of the uploaded descriptor sets
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Transcoder holds the REST routes of the gRPC services in a descriptor set.
+type Transcoder struct {
+	routes []*Route
+}
+
+// Route maps a REST endpoint to a gRPC method.
+type Route struct {
+	// Method is the gRPC method called for the route.
+	Method protoreflect.MethodDescriptor
+	// HTTPMethod is the HTTP method of the route.
+	HTTPMethod string
+	// Pattern is the path template of the route.
+	Pattern string
+	// Body is the request field the JSON body is mapped to, "*" for the whole request message.
+	Body string
+	// ResponseBody is the response field sent as JSON body, empty for the whole response message.
+	ResponseBody string
+
+	template *pathTemplate
+}
+
+// New parses a serialised FileDescriptorSet and collects the routes of its annotated methods.
+// Dependencies missing from the set are resolved against the descriptors compiled into the gateway.
+func New(descriptorSet []byte) (*Transcoder, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(descriptorSet, &set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+
+	files, err := newFiles(&set)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Transcoder{}
+	for _, fileProto := range set.File {
+		file, err := files.FindFileByPath(fileProto.GetName())
+		if err != nil {
+			return nil, err
+		}
+
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				if err := t.addRoutes(methods.Get(j)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// Routes returns the routes in the order they are matched.
+func (t *Transcoder) Routes() []*Route {
+	return t.routes
+}
+
+// Match returns the first route matching the method and path, together with
+// the values of its path variables keyed by field path.
+func (t *Transcoder) Match(method, path string) (*Route, map[string]string) {
+	for _, route := range t.routes {
+		if route.HTTPMethod != method {
+			continue
+		}
+
+		if params, ok := route.template.match(path); ok {
+			return route, params
+		}
+	}
+
+	return nil, nil
+}
+
+func (t *Transcoder) addRoutes(method protoreflect.MethodDescriptor) error {
+	// client streaming can't be expressed with a single JSON request
+	if method.IsStreamingClient() {
+		return nil
+	}
+
+	opts, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok || opts == nil || !proto.HasExtension(opts, annotations.E_Http) {
+		return nil
+	}
+
+	rule, ok := proto.GetExtension(opts, annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return nil
+	}
+
+	rules := append([]*annotations.HttpRule{rule}, rule.AdditionalBindings...)
+	for _, rule := range rules {
+		route, err := newRoute(method, rule)
+		if err != nil {
+			return fmt.Errorf("%s: %w", method.FullName(), err)
+		}
+
+		t.routes = append(t.routes, route)
+	}
+
+	return nil
+}
+
+func newRoute(method protoreflect.MethodDescriptor, rule *annotations.HttpRule) (*Route, error) {
+	route := &Route{
+		Method:       method,
+		Body:         rule.Body,
+		ResponseBody: rule.ResponseBody,
+	}
+
+	switch pattern := rule.Pattern.(type) {
+	case *annotations.HttpRule_Get:
+		route.HTTPMethod, route.Pattern = http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Put:
+		route.HTTPMethod, route.Pattern = http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Post:
+		route.HTTPMethod, route.Pattern = http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Delete:
+		route.HTTPMethod, route.Pattern = http.MethodDelete, pattern.Delete
+	case *annotations.HttpRule_Patch:
+		route.HTTPMethod, route.Pattern = http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Custom:
+		route.HTTPMethod, route.Pattern = strings.ToUpper(pattern.Custom.GetKind()), pattern.Custom.GetPath()
+	default:
+		return nil, errors.New("http rule without pattern")
+	}
+
+	template, err := parsePathTemplate(route.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	route.template = template
+
+	for _, variable := range template.variables {
+		if _, ok := fieldPath(method.Input(), variable); !ok {
+			return nil, fmt.Errorf("path variable %q is not a field of %s", variable, method.Input().FullName())
+		}
+	}
+
+	if route.Body != "" && route.Body != "*" && findField(method.Input(), route.Body) == nil {
+		return nil, fmt.Errorf("body %q is not a field of %s", route.Body, method.Input().FullName())
+	}
+
+	if route.ResponseBody != "" && findField(method.Output(), route.ResponseBody) == nil {
+		return nil, fmt.Errorf("response body %q is not a field of %s", route.ResponseBody, method.Output().FullName())
+	}
+
+	return route, nil
+}
+
+// GRPCPath returns the HTTP/2 path of the gRPC method.
+func (r *Route) GRPCPath() string {
+	return "/" + string(r.Method.Parent().FullName()) + "/" + string(r.Method.Name())
+}
+
+// OASPath returns the path template in OAS form, with variables written as {field.path}.
+func (r *Route) OASPath() string {
+	return r.template.oasPath
+}
+
+// Variables returns the field paths bound by the path template.
+func (r *Route) Variables() []string {
+	return r.template.variables
+}
+
+// newFiles builds a registry from the files of the set, registering dependencies first.
+func newFiles(set *descriptorpb.FileDescriptorSet) (*protoregistry.Files, error) {
+	protos := make(map[string]*descriptorpb.FileDescriptorProto, len(set.File))
+	for _, fileProto := range set.File {
+		protos[fileProto.GetName()] = fileProto
+	}
+
+	files := new(protoregistry.Files)
+
+	var register func(path string) error
+	register = func(path string) error {
+		if _, err := files.FindFileByPath(path); err == nil {
+			return nil
+		}
+
+		fileProto, ok := protos[path]
+		if !ok {
+			file, err := protoregistry.GlobalFiles.FindFileByPath(path)
+			if err != nil {
+				return fmt.Errorf("descriptor set is missing %q", path)
+			}
+
+			imports := file.Imports()
+			for i := 0; i < imports.Len(); i++ {
+				if err := register(imports.Get(i).Path()); err != nil {
+					return err
+				}
+			}
+
+			return files.RegisterFile(file)
+		}
+
+		for _, dependency := range fileProto.Dependency {
+			if err := register(dependency); err != nil {
+				return err
+			}
+		}
+
+		file, err := protodesc.NewFile(fileProto, files)
+		if err != nil {
+			return err
+		}
+
+		return files.RegisterFile(file)
+	}
+
+	for _, fileProto := range set.File {
+		if err := register(fileProto.GetName()); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,337 @@
+package transcoding_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/TykTechnologies/tyk/internal/transcoding"
+)
+
+// testDescriptorSet returns a serialised descriptor set of a small library service.
+func testDescriptorSet(t *testing.T) []byte {
+	t.Helper()
+
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string, repeated bool) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Type:   typ.Enum(),
+			Label:  label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+
+		return f
+	}
+
+	method := func(name, input, output string, rule *annotations.HttpRule, serverStreaming bool) *descriptorpb.MethodDescriptorProto {
+		opts := &descriptorpb.MethodOptions{}
+		proto.SetExtension(opts, annotations.E_Http, rule)
+
+		return &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(name),
+			InputType:       proto.String(input),
+			OutputType:      proto.String(output),
+			Options:         opts,
+			ServerStreaming: proto.Bool(serverStreaming),
+		}
+	}
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("library.proto"),
+		Package:    proto.String("library.v1"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/api/annotations.proto", "google/protobuf/timestamp.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Genre"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("GENRE_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("FICTION"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Book"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+					field("title", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+					field("page_count", 3, descriptorpb.FieldDescriptorProto_TYPE_INT64, "", false),
+					field("genre", 4, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".library.v1.Genre", false),
+					field("tags", 5, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", true),
+					field("published", 6, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp", false),
+				},
+			},
+			{
+				Name: proto.String("GetBookRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+				},
+			},
+			{
+				Name: proto.String("CreateBookRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("parent", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+					field("book", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".library.v1.Book", false),
+					field("validate_only", 3, descriptorpb.FieldDescriptorProto_TYPE_BOOL, "", false),
+				},
+			},
+			{
+				Name: proto.String("ListBooksRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("parent", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+					field("page_size", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, "", false),
+					field("genres", 3, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".library.v1.Genre", true),
+					field("published_after", 4, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp", false),
+				},
+			},
+			{
+				Name: proto.String("ListBooksResponse"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("books", 1, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".library.v1.Book", true),
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Library"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("GetBook", ".library.v1.GetBookRequest", ".library.v1.Book", &annotations.HttpRule{
+					Pattern: &annotations.HttpRule_Get{Get: "/v1/{name=shelves/*/books/*}"},
+				}, false),
+				method("CreateBook", ".library.v1.CreateBookRequest", ".library.v1.Book", &annotations.HttpRule{
+					Pattern: &annotations.HttpRule_Post{Post: "/v1/{parent=shelves/*}/books"},
+					Body:    "book",
+					AdditionalBindings: []*annotations.HttpRule{{
+						Pattern: &annotations.HttpRule_Post{Post: "/v1/books:create"},
+						Body:    "*",
+					}},
+				}, false),
+				method("ListBooks", ".library.v1.ListBooksRequest", ".library.v1.ListBooksResponse", &annotations.HttpRule{
+					Pattern:      &annotations.HttpRule_Get{Get: "/v1/{parent=shelves/*}/books"},
+					ResponseBody: "books",
+				}, false),
+				method("WatchBooks", ".library.v1.ListBooksRequest", ".library.v1.Book", &annotations.HttpRule{
+					Pattern: &annotations.HttpRule_Custom{Custom: &annotations.CustomHttpPattern{Kind: "get", Path: "/v1/{parent=shelves/*}/books:watch"}},
+				}, true),
+			},
+		}},
+	}
+
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	require.NoError(t, err)
+
+	return set
+}
+
+func newTestTranscoder(t *testing.T) *transcoding.Transcoder {
+	t.Helper()
+
+	transcoder, err := transcoding.New(testDescriptorSet(t))
+	require.NoError(t, err)
+
+	return transcoder
+}
+
+func TestNew(t *testing.T) {
+	transcoder := newTestTranscoder(t)
+
+	var patterns []string
+	for _, route := range transcoder.Routes() {
+		patterns = append(patterns, route.HTTPMethod+" "+route.Pattern)
+	}
+
+	assert.Equal(t, []string{
+		"GET /v1/{name=shelves/*/books/*}",
+		"POST /v1/{parent=shelves/*}/books",
+		"POST /v1/books:create",
+		"GET /v1/{parent=shelves/*}/books",
+		"GET /v1/{parent=shelves/*}/books:watch",
+	}, patterns)
+
+	route := transcoder.Routes()[0]
+	assert.Equal(t, "/library.v1.Library/GetBook", route.GRPCPath())
+	assert.Equal(t, "/v1/{name}", route.OASPath())
+	assert.Equal(t, []string{"name"}, route.Variables())
+
+	_, err := transcoding.New([]byte("not a descriptor set"))
+	assert.Error(t, err)
+}
+
+func TestTranscoder_Match(t *testing.T) {
+	transcoder := newTestTranscoder(t)
+
+	tests := []struct {
+		method, path string
+		grpcPath     string
+		params       map[string]string
+	}{
+		{http.MethodGet, "/v1/shelves/1/books/2", "/library.v1.Library/GetBook", map[string]string{"name": "shelves/1/books/2"}},
+		{http.MethodPost, "/v1/shelves/1/books", "/library.v1.Library/CreateBook", map[string]string{"parent": "shelves/1"}},
+		{http.MethodPost, "/v1/books:create", "/library.v1.Library/CreateBook", map[string]string{}},
+		{http.MethodGet, "/v1/shelves/1/books", "/library.v1.Library/ListBooks", map[string]string{"parent": "shelves/1"}},
+		{http.MethodGet, "/v1/shelves/1/books:watch", "/library.v1.Library/WatchBooks", map[string]string{"parent": "shelves/1"}},
+		{http.MethodDelete, "/v1/shelves/1/books/2", "", nil},
+		{http.MethodGet, "/v1/shelves/1/books/2/extra", "", nil},
+	}
+
+	for _, tc := range tests {
+		route, params := transcoder.Match(tc.method, tc.path)
+		if tc.grpcPath == "" {
+			assert.Nil(t, route, tc.path)
+			continue
+		}
+
+		require.NotNil(t, route, tc.path)
+		assert.Equal(t, tc.grpcPath, route.GRPCPath(), tc.path)
+		assert.Equal(t, tc.params, params, tc.path)
+	}
+}
+
+func TestRoute_NewRequest(t *testing.T) {
+	transcoder := newTestTranscoder(t)
+
+	decode := func(t *testing.T, route *transcoding.Route, data []byte) string {
+		t.Helper()
+
+		msg := dynamicpb.NewMessage(route.Method.Input())
+		require.NoError(t, proto.Unmarshal(data, msg))
+
+		out, err := protojson.Marshal(msg)
+		require.NoError(t, err)
+
+		return string(out)
+	}
+
+	t.Run("body field and path", func(t *testing.T) {
+		route, params := transcoder.Match(http.MethodPost, "/v1/shelves/1/books")
+		data, err := route.NewRequest([]byte(`{"title":"Dune","pageCount":"412","genre":"FICTION"}`), params, url.Values{
+			"validate_only": {"true"},
+			"book.title":    {"ignored"},
+		})
+		require.NoError(t, err)
+
+		assert.JSONEq(t, `{"parent":"shelves/1","book":{"title":"Dune","pageCount":"412","genre":"FICTION"},"validateOnly":true}`, decode(t, route, data))
+	})
+
+	t.Run("whole body", func(t *testing.T) {
+		route, params := transcoder.Match(http.MethodPost, "/v1/books:create")
+		data, err := route.NewRequest([]byte(`{"parent":"shelves/2","book":{"title":"Emma"}}`), params, url.Values{"validate_only": {"true"}})
+		require.NoError(t, err)
+
+		assert.JSONEq(t, `{"parent":"shelves/2","book":{"title":"Emma"}}`, decode(t, route, data))
+	})
+
+	t.Run("query parameters", func(t *testing.T) {
+		route, params := transcoder.Match(http.MethodGet, "/v1/shelves/1/books")
+		data, err := route.NewRequest(nil, params, url.Values{
+			"pageSize":        {"10"},
+			"genres":          {"FICTION", "0"},
+			"published_after": {"2020-01-01T00:00:00Z"},
+			"api_key":         {"unknown parameters are ignored"},
+		})
+		require.NoError(t, err)
+
+		assert.JSONEq(t, `{"parent":"shelves/1","pageSize":10,"genres":["FICTION","GENRE_UNSPECIFIED"],"publishedAfter":"2020-01-01T00:00:00Z"}`, decode(t, route, data))
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		route, params := transcoder.Match(http.MethodGet, "/v1/shelves/1/books")
+		_, err := route.NewRequest(nil, params, url.Values{"page_size": {"ten"}})
+		assert.Error(t, err)
+
+		route, params = transcoder.Match(http.MethodPost, "/v1/books:create")
+		_, err = route.NewRequest([]byte(`{"unknown":1}`), params, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestRoute_Response(t *testing.T) {
+	transcoder := newTestTranscoder(t)
+
+	encode := func(t *testing.T, route *transcoding.Route, json string) []byte {
+		t.Helper()
+
+		msg := dynamicpb.NewMessage(route.Method.Output())
+		require.NoError(t, protojson.Unmarshal([]byte(json), msg))
+
+		data, err := proto.Marshal(msg)
+		require.NoError(t, err)
+
+		return data
+	}
+
+	t.Run("unary", func(t *testing.T) {
+		route, _ := transcoder.Match(http.MethodGet, "/v1/shelves/1/books/2")
+		body, err := route.Response([][]byte{encode(t, route, `{"name":"shelves/1/books/2","title":"Dune"}`)})
+		require.NoError(t, err)
+
+		assert.JSONEq(t, `{"name":"shelves/1/books/2","title":"Dune","pageCount":"0","genre":"GENRE_UNSPECIFIED","tags":[],"published":null}`, string(body))
+
+		_, err = route.Response(nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("response body", func(t *testing.T) {
+		route, _ := transcoder.Match(http.MethodGet, "/v1/shelves/1/books")
+		body, err := route.Response([][]byte{encode(t, route, `{"books":[{"title":"Dune"}]}`)})
+		require.NoError(t, err)
+
+		assert.JSONEq(t, `[{"name":"","title":"Dune","pageCount":"0","genre":"GENRE_UNSPECIFIED","tags":[],"published":null}]`, string(body))
+	})
+
+	t.Run("server streaming", func(t *testing.T) {
+		route, _ := transcoder.Match(http.MethodGet, "/v1/shelves/1/books:watch")
+		body, err := route.Response([][]byte{
+			encode(t, route, `{"title":"Dune"}`),
+			encode(t, route, `{"title":"Emma"}`),
+		})
+		require.NoError(t, err)
+
+		var titles []string
+		for _, book := range []string{"Dune", "Emma"} {
+			titles = append(titles, `{"name":"","title":"`+book+`","pageCount":"0","genre":"GENRE_UNSPECIFIED","tags":[],"published":null}`)
+		}
+		assert.JSONEq(t, "["+titles[0]+","+titles[1]+"]", string(body))
+	})
+}
+
+func TestMessages(t *testing.T) {
+	body := append(transcoding.EncodeMessage([]byte{8, 1}), transcoding.EncodeMessage(nil)...)
+	assert.Equal(t, []byte{0, 0, 0, 0, 2, 8, 1, 0, 0, 0, 0, 0}, body)
+
+	messages, err := transcoding.DecodeMessages(body)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{{8, 1}, {}}, messages)
+
+	_, err = transcoding.DecodeMessages(body[:6])
+	assert.Error(t, err)
+
+	_, err = transcoding.DecodeMessages([]byte{1, 0, 0, 0, 0})
+	assert.Error(t, err)
+}
+
+func TestHTTPStatusFromCode(t *testing.T) {
+	assert.Equal(t, http.StatusOK, transcoding.HTTPStatusFromCode(codes.OK))
+	assert.Equal(t, http.StatusBadRequest, transcoding.HTTPStatusFromCode(codes.InvalidArgument))
+	assert.Equal(t, http.StatusNotFound, transcoding.HTTPStatusFromCode(codes.NotFound))
+	assert.Equal(t, http.StatusConflict, transcoding.HTTPStatusFromCode(codes.AlreadyExists))
+	assert.Equal(t, http.StatusUnauthorized, transcoding.HTTPStatusFromCode(codes.Unauthenticated))
+	assert.Equal(t, http.StatusTooManyRequests, transcoding.HTTPStatusFromCode(codes.ResourceExhausted))
+	assert.Equal(t, http.StatusServiceUnavailable, transcoding.HTTPStatusFromCode(codes.Unavailable))
+	assert.Equal(t, http.StatusInternalServerError, transcoding.HTTPStatusFromCode(codes.DataLoss))
+}
@@ -0,0 +1,75 @@
+package transcoding
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+)
+
+// messageHeaderLen is the length of the compression flag and message length prefix of a gRPC message.
+const messageHeaderLen = 5
+
+// EncodeMessage frames a protobuf message as an uncompressed gRPC message.
+func EncodeMessage(message []byte) []byte {
+	frame := make([]byte, messageHeaderLen, messageHeaderLen+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+
+	return append(frame, message...)
+}
+
+// DecodeMessages splits the body of a gRPC response into its messages.
+func DecodeMessages(body []byte) ([][]byte, error) {
+	var messages [][]byte
+	for len(body) > 0 {
+		if len(body) < messageHeaderLen {
+			return nil, errors.New("truncated gRPC message header")
+		}
+
+		if body[0] != 0 {
+			return nil, errors.New("compressed gRPC messages are not supported")
+		}
+
+		length := binary.BigEndian.Uint32(body[1:messageHeaderLen])
+		body = body[messageHeaderLen:]
+		if uint32(len(body)) < length {
+			return nil, errors.New("truncated gRPC message")
+		}
+
+		messages = append(messages, body[:length])
+		body = body[length:]
+	}
+
+	return messages, nil
+}
+
+// HTTPStatusFromCode maps a gRPC status code to the HTTP status of a transcoded response.
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
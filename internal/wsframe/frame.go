@@ -0,0 +1,139 @@
+// Package wsframe reads and writes the frames of RFC 6455 WebSocket connections.
+package wsframe
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Opcode is the type of a frame.
+type Opcode byte
+
+const (
+	OpContinuation Opcode = 0x0
+	OpText         Opcode = 0x1
+	OpBinary       Opcode = 0x2
+	OpClose        Opcode = 0x8
+	OpPing         Opcode = 0x9
+	OpPong         Opcode = 0xa
+)
+
+// IsControl returns true for close, ping and pong frames, which may be sent
+// between the fragments of a message.
+func (o Opcode) IsControl() bool {
+	return o&0x8 != 0
+}
+
+// Status codes sent in close frames.
+const (
+	CloseGoingAway       uint16 = 1001
+	ClosePolicyViolation uint16 = 1008
+	CloseMessageTooBig   uint16 = 1009
+)
+
+// ErrInvalidFrame is returned for frame headers violating the protocol.
+var ErrInvalidFrame = errors.New("invalid WebSocket frame")
+
+// Header is the header of a frame.
+type Header struct {
+	Fin     bool
+	Opcode  Opcode
+	Masked  bool
+	MaskKey [4]byte
+	// Length is the length of the payload following the header.
+	Length int64
+	// Raw is the header as read from the connection, so it can be forwarded unchanged.
+	Raw []byte
+}
+
+// ReadHeader reads the next frame header, the payload is left in the reader.
+func ReadHeader(r io.Reader) (Header, error) {
+	raw := make([]byte, 2, 14)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return Header{}, err
+	}
+
+	h := Header{
+		Fin:    raw[0]&0x80 != 0,
+		Opcode: Opcode(raw[0] & 0x0f),
+		Masked: raw[1]&0x80 != 0,
+		Length: int64(raw[1] & 0x7f),
+	}
+
+	extended := 0
+	switch h.Length {
+	case 126:
+		extended = 2
+	case 127:
+		extended = 8
+	}
+
+	rest := extended
+	if h.Masked {
+		rest += 4
+	}
+
+	raw = raw[:2+rest]
+	if _, err := io.ReadFull(r, raw[2:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Header{}, err
+	}
+
+	switch extended {
+	case 2:
+		h.Length = int64(binary.BigEndian.Uint16(raw[2:]))
+	case 8:
+		length := binary.BigEndian.Uint64(raw[2:])
+		if length>>63 != 0 {
+			return Header{}, ErrInvalidFrame
+		}
+		h.Length = int64(length)
+	}
+
+	if h.Masked {
+		copy(h.MaskKey[:], raw[2+extended:])
+	}
+
+	if h.Opcode.IsControl() && (!h.Fin || h.Length > 125) {
+		return Header{}, ErrInvalidFrame
+	}
+
+	h.Raw = raw
+	return h, nil
+}
+
+// Unmask applies the mask key to a frame payload in place.
+func Unmask(key [4]byte, payload []byte) {
+	for i := range payload {
+		payload[i] ^= key[i%4]
+	}
+}
+
+// CloseFrame returns a close frame with the status code and reason.
+// Frames sent by clients, such as the gateway towards the upstream, must be masked.
+func CloseFrame(code uint16, reason string, masked bool) []byte {
+	// control frame payloads are limited to 125 bytes
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+
+	payload := make([]byte, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	copy(payload[2:], reason)
+
+	frame := []byte{0x80 | byte(OpClose), byte(len(payload))}
+	if masked {
+		var key [4]byte
+		_, _ = rand.Read(key[:])
+		Unmask(key, payload)
+
+		frame[1] |= 0x80
+		frame = append(frame, key[:]...)
+	}
+
+	return append(frame, payload...)
+}
@@ -0,0 +1,95 @@
+package wsframe_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/internal/wsframe"
+)
+
+func TestReadHeader(t *testing.T) {
+	t.Run("short unmasked", func(t *testing.T) {
+		frame := []byte{0x81, 0x05, 'h', 'e', 'l', 'l', 'o'}
+		r := bytes.NewReader(frame)
+
+		h, err := wsframe.ReadHeader(r)
+		require.NoError(t, err)
+		assert.True(t, h.Fin)
+		assert.Equal(t, wsframe.OpText, h.Opcode)
+		assert.False(t, h.Masked)
+		assert.Equal(t, int64(5), h.Length)
+		assert.Equal(t, frame[:2], h.Raw)
+		assert.Equal(t, 5, r.Len(), "payload is left in the reader")
+	})
+
+	t.Run("extended masked", func(t *testing.T) {
+		frame := []byte{0x02, 0xfe, 0x01, 0x00, 1, 2, 3, 4}
+		h, err := wsframe.ReadHeader(bytes.NewReader(frame))
+		require.NoError(t, err)
+		assert.False(t, h.Fin)
+		assert.Equal(t, wsframe.OpBinary, h.Opcode)
+		assert.True(t, h.Masked)
+		assert.Equal(t, [4]byte{1, 2, 3, 4}, h.MaskKey)
+		assert.Equal(t, int64(256), h.Length)
+		assert.Equal(t, frame, h.Raw)
+	})
+
+	t.Run("64 bit length", func(t *testing.T) {
+		frame := []byte{0x82, 0x7f, 0, 0, 0, 0, 0, 1, 0, 0}
+		h, err := wsframe.ReadHeader(bytes.NewReader(frame))
+		require.NoError(t, err)
+		assert.Equal(t, int64(65536), h.Length)
+
+		frame[2] = 0x80
+		_, err = wsframe.ReadHeader(bytes.NewReader(frame))
+		assert.Equal(t, wsframe.ErrInvalidFrame, err)
+	})
+
+	t.Run("fragmented control frame", func(t *testing.T) {
+		_, err := wsframe.ReadHeader(bytes.NewReader([]byte{0x09, 0x00}))
+		assert.Equal(t, wsframe.ErrInvalidFrame, err)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := wsframe.ReadHeader(bytes.NewReader(nil))
+		assert.Equal(t, io.EOF, err)
+
+		_, err = wsframe.ReadHeader(bytes.NewReader([]byte{0x81, 0xfe, 0x01}))
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	})
+}
+
+func TestCloseFrame(t *testing.T) {
+	readClose := func(frame []byte) (wsframe.Header, uint16, string) {
+		r := bytes.NewReader(frame)
+		h, err := wsframe.ReadHeader(r)
+		require.NoError(t, err)
+
+		payload := make([]byte, h.Length)
+		_, err = io.ReadFull(r, payload)
+		require.NoError(t, err)
+
+		if h.Masked {
+			wsframe.Unmask(h.MaskKey, payload)
+		}
+
+		return h, binary.BigEndian.Uint16(payload), string(payload[2:])
+	}
+
+	h, code, reason := readClose(wsframe.CloseFrame(wsframe.ClosePolicyViolation, "rate limit exceeded", false))
+	assert.Equal(t, wsframe.OpClose, h.Opcode)
+	assert.False(t, h.Masked)
+	assert.Equal(t, wsframe.ClosePolicyViolation, code)
+	assert.Equal(t, "rate limit exceeded", reason)
+
+	h, code, reason = readClose(wsframe.CloseFrame(wsframe.CloseMessageTooBig, string(bytes.Repeat([]byte("a"), 200)), true))
+	assert.True(t, h.Masked)
+	assert.Equal(t, int64(125), h.Length)
+	assert.Equal(t, wsframe.CloseMessageTooBig, code)
+	assert.Len(t, reason, 123)
+}
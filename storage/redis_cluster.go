@@ -201,6 +201,17 @@ func (r *RedisCluster) GetKey(keyName string) (string, error) {
 
 // GetMultiKey gets multiple keys from the database
 func (r *RedisCluster) GetMultiKey(keys []string) ([]string, error) {
+	keyNames := make([]string, len(keys))
+	copy(keyNames, keys)
+	for index, val := range keyNames {
+		keyNames[index] = r.fixKey(val)
+	}
+
+	return r.GetRawMultiKey(keyNames)
+}
+
+// GetRawMultiKey gets multiple raw keys from the database, the keys not found are empty.
+func (r *RedisCluster) GetRawMultiKey(keyNames []string) ([]string, error) {
 	if err := r.up(); err != nil {
 		return nil, err
 	}
@@ -210,12 +221,6 @@ func (r *RedisCluster) GetMultiKey(keys []string) ([]string, error) {
 		return nil, err
 	}
 
-	keyNames := make([]string, len(keys))
-	copy(keyNames, keys)
-	for index, val := range keyNames {
-		keyNames[index] = r.fixKey(val)
-	}
-
 	result := make([]string, 0)
 
 	switch v := cluster.(type) {
@@ -375,6 +380,33 @@ func (r *RedisCluster) SetRawKey(keyName, session string, timeout int64) error {
 	return nil
 }
 
+// SetRawKeys sets the raw keys to their values with their timeouts (in seconds) in a single pipeline.
+func (r *RedisCluster) SetRawKeys(keys, values []string, timeouts []int64) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if err := r.up(); err != nil {
+		return err
+	}
+
+	singleton, err := r.singleton()
+	if err != nil {
+		return err
+	}
+
+	pipe := singleton.Pipeline()
+	for i, key := range keys {
+		pipe.Set(r.RedisController.ctx, key, values[i], time.Duration(timeouts[i])*time.Second)
+	}
+
+	if _, err := pipe.Exec(r.RedisController.ctx); err != nil {
+		log.WithError(err).Error("Error trying to set values")
+		return err
+	}
+	return nil
+}
+
 // Decrement will decrement a key in redis
 func (r *RedisCluster) Decrement(keyName string) {
 	keyName = r.fixKey(keyName)
@@ -428,6 +460,73 @@ func (r *RedisCluster) IncrememntWithExpire(keyName string, expire int64) int64
 	return val
 }
 
+// IncrementRawKeysWithExpire increments raw keys by an amount in a single transaction, and sets the expiry of the
+// keys it created.
+func (r *RedisCluster) IncrementRawKeysWithExpire(keys []string, by int64, expires []int64) ([]int64, error) {
+	if err := r.up(); err != nil {
+		return nil, err
+	}
+
+	singleton, err := r.singleton()
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err = singleton.TxPipelined(r.RedisController.ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.IncrBy(r.RedisController.ctx, key, by)
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("Error trying to increment keys")
+		return nil, err
+	}
+
+	values := make([]int64, len(keys))
+	pipe := singleton.Pipeline()
+	for i, cmd := range cmds {
+		values[i] = cmd.Val()
+		if values[i] == by && expires[i] > 0 {
+			pipe.Expire(r.RedisController.ctx, keys[i], time.Duration(expires[i])*time.Second)
+		}
+	}
+	if pipe.Len() > 0 {
+		if _, err := pipe.Exec(r.RedisController.ctx); err != nil {
+			log.WithError(err).Error("Error trying to set the expiry of keys")
+		}
+	}
+	return values, nil
+}
+
+// DecrementRawKeys decrements raw keys by an amount in a single pipeline.
+func (r *RedisCluster) DecrementRawKeys(keys []string, by int64) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if err := r.up(); err != nil {
+		return err
+	}
+
+	singleton, err := r.singleton()
+	if err != nil {
+		return err
+	}
+
+	pipe := singleton.Pipeline()
+	for _, key := range keys {
+		pipe.DecrBy(r.RedisController.ctx, key, by)
+	}
+
+	if _, err := pipe.Exec(r.RedisController.ctx); err != nil {
+		log.WithError(err).Error("Error trying to decrement keys")
+		return err
+	}
+	return nil
+}
+
 // GetKeys will return all keys according to the filter (filter is a prefix - e.g. tyk.keys.*)
 func (r *RedisCluster) GetKeys(filter string) []string {
 	if err := r.up(); err != nil {
@@ -645,6 +744,33 @@ func (r *RedisCluster) DeleteRawKey(keyName string) bool {
 	return n > 0
 }
 
+// DeleteRawKeys removes the raw keys in a single pipeline.
+func (r *RedisCluster) DeleteRawKeys(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if err := r.up(); err != nil {
+		return err
+	}
+
+	singleton, err := r.singleton()
+	if err != nil {
+		return err
+	}
+
+	pipe := singleton.Pipeline()
+	for _, key := range keys {
+		pipe.Del(r.RedisController.ctx, key)
+	}
+
+	if _, err := pipe.Exec(r.RedisController.ctx); err != nil {
+		log.WithError(err).Error("Error trying to delete keys")
+		return err
+	}
+	return nil
+}
+
 // DeleteKeys will remove a group of keys in bulk
 func (r *RedisCluster) DeleteScanMatch(pattern string) bool {
 	if err := r.up(); err != nil {
@@ -1270,6 +1396,37 @@ func (r *RedisCluster) GetSortedSetRange(keyName, scoreFrom, scoreTo string) ([]
 	return elements, scores, nil
 }
 
+// GetSortedSetRangeByLex gets at most count elements of a sorted set with equal scores, in lexicographical
+// order between min and max ("-", "+", "[value" or "(value" as in ZRANGEBYLEX).
+func (r *RedisCluster) GetSortedSetRangeByLex(keyName, min, max string, count int64) ([]string, error) {
+	fixedKey := r.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+		"min":      min,
+		"max":      max,
+	}
+	log.WithFields(logEntry).Debug("Getting sorted set range by lex")
+
+	if err := r.up(); err != nil {
+		return nil, err
+	}
+
+	singleton, err := r.singleton()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	values, err := singleton.ZRangeByLex(r.RedisController.ctx, fixedKey, &redis.ZRangeBy{Min: min, Max: max, Count: count}).Result()
+	if err != nil {
+		log.WithFields(logEntry).WithError(err).Error("ZRANGEBYLEX command failed")
+		return nil, err
+	}
+
+	return values, nil
+}
+
 // RemoveSortedSetRange removes range of elements from sorted set identified by keyName
 func (r *RedisCluster) RemoveSortedSetRange(keyName, scoreFrom, scoreTo string) error {
 	fixedKey := r.fixKey(keyName)
@@ -1295,6 +1452,153 @@ func (r *RedisCluster) RemoveSortedSetRange(keyName, scoreFrom, scoreTo string)
 	return nil
 }
 
+// RemoveFromSortedSet removes an element from the sorted set identified by keyName
+func (r *RedisCluster) RemoveFromSortedSet(keyName, value string) error {
+	fixedKey := r.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+		"value":    value,
+	}
+	log.WithFields(logEntry).Debug("Removing value from sorted set")
+
+	singleton, err := r.singleton()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if err := singleton.ZRem(r.RedisController.ctx, fixedKey, value).Err(); err != nil {
+		log.WithFields(logEntry).WithError(err).Error("ZREM command failed")
+		return err
+	}
+
+	return nil
+}
+
+// GetSortedSetCard returns the number of elements of the sorted set identified by keyName
+func (r *RedisCluster) GetSortedSetCard(keyName string) (int64, error) {
+	fixedKey := r.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+	}
+	log.WithFields(logEntry).Debug("Getting sorted set cardinality")
+
+	singleton, err := r.singleton()
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+
+	count, err := singleton.ZCard(r.RedisController.ctx, fixedKey).Result()
+	if err != nil {
+		log.WithFields(logEntry).WithError(err).Error("ZCARD command failed")
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetSortedSetScore returns the score of an element of the sorted set identified by keyName,
+// ok is false when the set doesn't contain the element
+func (r *RedisCluster) GetSortedSetScore(keyName, value string) (score float64, ok bool, err error) {
+	fixedKey := r.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+		"value":    value,
+	}
+	log.WithFields(logEntry).Debug("Getting sorted set score")
+
+	singleton, err := r.singleton()
+	if err != nil {
+		log.Error(err)
+		return 0, false, err
+	}
+
+	score, err = singleton.ZScore(r.RedisController.ctx, fixedKey, value).Result()
+	if err == redis.Nil {
+		return 0, false, nil
+	}
+	if err != nil {
+		log.WithFields(logEntry).WithError(err).Error("ZSCORE command failed")
+		return 0, false, err
+	}
+
+	return score, true, nil
+}
+
+// AddToStream appends an entry with the given fields to the stream identified by keyName, the stream is trimmed
+// to about maxLen entries when maxLen is positive.
+func (r *RedisCluster) AddToStream(keyName string, values map[string]interface{}, maxLen int64) error {
+	fixedKey := r.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+	}
+	log.WithFields(logEntry).Debug("Adding entry to stream")
+
+	if err := r.up(); err != nil {
+		return err
+	}
+
+	singleton, err := r.singleton()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	args := &redis.XAddArgs{Stream: fixedKey, Values: values}
+	if maxLen > 0 {
+		args.MaxLen = maxLen
+		args.Approx = true
+	}
+
+	if err := singleton.XAdd(r.RedisController.ctx, args).Err(); err != nil {
+		log.WithFields(logEntry).WithError(err).Error("XADD command failed")
+		return err
+	}
+
+	return nil
+}
+
+// GetStreamRange gets the fields of at most count entries of the stream identified by keyName, between the start
+// and stop entry IDs ("-" and "+" for the first and the last entries as in XRANGE).
+func (r *RedisCluster) GetStreamRange(keyName, start, stop string, count int64) ([]map[string]interface{}, error) {
+	fixedKey := r.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+		"start":    start,
+		"stop":     stop,
+	}
+	log.WithFields(logEntry).Debug("Getting stream range")
+
+	if err := r.up(); err != nil {
+		return nil, err
+	}
+
+	singleton, err := r.singleton()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	messages, err := singleton.XRangeN(r.RedisController.ctx, fixedKey, start, stop, count).Result()
+	if err != nil {
+		log.WithFields(logEntry).WithError(err).Error("XRANGE command failed")
+		return nil, err
+	}
+
+	entries := make([]map[string]interface{}, len(messages))
+	for i, message := range messages {
+		entries[i] = message.Values
+	}
+
+	return entries, nil
+}
+
 func (r *RedisCluster) ControllerInitiated() bool {
 	return r.RedisController != nil
 }
@@ -18,6 +18,8 @@ type Policy struct {
 	Per                           float64                          `bson:"per" json:"per"`
 	QuotaMax                      int64                            `bson:"quota_max" json:"quota_max"`
 	QuotaRenewalRate              int64                            `bson:"quota_renewal_rate" json:"quota_renewal_rate"`
+	QuotaRenewalMode              QuotaRenewalMode                 `bson:"quota_renewal_mode" json:"quota_renewal_mode,omitempty"`
+	QuotaRenewalTimezone          string                           `bson:"quota_renewal_timezone" json:"quota_renewal_timezone,omitempty"`
 	ThrottleInterval              float64                          `bson:"throttle_interval" json:"throttle_interval"`
 	ThrottleRetryLimit            int                              `bson:"throttle_retry_limit" json:"throttle_retry_limit"`
 	MaxQueryDepth                 int                              `bson:"max_query_depth" json:"max_query_depth"`
@@ -32,8 +34,60 @@ type Policy struct {
 	LastUpdated                   string                           `bson:"last_updated" json:"last_updated"`
 	MetaData                      map[string]interface{}           `bson:"meta_data" json:"meta_data"`
 	GraphQL                       map[string]GraphAccessDefinition `bson:"graphql_access_rights" json:"graphql_access_rights"`
+	Extends                       string                           `bson:"extends" json:"extends"`
+	Merge                         map[string]MergeStrategy         `bson:"merge" json:"merge"`
+	Schedules                     []PolicySchedule                 `bson:"schedules" json:"schedules"`
+	Group                         *GroupLimit                      `bson:"group" json:"group"`
 }
 
+// PolicySchedule changes the limits and access rights of a policy during a time window, in order with the other
+// active schedules of the policy.
+type PolicySchedule struct {
+	Name string `bson:"name" json:"name"`
+	// Timezone is the IANA time zone of the window, e.g. Europe/London, UTC by default.
+	Timezone string `bson:"timezone" json:"timezone"`
+	// Days are the days of the week the window starts, mon to sun, all of them when empty.
+	Days []string `bson:"days" json:"days"`
+	// From and To are the times of day of the window, e.g. 09:00, the whole day when empty. The window spans
+	// midnight when To isn't after From.
+	From string `bson:"from" json:"from"`
+	To   string `bson:"to" json:"to"`
+	// StartDate and EndDate limit the window to a range of dates, e.g. 2006-01-02, both included.
+	StartDate string `bson:"start_date" json:"start_date"`
+	EndDate   string `bson:"end_date" json:"end_date"`
+
+	// The limits replacing the limits of the policy in the window, unless they're zero.
+	Rate               float64 `bson:"rate" json:"rate"`
+	Per                float64 `bson:"per" json:"per"`
+	QuotaMax           int64   `bson:"quota_max" json:"quota_max"`
+	QuotaRenewalRate   int64   `bson:"quota_renewal_rate" json:"quota_renewal_rate"`
+	ThrottleInterval   float64 `bson:"throttle_interval" json:"throttle_interval"`
+	ThrottleRetryLimit int     `bson:"throttle_retry_limit" json:"throttle_retry_limit"`
+	MaxQueryDepth      int     `bson:"max_query_depth" json:"max_query_depth"`
+	// QuotaMultiplier multiplies the quota of the policy in the window, e.g. 2 doubles it.
+	QuotaMultiplier float64 `bson:"quota_multiplier" json:"quota_multiplier"`
+	// AccessRights are granted in the window only, on top of the access rights of the policy.
+	AccessRights map[string]AccessDefinition `bson:"access_rights" json:"access_rights"`
+}
+
+// MergeStrategy is how a field of a policy is merged with the same field of the policy it extends, or of the
+// policies applied before it to a key. Unset values, zero or empty, never replace set ones.
+type MergeStrategy string
+
+const (
+	// MergeOverride replaces the value, it's the default of the limits and access rights of an extending policy.
+	MergeOverride MergeStrategy = "override"
+	// MergeMin keeps the lowest limit, -1 being unlimited.
+	MergeMin MergeStrategy = "min"
+	// MergeMax keeps the highest limit, -1 being unlimited. It's the default of the limits of composed policies.
+	MergeMax MergeStrategy = "max"
+	// MergeUnion keeps the APIs, tags or metadata of both. It's the default of the access rights of composed
+	// policies, and of the tags and metadata.
+	MergeUnion MergeStrategy = "union"
+	// MergeIntersect keeps the APIs or tags in both only.
+	MergeIntersect MergeStrategy = "intersect"
+)
+
 type PolicyPartitions struct {
 	Quota      bool `bson:"quota" json:"quota"`
 	RateLimit  bool `bson:"rate_limit" json:"rate_limit"`
@@ -48,7 +48,11 @@ type APILimit struct {
 	QuotaRenews        int64   `json:"quota_renews" msg:"quota_renews"`
 	QuotaRemaining     int64   `json:"quota_remaining" msg:"quota_remaining"`
 	QuotaRenewalRate   int64   `json:"quota_renewal_rate" msg:"quota_renewal_rate"`
-	SetBy              string  `json:"-" msg:"-"`
+	// QuotaRenewalMode and QuotaRenewalTimezone renew the quota on calendar boundaries instead of QuotaRenewalRate
+	// seconds after its first use.
+	QuotaRenewalMode     QuotaRenewalMode `json:"quota_renewal_mode,omitempty" msg:"quota_renewal_mode"`
+	QuotaRenewalTimezone string           `json:"quota_renewal_timezone,omitempty" msg:"quota_renewal_timezone"`
+	SetBy                string           `json:"-" msg:"-"`
 }
 
 // AccessDefinition defines which versions of an API a key has access to
@@ -70,7 +74,7 @@ type AccessDefinition struct {
 }
 
 func (limit APILimit) IsEmpty() bool {
-	if limit.Rate != 0 || limit.Per != 0 || limit.ThrottleInterval != 0 || limit.ThrottleRetryLimit != 0 || limit.MaxQueryDepth != 0 || limit.QuotaMax != 0 || limit.QuotaRenews != 0 || limit.QuotaRemaining != 0 || limit.QuotaRenewalRate != 0 || limit.SetBy != "" {
+	if limit.Rate != 0 || limit.Per != 0 || limit.ThrottleInterval != 0 || limit.ThrottleRetryLimit != 0 || limit.MaxQueryDepth != 0 || limit.QuotaMax != 0 || limit.QuotaRenews != 0 || limit.QuotaRemaining != 0 || limit.QuotaRenewalRate != 0 || limit.QuotaRenewalMode != "" || limit.QuotaRenewalTimezone != "" || limit.SetBy != "" {
 		return false
 	}
 	return true
@@ -86,6 +90,17 @@ type FieldLimits struct {
 	MaxQueryDepth int `json:"max_query_depth" msg:"max_query_depth"`
 }
 
+// QuotaRenewalMode is when a quota renews: QuotaRenewalRate seconds after its first use, or at the start of each
+// hour, day or month in the time zone of the quota.
+type QuotaRenewalMode string
+
+const (
+	QuotaRenewalRolling QuotaRenewalMode = ""
+	QuotaRenewalHourly  QuotaRenewalMode = "hourly"
+	QuotaRenewalDaily   QuotaRenewalMode = "daily"
+	QuotaRenewalMonthly QuotaRenewalMode = "monthly"
+)
+
 type BasicAuthData struct {
 	Password string   `json:"password" msg:"password"`
 	Hash     HashType `json:"hash_type" msg:"hash_type"`
@@ -99,6 +114,29 @@ type Monitor struct {
 	TriggerLimits []float64 `json:"trigger_limits" msg:"trigger_limits"`
 }
 
+// KeyRotation is set on a key replaced by a new key, the key stays valid until the end of the grace period.
+type KeyRotation struct {
+	RotatedAt       int64 `json:"rotated_at" msg:"rotated_at"`
+	GracePeriodEnds int64 `json:"grace_period_ends" msg:"grace_period_ends"`
+}
+
+// GroupLimit is the rate limit and quota shared by a group of keys, e.g. the keys of one application, enforced
+// together with the limits of each key and the quota of the organisation: a request rejected by one of them isn't
+// counted against the others.
+type GroupLimit struct {
+	// ID identifies the group in the organisation, it may be read from the $tyk_meta. and $tyk_context. variables,
+	// e.g. $tyk_meta.app_id. The limits aren't enforced when it's empty.
+	ID               string  `json:"id" msg:"id"`
+	Rate             float64 `json:"rate" msg:"rate"`
+	Per              float64 `json:"per" msg:"per"`
+	QuotaMax         int64   `json:"quota_max" msg:"quota_max"`
+	QuotaRenewalRate int64   `json:"quota_renewal_rate" msg:"quota_renewal_rate"`
+	// QuotaRenewalMode and QuotaRenewalTimezone renew the quota on calendar boundaries instead of QuotaRenewalRate
+	// seconds after its first use.
+	QuotaRenewalMode     QuotaRenewalMode `json:"quota_renewal_mode,omitempty" msg:"quota_renewal_mode"`
+	QuotaRenewalTimezone string           `json:"quota_renewal_timezone,omitempty" msg:"quota_renewal_timezone"`
+}
+
 // SessionState objects represent a current API session, mainly used for rate limiting.
 // There's a data structure that's based on this and it's used for Protocol Buffer support, make sure to update "coprocess/proto/coprocess_session_state.proto" and generate the bindings using: cd coprocess/proto && ./update_bindings.sh
 //
@@ -117,6 +155,8 @@ type SessionState struct {
 	QuotaRenews                   int64                       `json:"quota_renews" msg:"quota_renews"`
 	QuotaRemaining                int64                       `json:"quota_remaining" msg:"quota_remaining"`
 	QuotaRenewalRate              int64                       `json:"quota_renewal_rate" msg:"quota_renewal_rate"`
+	QuotaRenewalMode              QuotaRenewalMode            `json:"quota_renewal_mode,omitempty" msg:"quota_renewal_mode"`
+	QuotaRenewalTimezone          string                      `json:"quota_renewal_timezone,omitempty" msg:"quota_renewal_timezone"`
 	AccessRights                  map[string]AccessDefinition `json:"access_rights" msg:"access_rights"`
 	OrgID                         string                      `json:"org_id" msg:"org_id"`
 	OauthClientID                 string                      `json:"oauth_client_id" msg:"oauth_client_id"`
@@ -143,6 +183,8 @@ type SessionState struct {
 	LastUpdated             string                 `json:"last_updated" msg:"last_updated"`
 	IdExtractorDeadline     int64                  `json:"id_extractor_deadline" msg:"id_extractor_deadline"`
 	SessionLifetime         int64                  `bson:"session_lifetime" json:"session_lifetime"`
+	Rotation                *KeyRotation           `json:"rotation,omitempty" msg:"rotation"`
+	Group                   *GroupLimit            `json:"group,omitempty" msg:"group"`
 
 	// Used to store token hash
 	keyHash string
@@ -162,6 +204,14 @@ func (s SessionState) Clone() SessionState {
 	newSession.ApplyPolicies = cloneSlice(s.ApplyPolicies)
 	newSession.MetaData = cloneMetadata(s.MetaData)
 	newSession.Tags = cloneSlice(s.Tags)
+	if s.Rotation != nil {
+		rotation := *s.Rotation
+		newSession.Rotation = &rotation
+	}
+	if s.Group != nil {
+		group := *s.Group
+		newSession.Group = &group
+	}
 
 	return newSession
 }